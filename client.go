@@ -5,6 +5,7 @@ import (
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/cli/account"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/cli/payee"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/cli/transaction"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/cli/wallet"
 
@@ -31,8 +32,13 @@ func main() {
 		wallet.NewCreateCommand(),
 		wallet.NewChangePasswordCommand(),
 		wallet.NewResetCommand(),
+		wallet.NewRepairCommand(),
+		wallet.NewPreviewRollbackCommand(),
+		wallet.NewDoctorCommand(),
+		wallet.NewConformanceCommand(),
 		account.NewCommand(),
 		transaction.NewCommand(),
+		payee.NewCommand(),
 	}
 
 	app.Run(os.Args)
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"github.com/elastos/Elastos.ELA.Utility/common"
 )
 
@@ -35,3 +37,84 @@ type DataStore interface {
 	// Close the database
 	Close()
 }
+
+// BlockLocator is an optional interface of DataStore, implement it if the
+// data store does not keep all the headers, for example a pruned headers store,
+// so the block locator can not be created by walking back previous headers.
+type BlockLocator interface {
+	// Create a block locator which is a array of block hashes from the chain tip
+	GetBlockLocatorHashes() []*common.Uint256
+}
+
+// StatsStore is an optional interface of DataStore, implement it to
+// persist the sync statistics, so they are kept across restarts.
+type StatsStore interface {
+	// Save serialized sync statistics
+	PutSyncStats(data []byte) error
+
+	// Get serialized sync statistics
+	GetSyncStats() ([]byte, error)
+}
+
+// ResponseStatsStore is an optional interface of DataStore, implement it to
+// persist the response times of peers, so request timeouts are tuned across restarts.
+type ResponseStatsStore interface {
+	// Save serialized response statistics
+	PutResponseStats(data []byte) error
+
+	// Get serialized response statistics
+	GetResponseStats() ([]byte, error)
+}
+
+// TxExpirer is an optional interface of DataStore, implement it to expire
+// transactions that stay unconfirmed too long, so their inputs can be spent again.
+type TxExpirer interface {
+	// Expire the transactions received before the given time and still unconfirmed,
+	// release their inputs and return the expired transaction ids
+	ExpireTxs(before time.Time) ([]common.Uint256, error)
+}
+
+// TxFinder is an optional interface of DataStore, implement it to keep relayed
+// transactions arriving before their unconfirmed parents in the orphan pool.
+type TxFinder interface {
+	// Check if the transaction is stored
+	HaveTx(txId common.Uint256) bool
+}
+
+// TxGetter is an optional interface of DataStore, implement it to look up the
+// outputs spent by observed transactions, so the fee estimator can price them.
+type TxGetter interface {
+	// Get the stored transaction
+	GetTx(txId common.Uint256) (*StoreTx, error)
+}
+
+// FilterProbeSource is an optional interface of DataStore, implement it to probe
+// if peers honor the bloom filter with the known matches of the filter.
+type FilterProbeSource interface {
+	// Get a confirmed transaction matching the filter and the hash of its block
+	GetFilterProbe() (txId common.Uint256, blockHash common.Uint256, ok bool)
+}
+
+// AncestorFinder is an optional interface of DataStore, implement it to serve
+// the stored header chain to other light clients by headers messages.
+type AncestorFinder interface {
+	// Get the hash of the ancestor of the header at the given height
+	GetAncestor(header *StoreHeader, height uint32) (*common.Uint256, error)
+}
+
+// MisbehaviorStore is an optional interface of DataStore, implement it to
+// keep the ban score events of peers, so operators can investigate them later.
+type MisbehaviorStore interface {
+	// Save a ban score event
+	PutMisbehavior(record *MisbehaviorRecord) error
+}
+
+// Batcher is an optional interface of DataStore, implement it to save the
+// changes of a block at once, instead of saving them on every change.
+type Batcher interface {
+	// Start collecting the changes of a block
+	BeginBatch() error
+
+	// Save the changes collected since BeginBatch
+	EndBatch() error
+}
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// ErrCorruptedRecord is returned by a store when a record can not be decoded or,
+// with verify-on-read enabled, does not match it's key. The block of the record
+// should be downloaded again to repair it.
+type ErrCorruptedRecord struct {
+	Hash common.Uint256
+}
+
+func (e *ErrCorruptedRecord) Error() string {
+	return fmt.Sprintf("Record %s in database is corrupted", e.Hash.String())
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// The max number of ban score events kept by MemDataStore, older ones are dropped
+const MaxMemMisbehaviors = 1000
+
+/*
+MemDataStore implements DataStore and its optional interfaces in memory, so
+integration tests and short-lived tools, like one-shot proof fetchers, can run
+the SPV service without touching disk. It needs no sqlite driver or other store,
+all data is lost when the process exits, and the chain is synchronized from the
+genesis block on every start.
+*/
+type MemDataStore struct {
+	sync.RWMutex
+	headers     map[Uint256]*StoreHeader
+	tip         *StoreHeader
+	chainHeight uint32
+	txs         map[Uint256]*StoreTx
+	// When the unconfirmed transactions were received
+	received     map[Uint256]time.Time
+	isMatch      func(tx *Transaction) bool
+	syncStats    []byte
+	respStats    []byte
+	misbehaviors []*MisbehaviorRecord
+}
+
+// Create a data store in memory, isMatch tells if a committed transaction is
+// wanted, others are false positives of the filter and not stored. Pass nil
+// to store all committed transactions.
+func NewMemDataStore(isMatch func(tx *Transaction) bool) *MemDataStore {
+	return &MemDataStore{
+		headers:  make(map[Uint256]*StoreHeader),
+		txs:      make(map[Uint256]*StoreTx),
+		received: make(map[Uint256]time.Time),
+		isMatch:  isMatch,
+	}
+}
+
+// Save a header to database
+func (s *MemDataStore) PutHeader(header *StoreHeader, newTip bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.headers[header.Hash()] = header
+	if newTip {
+		s.tip = header
+	}
+	return nil
+}
+
+// Get previous block of the given header
+func (s *MemDataStore) GetPrevious(header *StoreHeader) (*StoreHeader, error) {
+	if header.Height == 1 {
+		return &StoreHeader{TotalWork: new(big.Int)}, nil
+	}
+	return s.GetHeader(header.Previous)
+}
+
+// Get full header with it's hash
+func (s *MemDataStore) GetHeader(hash Uint256) (*StoreHeader, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.getHeader(hash)
+}
+
+func (s *MemDataStore) getHeader(hash Uint256) (*StoreHeader, error) {
+	header, ok := s.headers[hash]
+	if !ok {
+		return nil, fmt.Errorf("Header %s does not exist in database", hash.String())
+	}
+	return header, nil
+}
+
+// Get the header on chain tip
+func (s *MemDataStore) GetChainTip() (*StoreHeader, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.tip == nil {
+		return nil, errors.New("no headers in database")
+	}
+	return s.tip, nil
+}
+
+// Get the hash of the ancestor of the header at the given height
+func (s *MemDataStore) GetAncestor(header *StoreHeader, height uint32) (*Uint256, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if height > header.Height {
+		return nil, errors.New("ancestor height is higher than the header")
+	}
+	var err error
+	for header.Height > height {
+		header, err = s.getHeader(header.Previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hash := header.Hash()
+	return &hash, nil
+}
+
+// Save chain height to database
+func (s *MemDataStore) PutChainHeight(height uint32) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.chainHeight = height
+}
+
+// Get chain height from database
+func (s *MemDataStore) GetChainHeight() uint32 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.chainHeight
+}
+
+// Commit a transaction return if this is a false positive and error
+func (s *MemDataStore) CommitTx(tx *StoreTx) (bool, error) {
+	if s.isMatch != nil && !s.isMatch(&tx.Data) {
+		return true, nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.txs[tx.TxId] = tx
+	if tx.Height == 0 {
+		if _, ok := s.received[tx.TxId]; !ok {
+			s.received[tx.TxId] = time.Now()
+		}
+	} else {
+		delete(s.received, tx.TxId)
+	}
+	return false, nil
+}
+
+// Get a committed transaction
+func (s *MemDataStore) GetTx(txId Uint256) (*StoreTx, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	tx, ok := s.txs[txId]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s does not exist in database", txId.String())
+	}
+	return tx, nil
+}
+
+// Get all committed transactions
+func (s *MemDataStore) GetTxs() []*StoreTx {
+	s.RLock()
+	defer s.RUnlock()
+
+	txs := make([]*StoreTx, 0, len(s.txs))
+	for _, tx := range s.txs {
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// Check if the transaction is stored
+func (s *MemDataStore) HaveTx(txId Uint256) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.txs[txId]
+	return ok
+}
+
+// Rollback chain data on the given height
+func (s *MemDataStore) Rollback(height uint32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for txId, tx := range s.txs {
+		if tx.Height == height {
+			delete(s.txs, txId)
+		}
+	}
+	return nil
+}
+
+// Expire the transactions received before the given time and still unconfirmed
+func (s *MemDataStore) ExpireTxs(before time.Time) ([]Uint256, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var expired []Uint256
+	for txId, received := range s.received {
+		if received.Before(before) {
+			delete(s.txs, txId)
+			delete(s.received, txId)
+			expired = append(expired, txId)
+		}
+	}
+	return expired, nil
+}
+
+// Save serialized sync statistics
+func (s *MemDataStore) PutSyncStats(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.syncStats = data
+	return nil
+}
+
+// Get serialized sync statistics
+func (s *MemDataStore) GetSyncStats() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.syncStats == nil {
+		return nil, errors.New("no sync statistics in database")
+	}
+	return s.syncStats, nil
+}
+
+// Save serialized response statistics
+func (s *MemDataStore) PutResponseStats(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.respStats = data
+	return nil
+}
+
+// Get serialized response statistics
+func (s *MemDataStore) GetResponseStats() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.respStats == nil {
+		return nil, errors.New("no response statistics in database")
+	}
+	return s.respStats, nil
+}
+
+// Save a ban score event
+func (s *MemDataStore) PutMisbehavior(record *MisbehaviorRecord) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.misbehaviors = append(s.misbehaviors, record)
+	if len(s.misbehaviors) > MaxMemMisbehaviors {
+		s.misbehaviors = s.misbehaviors[len(s.misbehaviors)-MaxMemMisbehaviors:]
+	}
+	return nil
+}
+
+// Get the ban score events kept in memory, the oldest first
+func (s *MemDataStore) GetMisbehaviors() []*MisbehaviorRecord {
+	s.RLock()
+	defer s.RUnlock()
+
+	return append([]*MisbehaviorRecord(nil), s.misbehaviors...)
+}
+
+// Reset database, clear all data
+func (s *MemDataStore) Reset() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.headers = make(map[Uint256]*StoreHeader)
+	s.tip = nil
+	s.chainHeight = 0
+	s.txs = make(map[Uint256]*StoreTx)
+	s.received = make(map[Uint256]time.Time)
+	s.syncStats = nil
+	s.respStats = nil
+	s.misbehaviors = nil
+	return nil
+}
+
+// Close the database
+func (s *MemDataStore) Close() {}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// MisbehaviorRecord is a ban score event of a peer
+type MisbehaviorRecord struct {
+	Time   time.Time
+	PeerId uint64
+	Addr   string
+	Reason string
+	// The hash of the offending message, empty if it's not available
+	MsgHash common.Uint256
+	// The ban score increased by this event
+	Delta int
+	// The ban score of the peer after this event
+	Score int
+}
@@ -12,6 +12,9 @@ type StoreTx struct {
 	// The height at which it was mined
 	Height uint32
 
+	// The timestamp of the block it was mined in, zero for unconfirmed transactions
+	Timestamp uint32
+
 	// Transaction
 	Data Transaction
 }
@@ -0,0 +1,111 @@
+package _interface
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+BalanceProof attests the holdings of the registered accounts at a height for an
+external auditor. Each transaction with unspent outputs to the accounts comes
+with the header of its block and the merkle proof of the block, so the auditor
+verifies the outputs are in the chain with trusted headers only. A light client
+can not prove an output is not spent by a transaction it did not see, so the proof
+shows what the service holds to its knowledge, not a proof of non-spending.
+*/
+type BalanceProof struct {
+	// The chain height the proof was created at
+	Height uint32
+	Txs    []*UnspentTxProof
+}
+
+// UnspentTxProof is a confirmed transaction with unspent outputs to the accounts
+type UnspentTxProof struct {
+	sdk.TxProof
+	// The header of the block containing the transaction
+	Header Header
+	// Indexes of the unspent outputs
+	Indexes []uint16
+}
+
+// Create the balance proof of the unspent outputs of the registered accounts,
+// unconfirmed outputs are not included as they have no proof
+func (service *SPVServiceImpl) GetBalanceProof() (*BalanceProof, error) {
+	if service.SPVWallet == nil {
+		return nil, errors.New("SPV service not started")
+	}
+
+	balanceProof := &BalanceProof{Height: service.Blockchain().Height()}
+	txProofs := make(map[Uint256]*UnspentTxProof)
+	for _, account := range service.accounts {
+		utxos, err := service.DataStore().UTXOs().GetAddrAll(account)
+		if err != nil {
+			return nil, err
+		}
+		for _, utxo := range utxos {
+			if utxo.AtHeight == 0 || utxo.AtHeight > balanceProof.Height {
+				continue
+			}
+			txProof, ok := txProofs[utxo.Op.TxID]
+			if !ok {
+				txProof, err = service.getUnspentTxProof(utxo.Op.TxID)
+				if err != nil {
+					return nil, err
+				}
+				txProofs[utxo.Op.TxID] = txProof
+				balanceProof.Txs = append(balanceProof.Txs, txProof)
+			}
+			txProof.Indexes = append(txProof.Indexes, utxo.Op.Index)
+		}
+	}
+	return balanceProof, nil
+}
+
+func (service *SPVServiceImpl) getUnspentTxProof(txId Uint256) (*UnspentTxProof, error) {
+	txProof, header, err := service.getTxProof(txId)
+	if err != nil {
+		return nil, err
+	}
+	return &UnspentTxProof{TxProof: *txProof, Header: *header}, nil
+}
+
+/*
+Verify a balance proof with the trusted headers, getHeader returns the trusted
+header of the block hash or an error if the block is unknown. Returns the balance
+of each address proven, by program hash, the auditor checks the addresses are the
+ones attested.
+*/
+func VerifyBalanceProof(proof *BalanceProof, getHeader func(hash Uint256) (*Header, error)) (map[Uint168]Fixed64, error) {
+	balances := make(map[Uint168]Fixed64)
+	counted := make(map[OutPoint]bool)
+	for _, txProof := range proof.Txs {
+		blockHash := txProof.Proof.BlockHash
+		header, err := getHeader(blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("block %s is not trusted, %s", blockHash.String(), err)
+		}
+		if header.Height > proof.Height {
+			return nil, fmt.Errorf("block %s is above the proof height", blockHash.String())
+		}
+		if err := txProof.Verify(header); err != nil {
+			return nil, err
+		}
+
+		txId := txProof.Tx.Hash()
+		for _, index := range txProof.Indexes {
+			outPoint := OutPoint{TxID: txId, Index: index}
+			if int(index) >= len(txProof.Tx.Outputs) || counted[outPoint] {
+				return nil, fmt.Errorf("invalid output %s:%d", txId.String(), index)
+			}
+			counted[outPoint] = true
+			output := txProof.Tx.Outputs[index]
+			balances[output.ProgramHash] += output.Value
+		}
+	}
+	return balances, nil
+}
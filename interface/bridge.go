@@ -0,0 +1,346 @@
+package _interface
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Number of recorded transactions read at once by a cursor
+	BridgeBatchSize = 100
+
+	// Wait before calling the handler again with the transaction it failed
+	BridgeRetryInterval = time.Second * 10
+)
+
+// CrossChainTx is a cross-chain transaction reached the bridge depth
+type CrossChainTx struct {
+	// Sequence number of the transaction in the bridge, increases monotonically
+	Seq uint64
+	// The dedup ID of the transaction, the txid, the same on every delivery
+	ID string
+	// The transaction was handed to the handler before without being acked,
+	// the handler may have applied it, check the ID against the applied ones
+	Redelivered bool
+
+	Tx        Transaction
+	Proof     bloom.MerkleProof
+	BlockHash Uint256
+	Height    uint32
+}
+
+/*
+Bridge notifies arbiter services of the cross-chain transactions on the main chain
+once they are buried under the bridge depth. A transaction is recorded once when it
+reaches the depth, and delivered to each cursor in sequence. A cursor is the position
+of a consumer, saved after its handler returns nil, so a restarted daemon resumes
+from where it stopped.
+
+The ID of the transaction is saved before it's handed to the handler and cleared
+with the cursor when the handler returns nil. A transaction is delivered again only
+if the process stops in between, it comes marked Redelivered then. For exactly-once
+processing the handler saves the ID along with its effect in one transaction of its
+own store, and drops a redelivered transaction with an ID it saved.
+
+Transactions recorded are not taken back by a reorganize, set a finality depth not
+less than the bridge depth to refuse reorganizes deeper than it.
+*/
+type Bridge struct {
+	sync.Mutex
+	service *SPVServiceImpl
+	db      BridgeDB
+	depth   uint32
+	types   map[TransactionType]bool
+	cursors map[string]func(*CrossChainTx) error
+	// Closed and replaced when new transactions are recorded
+	recorded chan struct{}
+	// Closed by Stop to end the deliveries
+	quit     chan struct{}
+	stopped  bool
+	delivers sync.WaitGroup
+}
+
+func newBridge(service *SPVServiceImpl) *Bridge {
+	return &Bridge{
+		service:  service,
+		depth:    DefaultConfirmations,
+		types:    map[TransactionType]bool{TransferCrossChainAsset: true},
+		cursors:  make(map[string]func(*CrossChainTx) error),
+		recorded: make(chan struct{}),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Set the number of confirmations a cross-chain transaction needs to
+// be notified, DefaultConfirmations by default. Call it before Start().
+func (b *Bridge) SetDepth(depth uint32) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.depth = depth
+}
+
+// Set the transaction types notified, TransferCrossChainAsset by default,
+// add WithdrawFromSideChain to follow withdrawals. Call it before Start().
+func (b *Bridge) SetTypes(types ...TransactionType) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.types = make(map[TransactionType]bool)
+	for _, txType := range types {
+		b.types[txType] = true
+	}
+}
+
+// Deliver the cross-chain transactions after the saved position of the cursor to the
+// handler in sequence. Returning an error calls the handler with the same transaction
+// again after BridgeRetryInterval, so no transaction is skipped.
+func (b *Bridge) Subscribe(cursor string, handler func(*CrossChainTx) error) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.stopped {
+		return errors.New("bridge stopped")
+	}
+	if _, ok := b.cursors[cursor]; ok {
+		return errors.New("cursor " + cursor + " already subscribed")
+	}
+	b.cursors[cursor] = handler
+
+	// Start delivering now if the service started
+	if b.db != nil {
+		b.delivers.Add(1)
+		go b.deliver(cursor, handler)
+	}
+	return nil
+}
+
+// Stop delivering to the cursors and wait for the handlers running to return,
+// the cursors are saved so the deliveries resume after restart
+func (b *Bridge) Stop() {
+	b.Lock()
+	if b.stopped {
+		b.Unlock()
+		return
+	}
+	b.stopped = true
+	close(b.quit)
+	b.Unlock()
+
+	b.delivers.Wait()
+}
+
+// Wait for the duration, returns false if the bridge is stopped meanwhile
+func (b *Bridge) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-b.quit:
+		return false
+	}
+}
+
+// Get the last sequence number handled by the cursor, 0 if none
+func (b *Bridge) Cursor(cursor string) (uint64, error) {
+	db := b.getDB()
+	if db == nil {
+		return 0, errors.New("SPV service not started")
+	}
+	return db.GetCursor(cursor)
+}
+
+// Move the cursor to the sequence number, transactions after it are delivered
+// again. Do not call it while the cursor is subscribed.
+func (b *Bridge) SetCursor(cursor string, seq uint64) error {
+	db := b.getDB()
+	if db == nil {
+		return errors.New("SPV service not started")
+	}
+	return db.PutCursor(cursor, seq)
+}
+
+func (b *Bridge) getDB() BridgeDB {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.db
+}
+
+// Open the bridge database and start delivering to the subscribed cursors
+func (b *Bridge) start() error {
+	db, err := NewBridgeDB()
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.db = db
+	if b.stopped {
+		return nil
+	}
+	for cursor, handler := range b.cursors {
+		b.delivers.Add(1)
+		go b.deliver(cursor, handler)
+	}
+	return nil
+}
+
+func (b *Bridge) onBlockCommitted(block *bloom.MerkleBlock, txs []Transaction) {
+	b.Lock()
+	depth := b.depth
+	types := b.types
+	b.Unlock()
+
+	header := block.Header
+	for _, tx := range txs {
+		if !types[tx.TxType] {
+			continue
+		}
+		err := b.db.PutPending(&QueueItem{TxHash: tx.Hash(), BlockHash: header.Hash(), Height: header.Height})
+		if err != nil {
+			log.Error("Put pending cross-chain transaction failed, tx hash:", tx.Hash().String())
+		}
+	}
+
+	// Record transactions confirmed the same way as the notify queue
+	if header.Height < depth {
+		return
+	}
+	count, err := b.db.Confirm(header.Height - depth)
+	if err != nil {
+		log.Error("Record cross-chain transactions failed, height:", header.Height-depth, err)
+		return
+	}
+	if count > 0 {
+		b.Lock()
+		close(b.recorded)
+		b.recorded = make(chan struct{})
+		b.Unlock()
+	}
+}
+
+func (b *Bridge) onChainRollback(height uint32) {
+	err := b.db.Rollback(height)
+	if err != nil {
+		log.Error("Rollback pending cross-chain transactions failed, height:", height)
+	}
+}
+
+func (b *Bridge) deliver(cursor string, handler func(*CrossChainTx) error) {
+	defer b.delivers.Done()
+
+	for {
+		b.Lock()
+		recorded := b.recorded
+		b.Unlock()
+
+		seq, err := b.db.GetCursor(cursor)
+		if err != nil {
+			log.Error("Get bridge cursor", cursor, "failed,", err)
+			if !b.wait(BridgeRetryInterval) {
+				return
+			}
+			continue
+		}
+		items, err := b.db.GetTxs(seq+1, BridgeBatchSize)
+		if err != nil {
+			log.Error("Get cross-chain transactions failed,", err)
+			if !b.wait(BridgeRetryInterval) {
+				return
+			}
+			continue
+		}
+
+		// Wait for new transactions
+		if len(items) == 0 {
+			select {
+			case <-recorded:
+			case <-b.quit:
+				return
+			}
+			continue
+		}
+
+		for _, item := range items {
+			if !b.deliverTx(cursor, handler, item) {
+				break
+			}
+		}
+
+		select {
+		case <-b.quit:
+			return
+		default:
+		}
+	}
+}
+
+// Hand the recorded transaction to the handler until it returns nil and ack it,
+// returns false to reload the cursor, or if the bridge is stopped
+func (b *Bridge) deliverTx(cursor string, handler func(*CrossChainTx) error, item *BridgeItem) bool {
+	crossChainTx, err := b.crossChainTx(item)
+	if err != nil {
+		log.Error("Load cross-chain transaction failed, tx hash:", item.TxHash.String(), err)
+		b.wait(BridgeRetryInterval)
+		return false
+	}
+
+	last, err := b.db.StartDelivery(cursor, crossChainTx.ID)
+	if err != nil {
+		log.Error("Save bridge delivery", cursor, "failed,", err)
+		b.wait(BridgeRetryInterval)
+		return false
+	}
+	crossChainTx.Redelivered = last == crossChainTx.ID
+
+	for {
+		err = handler(crossChainTx)
+		if err == nil {
+			break
+		}
+		log.Error("Bridge cursor", cursor, "handle transaction failed, tx hash:", item.TxHash.String(), err)
+		if !b.wait(BridgeRetryInterval) {
+			return false
+		}
+		// The handler may have applied it before failing
+		crossChainTx.Redelivered = true
+	}
+
+	err = b.db.Ack(cursor, item.Seq)
+	if err != nil {
+		log.Error("Save bridge cursor", cursor, "failed,", err)
+		b.wait(BridgeRetryInterval)
+		return false
+	}
+	return true
+}
+
+// Load the transaction and its merkle proof of the recorded item
+func (b *Bridge) crossChainTx(item *BridgeItem) (*CrossChainTx, error) {
+	proof, err := b.service.proofs.Get(&item.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	storeTx, err := b.service.DataStore().Txs().Get(&item.TxHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrossChainTx{
+		Seq:       item.Seq,
+		ID:        item.TxHash.String(),
+		Tx:        storeTx.Data,
+		Proof:     *getTransactionProof(proof, storeTx.TxId),
+		BlockHash: item.BlockHash,
+		Height:    item.Height,
+	}, nil
+}
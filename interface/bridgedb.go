@@ -0,0 +1,248 @@
+package _interface
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	spvdb "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+type BridgeDB interface {
+	// Put a cross-chain transaction waiting for the bridge depth
+	PutPending(item *QueueItem) error
+
+	// Record the pending transactions at or below the height in sequence,
+	// returns the number of transactions recorded
+	Confirm(height uint32) (int, error)
+
+	// Delete the pending transactions at or above the height
+	Rollback(height uint32) error
+
+	// Get at most limit recorded transactions from the given sequence number
+	GetTxs(fromSeq uint64, limit int) ([]*BridgeItem, error)
+
+	// Get the last sequence number handled by the cursor, 0 if none
+	GetCursor(name string) (uint64, error)
+
+	// Set the last sequence number handled by the cursor
+	PutCursor(name string, seq uint64) error
+
+	// Save the ID of the transaction handed to the cursor's handler, returns the
+	// ID saved before, the handler did not ack it if it's the same ID
+	StartDelivery(name string, id string) (string, error)
+
+	// Ack the delivery of the transaction, saves the cursor and clears the
+	// delivering ID at once
+	Ack(name string, seq uint64) error
+}
+
+// BridgeItem is a cross-chain transaction recorded by the bridge
+type BridgeItem struct {
+	Seq uint64
+	QueueItem
+}
+
+const (
+	BridgeDBName = "./bridge.db"
+
+	CreateBridgePendingDB = `CREATE TABLE IF NOT EXISTS BridgePending(
+				TxHash BLOB NOT NULL PRIMARY KEY,
+				BlockHash BLOB NOT NULL,
+				Height INTEGER NOT NULL
+			);`
+
+	CreateBridgeTxsDB = `CREATE TABLE IF NOT EXISTS BridgeTxs(
+				Seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				TxHash BLOB NOT NULL UNIQUE,
+				BlockHash BLOB NOT NULL,
+				Height INTEGER NOT NULL
+			);`
+
+	CreateBridgeCursorsDB = `CREATE TABLE IF NOT EXISTS BridgeCursors(
+				Name TEXT NOT NULL PRIMARY KEY,
+				Seq INTEGER NOT NULL
+			);`
+
+	CreateBridgeDeliveriesDB = `CREATE TABLE IF NOT EXISTS BridgeDeliveries(
+				Name TEXT NOT NULL PRIMARY KEY,
+				ID TEXT NOT NULL
+			);`
+)
+
+type BridgeSQLiteDB struct {
+	*sync.RWMutex
+	*sql.DB
+}
+
+func NewBridgeDB() (BridgeDB, error) {
+	var db *sql.DB
+	var err error
+	if config.Values().Ephemeral {
+		db, err = spvdb.OpenMemoryDB("bridge")
+	} else {
+		db, err = sql.Open(DriverName, BridgeDBName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, create := range []string{CreateBridgePendingDB, CreateBridgeTxsDB, CreateBridgeCursorsDB, CreateBridgeDeliveriesDB} {
+		_, err = db.Exec(create)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &BridgeSQLiteDB{RWMutex: new(sync.RWMutex), DB: db}, nil
+}
+
+// Put a cross-chain transaction waiting for the bridge depth
+func (db *BridgeSQLiteDB) PutPending(item *QueueItem) error {
+	db.Lock()
+	defer db.Unlock()
+
+	sql := "INSERT OR REPLACE INTO BridgePending(TxHash, BlockHash, Height) VALUES(?,?,?)"
+	_, err := db.Exec(sql, item.TxHash.Bytes(), item.BlockHash.Bytes(), item.Height)
+	return err
+}
+
+// Record the pending transactions at or below the height in sequence,
+// returns the number of transactions recorded
+func (db *BridgeSQLiteDB) Confirm(height uint32) (int, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// A transaction already recorded is ignored, so it is never delivered twice
+	result, err := tx.Exec(`INSERT OR IGNORE INTO BridgeTxs(TxHash, BlockHash, Height)
+		SELECT TxHash, BlockHash, Height FROM BridgePending WHERE Height<=? ORDER BY Height, TxHash`, height)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM BridgePending WHERE Height<=?", height)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Delete the pending transactions at or above the height
+func (db *BridgeSQLiteDB) Rollback(height uint32) error {
+	db.Lock()
+	defer db.Unlock()
+
+	_, err := db.Exec("DELETE FROM BridgePending WHERE Height>=?", height)
+	return err
+}
+
+// Get at most limit recorded transactions from the given sequence number
+func (db *BridgeSQLiteDB) GetTxs(fromSeq uint64, limit int) ([]*BridgeItem, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	rows, err := db.Query(`SELECT Seq, TxHash, BlockHash, Height FROM BridgeTxs
+		WHERE Seq>=? ORDER BY Seq LIMIT ?`, fromSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*BridgeItem
+	for rows.Next() {
+		var item BridgeItem
+		var txHashBytes []byte
+		var blockHashBytes []byte
+		err = rows.Scan(&item.Seq, &txHashBytes, &blockHashBytes, &item.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		txHash, err := Uint256FromBytes(txHashBytes)
+		if err != nil {
+			return nil, err
+		}
+		blockHash, err := Uint256FromBytes(blockHashBytes)
+		if err != nil {
+			return nil, err
+		}
+		item.TxHash = *txHash
+		item.BlockHash = *blockHash
+		items = append(items, &item)
+	}
+
+	return items, nil
+}
+
+// Get the last sequence number handled by the cursor, 0 if none
+func (db *BridgeSQLiteDB) GetCursor(name string) (uint64, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var seq uint64
+	err := db.QueryRow("SELECT Seq FROM BridgeCursors WHERE Name=?", name).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// Set the last sequence number handled by the cursor
+func (db *BridgeSQLiteDB) PutCursor(name string, seq uint64) error {
+	db.Lock()
+	defer db.Unlock()
+
+	_, err := db.Exec("INSERT OR REPLACE INTO BridgeCursors(Name, Seq) VALUES(?,?)", name, seq)
+	return err
+}
+
+// Save the ID of the transaction handed to the cursor's handler, returns the
+// ID saved before, the handler did not ack it if it's the same ID
+func (db *BridgeSQLiteDB) StartDelivery(name string, id string) (string, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var last string
+	err := db.QueryRow("SELECT ID FROM BridgeDeliveries WHERE Name=?", name).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	_, err = db.Exec("INSERT OR REPLACE INTO BridgeDeliveries(Name, ID) VALUES(?,?)", name, id)
+	return last, err
+}
+
+// Ack the delivery of the transaction, saves the cursor and clears the
+// delivering ID at once
+func (db *BridgeSQLiteDB) Ack(name string, seq uint64) error {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO BridgeCursors(Name, Seq) VALUES(?,?)", name, seq)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM BridgeDeliveries WHERE Name=?", name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,33 @@
+package _interface
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// A queued transaction was notified with it's current confirmations
+	EventTransaction = 1
+
+	// Transactions on the given height has been rollback
+	EventRollback = 2
+)
+
+// Event is a record in the wallet event journal, a reattaching UI process
+// can replay events from the last sequence number it processed.
+type Event struct {
+	// Sequence number of the event, increases monotonically
+	Seq uint64
+
+	// Type of the event, EventTransaction or EventRollback
+	Type int
+
+	// Transaction and the block it was packed in, empty for rollback events
+	TxHash    Uint256
+	BlockHash Uint256
+
+	// The height of the transaction, or the rollback height
+	Height uint32
+
+	// Confirmations of the transaction when the event happened
+	Confirmations uint32
+}
@@ -0,0 +1,71 @@
+package _interface
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// TransactionFilter is an optional interface of TransactionListener, implement it
+// to be notified only of the transactions matching the filter, the filter is
+// evaluated by the service so unmatched transactions are never called back.
+type TransactionFilter interface {
+	NotifyFilter() *NotifyFilter
+}
+
+// NotifyFilter narrows down the transactions notified to a listener,
+// zero value fields do not filter anything.
+type NotifyFilter struct {
+	// Only notify transactions paying to one of these addresses
+	Addresses []Uint168
+
+	// Only notify transactions paying at least this amount,
+	// to the filter addresses if set, otherwise to all outputs
+	MinAmount Fixed64
+
+	// Only notify transactions reached this number of confirmations,
+	// it takes precedence over Confirmed() of the listener
+	Confirmations uint32
+}
+
+// Create a filter of the given addresses, other fields can be set later
+func NewNotifyFilter(addresses ...string) (*NotifyFilter, error) {
+	filter := new(NotifyFilter)
+	for _, address := range addresses {
+		programHash, err := Uint168FromAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		filter.Addresses = append(filter.Addresses, *programHash)
+	}
+	return filter, nil
+}
+
+// Check if the transaction with the given confirmations matches the filter
+func (f *NotifyFilter) Match(tx *Transaction, confirmations uint32) bool {
+	if confirmations < f.Confirmations {
+		return false
+	}
+
+	var matched bool
+	var amount Fixed64
+	for _, output := range tx.Outputs {
+		if len(f.Addresses) > 0 && !f.containAddr(output.ProgramHash) {
+			continue
+		}
+		matched = true
+		amount += output.Value
+	}
+	if len(f.Addresses) > 0 && !matched {
+		return false
+	}
+	return amount >= f.MinAmount
+}
+
+func (f *NotifyFilter) containAddr(programHash Uint168) bool {
+	for _, addr := range f.Addresses {
+		if addr.IsEqual(programHash) {
+			return true
+		}
+	}
+	return false
+}
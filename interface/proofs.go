@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 
 	. "github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -15,12 +16,15 @@ import (
 )
 
 type Proofs interface {
-	// Put a merkle proof of the block
-	Put(proof *MerkleProof) error
+	// Put a merkle proof of the block, indexed by the ids of the block transactions
+	Put(proof *MerkleProof, txIds []*Uint256) error
 
 	// Get a merkle proof of a block
 	Get(blockHash *Uint256) (*MerkleProof, error)
 
+	// Get the merkle proof of the block the transaction was last put with
+	GetByTx(txId *Uint256) (*MerkleProof, error)
+
 	// Get all merkle proofs in database
 	GetAll() ([]*MerkleProof, error)
 
@@ -41,9 +45,15 @@ type ProofsDB struct {
 
 var (
 	BKTProofs = []byte("Proofs")
+	// Block hashes of the proofs by transaction id
+	BKTTxProofs = []byte("TxProofs")
 )
 
 func NewProofsDB() (Proofs, error) {
+	if config.Values().Ephemeral {
+		return NewMemProofsDB(), nil
+	}
+
 	db, err := bolt.Open("proofs.bin", 0644, &bolt.Options{InitialMmapSize: 5000000})
 	if err != nil {
 		return nil, err
@@ -54,14 +64,18 @@ func NewProofsDB() (Proofs, error) {
 		if err != nil {
 			return err
 		}
+		_, err = btx.CreateBucketIfNotExists(BKTTxProofs)
+		if err != nil {
+			return err
+		}
 		return nil
 	})
 
 	return &ProofsDB{RWMutex: new(sync.RWMutex), DB: db}, nil
 }
 
-// Put a merkle proof of the block
-func (db *ProofsDB) Put(proof *MerkleProof) error {
+// Put a merkle proof of the block, indexed by the ids of the block transactions
+func (db *ProofsDB) Put(proof *MerkleProof, txIds []*Uint256) error {
 	db.Lock()
 	defer db.Unlock()
 
@@ -77,10 +91,40 @@ func (db *ProofsDB) Put(proof *MerkleProof) error {
 			return err
 		}
 
+		index := tx.Bucket(BKTTxProofs)
+		for _, txId := range txIds {
+			err = index.Put(txId.Bytes(), proof.BlockHash.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
 
+// Get the merkle proof of the block the transaction was last put with
+func (db *ProofsDB) GetByTx(txId *Uint256) (proof *MerkleProof, err error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		blockHash := tx.Bucket(BKTTxProofs).Get(txId.Bytes())
+		if blockHash == nil {
+			return errors.New(fmt.Sprintf("MerkleProof of transaction %s does not exist in database", txId.String()))
+		}
+
+		proof, err = getProof(tx, blockHash)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proof, nil
+}
+
 // Get a merkle proof of a block
 func (db *ProofsDB) Get(blockHash *Uint256) (proof *MerkleProof, err error) {
 	db.RLock()
@@ -147,6 +191,10 @@ func (db *ProofsDB) Reset() error {
 	defer db.Unlock()
 
 	return db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(BKTTxProofs)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
 		return tx.DeleteBucket(BKTProofs)
 	})
 }
@@ -184,3 +232,90 @@ func deserializeProof(body []byte) (*MerkleProof, error) {
 	}
 	return &proof, nil
 }
+
+// MemProofsDB implements Proofs in memory, for the ephemeral mode
+type MemProofsDB struct {
+	*sync.RWMutex
+	proofs map[Uint256]*MerkleProof
+	txs    map[Uint256]Uint256
+}
+
+func NewMemProofsDB() Proofs {
+	return &MemProofsDB{
+		RWMutex: new(sync.RWMutex),
+		proofs:  make(map[Uint256]*MerkleProof),
+		txs:     make(map[Uint256]Uint256),
+	}
+}
+
+// Put a merkle proof of the block, indexed by the ids of the block transactions
+func (db *MemProofsDB) Put(proof *MerkleProof, txIds []*Uint256) error {
+	db.Lock()
+	defer db.Unlock()
+
+	db.proofs[proof.BlockHash] = proof
+	for _, txId := range txIds {
+		db.txs[*txId] = proof.BlockHash
+	}
+	return nil
+}
+
+// Get the merkle proof of the block the transaction was last put with
+func (db *MemProofsDB) GetByTx(txId *Uint256) (*MerkleProof, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	blockHash, ok := db.txs[*txId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("MerkleProof of transaction %s does not exist in database", txId.String()))
+	}
+	proof, ok := db.proofs[blockHash]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("MerkleProof %s does not exist in database", blockHash.String()))
+	}
+	return proof, nil
+}
+
+// Get a merkle proof of a block
+func (db *MemProofsDB) Get(blockHash *Uint256) (*MerkleProof, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	proof, ok := db.proofs[*blockHash]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("MerkleProof %s does not exist in database", blockHash.String()))
+	}
+	return proof, nil
+}
+
+// Get all merkle proofs in database
+func (db *MemProofsDB) GetAll() ([]*MerkleProof, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	proofs := make([]*MerkleProof, 0, len(db.proofs))
+	for _, proof := range db.proofs {
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+// Delete a merkle proof of a block
+func (db *MemProofsDB) Delete(blockHash *Uint256) error {
+	db.Lock()
+	defer db.Unlock()
+
+	delete(db.proofs, *blockHash)
+	return nil
+}
+
+func (db *MemProofsDB) Reset() error {
+	db.Lock()
+	defer db.Unlock()
+
+	db.proofs = make(map[Uint256]*MerkleProof)
+	db.txs = make(map[Uint256]Uint256)
+	return nil
+}
+
+func (db *MemProofsDB) Close() {}
@@ -4,6 +4,9 @@ import (
 	"sync"
 	"database/sql"
 
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	spvdb "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"fmt"
 )
@@ -20,6 +23,15 @@ type Queue interface {
 
 	// Rollback queue items
 	Rollback(height uint32) error
+
+	// Append an event to the journal, the sequence number is returned
+	PutEvent(event *Event) (uint64, error)
+
+	// Get events in the journal from the given sequence number
+	GetEvents(fromSeq uint64) ([]*Event, error)
+
+	// Delete events in the journal up to the given sequence number
+	DeleteEvents(toSeq uint64) error
 }
 
 const (
@@ -31,6 +43,15 @@ const (
 				BlockHash BLOB NOT NULL,
 				Height INTEGER NOT NULL
 			);`
+
+	CreateEventsDB = `CREATE TABLE IF NOT EXISTS Events(
+				Seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				Type INTEGER NOT NULL,
+				TxHash BLOB NOT NULL,
+				BlockHash BLOB NOT NULL,
+				Height INTEGER NOT NULL,
+				Confirmations INTEGER NOT NULL
+			);`
 )
 
 type QueueDB struct {
@@ -39,7 +60,13 @@ type QueueDB struct {
 }
 
 func NewQueueDB() (Queue, error) {
-	db, err := sql.Open(DriverName, DBName)
+	var db *sql.DB
+	var err error
+	if config.Values().Ephemeral {
+		db, err = spvdb.OpenMemoryDB("queue")
+	} else {
+		db, err = sql.Open(DriverName, DBName)
+	}
 	if err != nil {
 		fmt.Println("Open sqlite db error:", err)
 		return nil, err
@@ -49,6 +76,10 @@ func NewQueueDB() (Queue, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, err = db.Exec(CreateEventsDB)
+	if err != nil {
+		return nil, err
+	}
 	return &QueueDB{RWMutex: new(sync.RWMutex), DB: db}, nil
 }
 
@@ -122,3 +153,73 @@ func (db *QueueDB) Rollback(height uint32) error {
 	_, err := db.Exec("DELETE FROM Queue WHERE Height=?", height)
 	return err
 }
+
+// Append an event to the journal, the sequence number is returned
+func (db *QueueDB) PutEvent(event *Event) (uint64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	sql := "INSERT INTO Events(Type, TxHash, BlockHash, Height, Confirmations) VALUES(?,?,?,?,?)"
+	result, err := db.Exec(sql, event.Type, event.TxHash.Bytes(), event.BlockHash.Bytes(),
+		event.Height, event.Confirmations)
+	if err != nil {
+		return 0, err
+	}
+
+	seq, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	event.Seq = uint64(seq)
+
+	return event.Seq, nil
+}
+
+// Delete events in the journal up to the given sequence number, the sequence
+// numbers of new events keep increasing after the events are deleted
+func (db *QueueDB) DeleteEvents(toSeq uint64) error {
+	db.Lock()
+	defer db.Unlock()
+
+	_, err := db.Exec("DELETE FROM Events WHERE Seq<=?", toSeq)
+	return err
+}
+
+// Get events in the journal from the given sequence number
+func (db *QueueDB) GetEvents(fromSeq uint64) ([]*Event, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	rows, err := db.Query(`SELECT Seq, Type, TxHash, BlockHash, Height, Confirmations
+		FROM Events WHERE Seq>=? ORDER BY Seq`, fromSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var event Event
+		var txHashBytes []byte
+		var blockHashBytes []byte
+		err = rows.Scan(&event.Seq, &event.Type, &txHashBytes, &blockHashBytes,
+			&event.Height, &event.Confirmations)
+		if err != nil {
+			return nil, err
+		}
+
+		txHash, err := Uint256FromBytes(txHashBytes)
+		if err != nil {
+			return nil, err
+		}
+		blockHash, err := Uint256FromBytes(blockHashBytes)
+		if err != nil {
+			return nil, err
+		}
+		event.TxHash = *txHash
+		event.BlockHash = *blockHash
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
@@ -30,9 +30,37 @@ type SPVService interface {
 	// This method is useful when receive a transaction from other peer
 	VerifyTransaction(bloom.MerkleProof, Transaction) error
 
+	// Get a confirmed transaction of the registered accounts and the merkle proof
+	// of its block on the main chain
+	GetTransactionAndProof(txId Uint256) (*bloom.MerkleProof, *Transaction, error)
+
+	// Get the proof of a confirmed transaction of the registered accounts serialized
+	// in the format the arbiters and side chains expect, so this package can be the
+	// SPV proof source of cross-chain transaction verification
+	GetSPVProof(txId Uint256) (*SPVProof, error)
+
+	// Create a balance proof of the unspent outputs of the registered accounts,
+	// with the headers and merkle proofs of their transactions, so an auditor can
+	// verify the holdings by VerifyBalanceProof() with trusted headers only
+	GetBalanceProof() (*BalanceProof, error)
+
 	// Send a transaction to the P2P network
 	SendTransaction(Transaction) error
 
+	// Get the bridge notifying cross-chain transactions once they reached the bridge
+	// depth, exactly once to each cursor, for arbiter services built on this package.
+	// Subscribe cursors before Start(), delivery resumes from the saved cursors.
+	CrossChainBridge() *Bridge
+
+	// Replay events in the journal from the given sequence number, so a reattaching
+	// UI process can rebuild it's view from the last event it processed.
+	// Replay stops when the handler returns an error, and the error is returned.
+	ReplayEvents(fromSeq uint64, handler func(*Event) error) error
+
+	// Acknowledge the events processed up to the given sequence number, they are
+	// deleted from the journal and can not be replayed any more.
+	AckEvents(toSeq uint64) error
+
 	// Get the Blockchain instance.
 	// Blockchain will handle block and transaction commits,
 	// verify and store the block and transactions.
@@ -40,6 +68,10 @@ type SPVService interface {
 	// use Blockchain.AddStateListener() to register chain state callbacks
 	Blockchain() *sdk.Blockchain
 
+	// Set the sync profile by the app state, Foreground, Background or Paused,
+	// to trade sync speed for battery
+	SetSyncProfile(profile sdk.SyncProfile) error
+
 	// Start the SPV service
 	Start() error
 }
@@ -24,14 +24,17 @@ type SPVServiceImpl struct {
 	queue      Queue
 	addrFilter *sdk.AddrFilter
 	listeners  map[TransactionType][]TransactionListener
+	bridge     *Bridge
 }
 
 func newSPVServiceImpl(clientId uint64, seeds []string) *SPVServiceImpl {
-	return &SPVServiceImpl{
+	service := &SPVServiceImpl{
 		clientId:  clientId,
 		seeds:     seeds,
 		listeners: make(map[TransactionType][]TransactionListener),
 	}
+	service.bridge = newBridge(service)
+	return service
 }
 
 func (service *SPVServiceImpl) RegisterAccount(address string) error {
@@ -65,42 +68,54 @@ func (service *SPVServiceImpl) VerifyTransaction(proof bloom.MerkleProof, tx Tra
 		return errors.New("can not get block from main chain")
 	}
 
-	// Check if merkleroot is match
-	merkleBlock := bloom.MerkleBlock{
-		Header:       header.Header,
-		Transactions: proof.Transactions,
-		Hashes:       proof.Hashes,
-		Flags:        proof.Flags,
+	txProof := &sdk.TxProof{Proof: proof, Tx: tx}
+	return txProof.Verify(&header.Header)
+}
+
+func (service *SPVServiceImpl) SendTransaction(tx Transaction) error {
+	if service.SPVWallet == nil {
+		return errors.New("SPV service not started")
 	}
-	txIds, err := bloom.CheckMerkleBlock(merkleBlock)
-	if err != nil {
-		return errors.New("check merkle branch failed, " + err.Error())
+
+	return service.SPVWallet.SendTransaction(tx)
+}
+
+func (service *SPVServiceImpl) SetSyncProfile(profile sdk.SyncProfile) error {
+	if service.SPVWallet == nil {
+		return errors.New("SPV service not started")
 	}
-	if len(txIds) == 0 {
-		return errors.New("invalid transaction proof, no transactions found")
+	return service.SPVWallet.SetSyncProfile(profile)
+}
+
+func (service *SPVServiceImpl) CrossChainBridge() *Bridge {
+	return service.bridge
+}
+
+func (service *SPVServiceImpl) ReplayEvents(fromSeq uint64, handler func(*Event) error) error {
+	if service.queue == nil {
+		return errors.New("SPV service not started")
 	}
 
-	// Check if transaction hash is match
-	match := false
-	for _, txId := range txIds {
-		if *txId == tx.Hash() {
-			match = true
-			break
-		}
+	events, err := service.queue.GetEvents(fromSeq)
+	if err != nil {
+		return err
 	}
-	if !match {
-		return errors.New("transaction hash not match proof")
+
+	for _, event := range events {
+		err = handler(event)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (service *SPVServiceImpl) SendTransaction(tx Transaction) error {
-	if service.SPVWallet == nil {
+func (service *SPVServiceImpl) AckEvents(toSeq uint64) error {
+	if service.queue == nil {
 		return errors.New("SPV service not started")
 	}
-
-	return service.SPVWallet.SendTransaction(tx)
+	return service.queue.DeleteEvents(toSeq)
 }
 
 func (service *SPVServiceImpl) Start() error {
@@ -125,12 +140,17 @@ func (service *SPVServiceImpl) Start() error {
 		return err
 	}
 
+	err = service.bridge.start()
+	if err != nil {
+		return err
+	}
+
 	// Register accounts
 	if len(service.accounts) == 0 {
 		return errors.New("No account registered")
 	}
 	for _, account := range service.accounts {
-		service.DataStore().Addrs().Put(account, RegisteredAccountScript, db.TypeNotify)
+		service.DataStore().Addrs().Put(account, RegisteredAccountScript, db.TypeNotify, "")
 	}
 
 	// Create address filter by accounts
@@ -146,6 +166,7 @@ func (service *SPVServiceImpl) Start() error {
 	go func() {
 		for range signals {
 			log.Trace("SPV service shutting down...")
+			service.bridge.Stop()
 			service.Stop()
 			stop <- 1
 		}
@@ -163,20 +184,36 @@ func (service *SPVServiceImpl) OnTxCommitted(tx Transaction, height uint32) {}
 
 func (service *SPVServiceImpl) OnChainRollback(height uint32) {
 	service.queue.Rollback(height)
+
+	// Record rollback event
+	_, err := service.queue.PutEvent(&Event{Type: EventRollback, Height: height})
+	if err != nil {
+		log.Error("Record rollback event failed, height:", height)
+	}
+
+	service.bridge.onChainRollback(height)
 	service.notifyRollback(height)
 }
 
 func (service *SPVServiceImpl) OnBlockCommitted(block bloom.MerkleBlock, txs []Transaction) {
 	header := block.Header
 
-	// Store merkle proof
+	// Store merkle proof, indexed by the block transactions
+	txIds := make([]*Uint256, 0, len(txs))
+	for i := range txs {
+		txId := txs[i].Hash()
+		txIds = append(txIds, &txId)
+	}
 	service.proofs.Put(&bloom.MerkleProof{
 		BlockHash:    header.Hash(),
 		Height:       header.Height,
 		Transactions: block.Transactions,
 		Hashes:       block.Hashes,
 		Flags:        block.Flags,
-	})
+	}, txIds)
+
+	// Record cross-chain transactions reached the bridge depth
+	service.bridge.onBlockCommitted(&block, txs)
 
 	// If no transactions return
 	if len(txs) == 0 {
@@ -226,14 +263,35 @@ func (service *SPVServiceImpl) OnBlockCommitted(block bloom.MerkleBlock, txs []T
 		// Prune the proof by the given transaction id
 		proof = getTransactionProof(proof, storeTx.TxId)
 
+		// Record transaction event
+		confirmations := header.Height - item.Height
+		_, err = service.queue.PutEvent(&Event{
+			Type:          EventTransaction,
+			TxHash:        item.TxHash,
+			BlockHash:     item.BlockHash,
+			Height:        item.Height,
+			Confirmations: confirmations,
+		})
+		if err != nil {
+			log.Error("Record transaction event failed, tx hash:", item.TxHash.String())
+		}
+
 		// Notify listeners
-		service.notifyTransaction(*proof, storeTx.Data, header.Height-item.Height)
+		service.notifyTransaction(*proof, storeTx.Data, confirmations)
 	}
 }
 
 func (service *SPVServiceImpl) notifyTransaction(proof bloom.MerkleProof, tx Transaction, confirmations uint32) {
 	listeners := service.listeners[tx.TxType]
 	for _, listener := range listeners {
+		if filtered, ok := listener.(TransactionFilter); ok {
+			if filter := filtered.NotifyFilter(); filter != nil {
+				if filter.Match(&tx, confirmations) {
+					go listener.Notify(proof, tx)
+				}
+				continue
+			}
+		}
 		if listener.Confirmed() {
 			if confirmations >= getConfirmations(tx) {
 				go listener.Notify(proof, tx)
@@ -0,0 +1,109 @@
+package _interface
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+SPVProof is the proof of a main chain transaction in the format the arbiters and
+side chains expect for cross-chain transactions, like the recharge payload of a
+side chain deposit. The merkle proof and the transaction are serialized as they
+are put into the payload, the header is the block the proof is anchored to.
+*/
+type SPVProof struct {
+	Header      Header
+	MerkleProof []byte
+	Transaction []byte
+}
+
+// Get the transaction of the hash and the merkle proof of its block on the main
+// chain, only transactions of the registered accounts are stored with proofs
+func (service *SPVServiceImpl) GetTransactionAndProof(txId Uint256) (*bloom.MerkleProof, *Transaction, error) {
+	txProof, _, err := service.getTxProof(txId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &txProof.Proof, &txProof.Tx, nil
+}
+
+// Get the proof of the transaction serialized for the arbiters and side chains
+func (service *SPVServiceImpl) GetSPVProof(txId Uint256) (*SPVProof, error) {
+	txProof, header, err := service.getTxProof(txId)
+	if err != nil {
+		return nil, err
+	}
+
+	proofBuf := new(bytes.Buffer)
+	if err := txProof.Proof.Serialize(proofBuf); err != nil {
+		return nil, err
+	}
+	txBuf := new(bytes.Buffer)
+	if err := txProof.Tx.Serialize(txBuf); err != nil {
+		return nil, err
+	}
+	return &SPVProof{
+		Header:      *header,
+		MerkleProof: proofBuf.Bytes(),
+		Transaction: txBuf.Bytes(),
+	}, nil
+}
+
+// Get the stored transaction with the merkle proof of its block on the main chain,
+// the proof is verified against the header before returned
+func (service *SPVServiceImpl) getTxProof(txId Uint256) (*sdk.TxProof, *Header, error) {
+	if service.SPVWallet == nil {
+		return nil, nil, errors.New("SPV service not started")
+	}
+
+	storeTx, err := service.DataStore().Txs().Get(&txId)
+	if err != nil {
+		return nil, nil, errors.New("query transaction failed, tx hash: " + txId.String())
+	}
+	if storeTx.Height == 0 {
+		return nil, nil, errors.New("transaction not confirmed, tx hash: " + txId.String())
+	}
+
+	// The transaction may be put with a block rolled back later
+	proof, err := service.proofs.GetByTx(&txId)
+	if err != nil {
+		proof, err = service.mainChainProof(storeTx.Height)
+	}
+	if err != nil || proof.Height != storeTx.Height || !service.Blockchain().IsOnMainChain(proof.BlockHash) {
+		return nil, nil, fmt.Errorf("no merkle proof of block at height %d", storeTx.Height)
+	}
+
+	header, err := service.Headers().GetHeader(proof.BlockHash)
+	if err != nil {
+		return nil, nil, errors.New("can not get block from main chain")
+	}
+
+	txProof := &sdk.TxProof{Proof: *proof, Tx: storeTx.Data}
+	if err := txProof.Verify(&header.Header); err != nil {
+		return nil, nil, err
+	}
+	return txProof, &header.Header, nil
+}
+
+// Get the proof of the main chain block at the height, for proofs put before
+// they were indexed by transactions
+func (service *SPVServiceImpl) mainChainProof(height uint32) (*bloom.MerkleProof, error) {
+	chain := service.Blockchain()
+	finder, ok := chain.DataStore.(db.AncestorFinder)
+	if !ok {
+		return nil, errors.New("no block index by height")
+	}
+	blockHash, err := finder.GetAncestor(chain.ChainTip(), height)
+	if err != nil {
+		return nil, err
+	}
+	return service.proofs.Get(blockHash)
+}
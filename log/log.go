@@ -35,7 +35,8 @@ var logger *log.Logger
 func Init() {
 	writers := []io.Writer{}
 	level = config.Values().PrintLevel
-	if level >= LevelFile {
+	// Nothing is written to the working directory in the ephemeral mode
+	if level >= LevelFile && !config.Values().Ephemeral {
 		logFile, err := OpenLogFile()
 		if err != nil {
 			fmt.Println("error: open log file failed")
@@ -1,16 +1,50 @@
 package main
 
 import (
+	"encoding/binary"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
-	"encoding/binary"
+	"strings"
 
+	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
-	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/explorer"
 )
 
+// Config overrides given by repeated -set flags
+type overrides []string
+
+func (o *overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
 func main() {
+	// Load config from the file, environment variables and flags
+	var sets overrides
+	configFile := flag.String("config", "", "config file, JSON or TOML by the .toml extension, "+
+		"default is $"+config.EnvConfigFile+" or "+config.ConfigFilename)
+	flag.Var(&sets, "set", "override a config value, like -set PrintLevel=5 or -set RemoteSigner.Address=host:port")
+	printConfig := flag.Bool("print-config", false, "print the effective config and exit")
+	flag.Parse()
+
+	err := config.Load(*configFile, sets)
+	if err != nil {
+		fmt.Println("Load config failed:", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		config.Values().Print(os.Stdout)
+		return
+	}
+
 	// Initiate log
 	log.Init()
 
@@ -42,5 +76,10 @@ func main() {
 
 	wallet.Start()
 
+	// Start explorer web UI if enabled
+	if port := config.Values().ExplorerPort; port > 0 {
+		explorer.New(wallet, config.Values().ExplorerHost, port).Start()
+	}
+
 	<-stop
 }
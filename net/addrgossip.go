@@ -0,0 +1,69 @@
+package net
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+	. "github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+)
+
+const (
+	// Average interval between two addr messages relayed
+	AddrGossipInterval = time.Minute * 10
+	// Max addresses relayed in one addr message
+	MaxGossipAddrs = 8
+)
+
+// Enable or disable relaying known-good addresses to peers, enabled by default
+func (pm *PeerManager) SetAddrGossip(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&pm.gossipDisabled, disabled)
+}
+
+// Periodically relay a few addresses of established peers to one random peer.
+// Addresses are trickled, one peer at a time with a random delay, so peers can
+// not tell which addresses we are connected to by the time they were received.
+func (pm *PeerManager) gossipAddrs() {
+	for {
+		// Random delay between half and one and a half of the interval
+		delay := AddrGossipInterval/2 + time.Duration(rand.Int63n(int64(AddrGossipInterval)))
+		time.Sleep(delay)
+
+		if atomic.LoadInt32(&pm.gossipDisabled) == 1 {
+			continue
+		}
+
+		peers := pm.ConnectedPeers()
+		if len(peers) < 2 {
+			continue
+		}
+		target := peers[rand.Intn(len(peers))]
+
+		var addrs []Addr
+		for _, i := range rand.Perm(len(peers)) {
+			peer := peers[i]
+			// Do not tell a peer it's own address
+			if peer.ID() == target.ID() {
+				continue
+			}
+			// Skip peers not listening
+			if peer.Addr().Port == 0 {
+				continue
+			}
+			addrs = append(addrs, *peer.Addr())
+			if len(addrs) >= MaxGossipAddrs {
+				break
+			}
+		}
+
+		log.Debug("Relay", len(addrs), "addresses to peer", target.ID())
+		go target.Send(NewAddrs(addrs))
+	}
+}
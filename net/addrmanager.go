@@ -19,6 +19,12 @@ type AddrManager struct {
 	seeds     []string
 	cached    []string
 	connected map[string]byte
+
+	// Do not read or write the cached addresses file
+	noCache bool
+
+	// Addresses resolved from DNS seeds, used instead of the static seeds if any
+	dnsAddrs []string
 }
 
 func newAddrManager(seeds []string) *AddrManager {
@@ -50,9 +56,17 @@ func newAddrManager(seeds []string) *AddrManager {
 }
 
 func (am *AddrManager) GetIdleAddrs(count int) []string {
+	am.RLock()
+	defer am.RUnlock()
+
 	addrMap := make(map[string]string)
 
-	for _, seed := range am.seeds {
+	// Fall back to the static seeds if no address is resolved from DNS seeds
+	seeds := am.dnsAddrs
+	if len(seeds) == 0 {
+		seeds = am.seeds
+	}
+	for _, seed := range seeds {
 		if am.isConnected(seed) {
 			continue
 		}
@@ -116,6 +130,14 @@ func (am *AddrManager) DiscardAddr(addr string) {
 	}
 }
 
+// Replace the addresses resolved from DNS seeds
+func (am *AddrManager) setDNSAddrs(addrs []string) {
+	am.Lock()
+	defer am.Unlock()
+
+	am.dnsAddrs = addrs
+}
+
 func (am *AddrManager) isSeed(addr string) bool {
 	for _, seed := range am.seeds {
 		if seed == addr {
@@ -139,7 +161,21 @@ func (am *AddrManager) isConnected(addr string) bool {
 	return ok
 }
 
+// Forget the addresses read from the cached addresses file and do not save
+// discovered addresses to it, only the seeds are connected
+func (am *AddrManager) disableCache() {
+	am.Lock()
+	defer am.Unlock()
+
+	am.noCache = true
+	am.cached = am.cached[:0]
+}
+
 func (am *AddrManager) saveCached() {
+	if am.noCache {
+		return
+	}
+
 	var cached string
 	for _, addr := range am.cached {
 		cached += string(addr)
@@ -0,0 +1,54 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// The read bandwidth limiter shared by all peer connections
+var bandwidth = new(bandwidthLimiter)
+
+// bandwidthLimiter limits the total bytes read per second,
+// by delaying the next read until the bytes already read are paid off
+type bandwidthLimiter struct {
+	sync.Mutex
+	limit int // bytes per second, 0 means unlimited
+	next  time.Time
+}
+
+func (l *bandwidthLimiter) setLimit(limit int) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.limit = limit
+	l.next = time.Time{}
+}
+
+func (l *bandwidthLimiter) wait(n int) {
+	l.Lock()
+	if l.limit <= 0 || n <= 0 {
+		l.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.limit))
+	delay := l.next.Sub(now)
+	l.Unlock()
+
+	time.Sleep(delay)
+}
+
+// throttledConn is a net.Conn with reads limited by the shared bandwidth limiter
+type throttledConn struct {
+	net.Conn
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	bandwidth.wait(n)
+	return n, err
+}
@@ -0,0 +1,193 @@
+package net
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+const (
+	// Peers reached the ban score are banned
+	DefaultBanThreshold = 100
+
+	// How long the address of a banned peer is refused
+	DefaultBanDuration = time.Hour * 24
+
+	// Ban scores halve every half life, so honest peers do not collect
+	// the scores of rare events over a long running session
+	BanScoreHalfLife = time.Minute * 10
+
+	// The max number of hosts with a ban score kept, the lowest scores
+	// are dropped first when it is reached
+	MaxBanScores = 1000
+)
+
+/*
+banManager keeps the ban scores of peers by host, so a misbehaving peer does not
+start over with a clean score by reconnecting, and bans the host for the ban duration
+once the score reached the threshold. Scores decay with BanScoreHalfLife, so only
+misbehaviors close in time add up to a ban. Banned hosts are neither connected to nor
+accepted from, a ban expires with the score.
+*/
+type banManager struct {
+	sync.Mutex
+	threshold int
+	duration  time.Duration
+	scores    map[string]*banScore
+	banned    map[string]time.Time
+}
+
+// The ban score of a host as of the time it was last updated
+type banScore struct {
+	score   float64
+	updated time.Time
+}
+
+// Get the score decayed to the time
+func (s *banScore) decayed(now time.Time) float64 {
+	elapsed := now.Sub(s.updated)
+	if elapsed <= 0 {
+		return s.score
+	}
+	return s.score * math.Exp2(-float64(elapsed)/float64(BanScoreHalfLife))
+}
+
+func newBanManager() *banManager {
+	return &banManager{
+		threshold: DefaultBanThreshold,
+		duration:  DefaultBanDuration,
+		scores:    make(map[string]*banScore),
+		banned:    make(map[string]time.Time),
+	}
+}
+
+// The host of the address, the address itself if it has no port
+func banHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Add the delta to the decayed score of the host, returns the score
+// and if the host is banned by reaching the threshold
+func (bm *banManager) addScore(host string, delta int) (int, bool) {
+	bm.Lock()
+	defer bm.Unlock()
+
+	now := time.Now()
+	current, ok := bm.scores[host]
+	if !ok {
+		if delta <= 0 {
+			return 0, false
+		}
+		if len(bm.scores) >= MaxBanScores {
+			bm.prune(now)
+		}
+		current = new(banScore)
+		bm.scores[host] = current
+	}
+	current.score = current.decayed(now) + float64(delta)
+	current.updated = now
+
+	score := int(current.score)
+	if score < bm.threshold {
+		return score, false
+	}
+	delete(bm.scores, host)
+	bm.banned[host] = now.Add(bm.duration)
+	return score, true
+}
+
+// Drop the scores decayed below 1 and the expired bans, and the lowest
+// scores if the scores are still full
+func (bm *banManager) prune(now time.Time) {
+	for host, until := range bm.banned {
+		if now.After(until) {
+			delete(bm.banned, host)
+		}
+	}
+	for host, score := range bm.scores {
+		if score.decayed(now) < 1 {
+			delete(bm.scores, host)
+		}
+	}
+	for len(bm.scores) >= MaxBanScores {
+		var lowest string
+		var min = math.Inf(1)
+		for host, score := range bm.scores {
+			if decayed := score.decayed(now); decayed < min {
+				lowest, min = host, decayed
+			}
+		}
+		delete(bm.scores, lowest)
+	}
+}
+
+func (bm *banManager) isBanned(host string) bool {
+	bm.Lock()
+	defer bm.Unlock()
+
+	until, ok := bm.banned[host]
+	if ok && time.Now().After(until) {
+		delete(bm.banned, host)
+		return false
+	}
+	return ok
+}
+
+// Set the ban score threshold and how long banned peers are refused,
+// this method should be called before PeerManager started
+func (pm *PeerManager) SetBanPolicy(threshold int, duration time.Duration) {
+	pm.banManager.Lock()
+	defer pm.banManager.Unlock()
+
+	pm.banManager.threshold = threshold
+	pm.banManager.duration = duration
+}
+
+// Increase the ban score of the peer's host by the delta for a protocol violation,
+// the peer is disconnected and its host banned once the score reached the threshold.
+// Returns the score and if the peer is banned.
+func (pm *PeerManager) Misbehave(peer *Peer, delta int) (int, bool) {
+	addr := peer.Addr().String()
+	score, banned := pm.banManager.addScore(banHost(addr), delta)
+	if banned {
+		log.Warn("Ban peer", peer.ID(), addr, "for", pm.banManager.duration)
+		pm.DisconnectPeerWithReason(peer, ReasonBan)
+		pm.OnDiscardAddr(addr)
+	}
+	return score, banned
+}
+
+// Check if the host of the address is banned
+func (pm *PeerManager) IsBanned(addr string) bool {
+	return pm.banManager.isBanned(banHost(addr))
+}
+
+// Get the banned hosts and when their bans expire
+func (pm *PeerManager) BannedHosts() map[string]time.Time {
+	pm.banManager.Lock()
+	defer pm.banManager.Unlock()
+
+	banned := make(map[string]time.Time)
+	now := time.Now()
+	for host, until := range pm.banManager.banned {
+		if until.After(now) {
+			banned[host] = until
+		}
+	}
+	return banned
+}
+
+// Lift the ban of the host
+func (pm *PeerManager) Unban(host string) {
+	pm.banManager.Lock()
+	defer pm.banManager.Unlock()
+
+	delete(pm.banManager.banned, host)
+}
@@ -0,0 +1,44 @@
+package net
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBanScoreDecay(t *testing.T) {
+	bm := newBanManager()
+
+	if score, banned := bm.addScore("1.2.3.4", 60); score != 60 || banned {
+		t.Fatalf("add score: %d %v, want 60 false", score, banned)
+	}
+	// Two half lives later the score is a quarter
+	bm.scores["1.2.3.4"].updated = time.Now().Add(-2 * BanScoreHalfLife)
+	if score, banned := bm.addScore("1.2.3.4", 60); score < 74 || score > 75 || banned {
+		t.Errorf("add score after decay: %d %v, want 75 false", score, banned)
+	}
+	if score, banned := bm.addScore("1.2.3.4", 60); !banned {
+		t.Errorf("add score without decay: %d %v, want banned", score, banned)
+	}
+	if !bm.isBanned("1.2.3.4") {
+		t.Error("host not banned")
+	}
+
+	// Zero deltas are not kept
+	if score, banned := bm.addScore("5.6.7.8", 0); score != 0 || banned {
+		t.Errorf("add zero score: %d %v", score, banned)
+	}
+	if _, ok := bm.scores["5.6.7.8"]; ok {
+		t.Error("zero score kept")
+	}
+}
+
+func TestBanScoresBounded(t *testing.T) {
+	bm := newBanManager()
+	for i := 0; i < MaxBanScores*2; i++ {
+		bm.addScore(fmt.Sprint("10.0.", i/256, ".", i%256), 1+i%50)
+	}
+	if len(bm.scores) > MaxBanScores {
+		t.Errorf("%d scores kept, want at most %d", len(bm.scores), MaxBanScores)
+	}
+}
@@ -0,0 +1,60 @@
+package net
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Rotate one outbound connection to a fresh address every interval, 0 disables
+// the churn, which is the default. A stable set of peers all controlled by one
+// party is hard to notice, rotating keeps discovering better peers and makes a
+// slow eclipse attack harder. Persistent peers and the sync peer are not rotated.
+func (pm *PeerManager) SetPeerChurn(interval time.Duration) {
+	atomic.StoreInt64(&pm.churnInterval, int64(interval))
+}
+
+func (pm *PeerManager) churnPeers() {
+	for {
+		interval := time.Duration(atomic.LoadInt64(&pm.churnInterval))
+		if interval <= 0 {
+			time.Sleep(time.Second * InfoUpdateDuration)
+			continue
+		}
+		time.Sleep(interval)
+		pm.churnPeer()
+	}
+}
+
+// Dial a fresh address before dropping a random outbound peer, so the number of
+// connections does not drop if no fresh address can be dialed
+func (pm *PeerManager) churnPeer() {
+	var candidates []*Peer
+	for _, peer := range append(pm.ConnectedPeers(), pm.StandbyPeers()...) {
+		if pm.IsSyncPeer(peer) || !pm.connManager.isChurnable(peer.Addr().String()) {
+			continue
+		}
+		candidates = append(candidates, peer)
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	var fresh string
+	for _, addr := range pm.addrManager.GetIdleAddrs(MaxOutboundCount) {
+		if pm.connManager.connect(addr) {
+			fresh = addr
+			break
+		}
+	}
+	if fresh == "" {
+		log.Debug("Peer churn skipped, no fresh address to dial")
+		return
+	}
+
+	peer := candidates[rand.Intn(len(candidates))]
+	log.Info("Peer churn, replace", peer.Addr().String(), "with", fresh)
+	pm.DisconnectPeerWithReason(peer, ReasonChurn)
+}
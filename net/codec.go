@@ -0,0 +1,89 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+const (
+	// The message header is magic, command, payload length and checksum
+	msgHeaderSize = 24
+	msgCMDSize    = 12
+	msgCMDOffset  = 4
+	msgLenOffset  = msgCMDOffset + msgCMDSize
+	msgSumOffset  = msgLenOffset + 4
+
+	// Read buffer size of peer connections, the message header
+	// and most inventory and ping messages fit in one read
+	ReadBufferSize = 4096
+
+	// Buffers grown larger than this by big messages are not pooled,
+	// so a few blocks do not pin their size of memory
+	maxPooledBufferSize = 1 << 20
+)
+
+// Write buffers reused by all peers, a message is serialized to a pooled
+// buffer and written in one call, instead of building a new slice for each
+var writeBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Serialize the message with its header to a pooled buffer, it holds the same bytes
+// as BuildMessage() returns. Release the buffer after the message is written.
+func encodeMessage(msg Message) (*bytes.Buffer, error) {
+	cmd := msg.CMD()
+	if len(cmd) > msgCMDSize {
+		return nil, errors.New("message command too long " + cmd)
+	}
+
+	buf := writeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	// Reserve the header, then fill it in after the payload is serialized
+	var header [msgHeaderSize]byte
+	buf.Write(header[:])
+	err := msg.Serialize(buf)
+	if err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	payload := data[msgHeaderSize:]
+	binary.LittleEndian.PutUint32(data, Magic)
+	copy(data[msgCMDOffset:msgLenOffset], cmd)
+	binary.LittleEndian.PutUint32(data[msgLenOffset:], uint32(len(payload)))
+	sum := sha256.Sum256(payload)
+	sum = sha256.Sum256(sum[:])
+	copy(data[msgSumOffset:msgHeaderSize], sum[:])
+
+	return buf, nil
+}
+
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		writeBuffers.Put(buf)
+	}
+}
+
+// bufferedConn reads the connection through a buffer, so reading a message
+// header and its payload takes one system call instead of several
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func newBufferedConn(conn net.Conn) *bufferedConn {
+	return &bufferedConn{Conn: conn, reader: bufio.NewReaderSize(conn, ReadBufferSize)}
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
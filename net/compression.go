@@ -0,0 +1,98 @@
+package net
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+/*
+compressedConn compresses the stream in both directions with deflate.
+Standard ELA nodes do not support it, so it is only used with the trusted
+nodes set by PeerManager.SetCompressedAddrs(), which must be served by a
+compatible node or by ServeCompressedProxy().
+
+The wire format is a raw deflate stream (RFC 1951, without a zlib or gzip
+header) in each direction, started right after the TCP connection is set up,
+there is no negotiation. The stream carries the same P2P messages as a plain
+connection. Each write, one message, ends with a sync flush, an empty stored
+block 00 00 ff ff, so the remote side decodes the message without waiting
+for more data.
+*/
+type compressedConn struct {
+	net.Conn
+	reader    io.ReadCloser
+	writeLock sync.Mutex
+	writer    *flate.Writer
+}
+
+func newCompressedConn(conn net.Conn) *compressedConn {
+	// Error is returned only when the compression level is invalid
+	writer, _ := flate.NewWriter(conn, flate.DefaultCompression)
+	return &compressedConn{
+		Conn:   conn,
+		reader: flate.NewReader(conn),
+		writer: writer,
+	}
+}
+
+func (c *compressedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *compressedConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	// Flush every message, so the remote peer can decode it immediately
+	return n, c.writer.Flush()
+}
+
+func (c *compressedConn) Close() error {
+	c.reader.Close()
+	return c.Conn.Close()
+}
+
+// ServeCompressedProxy accepts compressed connections on the listener and
+// relays them in plain to the P2P port of the node, so a standard ELA node
+// serves the compressed transport. It returns when the listener is closed.
+func ServeCompressedProxy(listener net.Listener, node string) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go relayCompressed(newCompressedConn(conn), node)
+	}
+}
+
+func relayCompressed(client net.Conn, node string) {
+	defer client.Close()
+
+	remote, err := net.DialTimeout("tcp", node, time.Second*ConnTimeOut)
+	if err != nil {
+		log.Error("Compressed proxy connect to node ", node, " failed, err", err)
+		return
+	}
+	defer remote.Close()
+
+	// Stop relaying when either side is closed
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,133 @@
+package net
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net"
+	"testing"
+)
+
+var compressionMessages = [][]byte{
+	[]byte("version"),
+	bytes.Repeat([]byte("headers"), 1000),
+	{},
+	bytes.Repeat([]byte{0}, 64*1024),
+	[]byte("ping"),
+}
+
+func TestCompressedConn(t *testing.T) {
+	local, remote := net.Pipe()
+	client, server := newCompressedConn(local), newCompressedConn(remote)
+	defer client.Close()
+	defer server.Close()
+
+	// Both directions at the same time, a pipe blocks writes until they are read
+	errs := make(chan error, 2)
+	send := func(conn *compressedConn) {
+		for _, msg := range compressionMessages {
+			if _, err := conn.Write(msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}
+	receive := func(name string, conn *compressedConn) {
+		for i, msg := range compressionMessages {
+			buf := make([]byte, len(msg))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatalf("%s: read message %d failed: %v", name, i, err)
+			}
+			if !bytes.Equal(buf, msg) {
+				t.Errorf("%s: message %d differs", name, i)
+			}
+		}
+	}
+	go send(client)
+	go send(server)
+	receive("server", server)
+	receive("client", client)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+}
+
+func TestCompressedWireFormat(t *testing.T) {
+	local, remote := net.Pipe()
+	client := newCompressedConn(local)
+	defer client.Close()
+	defer remote.Close()
+
+	msg := bytes.Repeat([]byte("inv"), 1000)
+	go client.Write(msg)
+
+	// The write ends with the sync flush marker, then a plain deflate reader
+	// decodes the message from the raw bytes
+	var wire bytes.Buffer
+	buf := make([]byte, 1024)
+	for !bytes.HasSuffix(wire.Bytes(), []byte{0, 0, 0xff, 0xff}) {
+		n, err := remote.Read(buf)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		wire.Write(buf[:n])
+	}
+	if wire.Len() >= len(msg) {
+		t.Errorf("%d bytes on the wire for a %d bytes message", wire.Len(), len(msg))
+	}
+
+	decoded := make([]byte, len(msg))
+	if _, err := io.ReadFull(flate.NewReader(&wire), decoded); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(decoded, msg) {
+		t.Errorf("decoded message differs")
+	}
+}
+
+func TestCompressedProxy(t *testing.T) {
+	// The node echoes what it receives in plain
+	node, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	go func() {
+		conn, err := node.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	go ServeCompressedProxy(proxy, node.Addr().String())
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newCompressedConn(conn)
+	defer client.Close()
+
+	for i, msg := range compressionMessages {
+		if _, err := client.Write(msg); err != nil {
+			t.Fatalf("write message %d failed: %v", i, err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatalf("read message %d failed: %v", i, err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Errorf("message %d differs after the proxy", i)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package net
 
 import (
-	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,38 +11,145 @@ import (
 )
 
 const (
-	ConnTimeOut   = 5
-	RetryDuration = 15
-	MaxRetryCount = 5
+	ConnTimeOut      = 5
+	RetryDuration    = 15
+	MaxRetryDuration = 60 * 10
+	MaxRetryCount    = 5
 )
 
+/*
+ConnManager dials the outbound connections. A failed address is retried with an
+exponential backoff, from RetryDuration doubling up to MaxRetryDuration, and is
+discarded after MaxRetryCount failures unless it is a persistent peer added by
+AddPeer(), which are reconnected whenever they are dropped.
+*/
 type ConnManager struct {
 	sync.Mutex
 
-	connList  []string
-	retryList map[string]int
+	// Addresses being dialed or handshaking
+	connList []string
+	// Established outbound connections
+	outbound map[string]bool
+	// Dial failures of addresses, cleared once connected
+	failures map[string]*connFailure
+	// Addresses always kept connected
+	persistent map[string]bool
 
 	OnDiscardAddr func(add string)
 }
 
+type connFailure struct {
+	count   int
+	retryAt time.Time
+}
+
 func newConnManager(onDiscardAddr func(add string)) *ConnManager {
 	cm := new(ConnManager)
-	cm.retryList = make(map[string]int)
+	cm.outbound = make(map[string]bool)
+	cm.failures = make(map[string]*connFailure)
+	cm.persistent = make(map[string]bool)
 	cm.OnDiscardAddr = onDiscardAddr
 	return cm
 }
 
 func (cm *ConnManager) Connect(addr string) {
+	cm.connect(addr)
+}
+
+// Dial the address, returns false if it is connecting, connected,
+// banned or waiting for the backoff of the last failure
+func (cm *ConnManager) connect(addr string) bool {
 	cm.Lock()
 	defer cm.Unlock()
 
-	if cm.inConnList(addr) {
+	if cm.inConnList(addr) || cm.outbound[addr] {
 		log.Info("ConnManager addr in connection list,", addr)
-		return
+		return false
+	}
+	if failure, ok := cm.failures[addr]; ok && time.Now().Before(failure.retryAt) {
+		log.Debug("ConnManager addr is backing off,", addr)
+		return false
+	}
+	if pm.IsBanned(addr) {
+		log.Debug("ConnManager addr is banned,", addr)
+		return false
 	}
 
 	cm.connList = append(cm.connList, addr)
 	go cm.connectPeer(addr)
+	return true
+}
+
+// Add a persistent peer in host:port format, it is connected in the next round of
+// keeping connections, within InfoUpdateDuration seconds, and reconnected whenever dropped
+func (cm *ConnManager) AddPeer(addr string) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	cm.persistent[addr] = true
+}
+
+// Remove the persistent peer and disconnect it, returns false if not added
+func (cm *ConnManager) RemovePeer(addr string) bool {
+	cm.Lock()
+	ok := cm.persistent[addr]
+	delete(cm.persistent, addr)
+	cm.Unlock()
+
+	if !ok {
+		return false
+	}
+	for _, peer := range append(pm.ConnectedPeers(), pm.StandbyPeers()...) {
+		if peer.Addr().String() == addr {
+			pm.DisconnectPeerWithReason(peer, ReasonUnknown)
+		}
+	}
+	return true
+}
+
+// Get the addresses of the persistent peers
+func (cm *ConnManager) Peers() []string {
+	cm.Lock()
+	defer cm.Unlock()
+
+	addrs := make([]string, 0, len(cm.persistent))
+	for addr := range cm.persistent {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Number of established outbound connections
+func (cm *ConnManager) OutboundCount() int {
+	cm.Lock()
+	defer cm.Unlock()
+
+	return len(cm.outbound)
+}
+
+// Check if the address is an established outbound connection
+// and not a persistent peer
+func (cm *ConnManager) isChurnable(addr string) bool {
+	cm.Lock()
+	defer cm.Unlock()
+
+	return cm.outbound[addr] && !cm.persistent[addr]
+}
+
+// Number of addresses being dialed or handshaking
+func (cm *ConnManager) PendingCount() int {
+	cm.Lock()
+	defer cm.Unlock()
+
+	return len(cm.connList)
+}
+
+// Reconnect the persistent peers not connected
+func (cm *ConnManager) connectPersistent() {
+	for _, addr := range cm.Peers() {
+		cm.connect(addr)
+	}
 }
 
 func (cm *ConnManager) inConnList(addr string) bool {
@@ -54,24 +161,50 @@ func (cm *ConnManager) inConnList(addr string) bool {
 	return false
 }
 
-func (cm *ConnManager) removeAddrFromConnectingList(addr string) {
-	delete(cm.retryList, addr)
+func (cm *ConnManager) removeAddrFromConnectingList(addr string) bool {
 	for i, connAddr := range cm.connList {
 		if connAddr == addr {
 			cm.connList = append(cm.connList[:i], cm.connList[i+1:]...)
-			return
+			return true
 		}
 	}
+	return false
+}
+
+// The peer at the address is established, it is an outbound
+// connection if it was dialed, the dial failures are forgotten
+func (cm *ConnManager) established(addr string) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if cm.removeAddrFromConnectingList(addr) {
+		cm.outbound[addr] = true
+	}
+	delete(cm.failures, addr)
+}
+
+// The peer at the address is disconnected or failed to handshake
+func (cm *ConnManager) disconnected(addr string) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	cm.removeAddrFromConnectingList(addr)
+	delete(cm.outbound, addr)
 }
 
 func (cm *ConnManager) connectPeer(addr string) {
-	conn, err := net.DialTimeout("tcp", addr, time.Second*ConnTimeOut)
+	conn, err := pm.dial(addr, time.Second*ConnTimeOut)
 	if err != nil {
 		log.Error("Connect to addr ", addr, " failed, err", err)
 		cm.retry(addr)
 		return
 	}
 
+	// Compress the connection to trusted nodes
+	if pm.isCompressedAddr(addr) {
+		conn = newCompressedConn(conn)
+	}
+
 	// Start read msg from remote peer
 	remote := NewPeer(conn)
 	remote.SetState(p2p.HAND)
@@ -81,26 +214,33 @@ func (cm *ConnManager) connectPeer(addr string) {
 	go remote.Send(pm.local.NewVersionMsg())
 }
 
+// Record the dial failure, the address is dialed again after the backoff
+// when more peers are needed, or discarded if it failed too many times
 func (cm *ConnManager) retry(addr string) {
 	cm.Lock()
-	retryTimes, ok := cm.retryList[addr]
+	cm.removeAddrFromConnectingList(addr)
+	failure, ok := cm.failures[addr]
 	if !ok {
-		retryTimes = 0
-	} else {
-		retryTimes += 1
+		failure = new(connFailure)
+		cm.failures[addr] = failure
+	}
+	failure.count++
+	backoff := time.Second * MaxRetryDuration
+	if failure.count <= MaxRetryCount {
+		backoff = time.Second * RetryDuration << uint(failure.count-1)
+		if backoff > time.Second*MaxRetryDuration {
+			backoff = time.Second * MaxRetryDuration
+		}
 	}
-	log.Info("Put into retry queue, retry times:", retryTimes)
-	if retryTimes > MaxRetryCount {
-		cm.removeAddrFromConnectingList(addr)
-		cm.Unlock()
+	failure.retryAt = time.Now().Add(backoff)
+	count := failure.count
+	discard := failure.count > MaxRetryCount && !cm.persistent[addr]
+	cm.Unlock()
+
+	if discard {
 		// Discard useless address
 		cm.OnDiscardAddr(addr)
 		return
 	}
-	cm.retryList[addr] = retryTimes
-	cm.Unlock()
-
-	log.Info("Wait for retry ", addr)
-	time.Sleep(time.Second * RetryDuration)
-	cm.connectPeer(addr)
+	log.Info("Retry ", addr, " in ", backoff, ", failed times:", count)
 }
@@ -0,0 +1,65 @@
+package net
+
+import (
+	"fmt"
+	"net"
+)
+
+/*
+PeerDiversity is an aggregate of the connected and standby peers, counted by the
+network group, protocol version and service bits, so operators can tell when the
+peer set is dominated by one network or one kind of node, which makes eclipsing
+the wallet easier. User agents are not counted, the version message of ELA
+nodes does not carry one.
+*/
+type PeerDiversity struct {
+	Total int
+	// Peers per network group, the /16 subnet of IPv4 and /32 of IPv6
+	Subnets map[string]int
+	// Peers per protocol version
+	Versions map[uint32]int
+	// Peers per service bit set, a peer is counted once for each bit
+	Services map[uint64]int
+}
+
+// The largest number of peers in one network group, and the group
+func (d *PeerDiversity) LargestSubnet() (string, int) {
+	var largest string
+	var count int
+	for subnet, n := range d.Subnets {
+		if n > count || n == count && subnet < largest {
+			largest, count = subnet, n
+		}
+	}
+	return largest, count
+}
+
+// Get the diversity of the connected and standby peers
+func (pm *PeerManager) Diversity() *PeerDiversity {
+	diversity := &PeerDiversity{
+		Subnets:  make(map[string]int),
+		Versions: make(map[uint32]int),
+		Services: make(map[uint64]int),
+	}
+	for _, peer := range append(pm.ConnectedPeers(), pm.StandbyPeers()...) {
+		diversity.Total++
+		diversity.Subnets[networkGroup(peer.IP16())]++
+		diversity.Versions[peer.Version()]++
+		for bit := uint(0); bit < 64; bit++ {
+			if service := uint64(1) << bit; peer.Services()&service != 0 {
+				diversity.Services[service]++
+			}
+		}
+	}
+	return diversity
+}
+
+// Get the network group of the address, peers in the same group are likely
+// run by the same operator
+func networkGroup(ip16 [16]byte) string {
+	ip := net.IP(ip16[:])
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.0.0/16", ip4[0], ip4[1])
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(32, 128)), Mask: net.CIDRMask(32, 128)}).String()
+}
@@ -0,0 +1,71 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Resolve the DNS seeds again in this interval, so the addresses follow the seeders
+const DNSSeedInterval = time.Minute * 30
+
+// dnsSeeder resolves the DNS seed host names to peer addresses,
+// each seeder answers with the addresses of the nodes it crawled
+type dnsSeeder struct {
+	hosts []string
+	port  uint16
+}
+
+// Resolve all the seed host names, returns the deduplicated addresses
+func (s *dnsSeeder) resolve() []string {
+	known := make(map[string]bool)
+	var addrs []string
+	for _, host := range s.hosts {
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			log.Warn("Resolve DNS seed", host, "failed,", err)
+			continue
+		}
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip, fmt.Sprint(s.port))
+			if !known[addr] {
+				known[addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// Discover peers by the DNS seed host names, the resolved addresses are connected
+// instead of the static seeds, which are used again if no address is resolved.
+// This method should be called before PeerManager started.
+func (pm *PeerManager) SetDNSSeeds(hosts []string, port uint16) {
+	if len(hosts) == 0 {
+		pm.dnsSeeder = nil
+		return
+	}
+	pm.dnsSeeder = &dnsSeeder{hosts: hosts, port: port}
+}
+
+func (pm *PeerManager) seedFromDNS() {
+	if pm.dnsSeeder == nil {
+		return
+	}
+	// DNS queries would bypass the proxy and leak the seeders to the local resolver
+	if pm.proxy != nil {
+		log.Warn("DNS seeds are not resolved through the proxy, use the static seeds")
+		return
+	}
+
+	ticker := time.NewTicker(DNSSeedInterval)
+	defer ticker.Stop()
+	for {
+		addrs := pm.dnsSeeder.resolve()
+		log.Info("DNS seeds resolved", len(addrs), "addresses")
+		pm.addrManager.setDNSAddrs(addrs)
+		<-ticker.C
+	}
+}
@@ -0,0 +1,26 @@
+package net
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+// HandleMessageFunc handles a message received from the connected peer
+type HandleMessageFunc func(peer *Peer, msg Message) error
+
+// Middleware wraps the message handling pipeline, it can do things like
+// metrics, tracing, rate limit or replay capture before or after calling next,
+// or stop the message by not calling next.
+type Middleware func(next HandleMessageFunc) HandleMessageFunc
+
+// Register middleware to the message handling pipeline, middleware registered
+// first is called first. This method should be called before PeerManager started.
+func (pm *PeerManager) Use(middleware ...Middleware) {
+	pm.middleware = append(pm.middleware, middleware...)
+
+	// Build the pipeline, the last registered middleware wraps the handler first
+	handler := HandleMessageFunc(pm.dispatchMessage)
+	for i := len(pm.middleware) - 1; i >= 0; i-- {
+		handler = pm.middleware[i](handler)
+	}
+	pm.pipeline = handler
+}
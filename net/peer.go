@@ -5,6 +5,7 @@ import (
 	"net"
 	"strings"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
@@ -28,6 +29,10 @@ type Peer struct {
 	conn net.Conn
 
 	reader *MsgReader
+
+	// Set when the peer connection is hijacked by a RawConn, guarded by rawLock
+	rawLock sync.RWMutex
+	rawConn *RawConn
 }
 
 func (peer *Peer) String() string {
@@ -48,7 +53,7 @@ func NewPeer(conn net.Conn) *Peer {
 	peer := new(Peer)
 	peer.conn = conn
 	peer.ip16, peer.port = addrFromConn(conn)
-	peer.reader = NewMsgReader(conn, peer)
+	peer.reader = NewMsgReader(newBufferedConn(&throttledConn{conn}), peer)
 	return peer
 }
 
@@ -140,23 +145,42 @@ func (peer *Peer) Height() uint64 {
 	return peer.height
 }
 
+func (peer *Peer) getRawConn() *RawConn {
+	peer.rawLock.RLock()
+	defer peer.rawLock.RUnlock()
+
+	return peer.rawConn
+}
+
 func (peer *Peer) OnDecodeError(err error) {
+	if rawConn := peer.getRawConn(); rawConn != nil {
+		rawConn.onDecodeError(err)
+		return
+	}
+
 	switch err {
 	case ErrDisconnected:
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, ReasonRemoteClose)
 	case ErrUnmatchedMagic:
 		log.Error("Decode message error:", ErrUnmatchedMagic)
-		peer.Disconnect()
+		pm.DisconnectPeerWithReason(peer, ReasonHandshake)
 	default:
 		log.Error(err, ", peer id is: ", peer.ID())
 	}
 }
 
 func (peer *Peer) OnMakeMessage(cmd string) (Message, error) {
+	if rawConn := peer.getRawConn(); rawConn != nil {
+		return rawConn.onMakeMessage(cmd)
+	}
 	return pm.makeMessage(cmd)
 }
 
 func (peer *Peer) OnMessageDecoded(msg Message) {
+	if rawConn := peer.getRawConn(); rawConn != nil {
+		rawConn.onMessageDecoded(msg)
+		return
+	}
 	pm.handleMessage(peer, msg)
 }
 
@@ -169,16 +193,17 @@ func (peer *Peer) Send(msg Message) {
 		return
 	}
 
-	buf, err := BuildMessage(msg)
+	buf, err := encodeMessage(msg)
 	if err != nil {
 		log.Error("Serialize message failed, ", err)
 		return
 	}
+	defer releaseBuffer(buf)
 
-	_, err = peer.conn.Write(buf)
+	_, err = peer.conn.Write(buf.Bytes())
 	if err != nil {
 		log.Error("Error sending message to peer ", err)
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, ReasonRemoteClose)
 	}
 }
 
@@ -0,0 +1,140 @@
+package net
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+// DisconnectReason tells why a peer was disconnected
+type DisconnectReason int
+
+const (
+	ReasonUnknown DisconnectReason = iota
+	// The peer stopped responding, or requests to it timed out
+	ReasonStall
+	// The peer misbehaved, like sending invalid or unrequested data
+	ReasonMisbehave
+	// The ban score of the peer reached the threshold
+	ReasonBan
+	// The handshake failed, like an unsupported version or services
+	ReasonHandshake
+	// The connection was closed by the remote peer or failed to write
+	ReasonRemoteClose
+	// Another connection to the same peer replaced this one
+	ReasonDuplicate
+	// Extra peers disconnected when the connection limits lowered
+	ReasonPeerLimit
+	// The service is shutting down
+	ReasonShutdown
+	// An outbound connection rotated to a fresh address by the peer churn
+	ReasonChurn
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case ReasonStall:
+		return "stall"
+	case ReasonMisbehave:
+		return "misbehave"
+	case ReasonBan:
+		return "ban"
+	case ReasonHandshake:
+		return "handshake failure"
+	case ReasonRemoteClose:
+		return "remote close"
+	case ReasonDuplicate:
+		return "duplicate connection"
+	case ReasonPeerLimit:
+		return "peer limit"
+	case ReasonShutdown:
+		return "shutdown"
+	case ReasonChurn:
+		return "churn"
+	default:
+		return "unknown"
+	}
+}
+
+// PeerInfo is a snapshot of a peer for applications to display
+type PeerInfo struct {
+	ID       uint64
+	Addr     string
+	Version  uint32
+	Services uint64
+	Height   uint64
+	Relay    bool
+	// The peer is a sync peer or an active peer, otherwise a standby peer
+	Active bool
+}
+
+/*
+PeerListener is an interface to receive peer connection events.
+Call PeerManager.AddPeerListener() to register your callbacks.
+*/
+type PeerListener interface {
+	// A peer finished the handshake and is connected
+	OnPeerConnected(info PeerInfo)
+
+	// A peer is disconnected, including peers failed in the handshake
+	OnPeerDisconnected(info PeerInfo, reason DisconnectReason)
+}
+
+// Register a peer listener, multiple registration is supported.
+// This method should be called before PeerManager started.
+func (pm *PeerManager) AddPeerListener(listener PeerListener) {
+	pm.peerListeners = append(pm.peerListeners, listener)
+}
+
+func (pm *PeerManager) peerInfo(peer *Peer, active bool) PeerInfo {
+	return PeerInfo{
+		ID:       peer.ID(),
+		Addr:     peer.Addr().String(),
+		Version:  peer.Version(),
+		Services: peer.Services(),
+		Height:   peer.Height(),
+		Relay:    peer.Relay() == 1,
+		Active:   active,
+	}
+}
+
+func (pm *PeerManager) notifyPeerConnected(peer *Peer) {
+	info := pm.peerInfo(peer, pm.isActive(peer))
+	for _, listener := range pm.peerListeners {
+		go listener.OnPeerConnected(info)
+	}
+}
+
+func (pm *PeerManager) notifyPeerDisconnected(peer *Peer, active bool, reason DisconnectReason) {
+	info := pm.peerInfo(peer, active)
+	for _, listener := range pm.peerListeners {
+		go listener.OnPeerDisconnected(info, reason)
+	}
+}
+
+// Disconnect all peers, call it when the service is shutting down
+func (pm *PeerManager) DisconnectAll(reason DisconnectReason) {
+	for _, peer := range pm.StandbyPeers() {
+		pm.DisconnectPeerWithReason(peer, reason)
+	}
+	for _, peer := range pm.ConnectedPeers() {
+		pm.DisconnectPeerWithReason(peer, reason)
+	}
+}
+
+func (pm *PeerManager) isActive(peer *Peer) bool {
+	for _, active := range pm.ConnectedPeers() {
+		if active.ID() == peer.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// Peer not added to peer manager yet, like failed in the handshake
+func (pm *PeerManager) disconnectUnknown(peer *Peer, reason DisconnectReason) {
+	if peer.State() == INACTIVITY {
+		return
+	}
+	peer.Disconnect()
+	pm.connManager.disconnected(peer.Addr().String())
+	pm.notifyPeerDisconnected(peer, false, reason)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
@@ -14,6 +15,7 @@ import (
 
 const (
 	MinConnCount       = 4
+	MaxStandbyCount    = 2
 	InfoUpdateDuration = 5
 	KeepAliveTimeout   = 3
 	MaxOutboundCount   = 6
@@ -35,6 +37,13 @@ type MessageHandler interface {
 	HandleMessage(*Peer, Message) error
 }
 
+// PromoteHandler is an optional interface of MessageHandler, implement it to
+// prepare a standby peer promoted to active, like loading the current filter
+type PromoteHandler interface {
+	// A standby peer is promoted to active to replace a disconnected peer
+	OnPeerPromoted(*Peer)
+}
+
 var pm *PeerManager
 
 type PeerManager struct {
@@ -42,14 +51,48 @@ type PeerManager struct {
 	addrManager *AddrManager
 	connManager *ConnManager
 	msgHandler  MessageHandler
+	middleware  []Middleware
+	pipeline    HandleMessageFunc
+
+	// Connection limits, can be changed at runtime by SetConnLimits()
+	minConnCount    int32
+	maxStandbyCount int32
+
+	// Number of outbound connections to keep, set by SetTargetOutbound()
+	targetOutbound int32
+
+	// Connections to these addresses are compressed
+	compressedAddrs map[string]bool
+
+	// Do not relay addresses to peers, set by SetAddrGossip()
+	gossipDisabled int32
+
+	peerListeners []PeerListener
+
+	// Outbound connections are dialed through the proxy if set
+	proxy *Proxy
+
+	// Discover peers by DNS seeds if set
+	dnsSeeder *dnsSeeder
+
+	// Ban scores and banned hosts
+	banManager *banManager
+
+	// Interval of rotating an outbound connection in nanoseconds, 0 means never
+	churnInterval int64
 }
 
 func InitPeerManager(localPeer *Peer, seeds []string) *PeerManager {
 	// Initiate PeerManager
 	pm = new(PeerManager)
-	pm.Peers = newPeers(localPeer)
+	pm.Peers = newPeers(localPeer, pm.onPeerPromoted)
 	pm.addrManager = newAddrManager(seeds)
 	pm.connManager = newConnManager(pm.OnDiscardAddr)
+	pm.pipeline = pm.dispatchMessage
+	pm.minConnCount = MinConnCount
+	pm.maxStandbyCount = MaxStandbyCount
+	pm.targetOutbound = MaxOutboundCount
+	pm.banManager = newBanManager()
 	return pm
 }
 
@@ -59,12 +102,105 @@ func (pm *PeerManager) SetMessageHandler(msgHandler MessageHandler) {
 
 func (pm *PeerManager) Start() {
 	log.Info("PeerManager start")
+	go pm.seedFromDNS()
 	go pm.keepConnections()
 	go pm.listenConnection()
+	go pm.gossipAddrs()
+	go pm.churnPeers()
+}
+
+func (pm *PeerManager) onPeerPromoted(peer *Peer) {
+	log.Debug("Standby peer promoted to active:", peer)
+	if handler, ok := pm.msgHandler.(PromoteHandler); ok {
+		handler.OnPeerPromoted(peer)
+	}
 }
 
 func (pm *PeerManager) NeedMorePeers() bool {
-	return pm.PeersCount() < MinConnCount
+	return pm.PeersCount() < int(atomic.LoadInt32(&pm.minConnCount)) ||
+		pm.StandbyCount() < int(atomic.LoadInt32(&pm.maxStandbyCount))
+}
+
+// Set the number of active and standby peers to keep,
+// extra peers are disconnected except the sync peer
+func (pm *PeerManager) SetConnLimits(active, standby int) {
+	atomic.StoreInt32(&pm.minConnCount, int32(active))
+	atomic.StoreInt32(&pm.maxStandbyCount, int32(standby))
+
+	// Disconnect standby peers first, so disconnected active peers
+	// will not be replaced by standby peers
+	for _, peer := range pm.StandbyPeers() {
+		if pm.StandbyCount() <= standby {
+			break
+		}
+		pm.DisconnectPeerWithReason(peer, ReasonPeerLimit)
+	}
+	for _, peer := range pm.ConnectedPeers() {
+		if pm.PeersCount() <= active {
+			break
+		}
+		if pm.IsSyncPeer(peer) {
+			continue
+		}
+		pm.DisconnectPeerWithReason(peer, ReasonPeerLimit)
+	}
+}
+
+// Set the number of outbound connections to keep, dropped connections are replaced
+// by other addresses. More are dialed if the active and standby peers are not enough.
+func (pm *PeerManager) SetTargetOutbound(count int) {
+	atomic.StoreInt32(&pm.targetOutbound, int32(count))
+}
+
+// Get the connection manager, to add or remove persistent peers
+func (pm *PeerManager) ConnManager() *ConnManager {
+	return pm.connManager
+}
+
+// Set the trusted node addresses that support the compressed transport,
+// connections to them are compressed to reduce data usage.
+// This method should be called before PeerManager started.
+func (pm *PeerManager) SetCompressedAddrs(addrs []string) {
+	pm.compressedAddrs = make(map[string]bool)
+	for _, addr := range addrs {
+		pm.compressedAddrs[addr] = true
+	}
+}
+
+// Set the services bitfield advertised to peers in the version message,
+// 0 by default which means a pure client serving nothing.
+// This method should be called before PeerManager started.
+func (pm *PeerManager) SetServices(services uint64) {
+	pm.Local().SetServices(services)
+}
+
+// Do not use the cached addresses file, for the ephemeral mode writing nothing
+// to the working directory. This method should be called before PeerManager started.
+func (pm *PeerManager) DisableAddrCache() {
+	pm.addrManager.disableCache()
+}
+
+// Dial all outbound peer connections through the SOCKS5 proxy, nil means
+// dial directly. This method should be called before PeerManager started.
+func (pm *PeerManager) SetProxy(proxy *Proxy) {
+	pm.proxy = proxy
+}
+
+// Dial the peer address, through the proxy if set
+func (pm *PeerManager) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if pm.proxy != nil {
+		return pm.proxy.Dial(addr, timeout)
+	}
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+func (pm *PeerManager) isCompressedAddr(addr string) bool {
+	return pm.compressedAddrs[addr]
+}
+
+// Limit the total read bandwidth of all peers in bytes per second, 0 means unlimited
+func (pm *PeerManager) SetBandwidthLimit(bytesPerSecond int) {
+	bandwidth.setLimit(bytesPerSecond)
 }
 
 func (pm *PeerManager) ConnectPeer(addr string) {
@@ -73,30 +209,43 @@ func (pm *PeerManager) ConnectPeer(addr string) {
 
 func (pm *PeerManager) AddConnectedPeer(peer *Peer) {
 	log.Trace("PeerManager add connected peer:", peer)
-	// Add peer to list
-	pm.Peers.AddPeer(peer)
+	// Add peer to list, keep extra peers as standby when active peers are enough
+	if pm.PeersCount() < int(atomic.LoadInt32(&pm.minConnCount)) {
+		pm.Peers.AddPeer(peer)
+	} else {
+		pm.Peers.AddStandbyPeer(peer)
+	}
 
 	addr := peer.Addr().String()
 
 	// Remove addr from connecting list
-	pm.connManager.removeAddrFromConnectingList(addr)
+	pm.connManager.established(addr)
 
 	// Mark addr as connected
 	pm.addrManager.AddAddr(addr)
 }
 
 func (pm *PeerManager) DisconnectPeer(peer *Peer) {
+	pm.DisconnectPeerWithReason(peer, ReasonUnknown)
+}
+
+// Disconnect the peer, peer listeners are notified with the reason
+func (pm *PeerManager) DisconnectPeerWithReason(peer *Peer, reason DisconnectReason) {
 	if peer == nil {
 		return
 	}
-	log.Trace("PeerManager disconnect peer:", peer.String())
-	peer, ok := pm.RemovePeer(peer.ID())
-	if ok {
-		addr := peer.Addr().String()
-		peer.Disconnect()
-		pm.connManager.removeAddrFromConnectingList(addr)
-		pm.addrManager.DisconnectedAddr(addr)
+	log.Trace("PeerManager disconnect peer:", peer.String(), "reason:", reason)
+	active := pm.isActive(peer)
+	removed, ok := pm.RemovePeer(peer.ID())
+	if !ok {
+		pm.disconnectUnknown(peer, reason)
+		return
 	}
+	addr := removed.Addr().String()
+	removed.Disconnect()
+	pm.connManager.disconnected(addr)
+	pm.addrManager.DisconnectedAddr(addr)
+	pm.notifyPeerDisconnected(removed, active, reason)
 }
 
 func (pm *PeerManager) OnDiscardAddr(addr string) {
@@ -121,11 +270,33 @@ func (pm *PeerManager) RandAddrs() []Addr {
 	return addrs
 }
 
+// Number of outbound connections to dial, to reach the target
+// outbound count and to fill the active and standby peer slots
+func (pm *PeerManager) missingConns() int {
+	missing := int(atomic.LoadInt32(&pm.targetOutbound)) - pm.connManager.OutboundCount()
+	slots := int(atomic.LoadInt32(&pm.minConnCount)) + int(atomic.LoadInt32(&pm.maxStandbyCount)) -
+		pm.PeersCount() - pm.StandbyCount()
+	if slots > missing {
+		missing = slots
+	}
+	return missing - pm.connManager.PendingCount()
+}
+
 func (pm *PeerManager) connectPeers() {
-	if pm.NeedMorePeers() {
-		addrs := pm.addrManager.GetIdleAddrs(MaxOutboundCount)
-		for _, addr := range addrs {
-			go pm.ConnectPeer(addr)
+	pm.connManager.connectPersistent()
+
+	missing := pm.missingConns()
+	if missing <= 0 {
+		return
+	}
+	// Some idle addresses may be connecting or backing off, get more to choose from
+	addrs := pm.addrManager.GetIdleAddrs(missing + MaxOutboundCount)
+	for _, addr := range addrs {
+		if missing == 0 {
+			break
+		}
+		if pm.connManager.connect(addr) {
+			missing--
 		}
 	}
 }
@@ -154,6 +325,11 @@ func (pm *PeerManager) listenConnection() {
 			fmt.Println("Error accepting ", err.Error())
 			continue
 		}
+		if pm.IsBanned(conn.RemoteAddr().String()) {
+			log.Info("Refuse connection from banned peer", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
 		fmt.Printf("New peer connection accepted, remote: %s local: %s\n", conn.RemoteAddr(), conn.LocalAddr())
 
 		peer := NewPeer(conn)
@@ -180,22 +356,25 @@ func (pm *PeerManager) makeMessage(cmd string) (Message, error) {
 }
 
 func (pm *PeerManager) handleMessage(peer *Peer, msg Message) {
-	var err error
+	// Handle message through the middleware pipeline
+	err := pm.pipeline(peer, msg)
+	if err != nil {
+		log.Error("Handle message error,", err)
+	}
+}
+
+func (pm *PeerManager) dispatchMessage(peer *Peer, msg Message) error {
 	switch msg := msg.(type) {
 	case *Version:
-		err = pm.OnVersion(peer, msg)
+		return pm.OnVersion(peer, msg)
 	case *VerAck:
-		err = pm.OnVerAck(peer, msg)
+		return pm.OnVerAck(peer, msg)
 	case *AddrsReq:
-		err = pm.OnAddrsReq(peer, msg)
+		return pm.OnAddrsReq(peer, msg)
 	case *Addrs:
-		err = pm.OnAddrs(peer, msg)
+		return pm.OnAddrs(peer, msg)
 	default:
-		err = pm.msgHandler.HandleMessage(peer, msg)
-	}
-
-	if err != nil {
-		log.Error("Handle message error,", err)
+		return pm.msgHandler.HandleMessage(peer, msg)
 	}
 }
 
@@ -203,7 +382,7 @@ func (pm *PeerManager) OnVersion(peer *Peer, v *Version) error {
 	// Check if handshake with itself
 	if v.Nonce == pm.Local().ID() {
 		log.Error("SPV disconnect peer, peer handshake with itself")
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, ReasonHandshake)
 		pm.OnDiscardAddr(peer.Addr().String())
 		return errors.New("Peer handshake with itself")
 	}
@@ -218,6 +397,7 @@ func (pm *PeerManager) OnVersion(peer *Peer, v *Version) error {
 	if ok {
 		log.Trace("Reconnect peer ", v.Nonce)
 		knownPeer.Disconnect()
+		pm.notifyPeerDisconnected(knownPeer, false, ReasonDuplicate)
 	}
 
 	log.Info("Is known peer:", ok)
@@ -227,7 +407,7 @@ func (pm *PeerManager) OnVersion(peer *Peer, v *Version) error {
 
 	// Handle peer handshake
 	if err := pm.msgHandler.OnHandshake(v); err != nil {
-		pm.DisconnectPeer(peer)
+		pm.DisconnectPeerWithReason(peer, ReasonHandshake)
 		return err
 	}
 
@@ -261,6 +441,7 @@ func (pm *PeerManager) OnVerAck(peer *Peer, va *VerAck) error {
 
 	// Notify peer connected
 	pm.msgHandler.OnPeerEstablish(peer)
+	pm.notifyPeerConnected(peer)
 
 	if pm.NeedMorePeers() {
 		go peer.Send(new(AddrsReq))
@@ -13,14 +13,20 @@ type Peers struct {
 	peersLock *sync.RWMutex
 	local     *Peer
 	peers     map[uint64]*Peer
+	standby   map[uint64]*Peer
+
+	// Called with a standby peer promoted to active
+	onPromote func(*Peer)
 }
 
-func newPeers(localPeer *Peer) *Peers {
+func newPeers(localPeer *Peer, onPromote func(*Peer)) *Peers {
 	peers := new(Peers)
 	peers.local = localPeer
+	peers.onPromote = onPromote
 	peers.syncPeerLock = new(sync.Mutex)
 	peers.peersLock = new(sync.RWMutex)
 	peers.peers = make(map[uint64]*Peer)
+	peers.standby = make(map[uint64]*Peer)
 	return peers
 }
 
@@ -35,11 +41,23 @@ func (p *Peers) AddPeer(peer *Peer) {
 	p.peers[peer.ID()] = peer
 }
 
+// Add a connected but idle peer, standby peers will not be used to download
+// until an active peer disconnected and it is promoted to active.
+func (p *Peers) AddStandbyPeer(peer *Peer) {
+	p.peersLock.Lock()
+	defer p.peersLock.Unlock()
+
+	p.standby[peer.ID()] = peer
+}
+
 func (p *Peers) Exist(peer *Peer) bool {
 	p.peersLock.RLock()
 	defer p.peersLock.RUnlock()
 
 	_, ok := p.peers[peer.ID()]
+	if !ok {
+		_, ok = p.standby[peer.ID()]
+	}
 	return ok
 }
 
@@ -51,12 +69,43 @@ func (p *Peers) RemovePeer(id uint64) (*Peer, bool) {
 		p.syncPeer = nil
 	}
 
-	peer, ok := p.peers[id]
+	peer, ok := p.standby[id]
+	if ok {
+		delete(p.standby, id)
+		return peer, ok
+	}
+
+	peer, ok = p.peers[id]
 	delete(p.peers, id)
 
+	// Fill the active peer's place with a standby peer
+	if ok {
+		p.promoteStandby()
+	}
+
 	return peer, ok
 }
 
+func (p *Peers) promoteStandby() {
+	var best *Peer
+	for _, peer := range p.standby {
+		if peer.State() != ESTABLISH {
+			continue
+		}
+		if best == nil || peer.height > best.height {
+			best = peer
+		}
+	}
+
+	if best != nil {
+		delete(p.standby, best.ID())
+		p.peers[best.ID()] = best
+		if p.onPromote != nil {
+			go p.onPromote(best)
+		}
+	}
+}
+
 func (p *Peers) PeersCount() int {
 	p.peersLock.RLock()
 	defer p.peersLock.RUnlock()
@@ -64,6 +113,13 @@ func (p *Peers) PeersCount() int {
 	return len(p.peers)
 }
 
+func (p *Peers) StandbyCount() int {
+	p.peersLock.RLock()
+	defer p.peersLock.RUnlock()
+
+	return len(p.standby)
+}
+
 func (p *Peers) ConnectedPeers() []*Peer {
 	p.peersLock.RLock()
 	defer p.peersLock.RUnlock()
@@ -75,11 +131,25 @@ func (p *Peers) ConnectedPeers() []*Peer {
 	return peers
 }
 
+func (p *Peers) StandbyPeers() []*Peer {
+	p.peersLock.RLock()
+	defer p.peersLock.RUnlock()
+
+	peers := make([]*Peer, 0, len(p.standby))
+	for _, v := range p.standby {
+		peers = append(peers, v)
+	}
+	return peers
+}
+
 func (p *Peers) EstablishedPeer(id uint64) bool {
 	p.peersLock.RLock()
 	defer p.peersLock.RUnlock()
 
 	peer, ok := p.peers[id]
+	if !ok {
+		peer, ok = p.standby[id]
+	}
 	if !ok {
 		return false
 	}
@@ -117,11 +187,26 @@ func (p *Peers) getBestPeer() *Peer {
 }
 
 func (p *Peers) Broadcast(msg Message) {
+	p.BroadcastExcept(msg)
+}
+
+// Broadcast message to active peers except the given peers
+func (p *Peers) BroadcastExcept(msg Message, except ...*Peer) {
 	p.peersLock.RLock()
 	defer p.peersLock.RUnlock()
 
+	excluded := make(map[uint64]bool)
+	for _, peer := range except {
+		excluded[peer.ID()] = true
+	}
+
 	for _, peer := range p.peers {
 
+		// Skip excluded peer
+		if excluded[peer.ID()] {
+			continue
+		}
+
 		// Skip unestablished peer
 		if peer.State() != ESTABLISH {
 			continue
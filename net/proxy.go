@@ -0,0 +1,196 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socksVersion = 5
+
+	socksAuthNone     = 0
+	socksAuthPassword = 2
+	socksAuthRefused  = 0xff
+
+	socksCmdConnect = 1
+
+	socksAddrIPv4   = 1
+	socksAddrDomain = 3
+	socksAddrIPv6   = 4
+)
+
+var socksReplies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// Proxy is a SOCKS5 proxy, like Tor or a corporate proxy, peer connections are
+// dialed through it. Host names are sent to the proxy unresolved, so the DNS
+// resolution goes through the proxy too.
+type Proxy struct {
+	// The proxy address in host:port format
+	Addr string
+	// Username and password authentication, empty means no authentication
+	Username string
+	Password string
+}
+
+// The remote address of a connection dialed through the proxy,
+// it is the address dialed instead of the proxy address
+type proxiedAddr string
+
+func (addr proxiedAddr) Network() string { return "tcp" }
+func (addr proxiedAddr) String() string  { return string(addr) }
+
+type proxiedConn struct {
+	net.Conn
+	remote proxiedAddr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Dial the address through the proxy, the handshake must finish in the timeout
+func (proxy *Proxy) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid port " + portStr)
+	}
+
+	conn, err := net.DialTimeout("tcp", proxy.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	err = proxy.handshake(conn, host, uint16(port))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy %s: %s", proxy.Addr, err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &proxiedConn{Conn: conn, remote: proxiedAddr(addr)}, nil
+}
+
+func (proxy *Proxy) handshake(conn net.Conn, host string, port uint16) error {
+	// Negotiate the authentication method
+	methods := []byte{socksAuthNone}
+	if proxy.Username != "" {
+		methods = append(methods, socksAuthPassword)
+	}
+	_, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[0] != socksVersion {
+		return errors.New("unsupported socks version")
+	}
+	switch buf[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		err = proxy.authenticate(conn)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("no acceptable authentication method")
+	}
+
+	// Request to connect, host names are resolved by the proxy
+	request := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name too long")
+		}
+		request = append(request, socksAddrDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socksAddrIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socksAddrIPv6)
+		request = append(request, ip.To16()...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+
+	// Read the reply, the bound address is skipped
+	buf = make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		if int(buf[1]) < len(socksReplies) {
+			return errors.New(socksReplies[buf[1]])
+		}
+		return fmt.Errorf("unknown reply %d", buf[1])
+	}
+	var size int
+	switch buf[3] {
+	case socksAddrIPv4:
+		size = net.IPv4len
+	case socksAddrIPv6:
+		size = net.IPv6len
+	case socksAddrDomain:
+		_, err = io.ReadFull(conn, buf[:1])
+		if err != nil {
+			return err
+		}
+		size = int(buf[0])
+	default:
+		return errors.New("unknown bound address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+// Username and password authentication of RFC 1929
+func (proxy *Proxy) authenticate(conn net.Conn) error {
+	if len(proxy.Username) > 255 || len(proxy.Password) > 255 {
+		return errors.New("username or password too long")
+	}
+	request := []byte{1, byte(len(proxy.Username))}
+	request = append(request, proxy.Username...)
+	request = append(request, byte(len(proxy.Password)))
+	request = append(request, proxy.Password...)
+	_, err := conn.Write(request)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
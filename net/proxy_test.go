@@ -0,0 +1,139 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+type socksTest struct {
+	name  string
+	proxy Proxy
+	host  string
+	port  uint16
+	// The method chosen, the auth status and the reply of the proxy
+	method     byte
+	authStatus byte
+	reply      byte
+	boundType  byte
+	// The connect request expected, nil if the handshake fails before it
+	request []byte
+	ok      bool
+}
+
+// Answer the handshake as a SOCKS5 proxy, the connect request received is sent to requests
+func serveSocks(conn net.Conn, test socksTest, requests chan<- []byte) {
+	defer conn.Close()
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, buf[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{socksVersion, test.method})
+
+	switch test.method {
+	case socksAuthNone:
+	case socksAuthPassword:
+		// Version and username, then password
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, buf[1])); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, buf[0])); err != nil {
+			return
+		}
+		conn.Write([]byte{1, test.authStatus})
+		if test.authStatus != 0 {
+			return
+		}
+	default:
+		return
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	var size int
+	switch request[3] {
+	case socksAddrIPv4:
+		size = net.IPv4len
+	case socksAddrIPv6:
+		size = net.IPv6len
+	case socksAddrDomain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		request = append(request, buf[0])
+		size = int(buf[0])
+	}
+	rest := make([]byte, size+2)
+	if _, err := io.ReadFull(conn, rest); err != nil {
+		return
+	}
+	requests <- append(request, rest...)
+
+	reply := []byte{socksVersion, test.reply, 0, test.boundType}
+	switch test.boundType {
+	case socksAddrIPv4:
+		reply = append(reply, make([]byte, net.IPv4len)...)
+	case socksAddrIPv6:
+		reply = append(reply, make([]byte, net.IPv6len)...)
+	case socksAddrDomain:
+		reply = append(reply, 4, 'h', 'o', 's', 't')
+	}
+	conn.Write(append(reply, 0x4f, 0x72))
+}
+
+func TestProxyHandshake(t *testing.T) {
+	ipv6 := append([]byte{socksVersion, socksCmdConnect, 0, socksAddrIPv6}, net.ParseIP("::1").To16()...)
+	tests := []socksTest{
+		{name: "ipv4", host: "1.2.3.4", port: 20338, method: socksAuthNone, boundType: socksAddrIPv4,
+			request: []byte{socksVersion, socksCmdConnect, 0, socksAddrIPv4, 1, 2, 3, 4, 0x4f, 0x72}, ok: true},
+		{name: "host name resolved by proxy", host: "seed", port: 20338, method: socksAuthNone, boundType: socksAddrDomain,
+			request: []byte{socksVersion, socksCmdConnect, 0, socksAddrDomain, 4, 's', 'e', 'e', 'd', 0x4f, 0x72}, ok: true},
+		{name: "ipv6", host: "::1", port: 20338, method: socksAuthNone, boundType: socksAddrIPv6,
+			request: append(ipv6, 0x4f, 0x72), ok: true},
+		{name: "password", proxy: Proxy{Username: "user", Password: "pass"}, host: "1.2.3.4", port: 20338,
+			method: socksAuthPassword, boundType: socksAddrIPv4,
+			request: []byte{socksVersion, socksCmdConnect, 0, socksAddrIPv4, 1, 2, 3, 4, 0x4f, 0x72}, ok: true},
+		{name: "wrong password", proxy: Proxy{Username: "user", Password: "wrong"}, host: "1.2.3.4", port: 20338,
+			method: socksAuthPassword, authStatus: 1},
+		{name: "no acceptable method", host: "1.2.3.4", port: 20338, method: socksAuthRefused},
+		{name: "connection refused", host: "1.2.3.4", port: 20338, method: socksAuthNone, reply: 5,
+			boundType: socksAddrIPv4,
+			request:   []byte{socksVersion, socksCmdConnect, 0, socksAddrIPv4, 1, 2, 3, 4, 0x4f, 0x72}},
+	}
+	for _, test := range tests {
+		client, server := net.Pipe()
+		requests := make(chan []byte, 1)
+		go serveSocks(server, test, requests)
+
+		err := test.proxy.handshake(client, test.host, test.port)
+		client.Close()
+		if test.ok && err != nil {
+			t.Errorf("%s: handshake failed: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: handshake succeeded, want error", test.name)
+		}
+
+		var request []byte
+		select {
+		case request = <-requests:
+		default:
+		}
+		if !bytes.Equal(request, test.request) {
+			t.Errorf("%s: connect request %x, want %x", test.name, request, test.request)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package net
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+// RawConn is a low-level message read/write handle on an established peer
+// connection. Messages received from a hijacked peer will not be handled by
+// the SPV handlers, they are delivered to ReadMessage() instead.
+// It is used to prototype new p2p messages with the SDK's dialer and codec.
+type RawConn struct {
+	peer        *Peer
+	makeMessage func(cmd string) (Message, error)
+
+	closeOnce *sync.Once
+	done      chan struct{}
+	msgChan   chan Message
+	errChan   chan error
+}
+
+func newRawConn(peer *Peer, makeMessage func(cmd string) (Message, error)) *RawConn {
+	return &RawConn{
+		peer:        peer,
+		makeMessage: makeMessage,
+		closeOnce:   new(sync.Once),
+		done:        make(chan struct{}),
+		msgChan:     make(chan Message, 10),
+		errChan:     make(chan error, 1),
+	}
+}
+
+// Get the hijacked peer
+func (conn *RawConn) Peer() *Peer {
+	return conn.peer
+}
+
+// Read the next message received from the peer, this method blocks
+// until a message received or the connection closed
+func (conn *RawConn) ReadMessage() (Message, error) {
+	select {
+	case msg := <-conn.msgChan:
+		return msg, nil
+	case err := <-conn.errChan:
+		return nil, err
+	case <-conn.done:
+		return nil, ErrDisconnected
+	}
+}
+
+// Write a message to the peer
+func (conn *RawConn) WriteMessage(msg Message) error {
+	if conn.peer.State() == INACTIVITY {
+		return ErrDisconnected
+	}
+
+	buf, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(buf)
+
+	_, err = conn.peer.conn.Write(buf.Bytes())
+	return err
+}
+
+// Close the raw connection and disconnect the peer
+func (conn *RawConn) Close() {
+	conn.peer.Disconnect()
+	conn.close()
+}
+
+func (conn *RawConn) close() {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+		pm.connManager.disconnected(conn.peer.Addr().String())
+		pm.addrManager.DisconnectedAddr(conn.peer.Addr().String())
+	})
+}
+
+func (conn *RawConn) onMakeMessage(cmd string) (Message, error) {
+	// Use the given message maker first, then the standard ones
+	msg, err := conn.makeMessage(cmd)
+	if err != nil {
+		return pm.makeMessage(cmd)
+	}
+	return msg, nil
+}
+
+func (conn *RawConn) onMessageDecoded(msg Message) {
+	select {
+	case conn.msgChan <- msg:
+	case <-conn.done:
+	}
+}
+
+func (conn *RawConn) onDecodeError(err error) {
+	switch err {
+	case ErrDisconnected:
+		conn.close()
+	case ErrUnmatchedMagic:
+		log.Error("Raw connection decode message error:", ErrUnmatchedMagic)
+		conn.Close()
+	default:
+		select {
+		case conn.errChan <- err:
+		default:
+		}
+	}
+}
+
+// Take over an established peer connection, the peer will be removed from
+// the peer manager, and messages received from it will be delivered to the
+// returned RawConn. makeMessage creates message instances by cmd, messages
+// it can not make will be created by the standard message maker. The raw
+// connection is set before the peer is removed, so no message received
+// meanwhile is handled by the SPV handlers.
+func (pm *PeerManager) HijackPeer(peer *Peer, makeMessage func(cmd string) (Message, error)) (*RawConn, error) {
+	if peer == nil {
+		return nil, errors.New("peer is nil")
+	}
+	if makeMessage == nil {
+		return nil, errors.New("makeMessage is nil")
+	}
+
+	peer.rawLock.Lock()
+	defer peer.rawLock.Unlock()
+
+	if peer.rawConn != nil {
+		return nil, errors.New("peer already hijacked")
+	}
+	if peer.State() != ESTABLISH {
+		return nil, errors.New("peer connection not established")
+	}
+	if pm.IsSyncPeer(peer) {
+		return nil, errors.New("can not hijack the sync peer")
+	}
+
+	conn := newRawConn(peer, makeMessage)
+	peer.rawConn = conn
+
+	_, ok := pm.RemovePeer(peer.ID())
+	if !ok {
+		peer.rawConn = nil
+		return nil, errors.New("peer not found in peer manager")
+	}
+
+	return conn, nil
+}
@@ -12,7 +12,8 @@ or get cached addresses list to build a bloom filter instead of load addresses f
 */
 type AddrFilter struct {
 	sync.Mutex
-	addrs map[Uint168]*Uint168
+	addrs     map[Uint168]*Uint168
+	templates []*ScriptTemplate
 }
 
 // Create a AddrFilter instance, you can pass all the addresses through this method
@@ -76,3 +77,32 @@ func (filter *AddrFilter) ContainAddr(hash Uint168) bool {
 	_, ok := filter.addrs[hash]
 	return ok
 }
+
+// Add a script template into this Filter to match scripts of a contract family
+func (filter *AddrFilter) AddTemplate(template *ScriptTemplate) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	filter.templates = append(filter.templates, template)
+}
+
+// Get script templates that were added into this Filter
+func (filter *AddrFilter) GetTemplates() []*ScriptTemplate {
+	filter.Lock()
+	defer filter.Unlock()
+
+	return filter.templates
+}
+
+// Check if a script matches any script template added into this Filter
+func (filter *AddrFilter) MatchTemplates(script []byte) bool {
+	filter.Lock()
+	defer filter.Unlock()
+
+	for _, template := range filter.templates {
+		if template.Match(script) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// Peers announcing best blocks within this many heights of each other are
+	// expected to be on the same chain
+	SplitHeightThreshold = 6
+	// Alert chain split when peers disagree longer than this duration in seconds,
+	// longer than a block interval, so a race of two blocks at the same height
+	// is settled by the next block before it is alerted
+	SplitAlertDuration = 300
+)
+
+/*
+AlertListener is an interface to receive alerts of abnormal network status.
+Call SPVService.AddAlertListener() to register your callbacks, services can
+pause irreversibility-sensitive actions when an alert is raised.
+*/
+type AlertListener interface {
+	// This method will be callback when connected peers at similar heights
+	// announce different best blocks for longer than the split alert duration,
+	// the announced blocks at the same height differ, or one is on the main chain
+	// and the other on a side chain.
+	OnChainSplitSuspected(tips []PeerTip)
+
+	// This method will be callback when a reorganize deeper than the finality depth
+	// is refused, call Blockchain.AcceptReorg() with the fork point to accept it.
+	OnReorgRefused(err *ReorgRefusedError)
+}
+
+// PeerTip is the best block announced by a connected peer, by inventory or headers
+type PeerTip struct {
+	PeerID uint64
+	Height uint64
+	Hash   Uint256
+}
+
+type splitDetector struct {
+	sync.Mutex
+	heightThreshold uint64
+	duration        time.Duration
+	// The last best block announced by each peer
+	tips    map[uint64]PeerTip
+	since   time.Time
+	alerted bool
+}
+
+func newSplitDetector() *splitDetector {
+	return &splitDetector{
+		heightThreshold: SplitHeightThreshold,
+		duration:        time.Second * SplitAlertDuration,
+		tips:            make(map[uint64]PeerTip),
+	}
+}
+
+// Set how close the heights of peers expected on the same chain are, and how long
+// they disagree before a chain split is alerted
+func (service *SPVServiceImpl) SetSplitAlert(heightThreshold uint32, duration time.Duration) {
+	service.splitDetector.Lock()
+	defer service.splitDetector.Unlock()
+
+	service.splitDetector.heightThreshold = uint64(heightThreshold)
+	service.splitDetector.duration = duration
+}
+
+// Record the best block announced by the peer, earlier blocks announced
+// later do not replace it
+func (d *splitDetector) announce(peer *net.Peer, height uint64, hash Uint256) {
+	d.Lock()
+	defer d.Unlock()
+
+	if tip, ok := d.tips[peer.ID()]; ok && tip.Height > height {
+		return
+	}
+	d.tips[peer.ID()] = PeerTip{PeerID: peer.ID(), Height: height, Hash: hash}
+}
+
+// Check the best blocks announced by the connected peers, returns the tips
+// of the connected peers when an alert should be raised. A block is on a side
+// chain if sideChain returns true for its hash.
+func (d *splitDetector) check(peers []*net.Peer, sideChain func(Uint256) bool) []PeerTip {
+	d.Lock()
+	defer d.Unlock()
+
+	// Forget the peers disconnected
+	connected := make(map[uint64]PeerTip, len(peers))
+	for _, peer := range peers {
+		if tip, ok := d.tips[peer.ID()]; ok {
+			connected[peer.ID()] = tip
+		}
+	}
+	d.tips = connected
+
+	var tips []PeerTip
+	for _, tip := range connected {
+		tips = append(tips, tip)
+	}
+	conflict, a, b := d.findConflict(tips, sideChain)
+
+	// Peers agree with each other, reset detector
+	if !conflict {
+		d.since = time.Time{}
+		d.alerted = false
+		return nil
+	}
+
+	if d.since.IsZero() {
+		d.since = time.Now()
+		log.Warnf("Peers announce different best blocks, peer %d %d %s, peer %d %d %s",
+			a.PeerID, a.Height, a.Hash.String(), b.PeerID, b.Height, b.Hash.String())
+	}
+
+	if d.alerted || time.Since(d.since) < d.duration {
+		return nil
+	}
+	d.alerted = true
+
+	return tips
+}
+
+// Find two tips of similar heights on different chains, the blocks at the same
+// height differ, or only one of them is on a side chain
+func (d *splitDetector) findConflict(tips []PeerTip, sideChain func(Uint256) bool) (bool, PeerTip, PeerTip) {
+	for i, a := range tips {
+		for _, b := range tips[i+1:] {
+			if a.Height > b.Height+d.heightThreshold || b.Height > a.Height+d.heightThreshold {
+				continue
+			}
+			if a.Height == b.Height && !a.Hash.IsEqual(b.Hash) {
+				return true, a, b
+			}
+			if sideChain(a.Hash) != sideChain(b.Hash) {
+				return true, a, b
+			}
+		}
+	}
+	return false, PeerTip{}, PeerTip{}
+}
@@ -0,0 +1,85 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestSplitDetector(t *testing.T) {
+	main, fork, side := Uint256{1}, Uint256{2}, Uint256{3}
+	sideChain := func(hash Uint256) bool { return hash == side }
+
+	type announcement struct {
+		peer   int
+		height uint64
+		hash   Uint256
+	}
+	tests := []struct {
+		name          string
+		announcements []announcement
+		conflict      bool
+	}{
+		{"same block", []announcement{{0, 100, main}, {1, 100, main}}, false},
+		{"different heights only", []announcement{{0, 100, main}, {1, 90, fork}}, false},
+		{"different blocks at same height", []announcement{{0, 100, main}, {1, 100, fork}}, true},
+		{"side chain at similar height", []announcement{{0, 100, main}, {1, 98, side}}, true},
+		{"side chain far below", []announcement{{0, 100, main}, {1, 50, side}}, false},
+		{"earlier block announced later", []announcement{{0, 100, main}, {1, 100, main}, {1, 99, fork}}, false},
+		{"block not announced", []announcement{{0, 100, main}}, false},
+	}
+	for _, test := range tests {
+		peers := []*net.Peer{new(net.Peer), new(net.Peer)}
+		for i, peer := range peers {
+			peer.SetID(uint64(i + 1))
+		}
+		detector := newSplitDetector()
+		detector.duration = 0
+		for _, a := range test.announcements {
+			detector.announce(peers[a.peer], a.height, a.hash)
+		}
+
+		tips := detector.check(peers, sideChain)
+		if conflict := tips != nil; conflict != test.conflict {
+			t.Errorf("%s: got conflict %v, want %v", test.name, conflict, test.conflict)
+			continue
+		}
+		// Alerted once until the peers agree again
+		if test.conflict && detector.check(peers, sideChain) != nil {
+			t.Errorf("%s: alerted twice", test.name)
+		}
+	}
+}
+
+func TestSplitDetectorDuration(t *testing.T) {
+	peers := []*net.Peer{new(net.Peer), new(net.Peer)}
+	for i, peer := range peers {
+		peer.SetID(uint64(i + 1))
+	}
+	noSideChain := func(Uint256) bool { return false }
+
+	detector := newSplitDetector()
+	detector.duration = time.Hour
+	detector.announce(peers[0], 100, Uint256{1})
+	detector.announce(peers[1], 100, Uint256{2})
+	if detector.check(peers, noSideChain) != nil {
+		t.Error("alerted before the duration")
+	}
+
+	// The next block settles the race
+	detector.announce(peers[0], 101, Uint256{4})
+	detector.announce(peers[1], 101, Uint256{4})
+	if detector.check(peers, noSideChain) != nil || !detector.since.IsZero() {
+		t.Error("agreeing peers not reset")
+	}
+
+	// Disconnected peers are forgotten
+	detector.announce(peers[1], 101, Uint256{5})
+	detector.check(peers[:1], noSideChain)
+	if _, ok := detector.tips[peers[1].ID()]; ok {
+		t.Error("tip of disconnected peer kept")
+	}
+}
@@ -0,0 +1,166 @@
+package sdk
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// The number of decimal places of an ELA amount
+	AmountDecimals = 8
+
+	// The number of sela in one ELA
+	SelaPerELA = 100000000
+)
+
+var (
+	// The result of an arithmetic operation on amounts overflows
+	ErrAmountOverflow = errors.New("amount overflow")
+
+	// The amount string is not a valid ELA amount
+	ErrInvalidAmount = errors.New("invalid amount, expect a number of ELA with at most 8 decimal places")
+)
+
+/*
+Amount is a value of ELA in sela, the smallest unit, one ELA is 100000000 sela.
+Use it to parse, format and calculate amounts instead of juggling raw int64 values,
+the arithmetic methods return ErrAmountOverflow instead of wrapping around.
+*/
+type Amount int64
+
+// Get the amount of a Fixed64 value, Fixed64 is in sela too
+func AmountOf(value Fixed64) Amount {
+	return Amount(value)
+}
+
+// Parse an amount from a decimal number of ELA like "1.5", it must not be negative,
+// more than 8 decimal places are refused instead of rounded
+func ParseAmount(str string) (Amount, error) {
+	str = strings.TrimSpace(str)
+	parts := strings.Split(str, ".")
+	if len(parts) > 2 || parts[0] == "" && (len(parts) == 1 || parts[1] == "") {
+		return 0, ErrInvalidAmount
+	}
+	for _, part := range parts {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, ErrInvalidAmount
+			}
+		}
+	}
+
+	var amount Amount
+	if parts[0] != "" {
+		ela, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || ela > math.MaxInt64/SelaPerELA {
+			return 0, ErrAmountOverflow
+		}
+		amount = Amount(ela * SelaPerELA)
+	}
+	if len(parts) == 2 && parts[1] != "" {
+		fraction := parts[1]
+		if len(fraction) > AmountDecimals {
+			return 0, ErrInvalidAmount
+		}
+		fraction += strings.Repeat("0", AmountDecimals-len(fraction))
+		sela, _ := strconv.ParseInt(fraction, 10, 64)
+		return amount.Add(Amount(sela))
+	}
+	return amount, nil
+}
+
+// Get the Fixed64 value of the amount, as used in transaction outputs
+func (a Amount) Fixed64() Fixed64 {
+	return Fixed64(a)
+}
+
+// Format the amount in ELA without trailing zeros, like "1.5"
+func (a Amount) String() string {
+	var buf bytes.Buffer
+	value := uint64(a)
+	if a < 0 {
+		buf.WriteByte('-')
+		value = uint64(-a)
+	}
+	buf.WriteString(strconv.FormatUint(value/SelaPerELA, 10))
+	if fraction := value % SelaPerELA; fraction > 0 {
+		str := strconv.FormatUint(fraction, 10)
+		buf.WriteByte('.')
+		buf.WriteString(strings.Repeat("0", AmountDecimals-len(str)))
+		buf.WriteString(strings.TrimRight(str, "0"))
+	}
+	return buf.String()
+}
+
+// Add the amounts, returns ErrAmountOverflow if the sum overflows
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, ErrAmountOverflow
+	}
+	return sum, nil
+}
+
+// Subtract the amount b from a, returns ErrAmountOverflow if the difference overflows
+func (a Amount) Sub(b Amount) (Amount, error) {
+	diff := a - b
+	if (b > 0 && diff > a) || (b < 0 && diff < a) {
+		return 0, ErrAmountOverflow
+	}
+	return diff, nil
+}
+
+// Multiply the amount by n, returns ErrAmountOverflow if the product overflows
+func (a Amount) Mul(n int64) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+	product := a * Amount(n)
+	if product/Amount(n) != a || (a == -1 && n == math.MinInt64) || (n == -1 && a == math.MinInt64) {
+		return 0, ErrAmountOverflow
+	}
+	return product, nil
+}
+
+// Sum the amounts, returns ErrAmountOverflow if the sum overflows
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var sum Amount
+	for _, amount := range amounts {
+		var err error
+		if sum, err = sum.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// FeeRate is a transaction fee rate in sela per KB, 1000 bytes
+type FeeRate Amount
+
+// Get the fee rate of the fee paid by a transaction of the size in bytes
+func FeeRateOf(fee Amount, size int) FeeRate {
+	if size <= 0 {
+		return 0
+	}
+	return FeeRate(int64(fee)/int64(size)*1000 + int64(fee)%int64(size)*1000/int64(size))
+}
+
+// Get the fee of a transaction of the size in bytes paying this rate,
+// returns ErrAmountOverflow if the fee overflows
+func (rate FeeRate) FeeForSize(size int) (Amount, error) {
+	fee, err := Amount(rate).Mul(int64(size))
+	if err != nil {
+		return 0, err
+	}
+	return fee / 1000, nil
+}
+
+// Format the fee rate in sela per KB
+func (rate FeeRate) String() string {
+	return strconv.FormatInt(int64(rate), 10) + " sela/KB"
+}
@@ -0,0 +1,125 @@
+package sdk
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		str    string
+		amount Amount
+		err    error
+	}{
+		{"integer", "2", 2 * SelaPerELA, nil},
+		{"fraction", "1.5", 150000000, nil},
+		{"smallest unit", "0.00000001", 1, nil},
+		{"no integer part", ".5", 50000000, nil},
+		{"no fraction part", "5.", 5 * SelaPerELA, nil},
+		{"spaces", " 2 ", 2 * SelaPerELA, nil},
+		{"max", "92233720368.54775807", math.MaxInt64, nil},
+		{"empty", "", 0, ErrInvalidAmount},
+		{"dot only", ".", 0, ErrInvalidAmount},
+		{"two dots", "1.2.3", 0, ErrInvalidAmount},
+		{"negative", "-1", 0, ErrInvalidAmount},
+		{"not a number", "abc", 0, ErrInvalidAmount},
+		{"too many decimals", "1.123456789", 0, ErrInvalidAmount},
+		{"integer overflow", "92233720369", 0, ErrAmountOverflow},
+		{"fraction overflow", "92233720368.54775808", 0, ErrAmountOverflow},
+	}
+	for _, test := range tests {
+		amount, err := ParseAmount(test.str)
+		if err != test.err {
+			t.Errorf("%s: parse %q got error %v, want %v", test.name, test.str, err, test.err)
+			continue
+		}
+		if amount != test.amount {
+			t.Errorf("%s: parse %q got %d, want %d", test.name, test.str, amount, test.amount)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		str    string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{SelaPerELA, "1"},
+		{150000000, "1.5"},
+		{-150000000, "-1.5"},
+		{math.MaxInt64, "92233720368.54775807"},
+		{math.MinInt64, "-92233720368.54775808"},
+	}
+	for _, test := range tests {
+		if str := test.amount.String(); str != test.str {
+			t.Errorf("amount %d: got %q, want %q", test.amount, str, test.str)
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	add := func(a, b Amount) func() (Amount, error) { return func() (Amount, error) { return a.Add(b) } }
+	sub := func(a, b Amount) func() (Amount, error) { return func() (Amount, error) { return a.Sub(b) } }
+	mul := func(a Amount, n int64) func() (Amount, error) { return func() (Amount, error) { return a.Mul(n) } }
+
+	tests := []struct {
+		name   string
+		op     func() (Amount, error)
+		result Amount
+		err    error
+	}{
+		{"add", add(1, 2), 3, nil},
+		{"add negative", add(1, -2), -1, nil},
+		{"add overflow", add(math.MaxInt64, 1), 0, ErrAmountOverflow},
+		{"add underflow", add(math.MinInt64, -1), 0, ErrAmountOverflow},
+		{"sub", sub(5, 7), -2, nil},
+		{"sub overflow", sub(math.MaxInt64, -1), 0, ErrAmountOverflow},
+		{"sub underflow", sub(math.MinInt64, 1), 0, ErrAmountOverflow},
+		{"mul", mul(3, -4), -12, nil},
+		{"mul zero", mul(math.MaxInt64, 0), 0, nil},
+		{"mul one", mul(math.MinInt64, 1), math.MinInt64, nil},
+		{"mul overflow", mul(math.MaxInt64, 2), 0, ErrAmountOverflow},
+		{"mul min by minus one", mul(-1, math.MinInt64), 0, ErrAmountOverflow},
+		{"min by minus one", mul(math.MinInt64, -1), 0, ErrAmountOverflow},
+	}
+	for _, test := range tests {
+		result, err := test.op()
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if result != test.result {
+			t.Errorf("%s: got %d, want %d", test.name, result, test.result)
+		}
+	}
+}
+
+func TestFeeRateOf(t *testing.T) {
+	tests := []struct {
+		name string
+		fee  Amount
+		size int
+		rate FeeRate
+	}{
+		{"one sela per byte", 226, 226, 1000},
+		{"higher rate", 1000, 250, 4000},
+		{"rounded down", 1, 3, 333},
+		{"large fee", math.MaxInt64, 1000, math.MaxInt64},
+		{"zero size", 1000, 0, 0},
+	}
+	for _, test := range tests {
+		if rate := FeeRateOf(test.fee, test.size); rate != test.rate {
+			t.Errorf("%s: got %d, want %d", test.name, rate, test.rate)
+		}
+	}
+
+	if fee, err := FeeRate(1000).FeeForSize(250); err != nil || fee != 250 {
+		t.Errorf("fee for size got %d, %v, want 250", fee, err)
+	}
+	if _, err := FeeRate(math.MaxInt64).FeeForSize(2); err != ErrAmountOverflow {
+		t.Errorf("fee for size overflow got %v, want %v", err, ErrAmountOverflow)
+	}
+}
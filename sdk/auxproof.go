@@ -0,0 +1,117 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+AuxProof is an auxiliary proof anchored to a main chain block header, for example
+a cross chain transaction proof verified by a side chain or a bridge service.
+Implement it for your own proof types, the anchoring header is provided by the
+header chain this package maintains.
+*/
+type AuxProof interface {
+	// The hash of the main chain block this proof is anchored to
+	BlockHash() Uint256
+
+	// Verify the proof against the anchoring block header
+	Verify(header *Header) error
+}
+
+/*
+AuxProofProvider fetches auxiliary proofs from a source like a full node RPC or
+a side chain node. Proofs from the provider are not trusted, they are verified
+with the header chain before returned.
+*/
+type AuxProofProvider interface {
+	// Get the proof by a key that the provider understands, like a transaction hash
+	GetAuxProof(key []byte) (AuxProof, error)
+}
+
+// TxProof proves a transaction is included in a main chain block
+type TxProof struct {
+	Proof bloom.MerkleProof
+	Tx    Transaction
+}
+
+func (p *TxProof) BlockHash() Uint256 {
+	return p.Proof.BlockHash
+}
+
+func (p *TxProof) Verify(header *Header) error {
+	// Check if merkleroot is match
+	merkleBlock := bloom.MerkleBlock{
+		Header:       *header,
+		Transactions: p.Proof.Transactions,
+		Hashes:       p.Proof.Hashes,
+		Flags:        p.Proof.Flags,
+	}
+	txIds, err := bloom.CheckMerkleBlock(merkleBlock)
+	if err != nil {
+		return errors.New("check merkle branch failed, " + err.Error())
+	}
+	if len(txIds) == 0 {
+		return errors.New("invalid transaction proof, no transactions found")
+	}
+
+	// Check if transaction hash is match
+	txHash := p.Tx.Hash()
+	for _, txId := range txIds {
+		if txId.IsEqual(txHash) {
+			return nil
+		}
+	}
+	return errors.New("transaction hash not match proof")
+}
+
+// Verify the proof is anchored to a block on the main chain, which has at
+// least the given confirmations, and the proof matches the block header
+func (bc *Blockchain) VerifyAuxProof(proof AuxProof, confirmations uint32) error {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	blockHash := proof.BlockHash()
+	header, err := bc.GetHeader(blockHash)
+	if err != nil {
+		return errors.New("can not get block from main chain")
+	}
+
+	tip := bc.chainTip()
+	if header.Height > tip.Height || tip.Height-header.Height+1 < confirmations {
+		return fmt.Errorf("block %s has not reached %d confirmations", blockHash.String(), confirmations)
+	}
+
+	// Walk back from the chain tip to make sure the block is not on a fork
+	ancestor := tip
+	for ancestor.Height > header.Height {
+		ancestor, err = bc.GetPrevious(ancestor)
+		if err != nil {
+			return err
+		}
+	}
+	if !ancestor.Hash().IsEqual(blockHash) {
+		return fmt.Errorf("block %s is not on the main chain", blockHash.String())
+	}
+
+	return proof.Verify(&header.Header)
+}
+
+// Request a proof from the provider and verify it with the header chain
+func (bc *Blockchain) RequestAuxProof(provider AuxProofProvider, key []byte, confirmations uint32) (AuxProof, error) {
+	proof, err := provider.GetAuxProof(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.VerifyAuxProof(proof, confirmations)
+	if err != nil {
+		return nil, err
+	}
+
+	return proof, nil
+}
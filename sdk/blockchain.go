@@ -1,10 +1,13 @@
 package sdk
 
 import (
+	"bytes"
 	"errors"
 	"math/big"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/db"
 	"github.com/elastos/Elastos.ELA.SPV/log"
@@ -45,6 +48,12 @@ type StateListener interface {
 	OnChainRollback(height uint32)
 }
 
+// TxExpiryListener is an optional interface of StateListener, implement it to
+// be notified when an unconfirmed transaction expired and it's inputs released.
+type TxExpiryListener interface {
+	OnTxExpired(txId Uint256)
+}
+
 /*
 Blockchain is the database of blocks, also when a new transaction or block commit,
 Blockchain will verify them with stored blocks.
@@ -54,22 +63,178 @@ type Blockchain struct {
 	state          ChainState
 	db.DataStore
 	stateListeners []StateListener
+
+	// Reorganizes deeper than finalityDepth are refused unless accepted
+	// by operator, zero means no limit
+	finalityDepth  uint32
+	acceptedReorgs map[Uint256]bool
+
+	// Transactions unconfirmed longer than txExpiry are expired,
+	// zero means never expire
+	txExpiry time.Duration
+
+	// The hash of the injected genesis header, nil if the first header is trusted from peers
+	genesis *Uint256
+
+	// Known blocks the chain must pass through, sorted by height
+	checkpoints []Checkpoint
+
+	// Consensus rules sorted by activation height
+	rules []Rules
+
+	// Set to 1 in catch-up mode, blocks without transactions are not
+	// notified to CatchUpListener
+	catchingUp int32
+
+	// Runs the notifications to state listeners
+	notifier notifyDispatcher
+
+	// Notifications collected under the lock, dispatched after it is released
+	pending []func()
+}
+
+// ReorgRefusedError is returned by CommitBlock when a reorganize is deeper
+// than the finality depth, call AcceptReorg() with the fork point to accept it
+type ReorgRefusedError struct {
+	ForkPoint  Uint256
+	ForkHeight uint32
+	TipHeight  uint32
+}
+
+func (e *ReorgRefusedError) Error() string {
+	return fmt.Sprintf("reorganize refused, fork point %s at height %d, wipe out %d blocks exceeds finality depth",
+		e.ForkPoint.String(), e.ForkHeight, e.TipHeight-e.ForkHeight)
 }
 
 // Create a instance of *Blockchain
 func NewBlockchain(dataStore db.DataStore) (*Blockchain, error) {
 	return &Blockchain{
-		lock:      new(sync.RWMutex),
-		state:     WAITING,
-		DataStore: dataStore,
+		lock:           new(sync.RWMutex),
+		state:          WAITING,
+		DataStore:      dataStore,
+		acceptedReorgs: make(map[Uint256]bool),
 	}, nil
 }
 
+// Set the max depth of reorganize that will be accepted automatically
+func (bc *Blockchain) SetFinalityDepth(depth uint32) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.finalityDepth = depth
+}
+
+// Set the duration after which an unconfirmed transaction is expired,
+// the data store must implement db.TxExpirer to support it
+func (bc *Blockchain) SetTxExpiry(expiry time.Duration) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.txExpiry = expiry
+}
+
+// Expire transactions unconfirmed longer than the expiry duration
+func (bc *Blockchain) ExpireTxs() error {
+	bc.lock.Lock()
+	defer bc.unlockAndNotify()
+
+	if bc.txExpiry == 0 {
+		return nil
+	}
+
+	expirer, ok := bc.DataStore.(db.TxExpirer)
+	if !ok {
+		return nil
+	}
+
+	txIds, err := expirer.ExpireTxs(time.Now().Add(-bc.txExpiry))
+	if err != nil {
+		return err
+	}
+
+	for _, txId := range txIds {
+		log.Info("Unconfirmed transaction expired:", txId.String())
+		bc.notifyTxExpired(txId)
+	}
+	return nil
+}
+
+// Accept the refused reorganize at the given fork point
+func (bc *Blockchain) AcceptReorg(forkPoint Uint256) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.acceptedReorgs[forkPoint] = true
+}
+
+// Inject the serialized genesis header, it is stored as the chain tip if the
+// headers store is empty, otherwise the store must be initialized with the same genesis header.
+func (bc *Blockchain) InitGenesis(data []byte) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	var header Header
+	err := header.Deserialize(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("invalid genesis header, " + err.Error())
+	}
+	if header.Height != 0 || !header.Previous.IsEqual(Uint256{}) {
+		return errors.New("invalid genesis header, height must be 0 and previous hash must be empty")
+	}
+	hash := header.Hash()
+
+	if _, err := bc.GetChainTip(); err == nil {
+		if _, err := bc.GetHeader(hash); err != nil {
+			return fmt.Errorf("headers store was not initialized with genesis header %s, reset it to use another network",
+				hash.String())
+		}
+		bc.genesis = &hash
+		return nil
+	}
+
+	genesis := &db.StoreHeader{Header: header, TotalWork: CalcWork(header.Bits)}
+	err = bc.PutHeader(genesis, true)
+	if err != nil {
+		return err
+	}
+	bc.DataStore.PutChainHeight(0)
+	bc.genesis = &hash
+
+	log.Info("Genesis header injected:", hash.String())
+	return nil
+}
+
 // Register a blockchain state listener, multiple registration is supported.
 func (bc *Blockchain) AddStateListener(listener StateListener) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
 	bc.stateListeners = append(bc.stateListeners, listener)
 }
 
+// Remove a registered state listener, notifications dispatched before are still delivered
+func (bc *Blockchain) RemoveStateListener(listener StateListener) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	// Copy the listeners, so notifications iterating the old slice are not affected
+	listeners := make([]StateListener, 0, len(bc.stateListeners))
+	for _, l := range bc.stateListeners {
+		if l != listener {
+			listeners = append(listeners, l)
+		}
+	}
+	bc.stateListeners = listeners
+}
+
+// Get the registered state listeners
+func (bc *Blockchain) listeners() []StateListener {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.stateListeners
+}
+
 // Close the blockchain
 func (bc *Blockchain) Close() {
 	bc.lock.Lock()
@@ -116,17 +281,54 @@ func (bc *Blockchain) chainTip() *db.StoreHeader {
 	return tip
 }
 
+// Check if the block is stored on the main chain, side chain blocks are not
+func (bc *Blockchain) IsOnMainChain(hash Uint256) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	header, err := bc.GetHeader(hash)
+	if err != nil {
+		return false
+	}
+	tip := bc.chainTip()
+	if header.Height > tip.Height {
+		return false
+	}
+
+	if finder, ok := bc.DataStore.(db.AncestorFinder); ok {
+		ancestor, err := finder.GetAncestor(tip, header.Height)
+		return err == nil && ancestor.IsEqual(hash)
+	}
+
+	ancestor := tip
+	for ancestor.Height > header.Height {
+		ancestor, err = bc.GetPrevious(ancestor)
+		if err != nil {
+			return false
+		}
+	}
+	return ancestor.Hash().IsEqual(hash)
+}
+
 // Create a block locator which is a array of block hashes stored in blockchain
 func (bc *Blockchain) GetBlockLocatorHashes() []*Uint256 {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
 
-	var ret []*Uint256
+	// Use the locator of data store if it has one
+	if locator, ok := bc.DataStore.(db.BlockLocator); ok {
+		return locator.GetBlockLocatorHashes()
+	}
+
 	parent, err := bc.GetChainTip()
 	if err != nil { // No headers stored return empty locator
-		return ret
+		return nil
 	}
 
+	// The hashes share one backing array instead of allocating one by one
+	hashes := make([]Uint256, MaxBlockLocatorHashes)
+	ret := make([]*Uint256, 0, MaxBlockLocatorHashes)
+
 	rollback := func(parent *db.StoreHeader, n int) (*db.StoreHeader, error) {
 		for i := 0; i < n; i++ {
 			parent, err = bc.GetPrevious(parent)
@@ -144,8 +346,8 @@ func (bc *Blockchain) GetBlockLocatorHashes() []*Uint256 {
 			step *= 2
 			start = 0
 		}
-		hash := parent.Hash()
-		ret = append(ret, &hash)
+		hashes[len(ret)] = parent.Hash()
+		ret = append(ret, &hashes[len(ret)])
 		if len(ret) >= MaxBlockLocatorHashes {
 			break
 		}
@@ -160,16 +362,124 @@ func (bc *Blockchain) GetBlockLocatorHashes() []*Uint256 {
 
 // Commit tx commits a transaction and return is false positive and error
 func (bc *Blockchain) CommitTx(tx Transaction) (bool, error) {
+	bc.lock.Lock()
+	defer bc.unlockAndNotify()
+
+	// Relayed transactions are to be confirmed in the next block
+	height := bc.chainTip().Height + 1
+	rules := bc.rulesAt(height)
+	if err := checkTxRules(&rules, &tx, height); err != nil {
+		return false, err
+	}
+
+	return bc.commitTx(tx, 0, 0)
+}
+
+// Store the connected headers validated by the header stage of the headers-first
+// sync, they become the chain tip when their blocks are committed
+func (bc *Blockchain) PutSyncHeaders(headers []Header) error {
 	bc.lock.Lock()
 	defer bc.lock.Unlock()
 
-	return bc.commitTx(tx, 0)
+	if len(headers) == 0 {
+		return nil
+	}
+	parent, err := bc.GetHeader(headers[0].Previous)
+	if err != nil {
+		return err
+	}
+	for _, header := range headers {
+		storeHeader := &db.StoreHeader{
+			Header:    header,
+			TotalWork: new(big.Int).Add(parent.TotalWork, CalcWork(header.Bits)),
+		}
+		err = bc.PutHeader(storeHeader, false)
+		if err != nil {
+			return err
+		}
+		parent = storeHeader
+	}
+	return nil
+}
+
+// Repair a corrupted header record with the header downloaded again
+func (bc *Blockchain) RepairHeader(header Header) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	repairHeader := &db.StoreHeader{Header: header}
+	parentHeader, err := bc.GetPrevious(repairHeader)
+	if err != nil {
+		return err
+	}
+	repairHeader.TotalWork = new(big.Int).Add(parentHeader.TotalWork, CalcWork(header.Bits))
+
+	tipHash := bc.chainTip().Hash()
+	return bc.PutHeader(repairHeader, tipHash.IsEqual(header.Hash()))
+}
+
+// Rewind the chain tip back to the given height, transactions committed above
+// it are rolled back, so the blocks will be downloaded and filtered again.
+func (bc *Blockchain) RewindTo(height uint32) error {
+	bc.lock.Lock()
+	defer bc.unlockAndNotify()
+
+	// Genesis block can not be rewind
+	if height == 0 {
+		height = 1
+	}
+
+	tip := bc.chainTip()
+	if tip.Height <= height {
+		return nil
+	}
+
+	header, err := bc.keptAncestor(tip, height)
+	if err != nil {
+		return err
+	}
+
+	err = bc.rollbackTo(header.Height)
+	if err != nil {
+		return err
+	}
+
+	return bc.PutHeader(header, true)
+}
+
+// Get the header on the main chain at the given height, or the nearest one below
+// it if the header is pruned. The ancestor is found by the height index of the
+// data store if it implements db.AncestorFinder, otherwise by walking back.
+func (bc *Blockchain) keptAncestor(tip *db.StoreHeader, height uint32) (*db.StoreHeader, error) {
+	finder, ok := bc.DataStore.(db.AncestorFinder)
+	if !ok {
+		var err error
+		header := tip
+		for header.Height > height {
+			header, err = bc.GetPrevious(header)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return header, nil
+	}
+
+	for ; height > 0; height-- {
+		hash, err := finder.GetAncestor(tip, height)
+		if err != nil {
+			return nil, err
+		}
+		if header, err := bc.GetHeader(*hash); err == nil {
+			return header, nil
+		}
+	}
+	return nil, errors.New("[Blockchain], No stored header to rewind to")
 }
 
 // Commit block commits a block and transactions with it, return is reorganize, false positives and error
 func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (bool, int, error) {
 	bc.lock.Lock()
-	defer bc.lock.Unlock()
+	defer bc.unlockAndNotify()
 
 	header := block.Header
 	commitHeader := &db.StoreHeader{Header: header}
@@ -178,6 +488,16 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 	tip := bc.chainTip()
 	tipHash := tip.Hash()
 
+	// Headers at a checkpoint height must be the checkpoint
+	if err := bc.checkCheckpoint(header.Hash(), header.Height); err != nil {
+		return false, 0, err
+	}
+
+	// The block must follow the consensus rules at its height
+	if err := bc.checkBlockRules(&header, txs); err != nil {
+		return false, 0, err
+	}
+
 	// Lookup of the parent header. Otherwise (ophan?) we need to fetch the parent.
 	// If the tip is also the parent of this header, then we can save a database read by skipping
 	var err error
@@ -187,9 +507,13 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 		parentHeader = tip
 	} else {
 		parentHeader, err = bc.GetPrevious(commitHeader)
+		if corrupted, ok := err.(*db.ErrCorruptedRecord); ok {
+			return false, 0, corrupted
+		}
 		if err != nil {
-			// If committing header is genesis header, make an empty parent header
-			if commitHeader.Height == 1 {
+			// If committing header is genesis header, make an empty parent header,
+			// when genesis header is injected, headers must extend it
+			if commitHeader.Height == 1 && bc.genesis == nil {
 				parentHeader = &db.StoreHeader{TotalWork: new(big.Int)}
 			} else {
 				return false, 0, fmt.Errorf("Header %s does not extend any known headers", header.Hash().String())
@@ -221,6 +545,21 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 				log.Errorf("error calculating common ancestor: %s", err.Error())
 				return false, 0, err
 			}
+			// Refuse reorganize below the last checkpoint passed by the chain tip
+			if checkpoint := bc.lastCheckpoint(tip.Height); checkpoint != nil && reorgPoint.Height < checkpoint.Height {
+				return false, 0, &CheckpointError{Checkpoint: *checkpoint, Hash: header.Hash(), Height: header.Height}
+			}
+			// Refuse reorganize deeper than finality depth unless it's accepted
+			forkPoint := reorgPoint.Hash()
+			if bc.finalityDepth > 0 && tip.Height-reorgPoint.Height > bc.finalityDepth &&
+				!bc.acceptedReorgs[forkPoint] {
+				return false, 0, &ReorgRefusedError{
+					ForkPoint:  forkPoint,
+					ForkHeight: reorgPoint.Height,
+					TipHeight:  tip.Height,
+				}
+			}
+			delete(bc.acceptedReorgs, forkPoint)
 			fmt.Printf("Reorganize At block %d, Wiped out %d blocks\n",
 				int(tip.Height), int(tip.Height-reorgPoint.Height))
 		}
@@ -244,18 +583,10 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 
 	fPositives := 0
 	if newTip {
-		// Save transactions
-		for _, tx := range txs {
-			fPositive, err := bc.commitTx(tx, header.Height)
-			if err != nil {
-				return reorg, 0, err
-			}
-			if fPositive {
-				fPositives++
-			}
+		fPositives, err = bc.commitBlockTxs(txs, header.Height, header.Timestamp)
+		if err != nil {
+			return reorg, 0, err
 		}
-		// Save current chain height
-		bc.DataStore.PutChainHeight(header.Height)
 	}
 
 	log.Debug("Commit header: ", commitHeader.Hash().String(), ", newTip: ", newTip)
@@ -273,8 +604,39 @@ func (bc *Blockchain) CommitBlock(block bloom.MerkleBlock, txs []Transaction) (b
 	return reorg, fPositives, nil
 }
 
-func (bc *Blockchain) commitTx(tx Transaction, height uint32) (bool, error) {
-	fPositive, err := bc.DataStore.CommitTx(db.NewStoreTx(tx, height))
+// Save the transactions and the height of a block, returns the number of false
+// positives. The changes are saved at once if the data store batches them.
+func (bc *Blockchain) commitBlockTxs(txs []Transaction, height, timestamp uint32) (fPositives int, err error) {
+	if batcher, ok := bc.DataStore.(db.Batcher); ok {
+		if err = batcher.BeginBatch(); err != nil {
+			return 0, err
+		}
+		defer func() {
+			if endErr := batcher.EndBatch(); err == nil {
+				err = endErr
+			}
+		}()
+	}
+
+	// Save transactions
+	for _, tx := range txs {
+		fPositive, err := bc.commitTx(tx, height, timestamp)
+		if err != nil {
+			return 0, err
+		}
+		if fPositive {
+			fPositives++
+		}
+	}
+	// Save current chain height
+	bc.DataStore.PutChainHeight(height)
+	return fPositives, nil
+}
+
+func (bc *Blockchain) commitTx(tx Transaction, height, timestamp uint32) (bool, error) {
+	storeTx := db.NewStoreTx(tx, height)
+	storeTx.Timestamp = timestamp
+	fPositive, err := bc.DataStore.CommitTx(storeTx)
 	if err != nil {
 		return false, err
 	}
@@ -345,21 +707,54 @@ func (bc *Blockchain) getCommonAncestor(bestHeader, prevTip *db.StoreHeader) (*d
 	}
 }
 
+// Notify the state listeners on a pool of workers instead of a goroutine per
+// notification, committing blocks waits when they fall behind, 0 means no pool
+func (bc *Blockchain) SetNotifyWorkers(workers int) {
+	bc.notifier.setWorkers(workers)
+}
+
+// Release the lock and dispatch the notifications collected under it, so a
+// dispatch waiting on a full queue or a listener calling back does not hold the chain
+func (bc *Blockchain) unlockAndNotify() {
+	pending := bc.pending
+	bc.pending = nil
+	bc.lock.Unlock()
+
+	for _, notify := range pending {
+		bc.notifier.dispatch(notify)
+	}
+}
+
 func (bc *Blockchain) notifyBlockCommitted(block bloom.MerkleBlock, txs []Transaction) {
+	quiet := len(txs) == 0 && atomic.LoadInt32(&bc.catchingUp) == 1
 	for _, listener := range bc.stateListeners {
-		go listener.OnBlockCommitted(block, txs)
+		if _, ok := listener.(CatchUpListener); ok && quiet {
+			continue
+		}
+		listener := listener
+		bc.pending = append(bc.pending, func() { listener.OnBlockCommitted(block, txs) })
 	}
 }
 
 func (bc *Blockchain) notifyTxCommitted(tx Transaction, height uint32) {
 	for _, listener := range bc.stateListeners {
-		go listener.OnTxCommitted(tx, height)
+		listener := listener
+		bc.pending = append(bc.pending, func() { listener.OnTxCommitted(tx, height) })
 	}
 }
 
 func (bc *Blockchain) notifyChainRollback(height uint32) {
 	for _, listener := range bc.stateListeners {
-		go listener.OnChainRollback(height)
+		listener := listener
+		bc.pending = append(bc.pending, func() { listener.OnChainRollback(height) })
+	}
+}
+
+func (bc *Blockchain) notifyTxExpired(txId Uint256) {
+	for _, listener := range bc.stateListeners {
+		if listener, ok := listener.(TxExpiryListener); ok {
+			bc.pending = append(bc.pending, func() { listener.OnTxExpired(txId) })
+		}
 	}
 }
 
@@ -384,8 +779,9 @@ func (bc *Blockchain) CheckProofOfWork(header Header) error {
 		return errors.New("[Blockchain], block target difficulty is too low.")
 	}
 
-	// The target difficulty must be less than the maximum allowed.
-	if target.Cmp(PowLimit) > 0 {
+	// The target difficulty must be less than the maximum allowed at the height.
+	rules := bc.RulesAt(header.Height)
+	if target.Cmp(rules.PowLimit()) > 0 {
 		return errors.New("[Blockchain], block target difficulty is higher than max of limit.")
 	}
 
@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// A listener blocking on the rollback notifications until released
+type blockingListener struct {
+	release chan struct{}
+}
+
+func (l *blockingListener) OnTxCommitted(tx Transaction, height uint32) {}
+
+func (l *blockingListener) OnBlockCommitted(bloom.MerkleBlock, []Transaction) {}
+
+func (l *blockingListener) OnChainRollback(height uint32) {
+	<-l.release
+}
+
+func TestNotifyAfterUnlock(t *testing.T) {
+	chain, err := NewBlockchain(db.NewMemDataStore(nil))
+	if err != nil {
+		t.Fatalf("create blockchain failed: %v", err)
+	}
+	listener := &blockingListener{release: make(chan struct{})}
+	defer close(listener.release)
+	chain.AddStateListener(listener)
+	chain.SetNotifyWorkers(1)
+
+	// Fill the notify queue, the dispatch waits on the blocked listener
+	chain.lock.Lock()
+	for height := uint32(0); height < NotifyJobsPerWorker+2; height++ {
+		chain.notifyChainRollback(height)
+	}
+	go chain.unlockAndNotify()
+
+	callWithin(t, "dispatch on a full queue", func() {
+		chain.Height()
+		chain.AddStateListener(&blockingListener{})
+	})
+}
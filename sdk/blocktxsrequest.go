@@ -3,6 +3,9 @@ package sdk
 import (
 	"errors"
 	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
 
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
@@ -14,15 +17,74 @@ type BlockTxsRequest struct {
 	BlockHash      Uint256
 	Block          bloom.MerkleBlock
 	txRequestQueue map[Uint256]*Request
+	pending        []*Request
 	Txs            []Transaction
+	// The peer the block is received from, and when it is requested,
+	// the block is filtered by the filter of the peer at that time
+	peer *net.Peer
+	sent time.Time
+}
+
+func newBlockTxsRequest(peer *net.Peer, sent time.Time, block *bloom.MerkleBlock, requests []*Request, maxInFlight int) *BlockTxsRequest {
+	req := &BlockTxsRequest{
+		BlockHash:      block.Header.Hash(),
+		Block:          *block,
+		peer:           peer,
+		sent:           sent,
+		txRequestQueue: make(map[Uint256]*Request, len(requests)),
+		pending:        requests,
+		Txs:            make([]Transaction, 0, len(requests)),
+	}
+	for _, request := range requests {
+		req.txRequestQueue[request.hash] = request
+	}
+
+	// Start the first batch of requests
+	for i := 0; i < maxInFlight; i++ {
+		req.startNext()
+	}
+
+	return req
+}
+
+// Start the next pending request, requests already finished are skipped
+func (req *BlockTxsRequest) startNext() {
+	for len(req.pending) > 0 {
+		request := req.pending[0]
+		req.pending = req.pending[1:]
+		if _, ok := req.txRequestQueue[request.hash]; ok {
+			request.Start()
+			return
+		}
+	}
 }
 
+// Redirect the transaction request to another peer, returns false if the
+// transaction is not requested by this block
+func (req *BlockTxsRequest) Redirect(txId Uint256, peer *net.Peer) bool {
+	req.Lock()
+	defer req.Unlock()
+
+	request, ok := req.txRequestQueue[txId]
+	if !ok {
+		return false
+	}
+	request.Redirect(peer)
+	return true
+}
+
+// Finish the transaction requests not answered yet, it is guarded by the request
+// lock, as transactions may be received or redirected meanwhile
 func (req *BlockTxsRequest) Finish() {
+	req.Lock()
+	defer req.Unlock()
+
 	// Finish transaction requests
 	for hash, request := range req.txRequestQueue {
 		request.Finish()
 		delete(req.txRequestQueue, hash)
 	}
+	req.pending = nil
 }
 
 func (req *BlockTxsRequest) OnTxReceived(tx *Transaction) (bool, error) {
@@ -38,10 +100,13 @@ func (req *BlockTxsRequest) OnTxReceived(tx *Transaction) (bool, error) {
 	}
 
 	// Remove from map
-	txRequest.Finish()
+	txRequest.OnResponse()
 	delete(req.txRequestQueue, txId)
 
 	req.Txs = append(req.Txs, *tx)
 
+	// Keep the pipeline filled
+	req.startNext()
+
 	return len(req.txRequestQueue) == 0, nil
 }
@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Keep the announced transactions to serve getdata requests for this duration in minutes
+	BroadcastTxExpiry = 60
+	// Max number of announced transactions kept, the oldest is dropped when full
+	MaxBroadcastTxs = 100
+)
+
+type broadcastTx struct {
+	tx    core.Transaction
+	since time.Time
+}
+
+// broadcastPool keeps the transactions announced to peers by inventory, so they
+// are served when the peers request them by getdata
+type broadcastPool struct {
+	sync.Mutex
+	txs map[Uint256]*broadcastTx
+}
+
+func newBroadcastPool() *broadcastPool {
+	return &broadcastPool{txs: make(map[Uint256]*broadcastTx)}
+}
+
+func (p *broadcastPool) add(tx *core.Transaction) {
+	p.Lock()
+	defer p.Unlock()
+
+	var oldest *Uint256
+	for txId, broadcast := range p.txs {
+		if time.Since(broadcast.since) > time.Minute*BroadcastTxExpiry {
+			delete(p.txs, txId)
+			continue
+		}
+		if oldest == nil || broadcast.since.Before(p.txs[*oldest].since) {
+			id := txId
+			oldest = &id
+		}
+	}
+	if len(p.txs) >= MaxBroadcastTxs && oldest != nil {
+		delete(p.txs, *oldest)
+	}
+	p.txs[tx.Hash()] = &broadcastTx{tx: *tx, since: time.Now()}
+}
+
+func (p *broadcastPool) get(txId Uint256) (*core.Transaction, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	broadcast, ok := p.txs[txId]
+	if !ok || time.Since(broadcast.since) > time.Minute*BroadcastTxExpiry {
+		return nil, false
+	}
+	return &broadcast.tx, true
+}
+
+// Serve the announced transactions requested by peers, other data is not served
+func (service *SPVServiceImpl) OnGetData(peer *net.Peer, req *msg.DataReq) error {
+	if req.Type == p2p.TxData {
+		if tx, ok := service.broadcasts.get(req.Hash); ok {
+			log.Debug("Serve transaction", req.Hash.String(), "to peer", peer.ID())
+			go peer.Send(tx)
+			return nil
+		}
+	}
+	go peer.Send(msg.NewNotFound(req.Hash))
+	return nil
+}
@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+)
+
+// The chain tip older than CatchUpThreshold on startup means the service has
+// been offline for a long time, it syncs in catch-up mode until caught up
+const CatchUpThreshold = time.Hour * 24
+
+// In catch-up mode more peers are kept and more blocks are requested at once
+var catchUpLimits = syncLimits{net.MinConnCount * 2, net.MaxStandbyCount, MaxRequestsInFlight * 2, 0}
+
+// CatchUpListener is an optional interface of StateListener, implement it to
+// receive the catch-up progress instead of a notification per block. In catch-up
+// mode, OnBlockCommitted() is not called for blocks without transactions.
+type CatchUpListener interface {
+	// Called after each batch of blocks committed in catch-up mode, caughtUp
+	// is true on the last call when the chain height reached the best peer
+	OnCatchUpProgress(height, bestHeight uint32, caughtUp bool)
+}
+
+// Enter catch-up mode if the chain tip is far behind the wall-clock time
+func (service *SPVServiceImpl) checkCatchUp() {
+	tip := service.chain.ChainTip()
+	behind := time.Since(time.Unix(int64(tip.Timestamp), 0))
+	if behind < CatchUpThreshold {
+		return
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	// Do not override the limits of a background or paused profile
+	if service.syncProfile() != Foreground {
+		return
+	}
+	service.catchingUp = true
+	atomic.StoreInt32(&service.chain.catchingUp, 1)
+	service.applyLimits(catchUpLimits)
+
+	log.Infof("Chain tip is %s behind, enter catch-up mode", behind.Truncate(time.Minute))
+}
+
+// Return to normal mode when the chain height reached the best peer
+func (service *SPVServiceImpl) checkCaughtUp() {
+	service.Lock()
+	defer service.Unlock()
+
+	if !service.catchingUp || service.chain.IsSyncing() || service.needSync() ||
+		service.PeerManager().GetBestPeer() == nil {
+		return
+	}
+	service.catchingUp = false
+	atomic.StoreInt32(&service.chain.catchingUp, 0)
+	service.applyLimits(syncProfiles[service.syncProfile()])
+
+	log.Info("Caught up, return to normal mode")
+	service.notifyCatchUpProgress(true)
+}
+
+func (service *SPVServiceImpl) notifyCatchUpProgress(caughtUp bool) {
+	height := service.chain.Height()
+	var bestHeight = height
+	if bestPeer := service.PeerManager().GetBestPeer(); bestPeer != nil {
+		bestHeight = uint32(bestPeer.Height())
+	}
+
+	for _, listener := range service.chain.listeners() {
+		if listener, ok := listener.(CatchUpListener); ok {
+			go listener.OnCatchUpProgress(height, bestHeight, caughtUp)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sdk
+
+import (
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Peers serving compact block filters set this bit in the services of the version message
+const ServiceCFilters = 1 << 6
+
+// GetCFilter requests the compact filter of a block, the peer answers with a cfilter message
+type GetCFilter struct {
+	BlockHash Uint256
+}
+
+func (msg *GetCFilter) CMD() string {
+	return "getcfilter"
+}
+
+func (msg *GetCFilter) Serialize(w io.Writer) error {
+	return msg.BlockHash.Serialize(w)
+}
+
+func (msg *GetCFilter) Deserialize(r io.Reader) error {
+	return msg.BlockHash.Deserialize(r)
+}
+
+// CFilter is the compact filter of a block with the block header and the number of
+// transactions, so a block not matched can be committed without downloading it
+type CFilter struct {
+	Header       core.Header
+	Transactions uint32
+	Filter       GCSFilter
+}
+
+func (msg *CFilter) CMD() string {
+	return "cfilter"
+}
+
+func (msg *CFilter) Serialize(w io.Writer) error {
+	err := msg.Header.Serialize(w)
+	if err != nil {
+		return err
+	}
+	err = WriteUint32(w, msg.Transactions)
+	if err != nil {
+		return err
+	}
+	return msg.Filter.Serialize(w)
+}
+
+func (msg *CFilter) Deserialize(r io.Reader) error {
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	msg.Transactions, err = ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	return msg.Filter.Deserialize(r)
+}
+
+// The filter key is the first 16 bytes of the block hash
+func cfilterKey(blockHash Uint256) [16]byte {
+	var key [16]byte
+	copy(key[:], blockHash[:])
+	return key
+}
+
+// Build the compact filter of the block, for peers serving compact filters. Items are
+// the program hashes of the outputs and the outpoints spent by the inputs, the same
+// items a bloom filter is built with by BuildBloomFilter().
+func BuildBlockCFilter(block *core.Block) *CFilter {
+	var items [][]byte
+	for _, tx := range block.Transactions {
+		for _, output := range tx.Outputs {
+			items = append(items, output.ProgramHash.Bytes())
+		}
+		for _, input := range tx.Inputs {
+			items = append(items, input.Previous.Bytes())
+		}
+	}
+	return &CFilter{
+		Header:       block.Header,
+		Transactions: uint32(len(block.Transactions)),
+		Filter:       *BuildGCSFilter(cfilterKey(block.Hash()), items),
+	}
+}
+
+/*
+Sync by compact block filters instead of bloom filters with peers serving them. The
+filter of each block is downloaded and matched locally with the items returned by the
+elements method, the program hashes of the addresses and the outpoints of the wallet,
+and only the matched blocks are downloaded in full. No filter is loaded to these peers,
+so they do not learn the wallet addresses. Peers not serving compact filters are synced
+by bloom filters as before. Pass nil to disable, this method should be called before Start().
+*/
+func (service *SPVServiceImpl) SetCompactFilters(elements func() [][]byte) {
+	service.cfilterElements = elements
+}
+
+// Check if the peer is synced by compact filters
+func (service *SPVServiceImpl) usesCFilters(peer *net.Peer) bool {
+	return service.cfilterElements != nil && peer.Services()&ServiceCFilters != 0
+}
+
+func (service *SPVServiceImpl) OnCFilter(peer *net.Peer, cfilter *CFilter) error {
+	blockHash := cfilter.Header.Hash()
+	matched, err := cfilter.Filter.MatchAny(cfilterKey(blockHash), service.cfilterElements())
+	if err != nil {
+		service.misbehave(peer, "invalid compact filter, "+err.Error(), blockHash, ScoreInvalidBlock)
+		return err
+	}
+
+	if matched {
+		// Download the full block, it is sent as is since no filter is loaded
+		log.Debug("Compact filter matched, request block:", blockHash.String())
+		go peer.Send(msg.NewDataReq(p2p.BlockData, blockHash))
+		return nil
+	}
+
+	// Nothing in the block for the wallet, commit the header by a merkle block
+	// with the merkle root only, which matches no transaction
+	return service.OnMerkleBlock(peer, &bloom.MerkleBlock{
+		Header:       cfilter.Header,
+		Transactions: cfilter.Transactions,
+		Hashes:       []*Uint256{&cfilter.Header.MerkleRoot},
+		Flags:        []byte{0},
+	})
+}
+
+// A full block requested after its compact filter matched, the merkle block and
+// the matched transactions are made locally and handled like received from the peer
+func (service *SPVServiceImpl) OnBlock(peer *net.Peer, block *core.Block) error {
+	if !service.usesCFilters(peer) {
+		service.misbehave(peer, "unexpected block", block.Hash(), ScoreUnexpectedMsg)
+		return nil
+	}
+
+	merkleBlock, matched := bloom.NewMerkleBlock(block, service.getFilter())
+	err := service.OnMerkleBlock(peer, merkleBlock)
+	if err != nil {
+		return err
+	}
+	for _, index := range matched {
+		err = service.OnTxn(peer, block.Transactions[index])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
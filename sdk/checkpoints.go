@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Checkpoint is a known block of the main chain, synced chains must pass through it
+type Checkpoint struct {
+	Height uint32
+	Hash   Uint256
+}
+
+// Parse a checkpoint in "height:hash" format, the hash is parsed by ParseHash,
+// in the same byte order as printed by Uint256.String()
+func ParseCheckpoint(str string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	sep := strings.Index(str, ":")
+	if sep < 0 {
+		return checkpoint, errors.New("invalid checkpoint " + str + ", expect height:hash")
+	}
+
+	height, err := strconv.ParseUint(strings.TrimSpace(str[:sep]), 10, 32)
+	if err != nil {
+		return checkpoint, errors.New("invalid checkpoint height " + str[:sep])
+	}
+	hash, err := ParseHash(str[sep+1:])
+	if err != nil {
+		return checkpoint, errors.New("invalid checkpoint hash " + str[sep+1:])
+	}
+
+	checkpoint.Height = uint32(height)
+	checkpoint.Hash = *hash
+	return checkpoint, nil
+}
+
+// CheckpointError is returned when a header does not match the checkpoint
+// at its height, or a reorganize forks below a passed checkpoint
+type CheckpointError struct {
+	Checkpoint Checkpoint
+	Hash       Uint256
+	Height     uint32
+}
+
+func (e *CheckpointError) Error() string {
+	return fmt.Sprintf("header %s at height %d does not pass through checkpoint %s at height %d",
+		e.Hash.String(), e.Height, e.Checkpoint.Hash.String(), e.Checkpoint.Height)
+}
+
+// Set the checkpoints the chain must pass through, headers at a checkpoint height
+// must have the checkpoint hash, and reorganizes below the last checkpoint passed by
+// the chain tip are refused. The proof of work below the last checkpoint is not checked.
+func (bc *Blockchain) SetCheckpoints(checkpoints []Checkpoint) {
+	sorted := make([]Checkpoint, len(checkpoints))
+	copy(sorted, checkpoints)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Height < sorted[j].Height })
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.checkpoints = sorted
+}
+
+// Check the header matches the checkpoint at its height
+func (bc *Blockchain) CheckCheckpoint(header Header) error {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.checkCheckpoint(header.Hash(), header.Height)
+}
+
+func (bc *Blockchain) checkCheckpoint(hash Uint256, height uint32) error {
+	index := sort.Search(len(bc.checkpoints), func(i int) bool { return bc.checkpoints[i].Height >= height })
+	if index < len(bc.checkpoints) && bc.checkpoints[index].Height == height &&
+		!bc.checkpoints[index].Hash.IsEqual(hash) {
+		return &CheckpointError{Checkpoint: bc.checkpoints[index], Hash: hash, Height: height}
+	}
+	return nil
+}
+
+// Check if the height is below the last checkpoint, so the header is
+// validated by the checkpoint instead of checking the proof of work
+func (bc *Blockchain) BelowCheckpoint(height uint32) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return len(bc.checkpoints) > 0 && height < bc.checkpoints[len(bc.checkpoints)-1].Height
+}
+
+// Get the last checkpoint at or below the height, nil if none
+func (bc *Blockchain) lastCheckpoint(height uint32) *Checkpoint {
+	index := sort.Search(len(bc.checkpoints), func(i int) bool { return bc.checkpoints[i].Height > height })
+	if index == 0 {
+		return nil
+	}
+	return &bc.checkpoints[index-1]
+}
@@ -0,0 +1,49 @@
+package sdk
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := Uint256{0x01, 0x02, 0x03, 31: 0xff}
+
+	tests := []struct {
+		name   string
+		str    string
+		height uint32
+		ok     bool
+	}{
+		{"printed hash", "1000:" + hash.String(), 1000, true},
+		{"spaces", " 1000 : " + hash.String() + " ", 1000, true},
+		{"upper case", "7:" + strings.ToUpper(hash.String()), 7, true},
+		{"no separator", hash.String(), 0, false},
+		{"invalid height", "x:" + hash.String(), 0, false},
+		{"negative height", "-1:" + hash.String(), 0, false},
+		{"short hash", "1000:" + hash.String()[2:], 0, false},
+		{"long hash", "1000:" + hash.String() + "00", 0, false},
+		{"invalid hex", "1000:" + strings.Repeat("zz", UINT256SIZE), 0, false},
+	}
+	for _, test := range tests {
+		checkpoint, err := ParseCheckpoint(test.str)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: parsed %q without error", test.name, test.str)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parse %q failed: %v", test.name, test.str, err)
+			continue
+		}
+		if checkpoint.Height != test.height {
+			t.Errorf("%s: height %d, want %d", test.name, checkpoint.Height, test.height)
+		}
+		// The parsed hash prints the same as the given one
+		if !checkpoint.Hash.IsEqual(hash) {
+			t.Errorf("%s: hash %s, want %s", test.name, checkpoint.Hash.String(), hash.String())
+		}
+	}
+}
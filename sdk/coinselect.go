@@ -0,0 +1,198 @@
+package sdk
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// Change below this value in sela costs about as much to spend later as it is
+	// worth at the fast fee rate, the default selector avoids creating it
+	DustChange = Fixed64(10000)
+
+	// The max number of branches the branch and bound selector tries for an exact match
+	MaxBranchAndBoundTries = 100000
+)
+
+// Names of the coin selection strategies in config and the command line
+const (
+	CoinSelectDefault        = "default"
+	CoinSelectLargestFirst   = "largest-first"
+	CoinSelectSmallestFirst  = "smallest-first"
+	CoinSelectBranchAndBound = "branch-and-bound"
+	CoinSelectRandom         = "random"
+)
+
+// CoinSelector chooses which outputs a transaction spends, the transaction builder
+// returns the value selected above the target to the spender as change
+type CoinSelector interface {
+	// Select outputs worth at least the target from the available ones,
+	// returns ErrInsufficientFunds if they are not enough
+	Select(available []*Spendable, target Fixed64) ([]*Spendable, error)
+}
+
+// The selector of the wallet when none is set in the wallet or config
+var DefaultCoinSelector CoinSelector = &DustAvoidingSelector{}
+
+// Get a coin selector by its strategy name, empty means the default
+func GetCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "", CoinSelectDefault:
+		return DefaultCoinSelector, nil
+	case CoinSelectLargestFirst:
+		return &LargestFirstSelector{}, nil
+	case CoinSelectSmallestFirst:
+		return &SmallestFirstSelector{}, nil
+	case CoinSelectBranchAndBound:
+		return &BranchAndBoundSelector{}, nil
+	case CoinSelectRandom:
+		return &RandomSelector{}, nil
+	}
+	return nil, errors.New("unknown coin selection " + name + ", use default, largest-first," +
+		" smallest-first, branch-and-bound or random")
+}
+
+// LargestFirstSelector spends the largest outputs first, for the fewest inputs and fees
+type LargestFirstSelector struct{}
+
+func (s *LargestFirstSelector) Select(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	return accumulate(sortSpendablesDesc(available), target)
+}
+
+// SmallestFirstSelector spends the smallest outputs first, consolidating small outputs
+type SmallestFirstSelector struct{}
+
+func (s *SmallestFirstSelector) Select(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	return accumulate(sortSpendables(available), target)
+}
+
+// RandomSelector spends outputs in random order, so the choice does not tell which
+// outputs belong to the same owner by their values
+type RandomSelector struct{}
+
+func (s *RandomSelector) Select(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	shuffled := make([]*Spendable, len(available))
+	for i, j := range rand.Perm(len(available)) {
+		shuffled[i] = available[j]
+	}
+	return accumulate(shuffled, target)
+}
+
+// BranchAndBoundSelector searches the outputs adding up to the target exactly,
+// so no change is created, or spends the largest first if there are none
+type BranchAndBoundSelector struct{}
+
+func (s *BranchAndBoundSelector) Select(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	if selected, ok := exactMatch(available, target); ok {
+		return selected, nil
+	}
+	return new(LargestFirstSelector).Select(available, target)
+}
+
+/*
+DustAvoidingSelector is the default selector. It spends the outputs adding up to the
+target exactly if there are some, otherwise the smallest first until the change is
+at least DustChange, so the wallet does not fill with outputs not worth spending.
+If all of them leave dust change, it is created anyway.
+*/
+type DustAvoidingSelector struct{}
+
+func (s *DustAvoidingSelector) Select(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	if selected, ok := exactMatch(available, target); ok {
+		return selected, nil
+	}
+
+	withChange, err := AmountOf(target).Add(AmountOf(DustChange))
+	if err != nil {
+		return nil, err
+	}
+	var selected []*Spendable
+	var value Amount
+	for _, spendable := range sortSpendables(available) {
+		selected = append(selected, spendable)
+		if value, err = value.Add(AmountOf(spendable.Value)); err != nil {
+			return nil, err
+		}
+		if value == AmountOf(target) || value >= withChange {
+			return selected, nil
+		}
+	}
+	if value < AmountOf(target) {
+		return nil, ErrInsufficientFunds
+	}
+	return selected, nil
+}
+
+// Spend the outputs in order until they are worth the target
+func accumulate(available []*Spendable, target Fixed64) ([]*Spendable, error) {
+	var selected []*Spendable
+	var value Amount
+	for _, spendable := range available {
+		selected = append(selected, spendable)
+		var err error
+		if value, err = value.Add(AmountOf(spendable.Value)); err != nil {
+			return nil, err
+		}
+		if value >= AmountOf(target) {
+			return selected, nil
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// Search the outputs adding up to the target exactly, depth first from the largest,
+// giving up after MaxBranchAndBoundTries branches
+func exactMatch(available []*Spendable, target Fixed64) ([]*Spendable, bool) {
+	sorted := sortSpendablesDesc(available)
+	// remaining[i] is the total value of sorted[i:]
+	remaining := make([]Fixed64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+
+	var selected []*Spendable
+	var tries int
+	var search func(i int, value Fixed64) bool
+	search = func(i int, value Fixed64) bool {
+		if value == target {
+			return true
+		}
+		if i == len(sorted) || value > target || value+remaining[i] < target || tries >= MaxBranchAndBoundTries {
+			return false
+		}
+		tries++
+
+		selected = append(selected, sorted[i])
+		if search(i+1, value+sorted[i].Value) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		// Leaving out an output and taking another of the same value is the same branch
+		next := i + 1
+		for next < len(sorted) && sorted[next].Value == sorted[i].Value {
+			next++
+		}
+		return search(next, value)
+	}
+
+	if target <= 0 || !search(0, 0) {
+		return nil, false
+	}
+	return selected, true
+}
+
+func sortSpendables(available []*Spendable) []*Spendable {
+	sorted := append([]*Spendable(nil), available...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+	return sorted
+}
+
+func sortSpendablesDesc(available []*Spendable) []*Spendable {
+	sorted := append([]*Spendable(nil), available...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value > sorted[j].Value })
+	return sorted
+}
@@ -0,0 +1,48 @@
+package sdk
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestCoinSelectors(t *testing.T) {
+	var available []*Spendable
+	for _, value := range []Fixed64{50000, 10000, 30000, 20000} {
+		available = append(available, &Spendable{Value: value})
+	}
+
+	tests := []struct {
+		name     string
+		selector CoinSelector
+		target   Fixed64
+		values   []Fixed64
+		err      error
+	}{
+		{"largest first", &LargestFirstSelector{}, 60000, []Fixed64{50000, 30000}, nil},
+		{"smallest first", &SmallestFirstSelector{}, 25000, []Fixed64{10000, 20000}, nil},
+		{"exact match", &BranchAndBoundSelector{}, 60000, []Fixed64{50000, 10000}, nil},
+		{"no exact match", &BranchAndBoundSelector{}, 55000, []Fixed64{50000, 30000}, nil},
+		{"dust avoiding exact", &DustAvoidingSelector{}, 40000, []Fixed64{30000, 10000}, nil},
+		// 10000+20000 leaves 5000 of dust change, one more output is spent
+		{"dust avoiding change", &DustAvoidingSelector{}, 25000, []Fixed64{10000, 20000, 30000}, nil},
+		{"not enough", &LargestFirstSelector{}, 110001, nil, ErrInsufficientFunds},
+		{"dust avoiding not enough", &DustAvoidingSelector{}, 110001, nil, ErrInsufficientFunds},
+	}
+	for _, test := range tests {
+		selected, err := test.selector.Select(available, test.target)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if len(selected) != len(test.values) {
+			t.Errorf("%s: selected %d outputs, want %d", test.name, len(selected), len(test.values))
+			continue
+		}
+		for i, spendable := range selected {
+			if spendable.Value != test.values[i] {
+				t.Errorf("%s: output %d is %d, want %d", test.name, i, spendable.Value, test.values[i])
+			}
+		}
+	}
+}
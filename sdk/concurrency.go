@@ -0,0 +1,90 @@
+package sdk
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Names of the concurrent subsystems in RuntimeStats
+const (
+	SubsystemVerifier = "verifier"
+	SubsystemRequests = "requests"
+	SubsystemNotify   = "notify"
+)
+
+// ConcurrencyConfig sizes the goroutine pools of the SPV service,
+// zero values keep the defaults
+type ConcurrencyConfig struct {
+	// Workers verifying transaction signatures, 0 means the number of CPUs
+	VerifyWorkers int
+	// Max transaction requests in flight per block, it caps the limits of the
+	// sync profiles, 0 means the profile limits
+	MaxRequestsInFlight int
+	// Workers notifying the state listeners, 0 means a goroutine per notification
+	NotifyWorkers int
+}
+
+// SubsystemStats reports the goroutines and the queue of a concurrent subsystem
+type SubsystemStats struct {
+	Name string
+	// Goroutines of the subsystem, working or waiting for work
+	Goroutines int
+	// Jobs waiting in the queue and its capacity, 0 capacity means no queue
+	QueueDepth    int
+	QueueCapacity int
+}
+
+// RuntimeStats is a snapshot of the goroutines of the process and the SPV service subsystems
+type RuntimeStats struct {
+	Goroutines int
+	Subsystems []SubsystemStats
+}
+
+func (service *SPVServiceImpl) SetConcurrency(config ConcurrencyConfig) {
+	service.Lock()
+	defer service.Unlock()
+
+	if config.VerifyWorkers != service.concurrency.VerifyWorkers {
+		service.verifier.Stop()
+		service.verifier = NewSigVerifier(config.VerifyWorkers)
+	}
+	service.chain.SetNotifyWorkers(config.NotifyWorkers)
+	service.concurrency = config
+
+	limits := syncProfiles[service.syncProfile()]
+	if service.catchingUp && service.syncProfile() == Foreground {
+		limits = catchUpLimits
+	}
+	service.applyLimits(limits)
+}
+
+func (service *SPVServiceImpl) RuntimeStats() RuntimeStats {
+	return RuntimeStats{
+		Goroutines: runtime.NumGoroutine(),
+		Subsystems: []SubsystemStats{
+			service.verifier.stats(),
+			service.queue.stats(),
+			service.chain.notifier.stats(),
+		},
+	}
+}
+
+func (v *SigVerifier) stats() SubsystemStats {
+	return SubsystemStats{
+		Name:          SubsystemVerifier,
+		Goroutines:    v.workers,
+		QueueDepth:    len(v.jobs),
+		QueueCapacity: cap(v.jobs),
+	}
+}
+
+// The goroutines are the requests waiting for their responses and the one
+// starting the queued block requests
+func (queue *RequestQueue) stats() SubsystemStats {
+	return SubsystemStats{
+		Name:          SubsystemRequests,
+		Goroutines:    int(atomic.LoadInt32(&queue.running)) + 1,
+		QueueDepth:    len(queue.hashesQueue),
+		QueueCapacity: cap(queue.hashesQueue),
+	}
+}
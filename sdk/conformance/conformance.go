@@ -0,0 +1,533 @@
+/*
+Package conformance connects to an ELA node and exercises the part of the peer to peer
+protocol the SPV service depends on, the handshake, ping, filterload, getblocks, merkle
+blocks with the filtered transactions and notfound. The results of several nodes can be
+written as a compatibility matrix, which helps node implementers to check their SPV
+support and wallet operators to validate their seeds before using them.
+*/
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	gonet "net"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+const DefaultTimeout = time.Second * 10
+
+// The names of the checks, in the order they run
+const (
+	CheckHandshake   = "handshake"
+	CheckSPVService  = "spv service"
+	CheckPing        = "ping"
+	CheckFilterLoad  = "filterload"
+	CheckGetBlocks   = "getblocks"
+	CheckMerkleBlock = "merkleblock"
+	CheckFilteredTxs = "filtered txs"
+	CheckNotFound    = "notfound"
+)
+
+type Status string
+
+const (
+	Pass Status = "PASS"
+	Fail Status = "FAIL"
+	// The check is not run, as the connection is closed or a check it depends on failed
+	Skip Status = "SKIP"
+)
+
+// Config of connecting to the nodes
+type Config struct {
+	// The peer to peer network id
+	Magic uint32
+	// Dial the nodes through the SOCKS5 proxy, optional
+	Proxy *net.Proxy
+	// Timeout of dialing and of waiting for each response, DefaultTimeout if zero
+	Timeout time.Duration
+	// The block locator of getblocks, optional. The first block announced is used to check
+	// the merkle blocks, the node starts from the genesis block if the locator is empty.
+	Locator []*Uint256
+}
+
+// Result of one check
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("[%s] %s: %s", r.Status, r.Check, r.Detail)
+}
+
+// Report is the results of all checks against one node
+type Report struct {
+	Node string
+	// The version and height announced by the node, zero if the handshake failed
+	Version uint32
+	Height  uint64
+	Results []*Result
+}
+
+// Check if all checks passed
+func (r *Report) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status != Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the result of the check by name, nil if not found
+func (r *Report) Result(check string) *Result {
+	for _, result := range r.Results {
+		if result.Check == check {
+			return result
+		}
+	}
+	return nil
+}
+
+type check struct {
+	name string
+	run  func(t *tester) (Status, string)
+}
+
+var checks = []check{
+	{CheckHandshake, (*tester).handshake},
+	{CheckSPVService, (*tester).spvService},
+	{CheckPing, (*tester).ping},
+	{CheckFilterLoad, (*tester).filterLoad},
+	{CheckGetBlocks, (*tester).getBlocks},
+	{CheckMerkleBlock, (*tester).merkleBlock},
+	{CheckFilteredTxs, (*tester).filteredTxs},
+	{CheckNotFound, (*tester).notFound},
+}
+
+// Run all checks against the node in host:port format. The p2p magic is set to the
+// config magic, so do not run it along with an SPV client of another network.
+func Run(node string, config *Config) *Report {
+	report := &Report{Node: node}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	p2p.Magic = config.Magic
+
+	var conn gonet.Conn
+	var err error
+	if config.Proxy != nil {
+		conn, err = config.Proxy.Dial(node, timeout)
+	} else {
+		conn, err = gonet.DialTimeout("tcp", node, timeout)
+	}
+	if err != nil {
+		report.Results = append(report.Results, &Result{
+			Check:  CheckHandshake,
+			Status: Fail,
+			Detail: "connect failed, " + err.Error(),
+		})
+		report.skip("not connected")
+		return report
+	}
+
+	t := &tester{session: newSession(conn, timeout), config: config, report: report}
+	defer t.session.close(nil)
+	go p2p.NewMsgReader(conn, t.session).Read()
+
+	for _, c := range checks {
+		if t.session.closed() {
+			report.skip("disconnected, " + t.session.err.Error())
+			break
+		}
+		status, detail := c.run(t)
+		report.Results = append(report.Results, &Result{Check: c.name, Status: status, Detail: detail})
+		if c.name == CheckHandshake && status != Pass {
+			report.skip("handshake failed")
+			break
+		}
+	}
+	return report
+}
+
+// Mark the checks not run skipped
+func (r *Report) skip(reason string) {
+	for _, c := range checks {
+		if r.Result(c.name) == nil {
+			r.Results = append(r.Results, &Result{Check: c.name, Status: Skip, Detail: reason})
+		}
+	}
+}
+
+// Write the results of the nodes as a table, a row for each node and a column
+// for each check, followed by the details of the checks not passed
+func WriteMatrix(w io.Writer, reports []*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"NODE", "VERSION", "HEIGHT"}
+	for _, c := range checks {
+		header = append(header, strings.ToUpper(c.name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, report := range reports {
+		row := []string{report.Node, fmt.Sprint(report.Version), fmt.Sprint(report.Height)}
+		for _, c := range checks {
+			status := Skip
+			if result := report.Result(c.name); result != nil {
+				status = result.Status
+			}
+			row = append(row, string(status))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		for _, result := range report.Results {
+			if result.Status == Fail {
+				_, err := fmt.Fprintln(w, report.Node, result)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tester runs the checks in sequence, later checks use the blocks found by earlier ones
+type tester struct {
+	session *session
+	config  *Config
+	report  *Report
+
+	filterLoaded bool
+	blockHash    *Uint256
+	block        *bloom.MerkleBlock
+	matched      []*Uint256
+}
+
+func (t *tester) handshake() (Status, string) {
+	version := new(msg.Version)
+	version.Version = sdk.ProtocolVersion
+	version.TimeStamp = uint32(time.Now().Unix())
+	version.Port = sdk.SPVClientPort
+	version.Nonce = rand.Uint64()
+	if err := t.session.send(version); err != nil {
+		return Fail, "send version failed, " + err.Error()
+	}
+
+	message, err := t.session.wait(func(m p2p.Message) bool {
+		_, ok := m.(*msg.Version)
+		return ok
+	})
+	if err != nil {
+		return Fail, "no version received, " + err.Error()
+	}
+	remote := message.(*msg.Version)
+	t.report.Version = remote.Version
+	t.report.Height = remote.Height
+	t.session.services = remote.Services
+
+	if err := t.session.send(new(msg.VerAck)); err != nil {
+		return Fail, "send verack failed, " + err.Error()
+	}
+	_, err = t.session.wait(func(m p2p.Message) bool {
+		_, ok := m.(*msg.VerAck)
+		return ok
+	})
+	if err != nil {
+		return Fail, "no verack received, " + err.Error()
+	}
+	return Pass, fmt.Sprint("version ", remote.Version, ", height ", remote.Height)
+}
+
+func (t *tester) spvService() (Status, string) {
+	if t.report.Version < sdk.ProtocolVersion {
+		return Fail, fmt.Sprint("protocol version ", t.report.Version, " is lower than ", sdk.ProtocolVersion)
+	}
+	if t.session.services/sdk.ServiveSPV&1 == 0 {
+		return Fail, fmt.Sprintf("spv service bit not set in services %#x", t.session.services)
+	}
+	return Pass, fmt.Sprintf("services %#x", t.session.services)
+}
+
+func (t *tester) ping() (Status, string) {
+	if err := t.session.ping(); err != nil {
+		return Fail, err.Error()
+	}
+	return Pass, "pong received"
+}
+
+// Load a filter matching everything, so all transactions of a block are relayed
+// and the merkle block can be compared with them
+func (t *tester) filterLoad() (Status, string) {
+	filter := &msg.FilterLoad{Filter: []byte{0xff}, HashFuncs: 1}
+	if err := t.session.send(filter); err != nil {
+		return Fail, "send filterload failed, " + err.Error()
+	}
+	// There is no response to filterload, the node must keep the connection
+	if err := t.session.ping(); err != nil {
+		return Fail, "connection lost after filterload, " + err.Error()
+	}
+	t.filterLoaded = true
+	return Pass, "filter accepted"
+}
+
+func (t *tester) getBlocks() (Status, string) {
+	locator := t.config.Locator
+	if len(locator) == 0 {
+		locator = []*Uint256{new(Uint256)}
+	}
+	if err := t.session.send(msg.NewBlocksReq(locator, Uint256{})); err != nil {
+		return Fail, "send getblocks failed, " + err.Error()
+	}
+
+	message, err := t.session.wait(func(m p2p.Message) bool {
+		inv, ok := m.(*msg.Inventory)
+		return ok && inv.Type == p2p.BlockData
+	})
+	if err != nil {
+		return Fail, "no block inventory received, " + err.Error()
+	}
+	inv := message.(*msg.Inventory)
+	if len(inv.Hashes) == 0 {
+		return Fail, "empty block inventory received"
+	}
+	t.blockHash = inv.Hashes[0]
+	return Pass, fmt.Sprint(len(inv.Hashes), " blocks announced")
+}
+
+func (t *tester) merkleBlock() (Status, string) {
+	if !t.filterLoaded || t.blockHash == nil {
+		return Skip, "no filter loaded or no block to request"
+	}
+	if err := t.session.send(msg.NewDataReq(p2p.BlockData, *t.blockHash)); err != nil {
+		return Fail, "send getdata failed, " + err.Error()
+	}
+
+	message, err := t.session.wait(func(m p2p.Message) bool {
+		switch m := m.(type) {
+		case *bloom.MerkleBlock:
+			return true
+		case *msg.NotFound:
+			return m.Hash.IsEqual(*t.blockHash)
+		}
+		return false
+	})
+	if err != nil {
+		return Fail, "no merkle block received, " + err.Error()
+	}
+	block, ok := message.(*bloom.MerkleBlock)
+	if !ok {
+		return Fail, "notfound received for announced block " + t.blockHash.String()
+	}
+	if hash := block.Header.Hash(); !hash.IsEqual(*t.blockHash) {
+		return Fail, "merkle block " + hash.String() + " received for block " + t.blockHash.String()
+	}
+	matched, err := bloom.CheckMerkleBlock(*block)
+	if err != nil {
+		return Fail, "invalid merkle block, " + err.Error()
+	}
+	// The filter matches everything, so do all transactions of the block
+	if uint32(len(matched)) != block.Transactions {
+		return Fail, fmt.Sprint(len(matched), " of ", block.Transactions,
+			" transactions matched by a filter matching everything")
+	}
+	t.block = block
+	t.matched = matched
+	return Pass, fmt.Sprint("height ", block.Header.Height, ", ", len(matched), " transactions matched")
+}
+
+// The matched transactions must follow the merkle block
+func (t *tester) filteredTxs() (Status, string) {
+	if t.block == nil {
+		return Skip, "no merkle block received"
+	}
+
+	pending := make(map[Uint256]bool, len(t.matched))
+	for _, hash := range t.matched {
+		pending[*hash] = true
+	}
+	for len(pending) > 0 {
+		message, err := t.session.wait(func(m p2p.Message) bool {
+			_, ok := m.(*core.Transaction)
+			return ok
+		})
+		if err != nil {
+			return Fail, fmt.Sprint(len(pending), " of ", len(t.matched),
+				" matched transactions not received, ", err)
+		}
+		hash := message.(*core.Transaction).Hash()
+		if !pending[hash] {
+			return Fail, "transaction " + hash.String() + " not matched by the merkle block received"
+		}
+		delete(pending, hash)
+	}
+	return Pass, fmt.Sprint(len(t.matched), " transactions received")
+}
+
+// Data the node does not have must be answered by notfound, without disconnecting
+func (t *tester) notFound() (Status, string) {
+	var hash Uint256
+	rand.Read(hash[:])
+	if err := t.session.send(msg.NewDataReq(p2p.TxData, hash)); err != nil {
+		return Fail, "send getdata failed, " + err.Error()
+	}
+
+	_, err := t.session.wait(func(m p2p.Message) bool {
+		notFound, ok := m.(*msg.NotFound)
+		return ok && notFound.Hash.IsEqual(hash)
+	})
+	if err != nil {
+		return Fail, "no notfound received for unknown transaction, " + err.Error()
+	}
+	if err := t.session.ping(); err != nil {
+		return Fail, "connection lost after notfound, " + err.Error()
+	}
+	return Pass, "unknown transaction answered by notfound"
+}
+
+// session is the connection to the node under test, pings from the node are
+// answered, other messages are delivered to the check waiting for them
+type session struct {
+	conn     gonet.Conn
+	timeout  time.Duration
+	services uint64
+
+	msgChan   chan p2p.Message
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func newSession(conn gonet.Conn, timeout time.Duration) *session {
+	return &session{
+		conn:    conn,
+		timeout: timeout,
+		msgChan: make(chan p2p.Message, 100),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *session) send(message p2p.Message) error {
+	buf, err := p2p.BuildMessage(message)
+	if err != nil {
+		return err
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err = s.conn.Write(buf)
+	return err
+}
+
+// Wait for a message accepted by the match function, other messages are dropped
+func (s *session) wait(match func(p2p.Message) bool) (p2p.Message, error) {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case message := <-s.msgChan:
+			if match(message) {
+				return message, nil
+			}
+		case <-s.done:
+			return nil, s.err
+		case <-timer.C:
+			return nil, fmt.Errorf("timeout after %s", s.timeout)
+		}
+	}
+}
+
+func (s *session) ping() error {
+	if err := s.send(msg.NewPing(0)); err != nil {
+		return err
+	}
+	_, err := s.wait(func(m p2p.Message) bool {
+		_, ok := m.(*msg.Pong)
+		return ok
+	})
+	return err
+}
+
+func (s *session) close(err error) {
+	s.closeOnce.Do(func() {
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		s.err = err
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *session) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *session) OnDecodeError(err error) {
+	switch err {
+	case p2p.ErrDisconnected:
+		s.close(errors.New("disconnected by node"))
+	case p2p.ErrUnmatchedMagic:
+		s.close(errors.New("unmatched network magic"))
+	}
+}
+
+func (s *session) OnMakeMessage(cmd string) (p2p.Message, error) {
+	var message p2p.Message
+	switch cmd {
+	case "version":
+		message = new(msg.Version)
+	case "verack":
+		message = new(msg.VerAck)
+	case "ping":
+		message = new(msg.Ping)
+	case "pong":
+		message = new(msg.Pong)
+	case "inv":
+		message = new(msg.Inventory)
+	case "tx":
+		message = new(core.Transaction)
+	case "merkleblock":
+		message = new(bloom.MerkleBlock)
+	case "notfound":
+		message = new(msg.NotFound)
+	default:
+		return nil, errors.New("unsupported message " + cmd)
+	}
+	return message, nil
+}
+
+func (s *session) OnMessageDecoded(message p2p.Message) {
+	if _, ok := message.(*msg.Ping); ok {
+		go s.send(msg.NewPong(0))
+		return
+	}
+	select {
+	case s.msgChan <- message:
+	case <-s.done:
+	}
+}
@@ -0,0 +1,166 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+/*
+downloadScheduler spreads the block requests of a sync round across the connected
+peers instead of the sync peer only. A block is requested from the peer with the
+fewest blocks in flight, and its transactions from the same peer, as they are
+matched by the filter on that peer. A stalled request is assigned to another peer.
+Peers only add the outpoints of the transactions they matched to their filters, so
+when a committed block has wallet transactions, the filter is reloaded on all peers
+and the blocks requested from the other peers before the reload are requested again.
+*/
+type downloadScheduler struct {
+	sync.Mutex
+	// Get the peers to download from, nil disables the parallel download
+	peers func() []*net.Peer
+	// Number of blocks in flight by peer id
+	inflight map[uint64]int
+	// The peers a block is requested from until its transactions are received,
+	// the last one is current, a late response from a stalled peer is still expected
+	assigned map[Uint256][]*net.Peer
+}
+
+func (service *SPVServiceImpl) SetParallelDownload(parallel bool) {
+	if !parallel {
+		service.queue.SetDownloadPeers(nil)
+		return
+	}
+	service.queue.SetDownloadPeers(service.PeerManager().ConnectedPeers)
+}
+
+func newDownloadScheduler() *downloadScheduler {
+	return &downloadScheduler{
+		inflight: make(map[uint64]int),
+		assigned: make(map[Uint256][]*net.Peer),
+	}
+}
+
+func (s *downloadScheduler) setPeers(peers func() []*net.Peer) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.peers = peers
+}
+
+func (s *downloadScheduler) parallel() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.peers != nil
+}
+
+// Assign the block to the least busy peer, the given peer is used if
+// the parallel download is disabled or no other peer is available
+func (s *downloadScheduler) assign(hash Uint256, peer *net.Peer) *net.Peer {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.peers != nil {
+		if best := s.leastBusy(peer, nil); best != nil {
+			peer = best
+		}
+	}
+	s.assignTo(hash, peer)
+	return peer
+}
+
+// Assign the block requested from the stalled peer to another peer,
+// returns the stalled peer if no other peer is available
+func (s *downloadScheduler) reassign(hash Uint256, stalled *net.Peer) *net.Peer {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.peers == nil {
+		return stalled
+	}
+	peer := s.leastBusy(nil, stalled)
+	if peer == nil {
+		return stalled
+	}
+	s.assignTo(hash, peer)
+	return peer
+}
+
+// Record the block is requested from the peer instead, like redirected on not found
+func (s *downloadScheduler) move(hash Uint256, peer *net.Peer) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.assignTo(hash, peer)
+}
+
+func (s *downloadScheduler) assignTo(hash Uint256, peer *net.Peer) {
+	if peer == nil {
+		return
+	}
+	peers := s.assigned[hash]
+	if len(peers) > 0 {
+		s.inflight[peers[len(peers)-1].ID()]--
+	}
+	s.assigned[hash] = append(peers, peer)
+	s.inflight[peer.ID()]++
+}
+
+// Pick the established peer with the fewest blocks in flight, a peer lower than the
+// given one is skipped as it may not have the blocks, so is the excluded peer
+func (s *downloadScheduler) leastBusy(peer *net.Peer, excluded *net.Peer) *net.Peer {
+	var best *net.Peer
+	for _, p := range s.peers() {
+		if p.State() != p2p.ESTABLISH || (peer != nil && p.Height() < peer.Height()) ||
+			(excluded != nil && p.ID() == excluded.ID()) {
+			continue
+		}
+		if best == nil || s.inflight[p.ID()] < s.inflight[best.ID()] {
+			best = p
+		}
+	}
+	return best
+}
+
+// The block is received, it is no longer in flight
+func (s *downloadScheduler) received(hash Uint256) {
+	s.Lock()
+	defer s.Unlock()
+
+	if peers := s.assigned[hash]; len(peers) > 0 {
+		s.inflight[peers[len(peers)-1].ID()]--
+	}
+}
+
+// The transactions of the block are received, forget the peer of the block
+func (s *downloadScheduler) release(hash Uint256) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.assigned, hash)
+}
+
+// Check if the block is requested from the peer
+func (s *downloadScheduler) assignedTo(hash Uint256, peerId uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, peer := range s.assigned[hash] {
+		if peer.ID() == peerId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *downloadScheduler) clear() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.inflight = make(map[uint64]int)
+	s.assigned = make(map[Uint256][]*net.Peer)
+}
@@ -0,0 +1,254 @@
+package sdk
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Fee rates of transactions confirmed in this many recent blocks are kept
+	FeeEstimateBlocks = 144
+
+	// The minimal number of fee rates to estimate the fee
+	MinFeeSamples = 10
+
+	// The share of transactions at or above the estimated rate that must have
+	// been confirmed within the target, in percent
+	FeeConfidence = 85
+
+	// Outputs of observed transactions kept to price the transactions spending
+	// them, they are forgotten when more are observed
+	maxKnownOutputs = 10000
+)
+
+var ErrNoFeeEstimate = errors.New("not enough transactions observed to estimate the fee")
+
+/*
+FeeEstimator estimates the fee rate of a transaction to be confirmed in a number of
+blocks from the transactions the service observes, so transaction builders do not
+hard code a static fee. A light client only observes the transactions matching its
+filter, the fee of one is known if the outputs it spends are observed or stored in
+the data store, which must implement db.TxGetter to look them up. Transactions
+relayed before they are confirmed tell how many blocks their fee rates took to be
+confirmed, the other transactions confirmed in recent blocks only tell the rates
+miners accept.
+*/
+type FeeEstimator struct {
+	sync.Mutex
+	chain *Blockchain
+
+	// The chain height when a relayed transaction was seen
+	seen map[Uint256]uint32
+	// Values of the outputs of observed transactions
+	outputs map[OutPoint]Fixed64
+	samples []feeSample
+}
+
+type feeSample struct {
+	rate   FeeRate
+	height uint32
+	// Blocks taken to confirm the transaction since relayed, 0 if not relayed
+	blocks uint32
+}
+
+// Create a fee estimator observing the blockchain
+func NewFeeEstimator(chain *Blockchain) *FeeEstimator {
+	estimator := &FeeEstimator{
+		chain:   chain,
+		seen:    make(map[Uint256]uint32),
+		outputs: make(map[OutPoint]Fixed64),
+	}
+	chain.AddStateListener(estimator)
+	return estimator
+}
+
+/*
+Estimate the fee rate in sela per KB for a transaction to be confirmed within the
+target blocks. It is the lowest rate that FeeConfidence percent of the relayed
+transactions paying at least as much were confirmed within the target, or the median
+rate of the transactions in recent blocks if too few were relayed. Returns
+ErrNoFeeEstimate if not enough transactions are observed yet.
+*/
+func (e *FeeEstimator) EstimateFee(targetBlocks uint32) (FeeRate, error) {
+	if targetBlocks == 0 {
+		return 0, errors.New("target blocks must be at least 1")
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	var relayed []feeSample
+	for _, sample := range e.samples {
+		if sample.blocks > 0 {
+			relayed = append(relayed, sample)
+		}
+	}
+
+	if len(relayed) >= MinFeeSamples {
+		sort.Slice(relayed, func(i, j int) bool { return relayed[i].rate > relayed[j].rate })
+		rate := relayed[0].rate
+		var within int
+		for i, sample := range relayed {
+			if sample.blocks <= targetBlocks {
+				within++
+			}
+			if within*100 >= (i+1)*FeeConfidence {
+				rate = sample.rate
+			}
+		}
+		return rate, nil
+	}
+
+	if len(e.samples) >= MinFeeSamples {
+		rates := make([]FeeRate, 0, len(e.samples))
+		for _, sample := range e.samples {
+			rates = append(rates, sample.rate)
+		}
+		sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+		return rates[len(rates)/2], nil
+	}
+
+	return 0, ErrNoFeeEstimate
+}
+
+// Record the chain height a relayed transaction was seen at
+func (e *FeeEstimator) OnTxCommitted(tx Transaction, height uint32) {
+	if height != 0 {
+		return
+	}
+	chainHeight := e.chain.Height()
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.addOutputs(&tx)
+	if _, ok := e.seen[tx.Hash()]; !ok {
+		e.seen[tx.Hash()] = chainHeight
+	}
+}
+
+// Record the fee rates of the transactions in the block
+func (e *FeeEstimator) OnBlockCommitted(block bloom.MerkleBlock, txs []Transaction) {
+	height := block.Header.Height
+
+	e.Lock()
+	defer e.Unlock()
+
+	// Transactions may spend outputs of the transactions before them in the block
+	for i := range txs {
+		e.addOutputs(&txs[i])
+	}
+
+	for i := range txs {
+		tx := &txs[i]
+		txId := tx.Hash()
+		seenAt, relayed := e.seen[txId]
+		delete(e.seen, txId)
+
+		rate, ok := e.feeRate(tx)
+		if !ok {
+			continue
+		}
+		sample := feeSample{rate: rate, height: height}
+		if relayed {
+			sample.blocks = 1
+			if height > seenAt+1 {
+				sample.blocks = height - seenAt
+			}
+		}
+		e.samples = append(e.samples, sample)
+	}
+
+	e.expire(height)
+}
+
+// Forget the fee rates of the rolled back blocks
+func (e *FeeEstimator) OnChainRollback(height uint32) {
+	e.Lock()
+	defer e.Unlock()
+
+	samples := e.samples[:0]
+	for _, sample := range e.samples {
+		if sample.height < height {
+			samples = append(samples, sample)
+		}
+	}
+	e.samples = samples
+}
+
+// Forget the fee rates and relayed transactions older than FeeEstimateBlocks
+func (e *FeeEstimator) expire(height uint32) {
+	if height <= FeeEstimateBlocks {
+		return
+	}
+	oldest := height - FeeEstimateBlocks
+
+	samples := e.samples[:0]
+	for _, sample := range e.samples {
+		if sample.height > oldest {
+			samples = append(samples, sample)
+		}
+	}
+	e.samples = samples
+
+	for txId, seenAt := range e.seen {
+		if seenAt <= oldest {
+			delete(e.seen, txId)
+		}
+	}
+}
+
+func (e *FeeEstimator) addOutputs(tx *Transaction) {
+	if len(e.outputs)+len(tx.Outputs) > maxKnownOutputs {
+		e.outputs = make(map[OutPoint]Fixed64)
+	}
+	txId := tx.Hash()
+	for index, output := range tx.Outputs {
+		e.outputs[OutPoint{TxID: txId, Index: uint16(index)}] = output.Value
+	}
+}
+
+// Get the fee rate of the transaction, false if the value of an input is unknown
+func (e *FeeEstimator) feeRate(tx *Transaction) (FeeRate, bool) {
+	if tx.IsCoinBaseTx() || len(tx.Inputs) == 0 {
+		return 0, false
+	}
+
+	var inputs, outputs Fixed64
+	for _, input := range tx.Inputs {
+		value, ok := e.inputValue(input.Previous)
+		if !ok {
+			return 0, false
+		}
+		inputs += value
+	}
+	for _, output := range tx.Outputs {
+		outputs += output.Value
+	}
+	if inputs < outputs {
+		return 0, false
+	}
+	return FeeRateOf(AmountOf(inputs-outputs), tx.GetSize()), true
+}
+
+func (e *FeeEstimator) inputValue(outPoint OutPoint) (Fixed64, bool) {
+	if value, ok := e.outputs[outPoint]; ok {
+		return value, true
+	}
+	getter, ok := e.chain.DataStore.(db.TxGetter)
+	if !ok {
+		return 0, false
+	}
+	storeTx, err := getter.GetTx(outPoint.TxID)
+	if err != nil || int(outPoint.Index) >= len(storeTx.Data.Outputs) {
+		return 0, false
+	}
+	return storeTx.Data.Outputs[outPoint.Index].Value, true
+}
@@ -0,0 +1,155 @@
+package sdk
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+const (
+	// Probe a peer with a known match of the filter in this interval by default
+	DefaultFilterProbeInterval = time.Minute * 10
+
+	// A peer not answering a probe in this duration fails it
+	FilterProbeTimeout = time.Minute
+)
+
+/*
+filterProber checks if peers honor the loaded bloom filter. It requests a block with
+a transaction known to match the filter from a peer, a peer accepted filterload but
+ignoring it answers a merkle block without the transaction, or does not answer.
+*/
+type filterProber struct {
+	sync.Mutex
+	interval time.Duration
+	last     time.Time
+	// Probes waiting for the merkle block by block hash
+	probes map[Uint256]*filterProbe
+	// Transactions matched by answered probes, they are relayed after
+	// the merkle block and must not be committed as new transactions
+	matched map[Uint256]time.Time
+}
+
+type filterProbe struct {
+	peer *net.Peer
+	txId Uint256
+	sent time.Time
+}
+
+func newFilterProber() *filterProber {
+	return &filterProber{
+		interval: DefaultFilterProbeInterval,
+		probes:   make(map[Uint256]*filterProbe),
+		matched:  make(map[Uint256]time.Time),
+	}
+}
+
+// Set how often peers are probed, 0 disables the probing
+func (service *SPVServiceImpl) SetFilterProbeInterval(interval time.Duration) {
+	service.prober.Lock()
+	defer service.prober.Unlock()
+
+	service.prober.interval = interval
+}
+
+// Fail the probes not answered in time, and probe a random peer if the
+// interval passed, the data store must implement db.FilterProbeSource
+func (service *SPVServiceImpl) probeFilter() {
+	source, ok := service.chain.DataStore.(db.FilterProbeSource)
+	if !ok {
+		return
+	}
+
+	p := service.prober
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	for blockHash, probe := range p.probes {
+		if now.Sub(probe.sent) > FilterProbeTimeout {
+			delete(p.probes, blockHash)
+			service.misbehave(probe.peer, "filter probe not answered", blockHash, ScoreRequestTimeout)
+		}
+	}
+	for txId, matched := range p.matched {
+		if now.Sub(matched) > FilterProbeTimeout {
+			delete(p.matched, txId)
+		}
+	}
+
+	if p.interval == 0 || now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	var peers []*net.Peer
+	for _, peer := range service.PeerManager().ConnectedPeers() {
+		// Peers synced by compact filters have no filter loaded
+		if peer.State() == p2p.ESTABLISH && !service.usesCFilters(peer) {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+	txId, blockHash, ok := source.GetFilterProbe()
+	if !ok {
+		return
+	}
+
+	peer := peers[rand.Intn(len(peers))]
+	p.probes[blockHash] = &filterProbe{peer: peer, txId: txId, sent: now}
+	log.Debugf("Probe filter of peer %d with transaction %s", peer.ID(), txId.String())
+	peer.Send(msg.NewDataReq(p2p.BlockData, blockHash))
+}
+
+// Check the merkle block answering a probe, returns if the block is handled
+func (service *SPVServiceImpl) handleProbeBlock(peer *net.Peer, block *bloom.MerkleBlock, txIds []*Uint256) bool {
+	p := service.prober
+	p.Lock()
+	defer p.Unlock()
+
+	blockHash := block.Header.Hash()
+	probe, ok := p.probes[blockHash]
+	if !ok || probe.peer.ID() != peer.ID() {
+		return false
+	}
+	delete(p.probes, blockHash)
+
+	matched := false
+	for _, txId := range txIds {
+		p.matched[*txId] = time.Now()
+		if txId.IsEqual(probe.txId) {
+			matched = true
+		}
+	}
+	if matched {
+		log.Debugf("Peer %d passed filter probe", peer.ID())
+		return true
+	}
+
+	service.misbehave(peer, "bloom filter ignored", blockHash, ScoreFilterIgnored)
+	service.PeerManager().DisconnectPeerWithReason(peer, net.ReasonMisbehave)
+	return true
+}
+
+// Check if the transaction is matched by an answered probe, it is
+// removed from the matched transactions
+func (service *SPVServiceImpl) isProbeTx(txId Uint256) bool {
+	p := service.prober
+	p.Lock()
+	defer p.Unlock()
+
+	_, ok := p.matched[txId]
+	delete(p.matched, txId)
+	return ok
+}
@@ -62,6 +62,26 @@ func (pool *FinishedReqPool) Next(current Uint256) (*BlockTxsRequest, bool) {
 	return nil, false
 }
 
+// Remove the finished requests the function returns true for, and return them
+func (pool *FinishedReqPool) RemoveIf(remove func(*BlockTxsRequest) bool) []*BlockTxsRequest {
+	pool.Lock()
+	defer pool.Unlock()
+
+	var removed []*BlockTxsRequest
+	for previous, request := range pool.requests {
+		if !remove(request) {
+			continue
+		}
+		if pool.genesis != nil && pool.genesis.IsEqual(previous) {
+			pool.genesis = nil
+		}
+		delete(pool.requests, previous)
+		delete(pool.blocks, request.BlockHash)
+		removed = append(removed, request)
+	}
+	return removed
+}
+
 func (pool *FinishedReqPool) LastPop() *Uint256 {
 	return pool.lastPop
 }
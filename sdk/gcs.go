@@ -0,0 +1,264 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// Golomb-Rice coding parameter and false positive rate of the compact
+	// filters, the same as the basic filters of BIP158
+	GCSFilterP = 19
+	GCSFilterM = 784931
+
+	// The max number of items in a compact filter
+	MaxGCSFilterItems = 1 << 24
+)
+
+/*
+GCSFilter is a Golomb-coded set, a compact probabilistic set of items. Items are hashed
+by SipHash with the filter key into the range [0, N*M), the sorted hashes are delta
+encoded by Golomb-Rice coding with parameter P, so the filter is about N*(P+2) bits.
+A query matches an item in the filter, or a false positive with a rate of 1/M.
+*/
+type GCSFilter struct {
+	N    uint32
+	Data []byte
+}
+
+// Build the filter of the items with the key, duplicated items are stored once
+func BuildGCSFilter(key [16]byte, items [][]byte) *GCSFilter {
+	items = uniqueItems(items)
+	values := hashGCSItems(key, uint64(len(items)), items)
+	sort.Sort(uint64s(values))
+
+	writer := new(bitWriter)
+	var last uint64
+	for _, value := range values {
+		delta := value - last
+		last = value
+
+		// Quotient in unary, then the remainder in P bits
+		for q := delta >> GCSFilterP; q > 0; q-- {
+			writer.writeBit(1)
+		}
+		writer.writeBit(0)
+		writer.writeBits(delta, GCSFilterP)
+	}
+	return &GCSFilter{N: uint32(len(values)), Data: writer.bytes()}
+}
+
+// Check if any of the items is in the filter
+func (f *GCSFilter) MatchAny(key [16]byte, items [][]byte) (bool, error) {
+	if f.N == 0 || len(items) == 0 {
+		return false, nil
+	}
+	queries := hashGCSItems(key, uint64(f.N), items)
+	sort.Sort(uint64s(queries))
+
+	reader := &bitReader{data: f.Data}
+	var value uint64
+	for i := uint32(0); i < f.N; i++ {
+		delta, err := reader.readGolomb()
+		if err != nil {
+			return false, err
+		}
+		value += delta
+
+		for len(queries) > 0 && queries[0] < value {
+			queries = queries[1:]
+		}
+		if len(queries) == 0 {
+			return false, nil
+		}
+		if queries[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *GCSFilter) Serialize(w io.Writer) error {
+	err := WriteVarUint(w, uint64(f.N))
+	if err != nil {
+		return err
+	}
+	return WriteVarBytes(w, f.Data)
+}
+
+func (f *GCSFilter) Deserialize(r io.Reader) error {
+	n, err := ReadVarUint(r, MaxGCSFilterItems)
+	if err != nil {
+		return err
+	}
+	f.N = uint32(n)
+	f.Data, err = ReadVarBytes(r)
+	return err
+}
+
+func uniqueItems(items [][]byte) [][]byte {
+	seen := make(map[string]bool, len(items))
+	unique := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if !seen[string(item)] {
+			seen[string(item)] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// Hash the items into the range [0, n*M)
+func hashGCSItems(key [16]byte, n uint64, items [][]byte) []uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	values := make([]uint64, len(items))
+	for i, item := range items {
+		values[i] = mulHigh64(sipHash24(k0, k1, item), n*GCSFilterM)
+	}
+	return values
+}
+
+// The high 64 bits of the 128 bits product, maps a hash into [0, n) fairly
+func mulHigh64(a, b uint64) uint64 {
+	aHi, aLo := a>>32, a&0xffffffff
+	bHi, bLo := b>>32, b&0xffffffff
+	lo := aLo * bLo
+	mid1 := aHi * bLo
+	mid2 := aLo * bHi
+	carry := (lo>>32 + mid1&0xffffffff + mid2&0xffffffff) >> 32
+	return aHi*bHi + mid1>>32 + mid2>>32 + carry
+}
+
+// SipHash-2-4 of the data with the key k0, k1
+func sipHash24(k0, k1 uint64, data []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = v1<<13 | v1>>51
+		v1 ^= v0
+		v0 = v0<<32 | v0>>32
+		v2 += v3
+		v3 = v3<<16 | v3>>48
+		v3 ^= v2
+		v0 += v3
+		v3 = v3<<21 | v3>>43
+		v3 ^= v0
+		v2 += v1
+		v1 = v1<<17 | v1>>47
+		v1 ^= v2
+		v2 = v2<<32 | v2>>32
+	}
+
+	length := len(data)
+	for len(data) >= 8 {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+		data = data[8:]
+	}
+
+	var last [8]byte
+	copy(last[:], data)
+	last[7] = byte(length)
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// bitWriter writes bits from the most significant bit of each byte
+type bitWriter struct {
+	buf    bytes.Buffer
+	cur    byte
+	filled uint
+}
+
+func (w *bitWriter) writeBit(bit byte) {
+	w.cur = w.cur<<1 | bit&1
+	w.filled++
+	if w.filled == 8 {
+		w.buf.WriteByte(w.cur)
+		w.cur, w.filled = 0, 0
+	}
+}
+
+func (w *bitWriter) writeBits(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit(byte(value >> (i - 1)))
+	}
+}
+
+// Get the written bytes, the last byte is padded with zero bits
+func (w *bitWriter) bytes() []byte {
+	data := w.buf.Bytes()
+	if w.filled > 0 {
+		data = append(data, w.cur<<(8-w.filled))
+	}
+	return data
+}
+
+var errGCSFilterTruncated = errors.New("compact filter data truncated")
+
+type bitReader struct {
+	data []byte
+	pos  uint
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	index := r.pos / 8
+	if index >= uint(len(r.data)) {
+		return 0, errGCSFilterTruncated
+	}
+	bit := r.data[index] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint64(bit), nil
+}
+
+func (r *bitReader) readGolomb() (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			break
+		}
+		q++
+	}
+	var remainder uint64
+	for i := 0; i < GCSFilterP; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		remainder = remainder<<1 | bit
+	}
+	return q<<GCSFilterP | remainder, nil
+}
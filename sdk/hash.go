@@ -0,0 +1,19 @@
+package sdk
+
+import (
+	"errors"
+	"strings"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Parse a block hash or transaction id in hex, in the same byte order as printed
+// by Uint256.String(), so hashes shown by the wallet and the logs parse back to
+// the same hash. Use it for all hashes given by users, in the RPC and in configs.
+func ParseHash(str string) (*Uint256, error) {
+	hashBytes, err := HexStringToBytes(strings.TrimSpace(str))
+	if err != nil || len(hashBytes) != UINT256SIZE {
+		return nil, errors.New("invalid hash " + str + ", expect 64 hex characters")
+	}
+	return Uint256FromBytes(hashBytes)
+}
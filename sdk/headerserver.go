@@ -0,0 +1,80 @@
+package sdk
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Answer getheaders requests of other light clients with the stored header chain,
+// this method should be called before Start()
+func (service *SPVServiceImpl) SetServeHeaders(serve bool) {
+	service.serveHeaders = serve
+}
+
+func (service *SPVServiceImpl) OnGetHeaders(peer *net.Peer, req *GetHeaders) error {
+	if !service.serveHeaders {
+		log.Debug("Serve headers disabled, ignore getheaders from peer", peer.ID())
+		return nil
+	}
+
+	headers, err := service.chain.GetHeadersAfter(req.Locator, req.HashStop, MaxHeadersPerMsg)
+	if err != nil {
+		return err
+	}
+	log.Debug("Serve", len(headers), "headers to peer", peer.ID())
+	go peer.Send(&Headers{Headers: headers})
+	return nil
+}
+
+// Get the headers of the main chain after the first block locator hash on it, up to
+// max headers or the stop hash. Headers from the genesis are returned if no locator
+// hash is on the main chain, and the headers stop before a pruned header.
+// The DataStore must implement db.AncestorFinder.
+func (bc *Blockchain) GetHeadersAfter(locator []*Uint256, hashStop Uint256, max int) ([]core.Header, error) {
+	finder, ok := bc.DataStore.(db.AncestorFinder)
+	if !ok {
+		return nil, errors.New("data store can not find ancestors of headers")
+	}
+
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	tip := bc.chainTip()
+
+	// Find the first locator hash on the main chain
+	var start uint32
+	for _, hash := range locator {
+		header, err := bc.GetHeader(*hash)
+		if err != nil || header.Height > tip.Height {
+			continue
+		}
+		ancestor, err := finder.GetAncestor(tip, header.Height)
+		if err == nil && ancestor.IsEqual(*hash) {
+			start = header.Height
+			break
+		}
+	}
+
+	var headers []core.Header
+	for height := start + 1; height <= tip.Height && len(headers) < max; height++ {
+		hash, err := finder.GetAncestor(tip, height)
+		if err != nil {
+			break
+		}
+		header, err := bc.GetHeader(*hash)
+		if err != nil {
+			break
+		}
+		headers = append(headers, header.Header)
+		if hash.IsEqual(hashStop) {
+			break
+		}
+	}
+	return headers, nil
+}
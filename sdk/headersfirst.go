@@ -0,0 +1,214 @@
+package sdk
+
+import (
+	"errors"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// GetHeaders requests the headers after the block locator, up to MaxHeadersPerMsg
+// headers or the stop hash, the peer answers with a headers message
+type GetHeaders struct {
+	Locator  []*Uint256
+	HashStop Uint256
+}
+
+func NewGetHeaders(locator []*Uint256, hashStop Uint256) *GetHeaders {
+	return &GetHeaders{Locator: locator, HashStop: hashStop}
+}
+
+func (msg *GetHeaders) CMD() string {
+	return "getheaders"
+}
+
+func (msg *GetHeaders) Serialize(w io.Writer) error {
+	err := WriteVarUint(w, uint64(len(msg.Locator)))
+	if err != nil {
+		return err
+	}
+	for _, hash := range msg.Locator {
+		err = hash.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	return msg.HashStop.Serialize(w)
+}
+
+func (msg *GetHeaders) Deserialize(r io.Reader) error {
+	count, err := ReadVarUint(r, MaxBlockLocatorHashes)
+	if err != nil {
+		return err
+	}
+	msg.Locator = make([]*Uint256, count)
+	for i := range msg.Locator {
+		msg.Locator[i] = new(Uint256)
+		err = msg.Locator[i].Deserialize(r)
+		if err != nil {
+			return err
+		}
+	}
+	return msg.HashStop.Deserialize(r)
+}
+
+var (
+	// The first headers do not connect to the chain tip, the peer is on a fork
+	errHeadersForked = errors.New("headers not connected to chain tip")
+
+	// The headers do not connect to the previous headers
+	errHeadersNotConnected = errors.New("headers not connected")
+
+	// A new block announced by the sync peer during the header stage
+	errHeaderAnnounced = errors.New("header announced")
+)
+
+/*
+headerSync is the header stage of the headers-first sync. The header chain from the
+chain tip to the sync peer tip is downloaded by getheaders messages. The headers of
+each message are validated and stored first, then the merkle blocks of them are
+queued as one batch before more headers are requested, instead of interleaving
+getblocks round trips with block downloads. The request queue is bounded, so the
+header stage waits for the blocks to be downloaded and keeps one batch in memory.
+*/
+type headerSync struct {
+	peer *net.Peer
+	// Hash and height of the last validated header
+	last   Uint256
+	height uint32
+	// The number of validated headers after the chain tip
+	count int
+}
+
+// Validate the headers and append them to the header chain, returns the hashes
+// of the headers, or the hash of the invalid header and the error. Every header
+// is checked by the proof of work and the checkpoints, headers below the last
+// checkpoint are queued before the checkpoint is reached, so they are not
+// trusted by the checkpoint.
+func (hs *headerSync) connect(chain *Blockchain, headers []core.Header) ([]*Uint256, Uint256, error) {
+	hashes := make([]*Uint256, 0, len(headers))
+	for _, header := range headers {
+		blockHash := header.Hash()
+		err := chain.CheckCheckpoint(header)
+		if err != nil {
+			return nil, blockHash, err
+		}
+		err = chain.CheckProofOfWork(header)
+		if err != nil {
+			return nil, blockHash, err
+		}
+
+		if !header.Previous.IsEqual(hs.last) || header.Height != hs.height+1 {
+			if hs.count == 0 {
+				return nil, blockHash, errHeadersForked
+			}
+			if len(headers) == 1 {
+				return nil, blockHash, errHeaderAnnounced
+			}
+			return nil, blockHash, errHeadersNotConnected
+		}
+
+		hs.last, hs.height = blockHash, header.Height
+		hs.count++
+		hashes = append(hashes, &blockHash)
+	}
+	return hashes, Uint256{}, nil
+}
+
+// Download headers first when syncing from peers supporting headers messages,
+// this method should be called before Start()
+func (service *SPVServiceImpl) SetHeadersFirst(headersFirst bool) {
+	service.headersFirst = headersFirst
+}
+
+// Start the header stage with the sync peer, returns false if the
+// headers-first sync is disabled or not supported by the peer
+func (service *SPVServiceImpl) startHeaderSync(peer *net.Peer) bool {
+	if !service.headersFirst || peer.Version() < SendHeadersVersion {
+		return false
+	}
+
+	tip := service.chain.ChainTip()
+	service.setHeaderSync(&headerSync{peer: peer, last: tip.Hash(), height: tip.Height})
+	log.Info("Headers-first sync from height", tip.Height, "with peer", peer.ID())
+	go peer.Send(NewGetHeaders(service.chain.GetBlockLocatorHashes(), Uint256{}))
+	return true
+}
+
+func (service *SPVServiceImpl) setHeaderSync(hs *headerSync) {
+	service.headerSyncLock.Lock()
+	defer service.headerSyncLock.Unlock()
+
+	service.headerSync = hs
+}
+
+func (service *SPVServiceImpl) getHeaderSync() *headerSync {
+	service.headerSyncLock.Lock()
+	defer service.headerSyncLock.Unlock()
+
+	return service.headerSync
+}
+
+// Validate and store the headers of the header stage, queue the merkle blocks
+// of them and request more headers, the header stage finishes when the peer has
+// no more. Returns if the headers are handled by the header stage.
+func (service *SPVServiceImpl) handleSyncHeaders(peer *net.Peer, headers *Headers) (bool, error) {
+	service.headerSyncLock.Lock()
+	hs := service.headerSync
+	if hs == nil || hs.peer.ID() != peer.ID() {
+		service.headerSyncLock.Unlock()
+		return false, nil
+	}
+	batch, blockHash, err := hs.connect(service.chain, headers.Headers)
+	var storeErr error
+	if err == nil {
+		// Store the headers first, so they are known when their blocks are committed
+		storeErr = service.chain.PutSyncHeaders(headers.Headers)
+	}
+	more := err == nil && storeErr == nil && len(headers.Headers) == MaxHeadersPerMsg
+	if !more && err != errHeaderAnnounced {
+		service.headerSync = nil
+	}
+	last := hs.last
+	service.headerSyncLock.Unlock()
+
+	switch {
+	case err == errHeaderAnnounced:
+		// The announced block is synced after the header stage
+	case err == errHeadersForked:
+		// The reorganize is handled by the getblocks sync
+		log.Info("Headers not connected to chain tip, sync by blocks")
+		go peer.Send(msg.NewBlocksReq(service.chain.GetBlockLocatorHashes(), Uint256{}))
+	case err == errHeadersNotConnected:
+		service.misbehave(peer, err.Error(), blockHash, ScoreUnexpectedMsg)
+		service.changeSyncPeerAndRestart(net.ReasonMisbehave)
+	case err != nil:
+		service.misbehave(peer, "invalid header, "+err.Error(), blockHash, ScoreInvalidBlock)
+		service.changeSyncPeerAndRestart(net.ReasonMisbehave)
+		return true, err
+	case storeErr != nil:
+		log.Error("Store sync headers failed,", storeErr)
+		service.stopSyncing()
+		return true, storeErr
+	case more:
+		// Queue the blocks of the batch, and request more headers from the last
+		// one when the batch is in the queue, unless the header stage is aborted
+		log.Debug("Header sync height:", hs.height)
+		go func() {
+			service.queue.PushHashes(peer, batch)
+			if service.getHeaderSync() == hs {
+				peer.Send(NewGetHeaders([]*Uint256{&last}, Uint256{}))
+			}
+		}()
+	default:
+		// The header chain is complete, queue the blocks of the last batch
+		log.Info("Header sync finished at height", hs.height, "requested", hs.count, "blocks")
+		go service.queue.PushHashes(peer, batch)
+	}
+	return true, nil
+}
@@ -0,0 +1,54 @@
+package sdk
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// Peers reached the ban score are banned, see net.PeerManager.SetBanPolicy()
+	BanThreshold = net.DefaultBanThreshold
+
+	// Ban score deltas of misbehaviors, timeouts are recorded but not scored,
+	// honest peers on slow links time out too
+	ScoreNonSyncPeerMsg = 20
+	ScoreUnexpectedMsg  = 10
+	ScoreInvalidBlock   = 50
+	ScoreRequestTimeout = 0
+	ScoreNotFound       = 10
+	ScoreFilterIgnored  = 50
+	ScoreInvalidTx      = 20
+)
+
+// Increase the ban score of the peer in the peer manager, the event is saved if the
+// data store implements db.MisbehaviorStore, the peer manager bans the peer's host
+// once the score reached the threshold
+func (service *SPVServiceImpl) misbehave(peer *net.Peer, reason string, msgHash Uint256, delta int) {
+	if peer == nil {
+		return
+	}
+
+	addr := peer.Addr().String()
+	log.Warnf("Peer %d %s misbehaved: %s, ban score +%d", peer.ID(), addr, reason, delta)
+	score, _ := service.PeerManager().Misbehave(peer, delta)
+
+	if store, ok := service.chain.DataStore.(db.MisbehaviorStore); ok {
+		err := store.PutMisbehavior(&db.MisbehaviorRecord{
+			Time:    time.Now(),
+			PeerId:  peer.ID(),
+			Addr:    addr,
+			Reason:  reason,
+			MsgHash: msgHash,
+			Delta:   delta,
+			Score:   score,
+		})
+		if err != nil {
+			log.Error("Save misbehavior failed:", err)
+		}
+	}
+}
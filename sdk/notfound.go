@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Not found records older than this are forgotten
+const NotFoundExpiry = time.Minute * 10
+
+// notFoundTracker remembers which peers answered not found for which data,
+// and which peer the request was redirected to
+type notFoundTracker struct {
+	sync.Mutex
+	records map[Uint256]*notFoundRecord
+}
+
+type notFoundRecord struct {
+	peers      map[uint64]*net.Peer
+	redirected uint64
+	time       time.Time
+}
+
+func newNotFoundTracker() *notFoundTracker {
+	return &notFoundTracker{records: make(map[Uint256]*notFoundRecord)}
+}
+
+// Record the peer lacks the data, returns the ids of all peers lacking it
+func (t *notFoundTracker) add(hash Uint256, peer *net.Peer) map[uint64]bool {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	for h, record := range t.records {
+		if now.Sub(record.time) > NotFoundExpiry {
+			delete(t.records, h)
+		}
+	}
+
+	record, ok := t.records[hash]
+	if !ok {
+		record = &notFoundRecord{peers: make(map[uint64]*net.Peer)}
+		t.records[hash] = record
+	}
+	record.peers[peer.ID()] = peer
+	record.time = now
+
+	lacking := make(map[uint64]bool, len(record.peers))
+	for id := range record.peers {
+		lacking[id] = true
+	}
+	return lacking
+}
+
+func (t *notFoundTracker) setRedirect(hash Uint256, peerId uint64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if record, ok := t.records[hash]; ok {
+		record.redirected = peerId
+	}
+}
+
+// Returns if the request of the data was redirected to the peer
+func (t *notFoundTracker) redirectedTo(hash Uint256, peerId uint64) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	record, ok := t.records[hash]
+	return ok && record.redirected == peerId
+}
+
+// The data is received, remove the record and return the peers lacking it
+func (t *notFoundTracker) resolve(hash Uint256) []*net.Peer {
+	t.Lock()
+	defer t.Unlock()
+
+	record, ok := t.records[hash]
+	if !ok {
+		return nil
+	}
+	delete(t.records, hash)
+
+	peers := make([]*net.Peer, 0, len(record.peers))
+	for _, peer := range record.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func (t *notFoundTracker) remove(hash Uint256) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.records, hash)
+}
@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The number of notifications queued per notify worker
+const NotifyJobsPerWorker = 64
+
+/*
+notifyDispatcher runs the notifications to state listeners. By default each
+notification runs on a new goroutine, so a slow listener does not block the chain,
+but the goroutines pile up while it is slow. With workers set, notifications are
+queued to a fixed pool of goroutines instead, and committing blocks waits when the
+queue is full, which bounds the goroutines on small devices.
+*/
+type notifyDispatcher struct {
+	lock    sync.RWMutex
+	workers int
+	queue   chan func()
+	// Notifications running or waiting on their own goroutines
+	running int32
+}
+
+// Set the number of workers, 0 means a goroutine per notification
+func (d *notifyDispatcher) setWorkers(workers int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.queue != nil {
+		// The workers exit when the queued notifications are done
+		close(d.queue)
+		d.queue = nil
+	}
+	d.workers = 0
+	if workers <= 0 {
+		return
+	}
+	d.workers = workers
+	d.queue = make(chan func(), workers*NotifyJobsPerWorker)
+	for i := 0; i < workers; i++ {
+		go d.work(d.queue)
+	}
+}
+
+func (d *notifyDispatcher) work(queue chan func()) {
+	for notify := range queue {
+		notify()
+	}
+}
+
+func (d *notifyDispatcher) dispatch(notify func()) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	if d.queue != nil {
+		d.queue <- notify
+		return
+	}
+	atomic.AddInt32(&d.running, 1)
+	go func() {
+		defer atomic.AddInt32(&d.running, -1)
+		notify()
+	}()
+}
+
+func (d *notifyDispatcher) stats() SubsystemStats {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	stats := SubsystemStats{
+		Name:       SubsystemNotify,
+		Goroutines: d.workers + int(atomic.LoadInt32(&d.running)),
+	}
+	if d.queue != nil {
+		stats.QueueDepth = len(d.queue)
+		stats.QueueCapacity = cap(d.queue)
+	}
+	return stats
+}
@@ -0,0 +1,205 @@
+package sdk
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Interval of checking the progress of asynchronous operations
+const OperationPollInterval = time.Second
+
+var (
+	// The operation was cancelled before it completed
+	ErrOperationCancelled = errors.New("operation cancelled")
+
+	// The transaction was not relayed back by observers in time
+	ErrNotPropagated = errors.New("transaction not propagated")
+)
+
+/*
+Operation is a handle of a long-running operation started asynchronously.
+Receive from Done() or call Wait() to know when it completes, and Cancel() to stop it.
+Cancel stops waiting for the operation, the work already done is not undone,
+like a transaction already broadcast or a chain already rewound.
+*/
+type Operation struct {
+	sync.Mutex
+	progress float64
+	err      error
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newOperation() *Operation {
+	return &Operation{done: make(chan struct{})}
+}
+
+// The channel closed when the operation completes, failed or is cancelled
+func (op *Operation) Done() <-chan struct{} {
+	return op.done
+}
+
+// Wait for the operation to complete and return the error if failed
+func (op *Operation) Wait() error {
+	<-op.done
+	return op.Err()
+}
+
+// The error of the operation, nil if it succeeded or is still running
+func (op *Operation) Err() error {
+	op.Lock()
+	defer op.Unlock()
+
+	return op.err
+}
+
+// The progress of the operation from 0 to 1
+func (op *Operation) Progress() float64 {
+	op.Lock()
+	defer op.Unlock()
+
+	return op.progress
+}
+
+// Cancel the operation, it completes with ErrOperationCancelled if still running
+func (op *Operation) Cancel() {
+	op.finish(ErrOperationCancelled)
+}
+
+func (op *Operation) setProgress(progress float64) {
+	op.Lock()
+	defer op.Unlock()
+
+	op.progress = math.Max(0, math.Min(1, progress))
+}
+
+// Complete the operation with the error, only the first call takes effect
+func (op *Operation) finish(err error) {
+	op.once.Do(func() {
+		op.Lock()
+		op.err = err
+		if err == nil {
+			op.progress = 1
+		}
+		op.Unlock()
+		close(op.done)
+	})
+}
+
+// Rescan from the given height asynchronously, the operation completes when the
+// chain is synced to the best peer height again, the progress is the rescanned
+// part of the blocks from the given height to the best peer height
+func (service *SPVServiceImpl) RescanAsync(height uint32) *Operation {
+	op := newOperation()
+	go func() {
+		err := service.Rescan(height)
+		if err != nil {
+			op.finish(err)
+			return
+		}
+
+		ticker := time.NewTicker(OperationPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-op.Done():
+				return
+			case <-ticker.C:
+			}
+
+			bestPeer := service.PeerManager().GetBestPeer()
+			if bestPeer == nil {
+				continue
+			}
+			chainHeight, bestHeight := uint64(service.chain.Height()), bestPeer.Height()
+			if bestHeight > uint64(height) {
+				op.setProgress((float64(chainHeight) - float64(height)) / float64(bestHeight-uint64(height)))
+			}
+			if chainHeight >= bestHeight && !service.chain.IsSyncing() {
+				op.finish(nil)
+			}
+		}
+	}()
+	return op
+}
+
+// Send the transaction asynchronously, the operation completes when an observer
+// peer relays the transaction back, fails with the reason of the reject if a peer
+// rejects it, or with ErrNotPropagated if it is not relayed back in
+// PropagationTimeout minutes
+func (service *SPVServiceImpl) SendTransactionAsync(tx core.Transaction) *Operation {
+	op := newOperation()
+	txId := tx.Hash()
+	service.propagation.addOperation(txId, op)
+	go func() {
+		defer service.propagation.removeOperation(txId, op)
+
+		err := service.SendTransaction(tx)
+		if err != nil {
+			op.finish(err)
+			return
+		}
+
+		select {
+		case <-op.Done():
+		case <-time.After(time.Minute * PropagationTimeout):
+			op.finish(ErrNotPropagated)
+		}
+	}()
+	return op
+}
+
+// Complete the send operations of the propagated transaction
+func (m *propagationMonitor) completeOperations(txId Uint256) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, op := range m.operations[txId] {
+		op.finish(nil)
+	}
+	delete(m.operations, txId)
+}
+
+// Fail the send operations of the rejected transaction with the reason
+func (m *propagationMonitor) failOperations(txId Uint256, reason *Reason) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, op := range m.operations[txId] {
+		op.finish(reason)
+	}
+	delete(m.operations, txId)
+}
+
+func (m *propagationMonitor) addOperation(txId Uint256, op *Operation) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.operations == nil {
+		m.operations = make(map[Uint256][]*Operation)
+	}
+	m.operations[txId] = append(m.operations[txId], op)
+}
+
+func (m *propagationMonitor) removeOperation(txId Uint256, op *Operation) {
+	m.Lock()
+	defer m.Unlock()
+
+	ops := m.operations[txId]
+	for i, o := range ops {
+		if o == op {
+			ops = append(ops[:i], ops[i+1:]...)
+			break
+		}
+	}
+	if len(ops) == 0 {
+		delete(m.operations, txId)
+	} else {
+		m.operations[txId] = ops
+	}
+}
@@ -0,0 +1,159 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Max number of orphan transactions kept by default
+	DefaultMaxOrphanTxs = 100
+
+	// Orphan transactions older than this are evicted by default
+	DefaultOrphanTxExpiry = time.Minute * 20
+)
+
+// orphanPool keeps the relayed transactions arriving before their unconfirmed
+// parents, until the parents arrive or they are evicted
+type orphanPool struct {
+	sync.Mutex
+	maxTxs  int
+	expiry  time.Duration
+	orphans map[Uint256]*orphanTx
+	// Ids of the orphans waiting for a parent by the parent id
+	children map[Uint256]map[Uint256]struct{}
+}
+
+type orphanTx struct {
+	tx      *core.Transaction
+	parents []Uint256
+	time    time.Time
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		maxTxs:   DefaultMaxOrphanTxs,
+		expiry:   DefaultOrphanTxExpiry,
+		orphans:  make(map[Uint256]*orphanTx),
+		children: make(map[Uint256]map[Uint256]struct{}),
+	}
+}
+
+func (p *orphanPool) setLimits(maxTxs int, expiry time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.maxTxs = maxTxs
+	p.expiry = expiry
+	p.evict(time.Now())
+}
+
+// Add an orphan transaction waiting for the parents,
+// returns false if the pool is disabled
+func (p *orphanPool) add(tx *core.Transaction, parents []Uint256) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.maxTxs <= 0 {
+		return false
+	}
+
+	txId := tx.Hash()
+	if _, ok := p.orphans[txId]; ok {
+		return true
+	}
+
+	p.evict(time.Now())
+	for len(p.orphans) >= p.maxTxs {
+		p.removeOldest()
+	}
+
+	p.orphans[txId] = &orphanTx{tx: tx, parents: parents, time: time.Now()}
+	for _, parent := range parents {
+		children, ok := p.children[parent]
+		if !ok {
+			children = make(map[Uint256]struct{})
+			p.children[parent] = children
+		}
+		children[txId] = struct{}{}
+	}
+	return true
+}
+
+// Remove and return the orphans waiting for the parent
+func (p *orphanPool) takeChildren(parent Uint256) []*core.Transaction {
+	p.Lock()
+	defer p.Unlock()
+
+	var txs []*core.Transaction
+	for txId := range p.children[parent] {
+		if orphan, ok := p.orphans[txId]; ok {
+			txs = append(txs, orphan.tx)
+			p.remove(txId)
+		}
+	}
+	delete(p.children, parent)
+	return txs
+}
+
+// Check if orphans are waiting for the transaction
+func (p *orphanPool) isParent(txId Uint256) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	_, ok := p.children[txId]
+	return ok
+}
+
+// Evict the orphans older than the expiry duration
+func (p *orphanPool) expire() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.evict(time.Now())
+}
+
+func (p *orphanPool) evict(now time.Time) {
+	for txId, orphan := range p.orphans {
+		if now.Sub(orphan.time) > p.expiry {
+			log.Debug("Orphan transaction expired:", txId.String())
+			p.remove(txId)
+		}
+	}
+	for len(p.orphans) > 0 && len(p.orphans) > p.maxTxs {
+		p.removeOldest()
+	}
+}
+
+func (p *orphanPool) removeOldest() {
+	var oldest *orphanTx
+	var oldestId Uint256
+	for txId, orphan := range p.orphans {
+		if oldest == nil || orphan.time.Before(oldest.time) {
+			oldest, oldestId = orphan, txId
+		}
+	}
+	if oldest != nil {
+		log.Debug("Orphan pool full, evict transaction:", oldestId.String())
+		p.remove(oldestId)
+	}
+}
+
+func (p *orphanPool) remove(txId Uint256) {
+	orphan, ok := p.orphans[txId]
+	if !ok {
+		return
+	}
+	delete(p.orphans, txId)
+	for _, parent := range orphan.parents {
+		delete(p.children[parent], txId)
+		if len(p.children[parent]) == 0 {
+			delete(p.children, parent)
+		}
+	}
+}
@@ -89,6 +89,12 @@ func (client *P2PClientImpl) OnPeerEstablish(peer *net.Peer) {
 	client.msgHandler.OnPeerEstablish(peer)
 }
 
+func (client *P2PClientImpl) OnPeerPromoted(peer *net.Peer) {
+	if handler, ok := client.msgHandler.(net.PromoteHandler); ok {
+		handler.OnPeerPromoted(peer)
+	}
+}
+
 func (client *P2PClientImpl) HandleMessage(peer *net.Peer, msg p2p.Message) error {
 	return client.msgHandler.HandleMessage(peer, msg)
 }
@@ -0,0 +1,150 @@
+package sdk
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+)
+
+// NetworkParams describes the network the SPV service works on, so the chains
+// derived from Elastos can be used without compiling their parameters in
+type NetworkParams struct {
+	// The peer to peer network id
+	Magic uint32
+
+	// The serialized genesis block header, optional. If set, it is stored as the
+	// first header when the headers store is initialized, and synced headers must
+	// extend it, otherwise the first header is trusted from peers.
+	GenesisHeader []byte
+
+	// Known blocks the synced chain must pass through, optional. Headers at a
+	// checkpoint height must have the checkpoint hash, and the proof of work
+	// below the last checkpoint is not checked.
+	Checkpoints []Checkpoint
+
+	// Host names of DNS seeders, optional. Peers are discovered by resolving them,
+	// the seeds are connected only if no address is resolved.
+	DNSSeeds []string
+
+	// Consensus rules by activation height, optional. Headers and transactions are
+	// validated with the rules at their heights, so hard forks are followed by
+	// updating the rules instead of the code.
+	Rules []Rules
+}
+
+var (
+	MainNetParams = &NetworkParams{Magic: MainNetMagic}
+	TestNetParams = &NetworkParams{Magic: TestNetMagic}
+)
+
+// ParamsError aggregates all the problems found in the network params and seeds,
+// so they can be fixed at once instead of failing one by one
+type ParamsError struct {
+	Problems []string
+}
+
+func (e *ParamsError) Error() string {
+	return "invalid network params: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate the network params with the seeds to connect,
+// returns a *ParamsError listing all the problems found
+func (params *NetworkParams) Validate(seeds []string) error {
+	var problems []string
+	if params.Magic == 0 {
+		problems = append(problems, "magic number is not set")
+	}
+
+	if len(seeds) == 0 {
+		problems = append(problems, "seed list is empty")
+	}
+	known := make(map[string]bool)
+	for i, seed := range seeds {
+		// Port of seeds is overwritten by SPVServerPort, only the host matters
+		host := strings.TrimSpace(seed)
+		if index := strings.LastIndex(host, ":"); index >= 0 {
+			host = host[:index]
+		}
+		if host == "" {
+			problems = append(problems, fmt.Sprintf("seed %d %q has no host", i, seed))
+			continue
+		}
+		if known[host] {
+			problems = append(problems, fmt.Sprintf("seed %d %q is duplicated", i, seed))
+		}
+		known[host] = true
+	}
+
+	if len(params.GenesisHeader) > 0 {
+		var header core.Header
+		err := header.Deserialize(bytes.NewReader(params.GenesisHeader))
+		if err != nil {
+			problems = append(problems, "genesis header can not be decoded, "+err.Error())
+		} else if header.Height != 0 || !header.Previous.IsEqual(common.Uint256{}) {
+			problems = append(problems, "genesis header height must be 0 and previous hash must be empty")
+		}
+	}
+
+	heights := make(map[uint32]bool)
+	for _, checkpoint := range params.Checkpoints {
+		if heights[checkpoint.Height] {
+			problems = append(problems, fmt.Sprintf("checkpoint at height %d is duplicated", checkpoint.Height))
+		}
+		heights[checkpoint.Height] = true
+	}
+
+	activations := make(map[uint32]bool)
+	for _, rules := range params.Rules {
+		if activations[rules.Height] {
+			problems = append(problems, fmt.Sprintf("rules at height %d are duplicated", rules.Height))
+		}
+		activations[rules.Height] = true
+	}
+
+	if len(problems) > 0 {
+		return &ParamsError{Problems: problems}
+	}
+	return nil
+}
+
+// Get the SPV client of the network described by params,
+// the params and seeds are validated before the client is created
+func GetSPVClientWithParams(params *NetworkParams, clientId uint64, seeds []string) (SPVClient, error) {
+	err := params.Validate(seeds)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewSPVClientImpl(params.Magic, clientId, seeds)
+	if err != nil {
+		return nil, err
+	}
+	client.PeerManager().SetDNSSeeds(params.DNSSeeds, SPVServerPort)
+	return client, nil
+}
+
+// Get a SPV service instance of the network described by params,
+// the genesis header in params is validated and injected into an empty headers store.
+func GetSPVServiceWithParams(params *NetworkParams, client SPVClient, database db.DataStore, getBloomFilter func() *bloom.Filter) (SPVService, error) {
+	service, err := NewSPVServiceImpl(client, database, getBloomFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.GenesisHeader) > 0 {
+		err = service.chain.InitGenesis(params.GenesisHeader)
+		if err != nil {
+			return nil, err
+		}
+		service.updateLocalHeight()
+	}
+	service.chain.SetCheckpoints(params.Checkpoints)
+	service.chain.SetRules(params.Rules)
+
+	return service, nil
+}
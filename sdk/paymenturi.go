@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// The scheme of ELA payment request URIs
+const PaymentURIScheme = "elastos"
+
+var (
+	ErrInvalidPaymentURI = errors.New("invalid payment URI, expect elastos:<address>[?amount=&memo=&exp=]")
+
+	// The payment request expired, ask the payee for a new one
+	ErrPaymentRequestExpired = errors.New("payment request expired")
+)
+
+/*
+PaymentRequest is a request to pay an address, encoded as a URI like
+elastos:<address>?amount=1.5&memo=invoice%2042&exp=1530000000 to be shown as a QR
+code or a link, following BIP21. The amount is in ELA, the memo is attached to the
+transaction and the expiry is a unix time after which the request must not be
+paid. Only the address is required. Unknown parameters are ignored, unless they
+start with "req-", which means the payer must understand them to pay.
+*/
+type PaymentRequest struct {
+	Address string
+	// The amount to pay, 0 means the payer chooses
+	Amount Amount
+	Memo   string
+	// The time the request expires, the zero time means never
+	Expires time.Time
+}
+
+// Parse a payment request URI, the address is checked to be a valid ELA address
+func ParsePaymentURI(uri string) (*PaymentRequest, error) {
+	uri = strings.TrimSpace(uri)
+	colon := strings.Index(uri, ":")
+	if colon < 0 || !strings.EqualFold(uri[:colon], PaymentURIScheme) {
+		return nil, ErrInvalidPaymentURI
+	}
+	rest := strings.TrimPrefix(uri[colon+1:], "//")
+
+	address, rawQuery := rest, ""
+	if mark := strings.Index(rest, "?"); mark >= 0 {
+		address, rawQuery = rest[:mark], rest[mark+1:]
+	}
+	if address == "" {
+		return nil, ErrInvalidPaymentURI
+	}
+	if _, err := Uint168FromAddress(address); err != nil {
+		return nil, errors.New("invalid payment URI address, " + err.Error())
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, ErrInvalidPaymentURI
+	}
+	request := &PaymentRequest{Address: address}
+	for key, values := range query {
+		value := values[0]
+		switch key {
+		case "amount":
+			request.Amount, err = ParseAmount(value)
+			if err != nil {
+				return nil, errors.New("invalid payment URI amount, " + err.Error())
+			}
+		case "memo", "message":
+			request.Memo = value
+		case "exp":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return nil, errors.New("invalid payment URI expiry " + value)
+			}
+			request.Expires = time.Unix(seconds, 0)
+		default:
+			if strings.HasPrefix(key, "req-") {
+				return nil, errors.New("payment URI requires unsupported parameter " + key)
+			}
+		}
+	}
+	return request, nil
+}
+
+// Check if the request expired at the time
+func (r *PaymentRequest) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+// Build the URI of the request, parameters without values are left out
+func (r *PaymentRequest) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(PaymentURIScheme)
+	buf.WriteByte(':')
+	buf.WriteString(r.Address)
+
+	var params []string
+	if r.Amount > 0 {
+		params = append(params, "amount="+r.Amount.String())
+	}
+	if r.Memo != "" {
+		// Spaces are %20 instead of + for the URI readers not decoding forms
+		params = append(params, "memo="+strings.Replace(url.QueryEscape(r.Memo), "+", "%20", -1))
+	}
+	if !r.Expires.IsZero() {
+		params = append(params, "exp="+strconv.FormatInt(r.Expires.Unix(), 10))
+	}
+	if len(params) > 0 {
+		buf.WriteByte('?')
+		buf.WriteString(strings.Join(params, "&"))
+	}
+	return buf.String()
+}
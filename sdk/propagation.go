@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+const (
+	// Max number of peers kept as observers of a broadcast transaction
+	MaxObservers = 2
+	// Stop watching a transaction if it is not relayed back in this duration in minutes
+	PropagationTimeout = 10
+)
+
+/*
+PropagationListener is an interface to receive transaction propagation feedback.
+Call SPVService.AddPropagationListener() to register your callbacks.
+*/
+type PropagationListener interface {
+	// This method will be callback when an observer peer, which the transaction
+	// was not sent to, relays the transaction back, so it has propagated in the network.
+	OnTxPropagated(txId Uint256, observer uint64)
+}
+
+type watchedTx struct {
+	observers map[uint64]bool
+	since     time.Time
+}
+
+// propagationMonitor watches the broadcast transactions until an observer relays them back
+type propagationMonitor struct {
+	sync.Mutex
+	txs map[Uint256]*watchedTx
+	// Operations of SendTransactionAsync waiting for the propagation
+	operations map[Uint256][]*Operation
+}
+
+func newPropagationMonitor() *propagationMonitor {
+	return &propagationMonitor{txs: make(map[Uint256]*watchedTx)}
+}
+
+// Pick the observers, standby peers are preferred because they do not receive broadcasts,
+// otherwise one active peer is kept as observer if there are more than one active peers
+func pickObservers(pm *net.PeerManager) []*net.Peer {
+	var observers []*net.Peer
+	for _, peer := range pm.StandbyPeers() {
+		if len(observers) >= MaxObservers {
+			break
+		}
+		if peer.State() == p2p.ESTABLISH {
+			observers = append(observers, peer)
+		}
+	}
+	if len(observers) > 0 {
+		return observers
+	}
+
+	var active []*net.Peer
+	for _, peer := range pm.ConnectedPeers() {
+		if peer.State() == p2p.ESTABLISH && peer.Relay() != 0 {
+			active = append(active, peer)
+		}
+	}
+	if len(active) > 1 {
+		observers = append(observers, active[0])
+	}
+	return observers
+}
+
+func (m *propagationMonitor) watch(txId Uint256, observers []*net.Peer) {
+	m.Lock()
+	defer m.Unlock()
+
+	// Remove transactions that never relayed back
+	for hash, tx := range m.txs {
+		if time.Since(tx.since) > time.Minute*PropagationTimeout {
+			delete(m.txs, hash)
+		}
+	}
+
+	tx := &watchedTx{observers: make(map[uint64]bool), since: time.Now()}
+	for _, peer := range observers {
+		tx.observers[peer.ID()] = true
+	}
+	m.txs[txId] = tx
+}
+
+// Check the transaction inventory from a peer, returns the transactions
+// propagated, which means relayed back by an observer
+func (m *propagationMonitor) onTxInv(peer *net.Peer, hashes []*Uint256) []Uint256 {
+	m.Lock()
+	defer m.Unlock()
+
+	var propagated []Uint256
+	for _, hash := range hashes {
+		tx, ok := m.txs[*hash]
+		if !ok || !tx.observers[peer.ID()] {
+			continue
+		}
+		delete(m.txs, *hash)
+		propagated = append(propagated, *hash)
+	}
+	return propagated
+}
@@ -0,0 +1,101 @@
+package sdk
+
+import "strings"
+
+// Categories of the failure reasons
+const (
+	// The transaction is refused by verification or by the consensus rules
+	CategoryReject = "reject"
+	// The spend policy of the wallet refused the transaction
+	CategoryPolicy = "policy"
+	// Funds or the keystore are locked
+	CategoryLock = "lock"
+	// The funds are not enough
+	CategoryFunds = "funds"
+	// The input of the user is invalid
+	CategoryInput = "input"
+)
+
+// Actions suggested to the user of a failure reason
+const (
+	// Correct the address, amount or other input and try again
+	ActionFixInput = "fix-input"
+	// Wait for the locked funds or a cooldown, then try again
+	ActionWait = "wait"
+	// Receive more funds or spend less
+	ActionAddFunds = "add-funds"
+	// Sign again to confirm the transaction
+	ActionReauthenticate = "reauthenticate"
+	// Ask the administrator to change the spend policy
+	ActionChangePolicy = "change-policy"
+	// Check the password and try again
+	ActionCheckPassword = "check-password"
+	// Nothing the user can do, the transaction can not be sent
+	ActionNone = "none"
+)
+
+/*
+Reason is an error carrying machine readable metadata of a user facing failure,
+so wallet UIs can show it in their language without parsing the English message.
+The code identifies the failure, the category groups failures for handling, the
+action is what the user can do about it and the params are the values in the
+message, like amounts and heights. Get the reason of an error by ReasonOf.
+*/
+type Reason struct {
+	Code     string            `json:"code"`
+	Category string            `json:"category"`
+	Action   string            `json:"action"`
+	Params   map[string]string `json:"params,omitempty"`
+	Message  string            `json:"message"`
+}
+
+// Create a failure reason, params are pairs of names and values
+func NewReason(code, category, action, message string, params ...string) *Reason {
+	reason := &Reason{Code: code, Category: category, Action: action, Message: message}
+	if len(params) > 0 {
+		reason.Params = make(map[string]string)
+		for i := 0; i+1 < len(params); i += 2 {
+			reason.Params[params[i]] = params[i+1]
+		}
+	}
+	return reason
+}
+
+func (r *Reason) Error() string {
+	return r.Message
+}
+
+// Get the reason of the error, nil if the error carries no reason. Wrapped
+// errors are unwrapped by their Unwrap() or Cause() method to find the reason.
+func ReasonOf(err error) *Reason {
+	for err != nil {
+		if reason, ok := err.(*Reason); ok {
+			return reason
+		}
+		switch wrapper := err.(type) {
+		case interface{ Unwrap() error }:
+			err = wrapper.Unwrap()
+		case interface{ Cause() error }:
+			err = wrapper.Cause()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+/*
+Get the message of the reason from the catalog of message templates by code, the
+names of the params in braces like {amount} are replaced by their values. The
+English message is returned if the catalog has no template for the code.
+*/
+func (r *Reason) Localize(catalog map[string]string) string {
+	template, ok := catalog[r.Code]
+	if !ok {
+		return r.Message
+	}
+	for name, value := range r.Params {
+		template = strings.Replace(template, "{"+name+"}", value, -1)
+	}
+	return template
+}
@@ -0,0 +1,127 @@
+package sdk
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+// repairHandler sends the request of a block downloaded again for a corrupted
+// record, a stalled request is retried with another peer
+type repairHandler struct {
+	service *SPVServiceImpl
+}
+
+func (h *repairHandler) OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256) {
+	peer.Send(msg.NewDataReq(reqType, hash))
+}
+
+// The repair failed with every retry, restart the sync, it repairs the
+// record again when it meets the corruption
+func (h *repairHandler) OnRequestTimeout(hash Uint256) {
+	service := h.service
+	service.repairLock.Lock()
+	if service.repair == nil || !service.repair.hash.IsEqual(hash) {
+		service.repairLock.Unlock()
+		return
+	}
+	service.repair = nil
+	service.repairLock.Unlock()
+
+	log.Warn("Repair block request timeout:", hash.String())
+	service.Lock()
+	defer service.Unlock()
+	service.syncBlocks()
+}
+
+// Retry with a random established peer other than the stalled one
+func (h *repairHandler) OnRequestRetry(peer *net.Peer, reqType uint8, hash Uint256) *net.Peer {
+	var peers []*net.Peer
+	for _, p := range h.service.PeerManager().ConnectedPeers() {
+		if p.State() == p2p.ESTABLISH && p.ID() != peer.ID() {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == 0 {
+		return peer
+	}
+	retry := peers[rand.Intn(len(peers))]
+	log.Debug("Repair block request", hash.String(), "stalled on peer", peer.ID(), "retry with peer", retry.ID())
+	return retry
+}
+
+func (h *repairHandler) OnResponse(peer *net.Peer, reqType uint8, duration time.Duration) {
+	h.service.OnResponse(peer, reqType, duration)
+}
+
+func (h *repairHandler) RequestTimeout(peer *net.Peer, reqType uint8) time.Duration {
+	return h.service.RequestTimeout(peer, reqType)
+}
+
+// Stop syncing and download the block of the corrupted record again,
+// the sync restarts after the record is repaired
+func (service *SPVServiceImpl) repairRecord(err *db.ErrCorruptedRecord) {
+	service.stopSyncing()
+
+	peer := service.PeerManager().GetBestPeer()
+	if peer == nil {
+		return
+	}
+
+	repair := &Request{
+		peer:    peer,
+		hash:    err.Hash,
+		reqType: p2p.BlockData,
+		handler: &repairHandler{service: service},
+	}
+	service.repairLock.Lock()
+	if service.repair != nil {
+		service.repair.Finish()
+	}
+	service.repair = repair
+	service.repairLock.Unlock()
+
+	repair.Start()
+}
+
+// Repair the corrupted record if the block is downloaded for it, returns
+// if the block is handled
+func (service *SPVServiceImpl) handleRepairBlock(block *bloom.MerkleBlock) bool {
+	blockHash := block.Header.Hash()
+
+	// Most blocks are not for a repair, check it before taking the service lock
+	service.repairLock.Lock()
+	repair := service.repair
+	if repair == nil || !repair.hash.IsEqual(blockHash) {
+		service.repairLock.Unlock()
+		return false
+	}
+	service.repair = nil
+	service.repairLock.Unlock()
+	repair.OnResponse()
+
+	service.Lock()
+	defer service.Unlock()
+
+	err := service.chain.RepairHeader(block.Header)
+	if err != nil {
+		log.Error("Repair header failed:", err)
+		if corrupted, ok := err.(*db.ErrCorruptedRecord); ok {
+			// The parent is also corrupted, repair it next
+			service.repairRecord(corrupted)
+		}
+		return true
+	}
+
+	log.Info("Header repaired:", blockHash.String())
+	service.syncBlocks()
+	return true
+}
@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+func TestRepairTimeout(t *testing.T) {
+	service := newTestService(t)
+	hash := service.chain.ChainTip().Hash()
+	service.repair = &Request{peer: new(net.Peer), hash: hash, reqType: p2p.BlockData}
+
+	handler := &repairHandler{service: service}
+	callWithin(t, "repair timeout", func() {
+		handler.OnRequestTimeout(hash)
+	})
+	if service.repair != nil {
+		t.Error("repair request kept after timeout")
+	}
+}
+
+func TestRepairBlock(t *testing.T) {
+	service := newTestService(t)
+	tip := service.chain.ChainTip()
+	block := &bloom.MerkleBlock{Header: core.Header{
+		Previous:  tip.Hash(),
+		Timestamp: tip.Timestamp + 1,
+		Bits:      tip.Bits,
+		Height:    tip.Height + 1,
+	}}
+	repair := &Request{
+		peer:    new(net.Peer),
+		hash:    block.Header.Hash(),
+		reqType: p2p.BlockData,
+		handler: &repairHandler{service: service},
+	}
+	service.repair = repair
+
+	// Blocks not requested for a repair are left to the sync
+	other := &bloom.MerkleBlock{Header: tip.Header}
+	if service.handleRepairBlock(other) {
+		t.Error("block not requested for repair handled")
+	}
+
+	var handled bool
+	callWithin(t, "repair block", func() {
+		handled = service.handleRepairBlock(block)
+	})
+	if !handled {
+		t.Error("repair block not handled")
+	}
+	if service.repair != nil {
+		t.Error("repair request kept after the block is received")
+	}
+}
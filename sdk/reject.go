@@ -0,0 +1,111 @@
+package sdk
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// The codes of reject messages, why a peer refused a message
+const (
+	RejectMalformed       = byte(0x01)
+	RejectInvalid         = byte(0x10)
+	RejectObsolete        = byte(0x11)
+	RejectDuplicate       = byte(0x12)
+	RejectNonstandard     = byte(0x40)
+	RejectDust            = byte(0x41)
+	RejectInsufficientFee = byte(0x42)
+	RejectCheckpoint      = byte(0x43)
+)
+
+// Reject is sent by a peer refusing a message, like a transaction failed its
+// verification, the hash is the transaction or block refused
+type Reject struct {
+	Cmd    string
+	Code   byte
+	Reason string
+	Hash   Uint256
+}
+
+func (msg *Reject) CMD() string {
+	return "reject"
+}
+
+func (msg *Reject) Serialize(w io.Writer) error {
+	err := WriteVarString(w, msg.Cmd)
+	if err != nil {
+		return err
+	}
+	err = WriteUint8(w, msg.Code)
+	if err != nil {
+		return err
+	}
+	err = WriteVarString(w, msg.Reason)
+	if err != nil {
+		return err
+	}
+	return msg.Hash.Serialize(w)
+}
+
+func (msg *Reject) Deserialize(r io.Reader) error {
+	var err error
+	msg.Cmd, err = ReadVarString(r)
+	if err != nil {
+		return err
+	}
+	msg.Code, err = ReadUint8(r)
+	if err != nil {
+		return err
+	}
+	msg.Reason, err = ReadVarString(r)
+	if err != nil {
+		return err
+	}
+	// Rejects of messages other than tx and block may have no hash
+	if err = msg.Hash.Deserialize(r); err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Get the failure reason of the reject message, the reject code maps to the
+// reason code, the message of the peer is kept in the "reason" param
+func RejectReason(reject *Reject) *Reason {
+	code, action := "rejected", ActionNone
+	switch reject.Code {
+	case RejectMalformed:
+		code = "rejected_malformed"
+	case RejectInvalid:
+		code = "rejected_invalid"
+	case RejectObsolete:
+		code = "rejected_obsolete"
+	case RejectDuplicate:
+		code = "rejected_duplicate"
+	case RejectNonstandard:
+		code = "rejected_nonstandard"
+	case RejectDust:
+		code, action = "rejected_dust", ActionFixInput
+	case RejectInsufficientFee:
+		code, action = "rejected_insufficient_fee", ActionFixInput
+	case RejectCheckpoint:
+		code = "rejected_checkpoint"
+	}
+	return NewReason(code, CategoryReject, action,
+		fmt.Sprintf("%s %s rejected by peer, %s", reject.Cmd, reject.Hash.String(), reject.Reason),
+		"cmd", reject.Cmd, "hash", reject.Hash.String(), "reason", reject.Reason)
+}
+
+// A refused transaction fails the send operations waiting for it with the
+// reason of the reject
+func (service *SPVServiceImpl) OnReject(peer *net.Peer, reject *Reject) error {
+	reason := RejectReason(reject)
+	log.Warnf("Peer %d rejected %s", peer.ID(), reason.Message)
+	if reject.Cmd == "tx" {
+		service.propagation.failOperations(reject.Hash, reason)
+	}
+	return nil
+}
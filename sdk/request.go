@@ -2,6 +2,8 @@ package sdk
 
 import (
 	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -11,20 +13,38 @@ import (
 const (
 	RequestTimeout = 15
 	MaxRetryTimes  = 3
+
+	// getdata message carries one hash, so a large hash set is sent as a
+	// pipeline of requests, by default at most this number of requests are in flight
+	MaxRequestsInFlight = 50
 )
 
 type RequestHandler interface {
 	OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256)
 	OnRequestTimeout(Uint256)
+	// Returns the peer to retry the request with after a timeout
+	OnRequestRetry(peer *net.Peer, reqType uint8, hash Uint256) *net.Peer
+	OnResponse(peer *net.Peer, reqType uint8, duration time.Duration)
+	RequestTimeout(peer *net.Peer, reqType uint8) time.Duration
 }
 
+// The message handler finishes and redirects requests on every received message,
+// so these never wait for the request goroutine. The peer is guarded by peerLock,
+// the send time and the finished flag are updated atomically, and the goroutine
+// is signaled by closing or buffered channels.
 type Request struct {
+	peerLock   sync.Mutex
 	peer       *net.Peer
 	hash       Uint256
 	reqType    uint8
 	retryTimes int
+	sent       int64 // unix nano of the last send, accessed atomically
+	finished   int32 // accessed atomically
 	doneChan   chan byte
+	redirect   chan byte
 	handler    RequestHandler
+	// Counter of running request goroutines, nil if not counted
+	running *int32
 }
 
 func (r *Request) Start() error {
@@ -32,13 +52,24 @@ func (r *Request) Start() error {
 		return errors.New("RequestHandler not set")
 	}
 	r.doneChan = make(chan byte)
-	go r.sendRequest()
+	r.redirect = make(chan byte, 1)
+	if r.running == nil {
+		go r.sendRequest()
+		return nil
+	}
+	atomic.AddInt32(r.running, 1)
+	go func() {
+		defer atomic.AddInt32(r.running, -1)
+		r.sendRequest()
+	}()
 	return nil
 }
 
 func (r *Request) sendRequest() {
-	r.handler.OnSendRequest(r.peer, r.reqType, r.hash)
-	timer := time.NewTimer(time.Second * RequestTimeout)
+	peer := r.Peer()
+	atomic.StoreInt64(&r.sent, time.Now().UnixNano())
+	r.handler.OnSendRequest(peer, r.reqType, r.hash)
+	timer := time.NewTimer(r.handler.RequestTimeout(peer, r.reqType))
 	select {
 	case <-timer.C:
 		if r.retryTimes >= MaxRetryTimes {
@@ -47,15 +78,60 @@ func (r *Request) sendRequest() {
 			break
 		}
 		r.retryTimes++
+		r.setPeer(r.handler.OnRequestRetry(peer, r.reqType, r.hash))
+		r.sendRequest()
+	case <-r.redirect:
+		timer.Stop()
+		r.retryTimes = 0
 		r.sendRequest()
 	case <-r.doneChan:
 		timer.Stop()
 	}
 }
 
+// Send the request to another peer, if the request is not started yet,
+// it will be sent to the peer when started
+func (r *Request) Redirect(peer *net.Peer) {
+	r.setPeer(peer)
+	if r.redirect != nil {
+		select {
+		case r.redirect <- 1:
+		default:
+		}
+	}
+}
+
+// Get the peer the request is sent to
+func (r *Request) Peer() *net.Peer {
+	r.peerLock.Lock()
+	defer r.peerLock.Unlock()
+	return r.peer
+}
+
+// Get the time the request is last sent
+func (r *Request) Sent() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&r.sent))
+}
+
+func (r *Request) setPeer(peer *net.Peer) {
+	r.peerLock.Lock()
+	r.peer = peer
+	r.peerLock.Unlock()
+}
+
+// Finish the request answered by the peer and record the response time
+func (r *Request) OnResponse() {
+	sent := atomic.LoadInt64(&r.sent)
+	r.handler.OnResponse(r.Peer(), r.reqType, time.Duration(time.Now().UnixNano()-sent))
+	r.Finish()
+}
+
+// Finish the request, it returns immediately and is safe to call more than once
 func (r *Request) Finish() {
+	if !atomic.CompareAndSwapInt32(&r.finished, 0, 1) {
+		return
+	}
 	if r.doneChan != nil {
-		r.doneChan <- 1
-		r.doneChan = nil
+		close(r.doneChan)
 	}
 }
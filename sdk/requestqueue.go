@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 	"github.com/elastos/Elastos.ELA.SPV/net"
@@ -16,6 +18,8 @@ import (
 
 type RequestQueueHandler interface {
 	OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256)
+	OnResponse(peer *net.Peer, reqType uint8, duration time.Duration)
+	RequestTimeout(peer *net.Peer, reqType uint8) time.Duration
 	OnRequestError(error)
 	OnRequestFinished(*FinishedReqPool)
 }
@@ -33,11 +37,26 @@ type RequestQueue struct {
 	blockTxs         map[Uint256]Uint256
 	finished         *FinishedReqPool
 	handler          RequestQueueHandler
+	maxInFlight      int32
+	running          int32
+	scheduler        *downloadScheduler
+	// The filter reloads of the sync round, the blocks requested before a reload
+	// from another peer than the one kept are requested again
+	reloadsLock *sync.Mutex
+	reloads     []filterReload
+}
+
+// A reload of the filter on the peers except the kept peer, which added the
+// outpoints of the wallet transactions to its filter by itself
+type filterReload struct {
+	time time.Time
+	kept *net.Peer
 }
 
 func NewRequestQueue(size int, handler RequestQueueHandler) *RequestQueue {
 	queue := new(RequestQueue)
 	queue.size = size
+	queue.maxInFlight = MaxRequestsInFlight
 	queue.hashesQueue = make(chan Uint256, size)
 	queue.blocksQueue = make(chan Uint256, size)
 	queue.blockTxsQueue = make(chan Uint256, size)
@@ -51,6 +70,8 @@ func NewRequestQueue(size int, handler RequestQueueHandler) *RequestQueue {
 		requests: make(map[Uint256]*BlockTxsRequest),
 	}
 	queue.handler = handler
+	queue.scheduler = newDownloadScheduler()
+	queue.reloadsLock = new(sync.Mutex)
 
 	go queue.start()
 	return queue
@@ -78,6 +99,9 @@ func (queue *RequestQueue) StartBlockRequest(peer *net.Peer, hash Uint256) {
 	// Block the method when queue is filled
 	queue.blocksQueue <- hash
 
+	// Pick the peer when the request is started, so the blocks in flight are spread
+	peer = queue.scheduler.assign(hash, peer)
+
 	queue.blockReqsLock.Lock()
 	// Create a new block request
 	blockRequest := &Request{
@@ -85,6 +109,7 @@ func (queue *RequestQueue) StartBlockRequest(peer *net.Peer, hash Uint256) {
 		hash:    hash,
 		reqType: p2p.BlockData,
 		handler: queue,
+		running: &queue.running,
 	}
 	// Add to request queue
 	queue.blockRequests[hash] = blockRequest
@@ -95,6 +120,12 @@ func (queue *RequestQueue) StartBlockRequest(peer *net.Peer, hash Uint256) {
 }
 
 func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.MerkleBlock, txIds []*Uint256) {
+	queue.startBlockTxsRequest(peer, time.Now(), block, txIds)
+}
+
+// Request the transactions of the block received from the peer, requested at
+// the sent time
+func (queue *RequestQueue) startBlockTxsRequest(peer *net.Peer, sent time.Time, block *bloom.MerkleBlock, txIds []*Uint256) {
 	blockHash := block.Header.Hash()
 	// No block transactions to request, notify request finished.
 	if len(txIds) == 0 {
@@ -102,6 +133,8 @@ func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.Mer
 		queue.OnRequestFinished(&BlockTxsRequest{
 			BlockHash: blockHash,
 			Block:     *block,
+			peer:      peer,
+			sent:      sent,
 		})
 		return
 	}
@@ -113,29 +146,82 @@ func (queue *RequestQueue) StartBlockTxsRequest(peer *net.Peer, block *bloom.Mer
 	queue.blockTxsQueue <- blockHash
 
 	queue.blockTxsReqsLock.Lock()
-	txRequestQueue := make(map[Uint256]*Request)
+	txRequests := make([]*Request, 0, len(txIds))
 	for _, txId := range txIds {
 		// Mark txId related block
 		queue.blockTxs[*txId] = blockHash
-		// Start a tx request
-		txRequest := &Request{
+		// Create a tx request, it will be started by the block txs request pipeline
+		txRequests = append(txRequests, &Request{
 			peer:    peer,
 			hash:    *txId,
 			reqType: p2p.TxData,
 			handler: queue,
-		}
-		txRequestQueue[*txId] = txRequest
-		txRequest.Start()
+			running: &queue.running,
+		})
 	}
 
-	blockTxsRequest := &BlockTxsRequest{
-		BlockHash:      blockHash,
-		Block:          *block,
-		txRequestQueue: txRequestQueue,
+	queue.blockTxsRequests[blockHash] = newBlockTxsRequest(peer, sent, block, txRequests, int(atomic.LoadInt32(&queue.maxInFlight)))
+	queue.blockTxsReqsLock.Unlock()
+}
+
+// Set the max number of transaction requests in flight per block, at least one,
+// it takes effect from the next block
+func (queue *RequestQueue) SetMaxInFlight(maxInFlight int) {
+	// No request would be started, and the block would never finish
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	atomic.StoreInt32(&queue.maxInFlight, int32(maxInFlight))
+}
+
+// Download the blocks from all the peers returned by the function instead of the
+// sync peer only, the transactions of a block are requested from the peer of the block.
+// Set nil to download from the sync peer only.
+func (queue *RequestQueue) SetDownloadPeers(peers func() []*net.Peer) {
+	queue.scheduler.setPeers(peers)
+}
+
+// Check if the blocks are downloaded from all the peers
+func (queue *RequestQueue) ParallelDownload() bool {
+	return queue.scheduler.parallel()
+}
+
+// Check if the block or transaction is requested from the peer
+func (queue *RequestQueue) RequestedFrom(hash Uint256, peerId uint64) bool {
+	if queue.scheduler.assignedTo(hash, peerId) {
+		return true
 	}
 
-	queue.blockTxsRequests[blockHash] = blockTxsRequest
+	queue.blockTxsReqsLock.Lock()
+	blockHash, ok := queue.blockTxs[hash]
 	queue.blockTxsReqsLock.Unlock()
+	return ok && queue.scheduler.assignedTo(blockHash, peerId)
+}
+
+// Redirect the request of the block or transaction to another peer,
+// returns false if the hash is not requested
+func (queue *RequestQueue) Redirect(hash Uint256, peer *net.Peer) bool {
+	queue.blockReqsLock.Lock()
+	request, ok := queue.blockRequests[hash]
+	queue.blockReqsLock.Unlock()
+	if ok {
+		queue.scheduler.move(hash, peer)
+		request.Redirect(peer)
+		return true
+	}
+
+	queue.blockTxsReqsLock.Lock()
+	defer queue.blockTxsReqsLock.Unlock()
+
+	blockHash, ok := queue.blockTxs[hash]
+	if !ok {
+		return false
+	}
+	blockTxsRequest, ok := queue.blockTxsRequests[blockHash]
+	if !ok {
+		return false
+	}
+	return blockTxsRequest.Redirect(hash, peer)
 }
 
 func (queue *RequestQueue) InBlockRequestQueue(blockHash Uint256) bool {
@@ -167,10 +253,31 @@ func (queue *RequestQueue) OnSendRequest(peer *net.Peer, reqType uint8, hash Uin
 	queue.handler.OnSendRequest(peer, reqType, hash)
 }
 
+func (queue *RequestQueue) OnResponse(peer *net.Peer, reqType uint8, duration time.Duration) {
+	queue.handler.OnResponse(peer, reqType, duration)
+}
+
+func (queue *RequestQueue) RequestTimeout(peer *net.Peer, reqType uint8) time.Duration {
+	return queue.handler.RequestTimeout(peer, reqType)
+}
+
 func (queue *RequestQueue) OnRequestTimeout(hash Uint256) {
 	queue.handler.OnRequestError(errors.New("Request timeout with hash: " + hash.String()))
 }
 
+// A stalled block request is assigned to another peer, transactions are
+// retried with the same peer as they are matched by its filter
+func (queue *RequestQueue) OnRequestRetry(peer *net.Peer, reqType uint8, hash Uint256) *net.Peer {
+	if reqType != p2p.BlockData {
+		return peer
+	}
+	retry := queue.scheduler.reassign(hash, peer)
+	if retry.ID() != peer.ID() {
+		log.Debug("Block request", hash.String(), "stalled on peer", peer.ID(), "retry with peer", retry.ID())
+	}
+	return retry
+}
+
 func (queue *RequestQueue) OnBlockReceived(block *bloom.MerkleBlock, txIds []*Uint256) error {
 	queue.blockReqsLock.Lock()
 	defer queue.blockReqsLock.Unlock()
@@ -185,12 +292,13 @@ func (queue *RequestQueue) OnBlockReceived(block *bloom.MerkleBlock, txIds []*Ui
 	}
 
 	// Remove from block request list
-	request.Finish()
+	request.OnResponse()
 	delete(queue.blockRequests, blockHash)
 	<-queue.blocksQueue
+	queue.scheduler.received(blockHash)
 
 	// Request block transactions
-	queue.StartBlockTxsRequest(request.peer, block, txIds)
+	queue.startBlockTxsRequest(request.Peer(), request.Sent(), block, txIds)
 
 	return nil
 }
@@ -233,6 +341,15 @@ func (queue *RequestQueue) OnTxReceived(tx *Transaction) error {
 }
 
 func (queue *RequestQueue) OnRequestFinished(request *BlockTxsRequest) {
+	queue.scheduler.release(request.BlockHash)
+
+	// Filtered by the filter before reloading it, request the block again
+	if queue.outdated(request) {
+		log.Debug("Request block", request.BlockHash.String(), "again with the reloaded filter")
+		go queue.StartBlockRequest(queue.peer, request.BlockHash)
+		return
+	}
+
 	// Add to finished pool
 	queue.finished.Add(request)
 
@@ -242,6 +359,40 @@ func (queue *RequestQueue) OnRequestFinished(request *BlockTxsRequest) {
 	queue.handler.OnRequestFinished(queue.finished)
 }
 
+/*
+Request again the blocks filtered by the filter before it is reloaded, those
+requested before from peers other than the given peer, which added the outpoints
+of the wallet transactions to its filter by itself. The blocks received are
+requested again right away, the requests in flight go on, so the peers answering
+them are not taken as misbehaving, and their blocks are requested again when they
+finish. Call it after the filter is reloaded on the peers.
+*/
+func (queue *RequestQueue) RequestAgainExcept(peer *net.Peer) {
+	queue.reloadsLock.Lock()
+	queue.reloads = append(queue.reloads, filterReload{time: time.Now(), kept: peer})
+	queue.reloadsLock.Unlock()
+
+	for _, request := range queue.finished.RemoveIf(queue.outdated) {
+		log.Debug("Request block", request.BlockHash.String(), "again with the reloaded filter")
+		go queue.StartBlockRequest(queue.peer, request.BlockHash)
+	}
+}
+
+// Check if the block is requested before a filter reload from another peer
+// than the one kept
+func (queue *RequestQueue) outdated(request *BlockTxsRequest) bool {
+	queue.reloadsLock.Lock()
+	defer queue.reloadsLock.Unlock()
+
+	for _, reload := range queue.reloads {
+		if request.sent.Before(reload.time) && (request.peer == nil || reload.kept == nil ||
+			request.peer.ID() != reload.kept.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (queue *RequestQueue) Clear() {
 	// Clear hashes chan
 	for len(queue.hashesQueue) > 0 {
@@ -274,4 +425,11 @@ func (queue *RequestQueue) Clear() {
 
 	// Clear finished requests pool
 	queue.finished.Clear()
+
+	// Clear the peers of the blocks
+	queue.scheduler.clear()
+
+	queue.reloadsLock.Lock()
+	queue.reloads = nil
+	queue.reloadsLock.Unlock()
 }
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestSetMaxInFlight(t *testing.T) {
+	queue := NewRequestQueue(MaxRequests, nil)
+	for _, test := range []struct{ set, want int32 }{{10, 10}, {1, 1}, {0, 1}, {-5, 1}} {
+		queue.SetMaxInFlight(int(test.set))
+		if got := atomic.LoadInt32(&queue.maxInFlight); got != test.want {
+			t.Errorf("set %d: max in flight %d, want %d", test.set, got, test.want)
+		}
+	}
+}
+
+func TestOutdatedAfterFilterReload(t *testing.T) {
+	kept, other := new(net.Peer), new(net.Peer)
+	kept.SetID(1)
+	other.SetID(2)
+
+	queue := NewRequestQueue(MaxRequests, nil)
+	before := time.Now()
+	queue.reloads = append(queue.reloads, filterReload{time: before.Add(time.Second), kept: kept})
+	after := before.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		peer     *net.Peer
+		sent     time.Time
+		outdated bool
+	}{
+		{"kept peer before reload", kept, before, false},
+		{"other peer before reload", other, before, true},
+		{"other peer after reload", other, after, false},
+	}
+	for i, test := range tests {
+		request := &BlockTxsRequest{peer: test.peer, sent: test.sent}
+		if outdated := queue.outdated(request); outdated != test.outdated {
+			t.Errorf("%s: outdated %v, want %v", test.name, outdated, test.outdated)
+		}
+
+		// The finished blocks not committed yet are taken out of the pool
+		request.BlockHash = Uint256{byte(i + 1)}
+		request.Block.Header.Previous = Uint256{byte(i + 1), 1}
+		queue.finished.Add(request)
+	}
+	removed := queue.finished.RemoveIf(queue.outdated)
+	if len(removed) != 1 || removed[0].peer != other || !removed[0].sent.Equal(before) {
+		t.Errorf("removed %d requests, want the one of the other peer before reload", len(removed))
+	}
+	if queue.finished.Length() != 2 {
+		t.Errorf("finished pool length %d, want 2", queue.finished.Length())
+	}
+
+	queue.Clear()
+	if queue.outdated(&BlockTxsRequest{peer: other, sent: before}) {
+		t.Error("outdated after the sync round is cleared")
+	}
+}
@@ -0,0 +1,192 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	gonet "net"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+)
+
+const (
+	// The stall deadline of a request is TimeoutFactor times of the p99 response time
+	TimeoutFactor = 3
+	// The fixed RequestTimeout is used until MinTimeoutSamples responses recorded
+	MinTimeoutSamples = 50
+	// Bounds of the adaptive stall deadline
+	MinRequestTimeout = time.Second * 2
+	MaxRequestTimeout = time.Second * 60
+	// Sample counts are halved when over MaxResponseSamples, so recent responses weigh more
+	MaxResponseSamples = 10000
+	// Save response stats to data store every ResponseStatsSaveInterval responses
+	ResponseStatsSaveInterval = 500
+)
+
+// Upper bound of the first histogram bucket, each next bucket doubles it,
+// the last bucket holds all the slower responses
+const (
+	firstBucketBound = time.Millisecond * 25
+	responseBuckets  = 13
+)
+
+// Histogram of response times of one message type from one peer class
+type responseHistogram struct {
+	Counts [responseBuckets]uint64
+	Total  uint64
+}
+
+func (h *responseHistogram) add(duration time.Duration) {
+	bucket, bound := 0, firstBucketBound
+	for bucket < responseBuckets-1 && duration > bound {
+		bucket++
+		bound *= 2
+	}
+	h.Counts[bucket]++
+	h.Total++
+
+	if h.Total > MaxResponseSamples {
+		h.Total = 0
+		for i := range h.Counts {
+			h.Counts[i] /= 2
+			h.Total += h.Counts[i]
+		}
+	}
+}
+
+// The upper bound of the bucket the given percentile falls in
+func (h *responseHistogram) percentile(p float64) time.Duration {
+	target := uint64(float64(h.Total) * p)
+	var count uint64
+	bound := firstBucketBound
+	for _, c := range h.Counts {
+		count += c
+		if count >= target {
+			break
+		}
+		bound *= 2
+	}
+	return bound
+}
+
+// responseStats derives the stall deadline of requests from the historical
+// response times per message type and peer class, instead of a fixed timeout
+type responseStats struct {
+	sync.Mutex
+	histograms map[string]*responseHistogram
+	recorded   int
+	database   db.DataStore
+}
+
+func newResponseStats(database db.DataStore) *responseStats {
+	stats := &responseStats{
+		histograms: make(map[string]*responseHistogram),
+		database:   database,
+	}
+
+	// Load persisted stats if data store supports it
+	if store, ok := database.(db.ResponseStatsStore); ok {
+		data, err := store.GetResponseStats()
+		if err == nil {
+			json.Unmarshal(data, &stats.histograms)
+		}
+	}
+
+	return stats
+}
+
+// Peers on the loopback or a private network respond much faster than
+// peers on the internet, so they are tracked separately
+func peerClass(peer *net.Peer) string {
+	ip16 := peer.IP16()
+	ip := gonet.IP(ip16[:])
+	if ip.IsLoopback() {
+		return "local"
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if ip4[0] == 10 || ip4[0] == 172 && ip4[1]&0xf0 == 16 || ip4[0] == 192 && ip4[1] == 168 {
+			return "local"
+		}
+	}
+	return "internet"
+}
+
+func responseKey(peer *net.Peer, reqType uint8) string {
+	var msgType string
+	switch reqType {
+	case p2p.BlockData:
+		msgType = "block"
+	case p2p.TxData:
+		msgType = "tx"
+	default:
+		msgType = fmt.Sprint(reqType)
+	}
+	return msgType + "/" + peerClass(peer)
+}
+
+func (s *responseStats) record(peer *net.Peer, reqType uint8, duration time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := responseKey(peer, reqType)
+	histogram, ok := s.histograms[key]
+	if !ok {
+		histogram = new(responseHistogram)
+		s.histograms[key] = histogram
+	}
+	histogram.add(duration)
+
+	s.recorded++
+	if s.recorded%ResponseStatsSaveInterval == 0 {
+		s.save()
+	}
+}
+
+// The stall deadline of the request to the peer
+func (s *responseStats) timeout(peer *net.Peer, reqType uint8) time.Duration {
+	s.Lock()
+	defer s.Unlock()
+
+	histogram, ok := s.histograms[responseKey(peer, reqType)]
+	if !ok || histogram.Total < MinTimeoutSamples {
+		return time.Second * RequestTimeout
+	}
+
+	timeout := histogram.percentile(0.99) * TimeoutFactor
+	if timeout < MinRequestTimeout {
+		return MinRequestTimeout
+	}
+	if timeout > MaxRequestTimeout {
+		return MaxRequestTimeout
+	}
+	return timeout
+}
+
+func (s *responseStats) Save() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.save()
+}
+
+func (s *responseStats) save() {
+	store, ok := s.database.(db.ResponseStatsStore)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(s.histograms)
+	if err != nil {
+		return
+	}
+
+	err = store.PutResponseStats(data)
+	if err != nil {
+		log.Error("Save response stats failed,", err)
+	}
+}
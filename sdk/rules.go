@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+Rules are the consensus rules the SPV client validates from an activation height
+until the rules of a later height activate, so hard forks like new header versions,
+new transaction types and DPoS are followed by updating the network params instead
+of the code. The rules at a height are the last ones activated at or below it, the
+defaults apply below the first activation height.
+*/
+type Rules struct {
+	// The height the rules activate at
+	Height uint32
+
+	// Versions of the block headers accepted, empty means any version
+	HeaderVersions []uint32
+
+	// Types of the transactions accepted, transactions of other types are refused
+	// in blocks and when relayed, empty means any type
+	TxTypes []TransactionType
+
+	// The max proof of work target in compact form, 0 means PowLimit
+	PowLimitBits uint32
+
+	// Blocks are confirmed by DPoS arbiters from the height. The confirmations are
+	// not verified by the SPV client, headers are still checked by proof of work,
+	// applications read it by Blockchain.RulesAt to tell which era a block is in.
+	DPoS bool
+}
+
+// Check if the header version is accepted by the rules
+func (r *Rules) AcceptsHeaderVersion(version uint32) bool {
+	if len(r.HeaderVersions) == 0 {
+		return true
+	}
+	for _, accepted := range r.HeaderVersions {
+		if version == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the transaction type is accepted by the rules
+func (r *Rules) AcceptsTxType(txType TransactionType) bool {
+	if len(r.TxTypes) == 0 {
+		return true
+	}
+	for _, accepted := range r.TxTypes {
+		if txType == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the max proof of work target of the rules
+func (r *Rules) PowLimit() *big.Int {
+	if r.PowLimitBits == 0 {
+		return PowLimit
+	}
+	return CompactToBig(r.PowLimitBits)
+}
+
+// Set the consensus rules by activation height, the chain validates headers and
+// transactions with the rules at their heights
+func (bc *Blockchain) SetRules(rules []Rules) {
+	sorted := make([]Rules, len(rules))
+	copy(sorted, rules)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Height < sorted[j].Height })
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.rules = sorted
+}
+
+// Get the consensus rules at the height
+func (bc *Blockchain) RulesAt(height uint32) Rules {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.rulesAt(height)
+}
+
+func (bc *Blockchain) rulesAt(height uint32) Rules {
+	index := sort.Search(len(bc.rules), func(i int) bool { return bc.rules[i].Height > height })
+	if index == 0 {
+		return Rules{}
+	}
+	return bc.rules[index-1]
+}
+
+// Check the block header and transactions with the rules at the block height
+func (bc *Blockchain) checkBlockRules(header *Header, txs []Transaction) error {
+	rules := bc.rulesAt(header.Height)
+	if !rules.AcceptsHeaderVersion(header.Version) {
+		return fmt.Errorf("[Blockchain], header version %d is not accepted at height %d",
+			header.Version, header.Height)
+	}
+	for i := range txs {
+		if err := checkTxRules(&rules, &txs[i], header.Height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTxRules(rules *Rules, tx *Transaction, height uint32) error {
+	if !rules.AcceptsTxType(tx.TxType) {
+		return fmt.Errorf("[Blockchain], transaction %s of type 0x%02x is not accepted at height %d",
+			tx.Hash().String(), byte(tx.TxType), height)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"errors"
+	"strings"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+)
+
+const (
+	// The wildcard in a script template matching any public key
+	KeyWildcard = "<key>"
+
+	// The length of a compressed public key, a wildcard matches a push of it
+	WildcardKeyLength = 33
+)
+
+/*
+ScriptTemplate is a pattern of redeem scripts, the script hex string with wildcards
+for public keys, like "21<key>ac" for any standard script. It is used to watch a family
+of contracts, like channel scripts across counterparties, without knowing all the keys.
+ELA outputs only carry program hashes, so a template matches the programs of the
+transactions spending from a contract, and the program hash of the matched script
+can be watched from then on.
+*/
+type ScriptTemplate struct {
+	template string
+	parts    [][]byte
+}
+
+// Parse a script template from the script hex string with <key> wildcards
+func ParseScriptTemplate(template string) (*ScriptTemplate, error) {
+	template = strings.ToLower(strings.TrimSpace(template))
+	if template == "" {
+		return nil, errors.New("empty script template")
+	}
+	if !strings.Contains(template, KeyWildcard) {
+		return nil, errors.New("script template has no " + KeyWildcard + " wildcard")
+	}
+
+	var parts [][]byte
+	for _, str := range strings.Split(template, KeyWildcard) {
+		part, err := HexStringToBytes(str)
+		if err != nil {
+			return nil, errors.New("invalid script template hex string " + str)
+		}
+		parts = append(parts, part)
+	}
+	return &ScriptTemplate{template: template, parts: parts}, nil
+}
+
+func (t *ScriptTemplate) String() string {
+	return t.template
+}
+
+// Check if the script matches this template, the fixed parts must be equal
+// and each wildcard is filled by a public key
+func (t *ScriptTemplate) Match(script []byte) bool {
+	_, ok := t.MatchKeys(script)
+	return ok
+}
+
+// Match the script with this template, and return the public keys filling the wildcards
+func (t *ScriptTemplate) MatchKeys(script []byte) ([][]byte, bool) {
+	size := (len(t.parts) - 1) * WildcardKeyLength
+	for _, part := range t.parts {
+		size += len(part)
+	}
+	if len(script) != size {
+		return nil, false
+	}
+
+	var keys [][]byte
+	offset := 0
+	for i, part := range t.parts {
+		if string(script[offset:offset+len(part)]) != string(part) {
+			return nil, false
+		}
+		offset += len(part)
+		if i == len(t.parts)-1 {
+			break
+		}
+		key := script[offset : offset+WildcardKeyLength]
+		if _, err := crypto.DecodePoint(key); err != nil {
+			return nil, false
+		}
+		keys = append(keys, key)
+		offset += WildcardKeyLength
+	}
+	return keys, true
+}
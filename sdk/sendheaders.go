@@ -0,0 +1,142 @@
+package sdk
+
+import (
+	"io"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/p2p"
+	"github.com/elastos/Elastos.ELA.Utility/p2p/msg"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Peers advertise this protocol version or higher support announcing
+	// new blocks by headers messages
+	SendHeadersVersion = 2
+
+	// The max number of headers in a headers message
+	MaxHeadersPerMsg = 2000
+)
+
+// SendHeaders asks the peer to announce new blocks by headers instead of inventory
+type SendHeaders struct{}
+
+func (msg *SendHeaders) CMD() string {
+	return "sendheaders"
+}
+
+func (msg *SendHeaders) Serialize(w io.Writer) error {
+	return nil
+}
+
+func (msg *SendHeaders) Deserialize(r io.Reader) error {
+	return nil
+}
+
+// Headers announces new blocks by their headers
+type Headers struct {
+	Headers []core.Header
+}
+
+func (msg *Headers) CMD() string {
+	return "headers"
+}
+
+func (msg *Headers) Serialize(w io.Writer) error {
+	err := WriteVarUint(w, uint64(len(msg.Headers)))
+	if err != nil {
+		return err
+	}
+	for _, header := range msg.Headers {
+		err = header.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (msg *Headers) Deserialize(r io.Reader) error {
+	count, err := ReadVarUint(r, MaxHeadersPerMsg)
+	if err != nil {
+		return err
+	}
+	msg.Headers = make([]core.Header, count)
+	for i := range msg.Headers {
+		err = msg.Headers[i].Deserialize(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ask the peer to announce new blocks by headers if it supports it
+func (service *SPVServiceImpl) sendHeaders(peer *net.Peer) {
+	if peer.Version() >= SendHeadersVersion {
+		peer.Send(new(SendHeaders))
+	}
+}
+
+// Headers announced by peers are checked and connected to the chain tip right away,
+// only the merkle block of the announced header is requested, without the
+// getblocks round trip of a sync round. Headers not connecting to the chain tip
+// are left to the next sync round.
+func (service *SPVServiceImpl) OnHeaders(peer *net.Peer, headers *Headers) error {
+	// Headers requested by the header stage of the headers-first sync
+	if handled, err := service.handleSyncHeaders(peer, headers); handled {
+		return err
+	}
+
+	if len(headers.Headers) == 0 {
+		return nil
+	}
+
+	// The last announced header is the best block of the peer
+	best := headers.Headers[len(headers.Headers)-1]
+	service.splitDetector.announce(peer, uint64(best.Height), best.Hash())
+
+	// Blocks are requested by the sync round in syncing mode
+	if service.chain.IsSyncing() || service.isPaused() {
+		return nil
+	}
+
+	tip := service.chain.ChainTip()
+	previous := tip.Hash()
+	for _, header := range headers.Headers {
+		blockHash := header.Hash()
+		err := service.chain.CheckProofOfWork(header)
+		if err != nil {
+			service.misbehave(peer, "invalid proof of work", blockHash, ScoreInvalidBlock)
+			return err
+		}
+
+		if !header.Previous.IsEqual(previous) {
+			// Already connected, announced by another peer first
+			if header.Height <= tip.Height {
+				continue
+			}
+			// Raise the peer height, so the next sync round fetches the missing blocks
+			log.Debug("Announced header not connected to chain tip, leave it to sync:", blockHash.String())
+			if uint64(header.Height) > peer.Height() {
+				peer.SetHeight(uint64(header.Height))
+			}
+			return nil
+		}
+		previous = blockHash
+
+		// Skip blocks already received
+		if service.queue.InBlockTxsRequestQueue(blockHash) || service.queue.InFinishedPool(blockHash) {
+			continue
+		}
+
+		// The filtered merkle block carries the transactions matched by the filter
+		log.Debug("Request announced block:", blockHash.String())
+		go peer.Send(msg.NewDataReq(p2p.BlockData, blockHash))
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package sdk
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// The number of signature jobs queued per worker
+const SigJobsPerWorker = 16
+
+// The verifier was stopped before the signatures were verified, it does not
+// mean the transaction is invalid
+var ErrVerifierStopped = errors.New("signature verifier stopped")
+
+/*
+SigVerifier verifies transaction signatures on a pool of worker goroutines.
+Each signature of a batch of transactions is a job, so the signatures of a large
+multi-sign or many-input transaction are verified in parallel. The jobs are queued
+to the workers by the caller, which waits while the queue is full, so a peer
+relaying many transactions is slowed down instead of creating goroutines.
+*/
+type SigVerifier struct {
+	workers int
+	jobs    chan *sigJob
+	quit    chan struct{}
+	once    sync.Once
+
+	// Senders hold the read lock, the jobs channel is closed under the write lock
+	lock    sync.RWMutex
+	stopped bool
+}
+
+// A signature to verify against the public keys of a program
+type sigJob struct {
+	data []byte
+	sig  []byte
+	keys [][]byte
+	// Index of the key the signature matches, -1 if none
+	matched int
+	// The verifier stopped before the job was run
+	stopped bool
+	tx      *txVerify
+}
+
+// The signature checks of a transaction, the callback is called once the
+// last job is done
+type txVerify struct {
+	checks   []*programCheck
+	err      error
+	pending  int32
+	callback func(err error)
+}
+
+// The signature jobs of a program, at least m of them must match distinct keys
+type programCheck struct {
+	jobs []*sigJob
+	m    int
+}
+
+// Create a SigVerifier with the number of workers, 0 means the number of CPUs
+func NewSigVerifier(workers int) *SigVerifier {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	v := &SigVerifier{
+		workers: workers,
+		jobs:    make(chan *sigJob, workers*SigJobsPerWorker),
+		quit:    make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go v.work()
+	}
+	return v
+}
+
+// Run the jobs until the verifier is stopped, the jobs queued before it
+// stopped are marked stopped, so their callbacks are called
+func (v *SigVerifier) work() {
+	for job := range v.jobs {
+		select {
+		case <-v.quit:
+			job.stop()
+		default:
+			job.run()
+		}
+	}
+}
+
+// Stop the workers, the verifier can not be used after stopped. The pending
+// verifications return ErrVerifierStopped.
+func (v *SigVerifier) Stop() {
+	v.once.Do(func() {
+		// Release the senders waiting for the queue before closing it
+		close(v.quit)
+		v.lock.Lock()
+		v.stopped = true
+		close(v.jobs)
+		v.lock.Unlock()
+	})
+}
+
+// Verify the signatures of the transaction
+func (v *SigVerifier) VerifyTx(tx *core.Transaction) error {
+	return v.VerifyTxs([]*core.Transaction{tx})[0]
+}
+
+// Verify the signatures of the transaction on the workers, and call back with the
+// result on a worker. It waits while the queue of the workers is full.
+func (v *SigVerifier) VerifyTxAsync(tx *core.Transaction, callback func(err error)) {
+	v.schedule(tx, callback)
+}
+
+// Verify the signatures of a batch of transactions, the jobs of all of them are
+// scheduled at once, returns the errors in the order of the transactions
+func (v *SigVerifier) VerifyTxs(txs []*core.Transaction) []error {
+	errs := make([]error, len(txs))
+	var done sync.WaitGroup
+	done.Add(len(txs))
+	for i, tx := range txs {
+		i := i
+		v.schedule(tx, func(err error) {
+			errs[i] = err
+			done.Done()
+		})
+	}
+	done.Wait()
+	return errs
+}
+
+// Queue the signature jobs of the transaction, the callback is called when
+// the last of them is done
+func (v *SigVerifier) schedule(tx *core.Transaction, callback func(err error)) {
+	verify := &txVerify{callback: callback}
+	verify.checks, verify.err = newProgramChecks(tx, verify)
+
+	var jobs []*sigJob
+	for _, check := range verify.checks {
+		jobs = append(jobs, check.jobs...)
+	}
+	if verify.err != nil || len(jobs) == 0 {
+		verify.finish()
+		return
+	}
+
+	// Count all jobs first, so a fast worker does not finish the transaction early
+	atomic.StoreInt32(&verify.pending, int32(len(jobs)))
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	for _, job := range jobs {
+		if v.stopped {
+			job.stop()
+			continue
+		}
+		select {
+		case v.jobs <- job:
+		case <-v.quit:
+			job.stop()
+		}
+	}
+}
+
+// Call back with the result of the checks
+func (verify *txVerify) finish() {
+	err := verify.err
+	if err == nil {
+		for _, check := range verify.checks {
+			if check.stopped() {
+				err = ErrVerifierStopped
+				break
+			}
+			if !check.passed() {
+				err = errors.New("invalid signature")
+				break
+			}
+		}
+	}
+	verify.callback(err)
+}
+
+func (verify *txVerify) jobDone() {
+	if atomic.AddInt32(&verify.pending, -1) == 0 {
+		verify.finish()
+	}
+}
+
+// Create the signature checks of the standard and multi-sign programs
+// of the transaction, other programs are not checked
+func newProgramChecks(tx *core.Transaction, verify *txVerify) ([]*programCheck, error) {
+	buf := new(bytes.Buffer)
+	err := tx.SerializeUnsigned(buf)
+	if err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+
+	var checks []*programCheck
+	for _, program := range tx.Programs {
+		if len(program.Code) == 0 {
+			return nil, errors.New("empty program code")
+		}
+		signType, err := crypto.GetScriptType(program.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		var keys [][]byte
+		var m int
+		switch signType {
+		case crypto.STANDARD:
+			if len(program.Code) != crypto.PUBLICKEYLENGTH+2 {
+				return nil, errors.New("invalid standard program code")
+			}
+			keys, m = [][]byte{program.Code[1 : len(program.Code)-1]}, 1
+		case crypto.MULTISIG:
+			keys, err = crypto.ParseMultisigScript(program.Code)
+			if err != nil {
+				return nil, err
+			}
+			// The code starts with the opcode pushing M
+			m = int(program.Code[0]) - 0x50
+		default:
+			continue
+		}
+
+		sigs, err := parseSignatures(program.Parameter)
+		if err != nil {
+			return nil, err
+		}
+		if len(sigs) < m {
+			return nil, errors.New("not enough signatures")
+		}
+
+		check := &programCheck{m: m}
+		for _, sig := range sigs {
+			check.jobs = append(check.jobs, &sigJob{data: data, sig: sig, keys: keys, tx: verify})
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// Split the program parameter into signatures, each is pushed with its length
+func parseSignatures(param []byte) ([][]byte, error) {
+	var sigs [][]byte
+	for len(param) > 0 {
+		size := int(param[0])
+		if size != crypto.SignatureLength || len(param) < size+1 {
+			return nil, errors.New("invalid signature parameter")
+		}
+		sigs = append(sigs, param[1:size+1])
+		param = param[size+1:]
+	}
+	return sigs, nil
+}
+
+func (job *sigJob) run() {
+	defer job.tx.jobDone()
+
+	job.matched = -1
+	for i, key := range job.keys {
+		publicKey, err := crypto.DecodePoint(key)
+		if err != nil {
+			continue
+		}
+		if crypto.Verify(*publicKey, job.data, job.sig) == nil {
+			job.matched = i
+			return
+		}
+	}
+}
+
+func (job *sigJob) stop() {
+	job.matched = -1
+	job.stopped = true
+	job.tx.jobDone()
+}
+
+// Check if any job was not run because the verifier stopped
+func (check *programCheck) stopped() bool {
+	for _, job := range check.jobs {
+		if job.stopped {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if at least m signatures matched distinct keys
+func (check *programCheck) passed() bool {
+	keys := make(map[int]bool)
+	for _, job := range check.jobs {
+		if job.matched < 0 {
+			return false
+		}
+		keys[job.matched] = true
+	}
+	return len(keys) >= check.m
+}
@@ -0,0 +1,79 @@
+package sdk
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Create a transaction signed by a new standard account
+func newSignedTx(t *testing.T) *core.Transaction {
+	privateKey, publicKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate key pair failed: %v", err)
+	}
+	account, err := NewAccount(privateKey, publicKey)
+	if err != nil {
+		t.Fatalf("create account failed: %v", err)
+	}
+
+	tx := &core.Transaction{
+		TxType:   core.TransferAsset,
+		Payload:  &core.PayloadTransferAsset{},
+		Programs: []*core.Program{{Code: account.RedeemScript()}},
+	}
+	buf := new(bytes.Buffer)
+	tx.SerializeUnsigned(buf)
+	signature, err := account.Sign(buf.Bytes())
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	tx.Programs[0].Parameter = append([]byte{byte(len(signature))}, signature...)
+	return tx
+}
+
+func TestSigVerifier(t *testing.T) {
+	verifier := NewSigVerifier(2)
+	defer verifier.Stop()
+
+	valid := newSignedTx(t)
+	tampered := newSignedTx(t)
+	tampered.LockTime++
+	unsigned := newSignedTx(t)
+	unsigned.Programs[0].Parameter = nil
+
+	errs := verifier.VerifyTxs([]*core.Transaction{valid, tampered, unsigned})
+	if errs[0] != nil {
+		t.Errorf("valid transaction: %v", errs[0])
+	}
+	if errs[1] == nil || errs[1] == ErrVerifierStopped {
+		t.Errorf("tampered transaction: %v, want invalid signature", errs[1])
+	}
+	if errs[2] == nil || errs[2] == ErrVerifierStopped {
+		t.Errorf("unsigned transaction: %v, want not enough signatures", errs[2])
+	}
+
+	result := make(chan error, 1)
+	verifier.VerifyTxAsync(valid, func(err error) { result <- err })
+	if err := <-result; err != nil {
+		t.Errorf("valid transaction async: %v", err)
+	}
+}
+
+func TestSigVerifierStopped(t *testing.T) {
+	verifier := NewSigVerifier(1)
+	verifier.Stop()
+	verifier.Stop()
+
+	// A valid transaction is not reported invalid after the verifier stopped
+	if err := verifier.VerifyTx(newSignedTx(t)); err != ErrVerifierStopped {
+		t.Errorf("verify after stop: %v, want %v", err, ErrVerifierStopped)
+	}
+	result := make(chan error, 1)
+	verifier.VerifyTxAsync(newSignedTx(t), func(err error) { result <- err })
+	if err := <-result; err != ErrVerifierStopped {
+		t.Errorf("verify async after stop: %v, want %v", err, ErrVerifierStopped)
+	}
+}
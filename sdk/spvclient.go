@@ -56,6 +56,30 @@ type SPVMessageHandler interface {
 	// If the BLOCK or TRANSACTION requested by the data request message can not be found,
 	// notfound message with requested data hash will return through this method.
 	OnNotFound(*net.Peer, *msg.NotFound) error
+
+	// After sent a sendheaders message to a peer supports it, new blocks are announced
+	// by headers message through this method instead of inventory message.
+	OnHeaders(*net.Peer, *Headers) error
+
+	// Other light clients request the headers after their block locator by getheaders
+	// message through this method, answer with a headers message to serve them.
+	OnGetHeaders(*net.Peer, *GetHeaders) error
+
+	// Peers request the transactions announced to them by inventory message with a
+	// data request through this method, answer with the transaction or notfound.
+	OnGetData(*net.Peer, *msg.DataReq) error
+
+	// After sent a getcfilter message to a peer serving compact filters, the compact
+	// filter of the requested block will return through this method.
+	OnCFilter(*net.Peer, *CFilter) error
+
+	// After sent a data request with invType BLOCK to a peer without a filter loaded,
+	// the full block will return through this method.
+	OnBlock(*net.Peer, *core.Block) error
+
+	// A peer refused a message sent to it, like a transaction failed its
+	// verification, the reject message returns through this method.
+	OnReject(*net.Peer, *Reject) error
 }
 
 /*
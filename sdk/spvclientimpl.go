@@ -56,6 +56,18 @@ func (client *SPVClientImpl) MakeMessage(cmd string) (message p2p.Message, err e
 		message = new(bloom.MerkleBlock)
 	case "notfound":
 		message = new(msg.NotFound)
+	case "headers":
+		message = new(Headers)
+	case "getheaders":
+		message = new(GetHeaders)
+	case "getdata":
+		message = new(msg.DataReq)
+	case "cfilter":
+		message = new(CFilter)
+	case "block":
+		message = new(core.Block)
+	case "reject":
+		message = new(Reject)
 	default:
 		return nil, errors.New("Received unsupported message, CMD " + cmd)
 	}
@@ -76,6 +88,18 @@ func (client *SPVClientImpl) HandleMessage(peer *net.Peer, message p2p.Message)
 		return client.msgHandler.OnTxn(peer, msg)
 	case *msg.NotFound:
 		return client.msgHandler.OnNotFound(peer, msg)
+	case *Headers:
+		return client.msgHandler.OnHeaders(peer, msg)
+	case *GetHeaders:
+		return client.msgHandler.OnGetHeaders(peer, msg)
+	case *msg.DataReq:
+		return client.msgHandler.OnGetData(peer, msg)
+	case *CFilter:
+		return client.msgHandler.OnCFilter(peer, msg)
+	case *core.Block:
+		return client.msgHandler.OnBlock(peer, msg)
+	case *Reject:
+		return client.msgHandler.OnReject(peer, msg)
 	default:
 		return errors.New("handle message unknown type")
 	}
@@ -85,6 +109,12 @@ func (client *SPVClientImpl) OnPeerEstablish(peer *net.Peer) {
 	client.msgHandler.OnPeerEstablish(peer)
 }
 
+func (client *SPVClientImpl) OnPeerPromoted(peer *net.Peer) {
+	if handler, ok := client.msgHandler.(net.PromoteHandler); ok {
+		handler.OnPeerPromoted(peer)
+	}
+}
+
 func (client *SPVClientImpl) OnPing(peer *net.Peer, p *msg.Ping) error {
 	peer.SetHeight(p.Height)
 	// Return pong message to peer
@@ -102,14 +132,15 @@ func (client *SPVClientImpl) keepUpdate() {
 	defer ticker.Stop()
 	for range ticker.C {
 
-		// Update peers info
-		for _, peer := range client.PeerManager().ConnectedPeers() {
+		// Update peers info, standby peers are kept alive to be promoted
+		pm := client.PeerManager()
+		for _, peer := range append(pm.ConnectedPeers(), pm.StandbyPeers()...) {
 			if peer.State() == p2p.ESTABLISH {
 
 				// Disconnect inactive peer
 				if peer.LastActive().Before(
 					time.Now().Add(-time.Second * net.InfoUpdateDuration * net.KeepAliveTimeout)) {
-					client.PeerManager().DisconnectPeer(peer)
+					client.PeerManager().DisconnectPeerWithReason(peer, net.ReasonStall)
 					continue
 				}
 
@@ -1,9 +1,13 @@
 package sdk
 
 import (
+	"time"
+
 	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/net"
 
 	"github.com/elastos/Elastos.ELA/bloom"
+	"github.com/elastos/Elastos.ELA/core"
 	"github.com/elastos/Elastos.ELA.Utility/p2p"
 )
 
@@ -26,8 +30,107 @@ type SPVService interface {
 	// use Blockchain.AddStateListener() to register chain state callbacks
 	Blockchain() *Blockchain
 
+	// Get the fee estimator, which estimates the fee rate for a confirmation target
+	// from the observed transactions. The DataStore should implement db.TxGetter,
+	// so the fees of transactions spending stored outputs are known.
+	FeeEstimator() *FeeEstimator
+
 	// Broadcast a message to the peer to peer network.
 	BroadCastMessage(message p2p.Message)
+
+	// Get peer manager, which is the main program of the peer to peer network
+	PeerManager() *net.PeerManager
+
+	// Get the time spent per block in download, verify and commit phases
+	Stats() SyncStats
+
+	// Register an alert listener to receive alerts of abnormal network status
+	AddAlertListener(listener AlertListener)
+
+	// Adjust peer count, request concurrency and bandwidth by the app state,
+	// it takes effect at runtime without restarting the service
+	SetSyncProfile(profile SyncProfile) error
+
+	// Announce a transaction to connected peers by inventory message and send it to
+	// the peers requesting it, one or two peers are kept as observers and not
+	// announced to, the transaction is propagated when an observer relays it back,
+	// register a PropagationListener to receive the feedback
+	SendTransaction(tx core.Transaction) error
+
+	// Send a transaction like SendTransaction without blocking, the returned operation
+	// completes when the transaction is relayed back by an observer peer
+	SendTransactionAsync(tx core.Transaction) *Operation
+
+	// Register a propagation listener to receive broadcast transaction feedback
+	AddPropagationListener(listener PropagationListener)
+
+	// In blocks only mode, peers are told not to relay transactions in the version
+	// handshake, and unsolicited transactions are ignored, only the transactions
+	// in blocks are committed. This method should be called before Start().
+	SetBlocksOnly(blocksOnly bool)
+
+	// In headers-first mode, the header chain is downloaded by getheaders messages,
+	// the headers of each message are validated and stored before their merkle
+	// blocks are queued, instead of interleaving getblocks round trips with block
+	// downloads. It is used with sync peers supporting headers messages. This
+	// method should be called before Start().
+	SetHeadersFirst(headersFirst bool)
+
+	// In parallel download mode, the blocks of a sync round are requested from all
+	// the connected peers, each block from the peer with the fewest blocks in flight
+	// and its transactions from the same peer, a stalled block request is retried
+	// with another peer. Otherwise all blocks are downloaded from the sync peer. After
+	// each block with wallet transactions, the filter is reloaded on all peers and
+	// the blocks not committed yet, requested from the other peers with the former
+	// filter, are requested again, the other requests in flight go on.
+	SetParallelDownload(parallel bool)
+
+	// In serve headers mode, getheaders requests of other light clients connected
+	// to the listening port are answered with the stored header chain, so the SPV
+	// service is a relay point of headers on sparse networks. Blocks and transactions
+	// are not served. The DataStore must implement db.AncestorFinder to support it.
+	SetServeHeaders(serve bool)
+
+	// In compact filters mode, peers serving compact block filters are synced by
+	// downloading the filter of each block and matching it locally with the items
+	// returned by elements, only matched blocks are downloaded in full and no bloom
+	// filter is loaded to these peers. Pass nil to disable, call it before Start().
+	SetCompactFilters(elements func() [][]byte)
+
+	// Relayed transactions arriving before their unconfirmed parents are kept in
+	// the orphan pool, and the parents are requested from the peer, the orphans
+	// are committed again when the parents arrive. Set the max number of orphans
+	// and how long they are kept, max of 0 disables the pool. The DataStore must
+	// implement db.TxFinder to find the missing parents.
+	SetOrphanPoolLimits(maxTxs int, expiry time.Duration)
+
+	// Peers are probed periodically with a block containing a transaction known to
+	// match the filter, a peer not matching it is disconnected as it ignores the
+	// filter. Set how often peers are probed, 0 disables the probing. The DataStore
+	// must implement db.FilterProbeSource to provide the known matches.
+	SetFilterProbeInterval(interval time.Duration)
+
+	// Peers announcing best blocks within heightThreshold heights of each other are
+	// expected on the same chain, an AlertListener is told of a suspected chain split
+	// when their blocks at the same height differ, or only one is on a side chain,
+	// for longer than the duration. SplitHeightThreshold and SplitAlertDuration by default.
+	SetSplitAlert(heightThreshold uint32, duration time.Duration)
+
+	// Size the goroutine pools of signature verification, transaction requests
+	// and listener notifications, for small devices. Call it before Start().
+	SetConcurrency(config ConcurrencyConfig)
+
+	// Get the goroutine counts and queue depths of the concurrent subsystems
+	RuntimeStats() RuntimeStats
+
+	// Rewind the chain to the given height and download blocks from there again,
+	// use it to find transactions of addresses added after they were synced. If the
+	// header at the height is pruned, the chain is rewound to the nearest stored one below.
+	Rescan(height uint32) error
+
+	// Rescan like Rescan without blocking, the returned operation reports the
+	// rescan progress and completes when the chain is synced again
+	RescanAsync(height uint32) *Operation
 }
 
 /*
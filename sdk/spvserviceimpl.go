@@ -30,6 +30,61 @@ type SPVServiceImpl struct {
 	queue      *RequestQueue
 	getFilter  func() *bloom.Filter
 	fPositives int
+	timer      *syncTimer
+	responses  *responseStats
+
+	alertListeners []AlertListener
+	splitDetector  *splitDetector
+	refusedReorg   *Uint256
+
+	// The SyncProfile, written under the lock and read atomically
+	profile int32
+
+	propagation          *propagationMonitor
+	propagationListeners []PropagationListener
+
+	// Transactions announced to peers, served when requested
+	broadcasts *broadcastPool
+
+	// The request of the block downloaded again to repair a corrupted record,
+	// guarded by repairLock so merkle blocks are checked without the service lock
+	repairLock sync.Mutex
+	repair     *Request
+
+	// Ignore unsolicited transactions
+	blocksOnly bool
+
+	// Peers answered not found for the requested data
+	notFound *notFoundTracker
+
+	// Syncing in catch-up mode after a long offline period
+	catchingUp bool
+
+	// Relayed transactions waiting for their parents
+	orphans *orphanPool
+
+	// Probes checking if peers honor the filter
+	prober *filterProber
+
+	// Verify signatures of relayed and sent transactions
+	verifier *SigVerifier
+
+	// Estimate fee rates from observed transactions
+	feeEstimator *FeeEstimator
+
+	// Goroutine pool sizes set by SetConcurrency
+	concurrency ConcurrencyConfig
+
+	// Download and validate headers before requesting blocks
+	headersFirst   bool
+	headerSyncLock sync.Mutex
+	headerSync     *headerSync
+
+	// Answer getheaders requests of other light clients
+	serveHeaders bool
+
+	// Items matched with compact filters, nil if syncing by bloom filters only
+	cfilterElements func() [][]byte
 }
 
 // Create a instance of SPV service implementation.
@@ -52,25 +107,63 @@ func NewSPVServiceImpl(client SPVClient, database db.DataStore, getBloomFilter f
 	// Initialize request queue
 	service.queue = NewRequestQueue(MaxRequests, service)
 
+	// Initialize block processing timer
+	service.timer = newSyncTimer(database)
+
+	// Initialize response times for adaptive request timeouts
+	service.responses = newResponseStats(database)
+
+	// Initialize broadcast transactions monitor
+	service.propagation = newPropagationMonitor()
+	service.broadcasts = newBroadcastPool()
+
+	service.splitDetector = newSplitDetector()
+	service.notFound = newNotFoundTracker()
+	service.orphans = newOrphanPool()
+	service.prober = newFilterProber()
+	service.verifier = NewSigVerifier(0)
+	service.feeEstimator = NewFeeEstimator(service.chain)
+
 	// Set get bloom filter method
 	service.getFilter = getBloomFilter
 
 	return service, nil
 }
 
+func (service *SPVServiceImpl) FeeEstimator() *FeeEstimator {
+	return service.feeEstimator
+}
+
 func (service *SPVServiceImpl) OnPeerEstablish(peer *net.Peer) {
-	// Send filterload message
-	peer.Send(service.getFilter().GetFilterLoadMsg())
+	// Send filterload message, peers synced by compact filters do not get the filter
+	if !service.usesCFilters(peer) {
+		peer.Send(service.getFilter().GetFilterLoadMsg())
+	}
+	// Ask the peer to announce new blocks by headers
+	service.sendHeaders(peer)
+}
+
+// A standby peer may have missed filter reloads, load the current filter
+// before it is used for downloads
+func (service *SPVServiceImpl) OnPeerPromoted(peer *net.Peer) {
+	if !service.usesCFilters(peer) {
+		peer.Send(service.getFilter().GetFilterLoadMsg())
+	}
 }
 
 func (service *SPVServiceImpl) Start() {
 	service.SPVClient.Start()
+	service.checkCatchUp()
 	go service.keepUpdate()
 	log.Info("SPV service started...")
 }
 
 func (service *SPVServiceImpl) Stop() {
 	service.stopSyncing()
+	service.verifier.Stop()
+	service.PeerManager().DisconnectAll(net.ReasonShutdown)
+	service.timer.Save()
+	service.responses.Save()
 	service.chain.Close()
 	log.Info("SPV service stopped...")
 }
@@ -83,15 +176,123 @@ func (service *SPVServiceImpl) BroadCastMessage(message p2p.Message) {
 	service.PeerManager().Broadcast(message)
 }
 
+func (service *SPVServiceImpl) Stats() SyncStats {
+	return service.timer.Stats()
+}
+
+func (service *SPVServiceImpl) AddAlertListener(listener AlertListener) {
+	service.alertListeners = append(service.alertListeners, listener)
+}
+
+func (service *SPVServiceImpl) SetBlocksOnly(blocksOnly bool) {
+	service.blocksOnly = blocksOnly
+	if blocksOnly {
+		// Tell peers not to relay transactions in the version handshake
+		service.PeerManager().Local().SetRelay(0)
+	}
+}
+
+func (service *SPVServiceImpl) AddPropagationListener(listener PropagationListener) {
+	service.propagationListeners = append(service.propagationListeners, listener)
+}
+
+func (service *SPVServiceImpl) SendTransaction(tx core.Transaction) error {
+	// Do not broadcast a transaction peers will reject
+	err := service.verifier.VerifyTx(&tx)
+	if err == ErrVerifierStopped {
+		return err
+	}
+	if err != nil {
+		return NewReason("tx_rejected", CategoryReject, ActionNone,
+			"transaction rejected, "+err.Error(), "error", err.Error())
+	}
+
+	observers := pickObservers(service.PeerManager())
+	if len(observers) == 0 {
+		log.Warn("No observer peers, transaction propagation can not be confirmed")
+	}
+	txId := tx.Hash()
+	service.propagation.watch(txId, observers)
+
+	// Announce the transaction to connected peers except the observers, and serve
+	// it when they request it, some nodes do not accept unsolicited transactions
+	service.broadcasts.add(&tx)
+	service.PeerManager().BroadcastExcept(msg.NewInventory(p2p.TxData, []*Uint256{&txId}), observers...)
+	return nil
+}
+
+func (service *SPVServiceImpl) Rescan(height uint32) error {
+	service.Lock()
+	defer service.Unlock()
+
+	service.stopSyncing()
+	err := service.chain.RewindTo(height)
+	if err != nil {
+		return err
+	}
+	service.updateLocalHeight()
+
+	// Make sure peers are filtering with the latest addresses
+	service.reloadFilter()
+	service.syncBlocks()
+	return nil
+}
+
 func (service *SPVServiceImpl) keepUpdate() {
 	ticker := time.NewTicker(time.Second * net.InfoUpdateDuration)
 	defer ticker.Stop()
 	for range ticker.C {
 		// Keep synchronizing blocks
 		service.syncBlocks()
+
+		// Return to normal mode if caught up after a long offline period
+		service.checkCaughtUp()
+
+		// Check if connected peers are on different chain tips
+		service.checkChainSplit()
+
+		// Evict stale orphan transactions
+		service.orphans.expire()
+
+		// Check if peers honor the filter, blocks requested during syncing
+		// are answered in order, so only probe when the chain is synced
+		if !service.chain.IsSyncing() {
+			service.probeFilter()
+		}
+
+		// Expire stuck transactions, only when the chain is synced,
+		// otherwise they may be confirmed in the blocks not synced yet
+		if !service.chain.IsSyncing() && !service.needSync() {
+			err := service.chain.ExpireTxs()
+			if err != nil {
+				log.Error("Expire transactions failed:", err)
+			}
+		}
 	}
 }
 
+func (service *SPVServiceImpl) checkChainSplit() {
+	tips := service.splitDetector.check(service.PeerManager().ConnectedPeers(), service.onSideChain)
+	if tips == nil {
+		return
+	}
+
+	log.Warn("Chain split suspected, peer tips:", tips)
+	for _, listener := range service.alertListeners {
+		go listener.OnChainSplitSuspected(tips)
+	}
+}
+
+// Check if the block is stored and not on the main chain, blocks above the
+// chain tip are not synced yet and not on a side chain
+func (service *SPVServiceImpl) onSideChain(hash Uint256) bool {
+	header, err := service.chain.GetHeader(hash)
+	if err != nil || header.Height > service.chain.Height() {
+		return false
+	}
+	return !service.chain.IsOnMainChain(hash)
+}
+
 func (service *SPVServiceImpl) needSync() bool {
 	bestPeer := service.PeerManager().GetBestPeer()
 	if bestPeer == nil { // no peers connected, return false
@@ -105,8 +306,8 @@ func (service *SPVServiceImpl) needSync() bool {
 }
 
 func (service *SPVServiceImpl) syncBlocks() {
-	// Check if blockchain need sync
-	if service.needSync() {
+	// Check if blockchain need sync, do not start new sync rounds when paused
+	if !service.isPaused() && service.needSync() {
 		// Check if blockchain is in syncing state
 		if service.chain.IsSyncing() || service.queue.IsRunning() {
 			return
@@ -124,10 +325,13 @@ func (service *SPVServiceImpl) stopSyncing() {
 	if service.chain.IsSyncing() {
 		// Clear request queue
 		service.queue.Clear()
+		service.timer.Clear()
 		// Set blockchain state to waiting
 		service.chain.SetChainState(WAITING)
 		// Remove sync peer
 		service.PeerManager().SetSyncPeer(nil)
+		// Abort the header stage
+		service.setHeaderSync(nil)
 	}
 }
 
@@ -139,17 +343,22 @@ func (service *SPVServiceImpl) requestBlocks() {
 		fmt.Println("SyncManager no sync peer connected")
 		return
 	}
+	// Download headers first if enabled
+	if service.startHeaderSync(syncPeer) {
+		return
+	}
+
 	// Request blocks returns a inventory message which contains block hashes
 	request := msg.NewBlocksReq(service.chain.GetBlockLocatorHashes(), Uint256{})
 
 	go syncPeer.Send(request)
 }
 
-func (service *SPVServiceImpl) changeSyncPeerAndRestart() {
+func (service *SPVServiceImpl) changeSyncPeerAndRestart(reason net.DisconnectReason) {
 	log.Debug("Change sync peer and restart")
 	// Disconnect current sync peer
 	syncPeer := service.PeerManager().GetSyncPeer()
-	service.PeerManager().DisconnectPeer(syncPeer)
+	service.PeerManager().DisconnectPeerWithReason(syncPeer, reason)
 
 	service.stopSyncing()
 	// Restart
@@ -157,14 +366,31 @@ func (service *SPVServiceImpl) changeSyncPeerAndRestart() {
 }
 
 func (service *SPVServiceImpl) OnSendRequest(peer *net.Peer, reqType uint8, hash Uint256) {
+	if reqType == p2p.BlockData {
+		service.timer.OnBlockRequested(hash)
+		// Request the compact filter first, the block is requested if it matches
+		if service.usesCFilters(peer) {
+			peer.Send(&GetCFilter{BlockHash: hash})
+			return
+		}
+	}
 	peer.Send(msg.NewDataReq(reqType, hash))
 }
 
+func (service *SPVServiceImpl) OnResponse(peer *net.Peer, reqType uint8, duration time.Duration) {
+	service.responses.record(peer, reqType, duration)
+}
+
+func (service *SPVServiceImpl) RequestTimeout(peer *net.Peer, reqType uint8) time.Duration {
+	return service.responses.timeout(peer, reqType)
+}
+
 func (service *SPVServiceImpl) OnRequestError(err error) {
 	service.Lock()
 	defer service.Unlock()
 
-	service.changeSyncPeerAndRestart()
+	service.misbehave(service.PeerManager().GetSyncPeer(), "request error, "+err.Error(), Uint256{}, ScoreRequestTimeout)
+	service.changeSyncPeerAndRestart(net.ReasonStall)
 }
 
 func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
@@ -179,52 +405,125 @@ func (service *SPVServiceImpl) OnRequestFinished(pool *FinishedReqPool) {
 	}
 
 	var fPositives int
+	var committed bool
 	for request, ok := pool.Next(*current); ok; request, ok = pool.Next(request.Block.Header.Hash()) {
 		// Try to commit next block
+		start := time.Now()
 		reorg, fp, err := service.chain.CommitBlock(request.Block, request.Txs)
+		if refused, ok := err.(*ReorgRefusedError); ok {
+			log.Warn(refused)
+			service.handleReorgRefused(refused)
+			return
+		}
+		if corrupted, ok := err.(*db.ErrCorruptedRecord); ok {
+			log.Warn(corrupted)
+			service.repairRecord(corrupted)
+			return
+		}
 		if err != nil {
 			fmt.Println(err)
-			service.changeSyncPeerAndRestart()
+			service.misbehave(service.PeerManager().GetSyncPeer(), "invalid block, "+err.Error(),
+				request.BlockHash, ScoreInvalidBlock)
+			service.changeSyncPeerAndRestart(net.ReasonMisbehave)
 			return
 		}
+		service.timer.OnBlockCommitted(request.BlockHash, time.Since(start))
 		// Update local height after block committed
 		service.updateLocalHeight()
 
 		// If we meet a reorganize, restart sync process
 		if reorg {
 			log.Warn("service handle reorganize, restart sync")
+			// Outpoints spent in the rolled back blocks are unspent again, they may
+			// have been removed from the filter on peers, so reload filter to match them
+			service.reloadFilter()
 			service.stopSyncing()
 			service.syncBlocks()
 			return
 		}
 		fPositives += fp
+		committed = true
+
+		// The block has wallet transactions, the filters on the other peers do not
+		// have their outpoints, so blocks requested from them may miss the spends.
+		// Reload the filter on all peers and request the blocks not committed from
+		// the other peers again, the requests in flight are kept.
+		if len(request.Txs) > fp && service.queue.ParallelDownload() {
+			log.Debug("Wallet transactions in block", request.BlockHash.String(), "reload filter")
+			service.reloadFilter()
+			service.queue.RequestAgainExcept(request.peer)
+		}
 	}
 
+	if committed && service.catchingUp {
+		service.notifyCatchUpProgress(false)
+	}
 	go service.handleFPositive(fPositives)
 }
 
+// Stop syncing the refused fork and alert listeners, the fork will be
+// synced again after operator accepted it
+func (service *SPVServiceImpl) handleReorgRefused(err *ReorgRefusedError) {
+	service.stopSyncing()
+
+	// Alert once for the same fork point
+	if service.refusedReorg != nil && service.refusedReorg.IsEqual(err.ForkPoint) {
+		return
+	}
+	service.refusedReorg = &err.ForkPoint
+
+	for _, listener := range service.alertListeners {
+		go listener.OnReorgRefused(err)
+	}
+}
+
 func (service *SPVServiceImpl) handleFPositive(fPositives int) {
 	service.fPositives += fPositives
 	if service.fPositives > MaxFalsePositives {
-		// Broadcast filterload message to connected peers
-		service.PeerManager().Broadcast(service.getFilter().GetFilterLoadMsg())
-		service.fPositives = 0
+		service.reloadFilter()
+	}
+}
+
+// Rebuild the filter and broadcast filterload message to connected peers,
+// standby peers included
+func (service *SPVServiceImpl) reloadFilter() {
+	filterLoad := service.getFilter().GetFilterLoadMsg()
+	pm := service.PeerManager()
+	for _, peer := range append(pm.ConnectedPeers(), pm.StandbyPeers()...) {
+		if !service.usesCFilters(peer) {
+			peer.Send(filterLoad)
+		}
 	}
+	service.fPositives = 0
 }
 
 func (service *SPVServiceImpl) OnInventory(peer *net.Peer, inv *msg.Inventory) error {
 	switch inv.Type {
 	case p2p.TxData:
-		// Do nothing, transaction inventory is not supported
+		// Transactions are not requested by inventory, only check
+		// if a broadcast transaction is relayed back by an observer
+		if !service.blocksOnly {
+			service.handleTxInvMsg(peer, inv)
+		}
 	case p2p.BlockData:
 		return service.HandleBlockInvMsg(peer, inv)
 	}
 	return nil
 }
 
+func (service *SPVServiceImpl) handleTxInvMsg(peer *net.Peer, inv *msg.Inventory) {
+	for _, txId := range service.propagation.onTxInv(peer, inv.Hashes) {
+		log.Info("Transaction propagated:", txId.String(), "observer:", peer.ID())
+		service.propagation.completeOperations(txId)
+		for _, listener := range service.propagationListeners {
+			go listener.OnTxPropagated(txId, peer.ID())
+		}
+	}
+}
+
 func (service *SPVServiceImpl) HandleBlockInvMsg(peer *net.Peer, inv *msg.Inventory) error {
 	if !service.chain.IsSyncing() {
-		peer.Disconnect()
+		service.PeerManager().DisconnectPeerWithReason(peer, net.ReasonMisbehave)
 		return errors.New("receive inventory message in non syncing mode")
 	}
 
@@ -233,41 +532,88 @@ func (service *SPVServiceImpl) HandleBlockInvMsg(peer *net.Peer, inv *msg.Invent
 		return nil
 	}
 
-	// Put hashes to request queue
-	service.queue.PushHashes(peer, inv.Hashes)
+	// The last block of the inventory is the latest the peer announces, recorded
+	// for the split detector if its height is known
+	last := *inv.Hashes[len(inv.Hashes)-1]
+	if header, err := service.chain.GetHeader(last); err == nil {
+		service.splitDetector.announce(peer, uint64(header.Height), last)
+	}
 
-	// Request more blocks
+	// Request more blocks after the last one, known or not
 	locator := []*Uint256{inv.Hashes[len(inv.Hashes)-1]}
+
+	// Put hashes of the blocks not stored yet to request queue
+	service.queue.PushHashes(peer, service.unknownBlocks(inv.Hashes))
+
 	go peer.Send(msg.NewBlocksReq(locator, Uint256{}))
 
 	return nil
 }
 
+// Drop the leading hashes of the inventory already stored on the main chain. A peer
+// not finding the latest locator hashes announces blocks from an older one, which
+// would be downloaded and discarded again. Inventory hashes are consecutive, so if
+// the last known one is on the main chain, all known ones before it are.
+func (service *SPVServiceImpl) unknownBlocks(hashes []*Uint256) []*Uint256 {
+	known := 0
+	for known < len(hashes) {
+		if _, err := service.chain.GetHeader(*hashes[known]); err != nil {
+			break
+		}
+		known++
+	}
+	if known == 0 || !service.chain.IsOnMainChain(*hashes[known-1]) {
+		return hashes
+	}
+	log.Debugf("Skip %d known blocks of inventory", known)
+	return hashes[known:]
+}
+
 func (service *SPVServiceImpl) OnMerkleBlock(peer *net.Peer, block *bloom.MerkleBlock) error {
 	blockHash := block.Header.Hash()
 	log.Debug("Receive merkle block hash: ", blockHash.String())
+	service.timer.OnBlockReceived(blockHash)
 
+	start := time.Now()
 	header := block.Header
-	err := service.chain.CheckProofOfWork(header)
-	if err != nil {
-		return err
+	// Headers below the last checkpoint are validated by the checkpoint
+	if !service.chain.BelowCheckpoint(header.Height) {
+		err := service.chain.CheckProofOfWork(header)
+		if err != nil {
+			service.misbehave(peer, "invalid proof of work", blockHash, ScoreInvalidBlock)
+			return err
+		}
 	}
 
 	txIds, err := bloom.CheckMerkleBlock(*block)
 	if err != nil {
+		service.misbehave(peer, "invalid merkle block", blockHash, ScoreInvalidBlock)
 		return errors.New("Invalid merkle block received: " + err.Error())
 	}
+	service.timer.OnBlockVerified(blockHash, time.Since(start))
+	defer service.corroborateNotFound(blockHash)
+
+	if service.handleProbeBlock(peer, block, txIds) {
+		return nil
+	}
+
+	if service.handleRepairBlock(block) {
+		return nil
+	}
 
 	if service.chain.IsSyncing() { // When blockchain in syncing mode
-		if service.PeerManager().GetSyncPeer() != nil && service.PeerManager().GetSyncPeer().ID() != peer.ID() {
-			peer.Disconnect()
+		if service.PeerManager().GetSyncPeer() != nil && service.PeerManager().GetSyncPeer().ID() != peer.ID() &&
+			!service.notFound.redirectedTo(blockHash, peer.ID()) && !service.queue.RequestedFrom(blockHash, peer.ID()) {
+			service.misbehave(peer, "block from non sync peer", blockHash, ScoreNonSyncPeerMsg)
+			service.PeerManager().DisconnectPeerWithReason(peer, net.ReasonMisbehave)
 			return fmt.Errorf("receive message from non sync peer: %d\n", peer.ID())
 		}
 
 		// Add block to sync queue
 		err = service.queue.OnBlockReceived(block, txIds)
 		if err != nil {
-			service.changeSyncPeerAndRestart()
+			service.misbehave(peer, "unexpected block, "+err.Error(), blockHash, ScoreUnexpectedMsg)
+			service.changeSyncPeerAndRestart(net.ReasonMisbehave)
 			return err
 		}
 	} else {
@@ -282,11 +628,19 @@ func (service *SPVServiceImpl) OnMerkleBlock(peer *net.Peer, block *bloom.Merkle
 
 func (service *SPVServiceImpl) OnTxn(peer *net.Peer, txn *core.Transaction) error {
 	log.Debug("Receive transaction hash: ", txn.Hash().String())
+	defer service.corroborateNotFound(txn.Hash())
+
+	// Transactions of filter probe blocks are committed already
+	if service.isProbeTx(txn.Hash()) {
+		return nil
+	}
 
 	if service.chain.IsSyncing() && service.PeerManager().GetSyncPeer() != nil &&
-		service.PeerManager().GetSyncPeer().ID() != peer.ID() {
+		service.PeerManager().GetSyncPeer().ID() != peer.ID() && !service.notFound.redirectedTo(txn.Hash(), peer.ID()) &&
+		!service.queue.RequestedFrom(txn.Hash(), peer.ID()) {
 
-		peer.Disconnect()
+		service.misbehave(peer, "transaction from non sync peer", txn.Hash(), ScoreNonSyncPeerMsg)
+		service.PeerManager().DisconnectPeerWithReason(peer, net.ReasonMisbehave)
 		return fmt.Errorf("receive message from non sync peer: %d\n", peer.ID())
 	}
 
@@ -294,30 +648,154 @@ func (service *SPVServiceImpl) OnTxn(peer *net.Peer, txn *core.Transaction) erro
 		// Add transaction to queue
 		err := service.queue.OnTxReceived(txn)
 		if err != nil {
-			service.changeSyncPeerAndRestart()
+			service.misbehave(peer, "unexpected transaction, "+err.Error(), txn.Hash(), ScoreUnexpectedMsg)
+			service.changeSyncPeerAndRestart(net.ReasonMisbehave)
 			return err
 		}
+	} else if service.blocksOnly {
+		// Ignore unsolicited transaction
+		log.Debug("Blocks only mode, ignore transaction:", txn.Hash().String())
 	} else {
-		isFPositive, err := service.chain.CommitTx(*txn)
+		// A requested parent of orphans is not kept as an orphan again,
+		// so the ancestors of a false positive are not requested one by one
+		orphanable := !service.orphans.isParent(txn.Hash())
+
+		// Verify signatures on the worker pool, the message handler waits only
+		// while the queue of the workers is full
+		service.verifier.VerifyTxAsync(txn, func(err error) {
+			if err == ErrVerifierStopped {
+				log.Debug("Signature verifier stopped, drop transaction:", txn.Hash().String())
+				return
+			}
+			if err != nil {
+				service.misbehave(peer, "invalid transaction, "+err.Error(), txn.Hash(), ScoreInvalidTx)
+				return
+			}
+			err = service.commitRelayedTx(peer, txn, orphanable)
+			if err != nil {
+				log.Error("Commit transaction failed:", err)
+			}
+		})
+	}
+
+	return nil
+}
+
+// Commit a relayed transaction and promote the orphans waiting for it. A false positive
+// spending unknown transactions is kept in the orphan pool if orphanable, and its
+// missing parents are requested, they may be unconfirmed transactions not arrived yet.
+func (service *SPVServiceImpl) commitRelayedTx(peer *net.Peer, txn *core.Transaction, orphanable bool) error {
+	isFPositive, err := service.chain.CommitTx(*txn)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range service.orphans.takeChildren(txn.Hash()) {
+		log.Debug("Promote orphan transaction:", orphan.Hash().String())
+		err := service.commitRelayedTx(peer, orphan, false)
 		if err != nil {
-			return err
+			log.Error("Commit orphan transaction failed:", err)
 		}
+	}
 
-		if isFPositive {
-			service.handleFPositive(1)
+	if !isFPositive {
+		return nil
+	}
+
+	if orphanable {
+		parents := service.missingParents(txn)
+		if len(parents) > 0 && service.orphans.add(txn, parents) {
+			log.Debug("Orphan transaction:", txn.Hash().String(), "missing parents:", len(parents))
+			for _, parent := range parents {
+				peer.Send(msg.NewDataReq(p2p.TxData, parent))
+			}
+			return nil
 		}
 	}
 
+	service.handleFPositive(1)
 	return nil
 }
 
+// Get the ids of the transactions spent by the transaction and not stored,
+// the data store must implement db.TxFinder to find them
+func (service *SPVServiceImpl) missingParents(txn *core.Transaction) []Uint256 {
+	finder, ok := service.chain.DataStore.(db.TxFinder)
+	if !ok || txn.IsCoinBaseTx() {
+		return nil
+	}
+
+	var parents []Uint256
+	seen := make(map[Uint256]bool)
+	for _, input := range txn.Inputs {
+		txId := input.Previous.TxID
+		if seen[txId] {
+			continue
+		}
+		seen[txId] = true
+		if !finder.HaveTx(txId) {
+			parents = append(parents, txId)
+		}
+	}
+	return parents
+}
+
+// Set the max number of orphan transactions and how long they are kept,
+// max of 0 disables the orphan pool
+func (service *SPVServiceImpl) SetOrphanPoolLimits(maxTxs int, expiry time.Duration) {
+	service.orphans.setLimits(maxTxs, expiry)
+}
+
 func (service *SPVServiceImpl) OnNotFound(peer *net.Peer, msg *msg.NotFound) error {
 	log.Debug("Receive not found: ", msg.Hash.String())
 
-	service.changeSyncPeerAndRestart()
+	// A parent of orphans is not in the mempool of the peer, it is likely
+	// confirmed already, the orphans are evicted when they expire
+	if service.orphans.isParent(msg.Hash) {
+		return nil
+	}
+
+	// Find a peer not known to lack the data
+	lacking := service.notFound.add(msg.Hash, peer)
+	var candidate *net.Peer
+	for _, p := range service.PeerManager().ConnectedPeers() {
+		if !lacking[p.ID()] {
+			candidate = p
+			break
+		}
+	}
+
+	// All peers lack the data, it is likely not on the main chain any more,
+	// restart syncing without blaming the peers
+	if candidate == nil {
+		log.Warn("Data not found on all peers: ", msg.Hash.String())
+		service.notFound.remove(msg.Hash)
+		service.stopSyncing()
+		service.syncBlocks()
+		return nil
+	}
+
+	if !service.queue.Redirect(msg.Hash, candidate) {
+		return nil
+	}
+	service.notFound.setRedirect(msg.Hash, candidate.ID())
+	log.Infof("Data %s not found on peer %d, request it from peer %d", msg.Hash.String(), peer.ID(), candidate.ID())
 	return nil
 }
 
+// The data is served by another peer, so the peers answered not found
+// are misbehaving, they are disconnected
+func (service *SPVServiceImpl) corroborateNotFound(hash Uint256) {
+	for _, peer := range service.notFound.resolve(hash) {
+		service.misbehave(peer, "not found data served by another peer", hash, ScoreNotFound)
+		if service.PeerManager().IsSyncPeer(peer) {
+			service.changeSyncPeerAndRestart(net.ReasonMisbehave)
+			continue
+		}
+		service.PeerManager().DisconnectPeerWithReason(peer, net.ReasonMisbehave)
+	}
+}
+
 // Update local peer height with current chain height
 func (service *SPVServiceImpl) updateLocalHeight() {
 	service.PeerManager().Local().SetHeight(uint64(service.chain.Height()))
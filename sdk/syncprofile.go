@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+)
+
+// SyncProfile trades sync speed for battery and data usage,
+// call SPVService.SetSyncProfile() when the app state changes
+type SyncProfile int
+
+const (
+	// Sync as fast as possible, the default profile
+	Foreground SyncProfile = iota
+	// Keep syncing with less peers, requests and bandwidth
+	Background
+	// Do not start new sync rounds, keep one peer to receive transactions
+	Paused
+)
+
+func (p SyncProfile) String() string {
+	switch p {
+	case Foreground:
+		return "Foreground"
+	case Background:
+		return "Background"
+	case Paused:
+		return "Paused"
+	default:
+		return "Unknown"
+	}
+}
+
+type syncLimits struct {
+	activePeers  int
+	standbyPeers int
+	inFlight     int
+	bandwidth    int // bytes per second, 0 means unlimited
+}
+
+var syncProfiles = map[SyncProfile]syncLimits{
+	Foreground: {net.MinConnCount, net.MaxStandbyCount, MaxRequestsInFlight, 0},
+	Background: {2, 0, 10, 64 << 10},
+	Paused:     {1, 0, 1, 8 << 10},
+}
+
+func (service *SPVServiceImpl) SetSyncProfile(profile SyncProfile) error {
+	limits, ok := syncProfiles[profile]
+	if !ok {
+		return errors.New("unknown sync profile")
+	}
+
+	service.Lock()
+	atomic.StoreInt32(&service.profile, int32(profile))
+	// Keep the catch-up limits until caught up
+	if service.catchingUp && profile == Foreground {
+		limits = catchUpLimits
+	}
+	service.applyLimits(limits)
+	service.Unlock()
+
+	log.Info("Sync profile changed to", profile)
+	return nil
+}
+
+func (service *SPVServiceImpl) applyLimits(limits syncLimits) {
+	if max := service.concurrency.MaxRequestsInFlight; max > 0 && limits.inFlight > max {
+		limits.inFlight = max
+	}
+	service.PeerManager().SetConnLimits(limits.activePeers, limits.standbyPeers)
+	service.PeerManager().SetBandwidthLimit(limits.bandwidth)
+	service.queue.SetMaxInFlight(limits.inFlight)
+}
+
+// The profile is read without the service lock, syncBlocks() is called
+// from the request callbacks holding the lock
+func (service *SPVServiceImpl) syncProfile() SyncProfile {
+	return SyncProfile(atomic.LoadInt32(&service.profile))
+}
+
+func (service *SPVServiceImpl) isPaused() bool {
+	return service.syncProfile() == Paused
+}
@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+
+	"github.com/elastos/Elastos.ELA/bloom"
+)
+
+// A client without network, the service sees no peers connected
+type stubClient struct {
+	peerManager *net.PeerManager
+}
+
+func (client *stubClient) SetMessageHandler(SPVMessageHandler) {}
+
+func (client *stubClient) Start() {}
+
+func (client *stubClient) PeerManager() *net.PeerManager {
+	return client.peerManager
+}
+
+func newTestService(t *testing.T) *SPVServiceImpl {
+	log.Init()
+
+	client := &stubClient{peerManager: net.InitPeerManager(new(net.Peer), nil)}
+	getFilter := func() *bloom.Filter { return NewBloomFilter(1) }
+	service, err := NewSPVServiceImpl(client, db.NewMemDataStore(nil), getFilter)
+	if err != nil {
+		t.Fatalf("create service failed: %v", err)
+	}
+	return service
+}
+
+// Run the callback, fail if it does not return, a callback holding
+// the service lock must not lock it again to restart the sync
+func callWithin(t *testing.T, name string, callback func()) {
+	done := make(chan struct{})
+	go func() {
+		callback()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s deadlocked the service", name)
+	}
+}
+
+func TestRequestTimeoutInForeground(t *testing.T) {
+	service := newTestService(t)
+	if err := service.SetSyncProfile(Foreground); err != nil {
+		t.Fatalf("set sync profile failed: %v", err)
+	}
+
+	callWithin(t, "request timeout", func() {
+		service.OnRequestError(errors.New("request timeout"))
+	})
+	callWithin(t, "rescan", func() {
+		if err := service.Rescan(0); err != nil {
+			t.Errorf("rescan failed: %v", err)
+		}
+	})
+}
+
+func TestSyncProfileIsPaused(t *testing.T) {
+	service := newTestService(t)
+	for _, profile := range []SyncProfile{Foreground, Background, Paused} {
+		if err := service.SetSyncProfile(profile); err != nil {
+			t.Fatalf("set sync profile %s failed: %v", profile, err)
+		}
+		if paused := service.isPaused(); paused != (profile == Paused) {
+			t.Errorf("profile %s: paused %v", profile, paused)
+		}
+	}
+}
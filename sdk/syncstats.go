@@ -0,0 +1,167 @@
+package sdk
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// A block phase takes longer than OutlierFactor times of the average is an outlier
+	OutlierFactor = 4
+	// Outliers are checked after MinOutlierSamples blocks processed
+	MinOutlierSamples = 10
+	// Save sync stats to data store every StatsSaveInterval blocks committed
+	StatsSaveInterval = 100
+)
+
+// PhaseStats is the aggregate time spent in one phase of block processing
+type PhaseStats struct {
+	Count uint64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Average time spent in this phase per block
+func (s PhaseStats) Average() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+/*
+SyncStats is the aggregate of time spent per block during sync.
+Download is from the block requested to the merkle block received,
+Verify is checking the proof of work and merkle tree of the block,
+Commit is saving the block and transactions into data store.
+*/
+type SyncStats struct {
+	Blocks   uint64
+	Download PhaseStats
+	Verify   PhaseStats
+	Commit   PhaseStats
+}
+
+type syncTimer struct {
+	sync.Mutex
+	stats    SyncStats
+	sent     map[Uint256]time.Time
+	database db.DataStore
+}
+
+func newSyncTimer(database db.DataStore) *syncTimer {
+	timer := &syncTimer{
+		sent:     make(map[Uint256]time.Time),
+		database: database,
+	}
+
+	// Load persisted stats if data store supports it
+	if store, ok := database.(db.StatsStore); ok {
+		data, err := store.GetSyncStats()
+		if err == nil {
+			json.Unmarshal(data, &timer.stats)
+		}
+	}
+
+	return timer
+}
+
+func (t *syncTimer) Stats() SyncStats {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.stats
+}
+
+// Mark the time a block is requested, retries will not reset it
+func (t *syncTimer) OnBlockRequested(hash Uint256) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.sent[hash]; !ok {
+		t.sent[hash] = time.Now()
+	}
+}
+
+func (t *syncTimer) OnBlockReceived(hash Uint256) {
+	t.Lock()
+	defer t.Unlock()
+
+	sent, ok := t.sent[hash]
+	if !ok {
+		return
+	}
+	delete(t.sent, hash)
+	t.record(&t.stats.Download, "download", hash, time.Since(sent))
+}
+
+func (t *syncTimer) OnBlockVerified(hash Uint256, duration time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.record(&t.stats.Verify, "verify", hash, duration)
+}
+
+func (t *syncTimer) OnBlockCommitted(hash Uint256, duration time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.record(&t.stats.Commit, "commit", hash, duration)
+	t.stats.Blocks++
+	if t.stats.Blocks%StatsSaveInterval == 0 {
+		t.save()
+	}
+}
+
+// Clear the requested blocks, they will not be received after sync stopped
+func (t *syncTimer) Clear() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.sent = make(map[Uint256]time.Time)
+}
+
+func (t *syncTimer) Save() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.save()
+}
+
+func (t *syncTimer) save() {
+	store, ok := t.database.(db.StatsStore)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(t.stats)
+	if err != nil {
+		return
+	}
+
+	err = store.PutSyncStats(data)
+	if err != nil {
+		log.Error("Save sync stats failed,", err)
+	}
+}
+
+func (t *syncTimer) record(phase *PhaseStats, name string, hash Uint256, duration time.Duration) {
+	if phase.Count >= MinOutlierSamples {
+		average := phase.Average()
+		if duration > average*OutlierFactor {
+			log.Warnf("Slow block %s, hash: %s, took %v, average %v", name, hash.String(), duration, average)
+		}
+	}
+
+	phase.Count++
+	phase.Total += duration
+	if duration > phase.Max {
+		phase.Max = duration
+	}
+}
@@ -0,0 +1,242 @@
+package testutil
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// The bits of the simulated blocks, every block adds the same work,
+	// so the longer branch is the best chain
+	SimBits = 0x1d00ffff
+
+	// The timestamp of the first simulated block, and the seconds between blocks
+	SimStartTime = 1513936800
+	SimBlockTime = 120
+)
+
+// SimBlock is a block of the simulated chain
+type SimBlock struct {
+	Header Header
+	Txs    []*Transaction
+	parent *SimBlock
+}
+
+func (block *SimBlock) Hash() Uint256 {
+	return block.Header.Hash()
+}
+
+/*
+ChainSim simulates a blockchain in memory and commits its blocks to a Blockchain
+on a MemDataStore, the way the SPV service commits the blocks downloaded from
+peers, so applications can test their rollback handling deterministically
+without a network: build a fork of some depth, switch the chain tip to it, and
+check the transactions orphaned by the reorganize. Blocks are not mined, their
+proof of work and merkle roots are not valid, Blockchain.CommitBlock does not
+check them.
+*/
+type ChainSim struct {
+	chain *sdk.Blockchain
+	store *db.MemDataStore
+	// The tip of the committed main chain
+	best  *SimBlock
+	nonce uint32
+}
+
+// Fork is a branch built on a block of the main chain, its blocks are
+// committed when the chain switches to it by ChainSim.SwitchTo()
+type Fork struct {
+	sim  *ChainSim
+	base *SimBlock
+	tip  *SimBlock
+}
+
+// Create a simulated chain, isMatch tells the data store if a committed
+// transaction is wanted like NewMemDataStore(), pass nil to keep all
+func NewChainSim(isMatch func(tx *Transaction) bool) (*ChainSim, error) {
+	store := db.NewMemDataStore(isMatch)
+	chain, err := sdk.NewBlockchain(store)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainSim{chain: chain, store: store}, nil
+}
+
+// The blockchain the simulated blocks are committed to, register state
+// listeners on it to test the application
+func (sim *ChainSim) Blockchain() *sdk.Blockchain {
+	return sim.chain
+}
+
+// The data store of the blockchain
+func (sim *ChainSim) DataStore() *db.MemDataStore {
+	return sim.store
+}
+
+// The tip of the main chain, nil if no blocks mined yet
+func (sim *ChainSim) Tip() *SimBlock {
+	return sim.best
+}
+
+// Mine a block with the transactions on the main chain and commit it
+func (sim *ChainSim) Mine(txs ...*Transaction) (*SimBlock, error) {
+	block := sim.newBlock(sim.best, txs)
+	reorg, err := sim.commit(block)
+	if err != nil {
+		return nil, err
+	}
+	if reorg {
+		return nil, errors.New("mined block caused a reorganize, the main chain is out of sync")
+	}
+	sim.best = block
+	return block, nil
+}
+
+// Mine n empty blocks on the main chain
+func (sim *ChainSim) MineEmpty(n int) error {
+	for i := 0; i < n; i++ {
+		_, err := sim.Mine()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start a fork from the block depth blocks below the tip, depth 0 forks from
+// the tip. The fork has no blocks yet, mine more blocks on it than the depth
+// to make it the best chain.
+func (sim *ChainSim) BuildFork(depth uint32) (*Fork, error) {
+	base := sim.best
+	for i := uint32(0); i < depth; i++ {
+		if base == nil {
+			return nil, errors.New("fork depth is more than the chain height")
+		}
+		base = base.parent
+	}
+	return &Fork{sim: sim, base: base, tip: base}, nil
+}
+
+// The block the fork is built on, nil if forked below the first block
+func (fork *Fork) Base() *SimBlock {
+	return fork.base
+}
+
+// The last block of the fork
+func (fork *Fork) Tip() *SimBlock {
+	return fork.tip
+}
+
+// Mine a block with the transactions on the fork, it is not committed until
+// the chain switches to the fork
+func (fork *Fork) Mine(txs ...*Transaction) *SimBlock {
+	fork.tip = fork.sim.newBlock(fork.tip, txs)
+	return fork.tip
+}
+
+// Mine n empty blocks on the fork
+func (fork *Fork) MineEmpty(n int) {
+	for i := 0; i < n; i++ {
+		fork.Mine()
+	}
+}
+
+/*
+Commit the blocks of the fork. If the fork has more work than the main chain, the
+blockchain rolls back to the fork point and the fork becomes the main chain, the
+transactions of the wiped blocks not in the fork are returned as orphaned. Else
+the fork blocks are kept as a side chain and nothing is returned. A reorganize
+deeper than the finality depth of the blockchain returns *sdk.ReorgRefusedError.
+*/
+func (sim *ChainSim) SwitchTo(fork *Fork) ([]*Transaction, error) {
+	var branch []*SimBlock
+	for block := fork.tip; block != fork.base; block = block.parent {
+		branch = append([]*SimBlock{block}, branch...)
+	}
+
+	for i, block := range branch {
+		reorg, err := sim.commit(block)
+		if err != nil {
+			return nil, err
+		}
+		if !reorg {
+			continue
+		}
+		// The blockchain rolled back to the fork point without committing the
+		// block, commit the branch again from the fork point like the sync does
+		for _, block := range branch[:i+1] {
+			_, err = sim.commit(block)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tip := sim.chain.ChainTip()
+	if fork.tip == nil || !tip.Hash().IsEqual(fork.tip.Hash()) {
+		return nil, nil
+	}
+
+	included := make(map[Uint256]bool)
+	for _, block := range branch {
+		for _, tx := range block.Txs {
+			included[tx.Hash()] = true
+		}
+	}
+	var orphaned []*Transaction
+	for block := sim.best; block != fork.base; block = block.parent {
+		for _, tx := range block.Txs {
+			if !included[tx.Hash()] {
+				orphaned = append(orphaned, tx)
+			}
+		}
+	}
+
+	sim.best = fork.tip
+	return orphaned, nil
+}
+
+// Replace the top depth blocks of the main chain with depth+1 empty blocks,
+// returns the orphaned transactions of the replaced blocks
+func (sim *ChainSim) Reorg(depth uint32) ([]*Transaction, error) {
+	fork, err := sim.BuildFork(depth)
+	if err != nil {
+		return nil, err
+	}
+	fork.MineEmpty(int(depth) + 1)
+	return sim.SwitchTo(fork)
+}
+
+// Headers differ by the nonce, so blocks with the same parent and
+// transactions on different branches have different hashes
+func (sim *ChainSim) newBlock(parent *SimBlock, txs []*Transaction) *SimBlock {
+	sim.nonce++
+	header := Header{
+		Timestamp: SimStartTime,
+		Bits:      SimBits,
+		Nonce:     sim.nonce,
+		Height:    1,
+	}
+	if parent != nil {
+		header.Previous = parent.Hash()
+		header.Timestamp = parent.Header.Timestamp + SimBlockTime
+		header.Height = parent.Header.Height + 1
+	}
+	return &SimBlock{Header: header, Txs: txs, parent: parent}
+}
+
+func (sim *ChainSim) commit(block *SimBlock) (bool, error) {
+	txs := make([]Transaction, 0, len(block.Txs))
+	for _, tx := range block.Txs {
+		txs = append(txs, *tx)
+	}
+	merkleBlock := bloom.MerkleBlock{Header: block.Header, Transactions: uint32(len(txs))}
+	reorg, _, err := sim.chain.CommitBlock(merkleBlock, txs)
+	return reorg, err
+}
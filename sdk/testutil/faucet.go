@@ -0,0 +1,146 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/bloom"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// Timeout of a faucet request, so a faucet not responding fails the test
+// instead of hanging it
+const FaucetTimeout = time.Second * 30
+
+// Faucet is a client of the testnet faucet HTTP API, which sends
+// testnet coins to the given address, used in end-to-end tests.
+type Faucet struct {
+	url    string
+	client *http.Client
+}
+
+type faucetReq struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount,omitempty"`
+}
+
+type faucetResp struct {
+	TxId  string `json:"txid"`
+	Error string `json:"error"`
+}
+
+// Create a faucet client with the faucet API url
+func NewFaucet(url string) *Faucet {
+	return &Faucet{url: url, client: &http.Client{Timeout: FaucetTimeout}}
+}
+
+// Request coins from faucet to the given address, amount can be nil to
+// use the default amount of the faucet, the transaction id is returned
+func (faucet *Faucet) Request(address string, amount *Fixed64) (*Uint256, error) {
+	req := faucetReq{Address: address}
+	if amount != nil {
+		req.Amount = amount.String()
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := faucet.client.Post(faucet.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret faucetResp
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// The faucet may explain the failure in the error field
+		if json.Unmarshal(body, &ret) == nil && ret.Error != "" {
+			return nil, fmt.Errorf("faucet request failed, %s, %s", resp.Status, ret.Error)
+		}
+		return nil, errors.New("faucet request failed, " + resp.Status)
+	}
+	err = json.Unmarshal(body, &ret)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Error != "" {
+		return nil, errors.New("faucet request failed, " + ret.Error)
+	}
+
+	// The transaction id is in the byte order printed by Uint256.String()
+	return sdk.ParseHash(ret.TxId)
+}
+
+// Request coins from faucet and wait until the transaction committed
+// in a block of the given blockchain, or the timeout reached
+func (faucet *Faucet) RequestAndWait(chain *sdk.Blockchain, address string, amount *Fixed64, timeout time.Duration) (*Uint256, error) {
+	// Register listener before request, so the transaction will not be missed
+	listener := newTxWaiter()
+	chain.AddStateListener(listener)
+	defer chain.RemoveStateListener(listener)
+
+	txId, err := faucet.Request(address, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = listener.Wait(*txId, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return txId, nil
+}
+
+// txWaiter is a blockchain state listener to wait for a transaction confirmed
+type txWaiter struct {
+	committed chan Uint256
+}
+
+func newTxWaiter() *txWaiter {
+	return &txWaiter{committed: make(chan Uint256, 100)}
+}
+
+func (w *txWaiter) OnTxCommitted(tx Transaction, height uint32) {
+	// Unconfirmed transactions are committed on height 0
+	if height == 0 {
+		return
+	}
+	select {
+	case w.committed <- tx.Hash():
+	default:
+	}
+}
+
+func (w *txWaiter) OnBlockCommitted(bloom.MerkleBlock, []Transaction) {}
+
+func (w *txWaiter) OnChainRollback(height uint32) {}
+
+func (w *txWaiter) Wait(txId Uint256, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case hash := <-w.committed:
+			if hash.IsEqual(txId) {
+				return nil
+			}
+		case <-timer.C:
+			return errors.New("wait for faucet transaction timeout, tx: " + txId.String())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestFaucetRequest(t *testing.T) {
+	txId := Uint256{0x01, 0x02, 31: 0xff}
+
+	tests := []struct {
+		name   string
+		status int
+		resp   faucetResp
+		ok     bool
+	}{
+		{"transaction id", http.StatusOK, faucetResp{TxId: txId.String()}, true},
+		{"created", http.StatusCreated, faucetResp{TxId: txId.String()}, true},
+		{"faucet error", http.StatusOK, faucetResp{Error: "empty"}, false},
+		{"invalid transaction id", http.StatusOK, faucetResp{TxId: "xyz"}, false},
+		{"short transaction id", http.StatusOK, faucetResp{TxId: txId.String()[2:]}, false},
+		// A transaction id in a failed response is not trusted
+		{"server error", http.StatusInternalServerError, faucetResp{TxId: txId.String()}, false},
+		{"rate limited", http.StatusTooManyRequests, faucetResp{Error: "try later"}, false},
+	}
+	for _, test := range tests {
+		status, resp := test.status, test.resp
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req faucetReq
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(resp)
+		}))
+
+		hash, err := NewFaucet(server.URL).Request("EQ4QhsYRwuBbNBXc8BPW972xA9ANByKt6U", nil)
+		server.Close()
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: request succeeded", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: request failed: %v", test.name, err)
+			continue
+		}
+		// The returned id prints the same as the faucet response
+		if !hash.IsEqual(txId) {
+			t.Errorf("%s: got %s, want %s", test.name, hash.String(), txId.String())
+		}
+	}
+}
+
+func TestFaucetTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	faucet := NewFaucet(server.URL)
+	faucet.client.Timeout = time.Millisecond * 100
+	if _, err := faucet.Request("EQ4QhsYRwuBbNBXc8BPW972xA9ANByKt6U", nil); err == nil {
+		t.Error("request to a faucet not responding succeeded")
+	}
+}
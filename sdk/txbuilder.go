@@ -0,0 +1,319 @@
+package sdk
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// The fee rate of a TxBuilder if SetFeeRate is not called
+	DefaultFeeRate = FeeRate(1000)
+
+	// The size of the signature parameter of a standard program, the length byte
+	// and the signature, reserved in the size the fee is computed on
+	standardSignatureSize = 65
+
+	// Rounds of selecting inputs for the fee of the transaction size, more inputs
+	// make the transaction larger and the fee higher
+	maxFeeRounds = 10
+
+	// The fee the arbiters take from a deposit to a side chain
+	DefaultCrossChainFee = Amount(10000)
+)
+
+var ErrInsufficientFunds error = NewReason("insufficient_funds", CategoryFunds, ActionAddFunds,
+	"available outputs are not enough to pay the outputs and the fee")
+
+// The asset id of ELA, the hash of the transaction registering it
+var SystemAssetID = systemAssetID()
+
+func systemAssetID() Uint256 {
+	systemToken := &core.Transaction{
+		TxType:         core.RegisterAsset,
+		PayloadVersion: 0,
+		Payload: &core.PayloadRegisterAsset{
+			Asset: core.Asset{
+				Name:      "ELA",
+				Precision: 0x08,
+				AssetType: 0x00,
+			},
+			Amount:     0 * 100000000,
+			Controller: Uint168{},
+		},
+		Attributes: []*core.Attribute{},
+		Inputs:     []*core.Input{},
+		Outputs:    []*core.Output{},
+		Programs:   []*core.Program{},
+	}
+	return systemToken.Hash()
+}
+
+// Spendable is an unspent output of the system asset ELA that can be spent
+type Spendable struct {
+	Op    core.OutPoint
+	Value Fixed64
+	// The height the output is locked until, 0 if it is not locked
+	LockTime uint32
+}
+
+// UTXOSource provides the spendable outputs of an address to the TxBuilder,
+// outputs still locked at the current height must not be returned
+type UTXOSource interface {
+	GetSpendables(programHash Uint168) ([]*Spendable, error)
+}
+
+/*
+TxBuilder builds a transfer transaction from an account, the glue every wallet
+needs. Add the outputs and data, then Sign pulls the spendable outputs of the
+account from the UTXOSource, selects the inputs for the outputs and the fee of
+the signed transaction size at the fee rate, returns the change to the change
+address and signs it with the account. Broadcast sends the signed transaction by
+the SPV service.
+*/
+type TxBuilder struct {
+	source     UTXOSource
+	account    *Account
+	outputs    []*core.Output
+	crossChain core.PayloadTransferCrossChainAsset
+	attributes []*core.Attribute
+	feeRate    FeeRate
+	change     Uint168
+	lockTime   uint32
+	selector   CoinSelector
+	tx         *core.Transaction
+}
+
+// Create a transaction builder spending the outputs of the account,
+// the change goes back to the account unless SetChangeAddress is called
+func NewTxBuilder(source UTXOSource, account *Account) *TxBuilder {
+	return &TxBuilder{
+		source:   source,
+		account:  account,
+		feeRate:  DefaultFeeRate,
+		change:   *account.ProgramHash(),
+		selector: &LargestFirstSelector{},
+	}
+}
+
+// Pay the amount to the address
+func (b *TxBuilder) AddOutput(address string, amount Amount) error {
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return NewReason("invalid_address", CategoryInput, ActionFixInput,
+			"invalid output address "+address, "address", address)
+	}
+	if amount <= 0 {
+		return NewReason("invalid_amount", CategoryInput, ActionFixInput,
+			"output amount must be positive", "amount", amount.String())
+	}
+	b.outputs = append(b.outputs, &core.Output{
+		AssetID:     SystemAssetID,
+		Value:       amount.Fixed64(),
+		ProgramHash: *programHash,
+	})
+	b.tx = nil
+	return nil
+}
+
+/*
+Deposit the amount to the address on a side chain, like the DID or ETH side chain.
+The output pays the amount and the cross-chain fee to the genesis address of the
+side chain, the address its genesis block hash converts to on the main chain, and
+the payload tells the arbiters to credit the amount to the side chain address once
+the transaction is confirmed. The transaction becomes a TransferCrossChainAsset
+transaction, it can have normal outputs too.
+*/
+func (b *TxBuilder) AddCrossChainOutput(genesisAddress, sideChainAddress string, amount, fee Amount) error {
+	if sideChainAddress == "" {
+		return NewReason("invalid_address", CategoryInput, ActionFixInput,
+			"side chain address is empty", "address", sideChainAddress)
+	}
+	if amount <= 0 {
+		return NewReason("invalid_amount", CategoryInput, ActionFixInput,
+			"output amount must be positive", "amount", amount.String())
+	}
+	if fee < 0 {
+		return NewReason("invalid_fee", CategoryInput, ActionFixInput,
+			"cross-chain fee must not be negative", "fee", fee.String())
+	}
+	value, err := amount.Add(fee)
+	if err != nil {
+		return err
+	}
+	index := len(b.outputs)
+	if err := b.AddOutput(genesisAddress, value); err != nil {
+		return err
+	}
+	b.crossChain.CrossChainAddresses = append(b.crossChain.CrossChainAddresses, sideChainAddress)
+	b.crossChain.OutputIndexes = append(b.crossChain.OutputIndexes, uint64(index))
+	b.crossChain.CrossChainAmounts = append(b.crossChain.CrossChainAmounts, amount.Fixed64())
+	return nil
+}
+
+// Attach the data to the transaction as a memo attribute
+func (b *TxBuilder) AddData(data []byte) {
+	memo := core.NewAttribute(core.Memo, data)
+	b.attributes = append(b.attributes, &memo)
+	b.tx = nil
+}
+
+// Set the fee rate in sela per KB of the signed transaction size
+func (b *TxBuilder) SetFeeRate(rate FeeRate) {
+	b.feeRate = rate
+	b.tx = nil
+}
+
+// Send the change to the address instead of the account
+func (b *TxBuilder) SetChangeAddress(address string) error {
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return NewReason("invalid_address", CategoryInput, ActionFixInput,
+			"invalid change address "+address, "address", address)
+	}
+	b.change = *programHash
+	b.tx = nil
+	return nil
+}
+
+// Set the lock time of the transaction, usually the current chain height,
+// it is raised to the lock times of the spent outputs
+func (b *TxBuilder) SetLockTime(height uint32) {
+	b.lockTime = height
+	b.tx = nil
+}
+
+// Choose the spent outputs by the selector instead of LargestFirstSelector
+func (b *TxBuilder) SetCoinSelector(selector CoinSelector) {
+	b.selector = selector
+	b.tx = nil
+}
+
+// Build and sign the transaction
+func (b *TxBuilder) Sign() (*core.Transaction, error) {
+	tx, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	tx.SerializeUnsigned(buf)
+	signature, err := b.account.Sign(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	param := new(bytes.Buffer)
+	param.WriteByte(byte(len(signature)))
+	param.Write(signature)
+	tx.Programs[0].Parameter = param.Bytes()
+
+	b.tx = tx
+	return tx, nil
+}
+
+// Send the signed transaction by the SPV service, it is signed first if Sign is
+// not called or the builder changed since
+func (b *TxBuilder) Broadcast(service SPVService) (*core.Transaction, error) {
+	tx := b.tx
+	if tx == nil {
+		var err error
+		if tx, err = b.Sign(); err != nil {
+			return nil, err
+		}
+	}
+	return tx, service.SendTransaction(*tx)
+}
+
+func (b *TxBuilder) build() (*core.Transaction, error) {
+	if len(b.outputs) == 0 {
+		return nil, NewReason("no_outputs", CategoryInput, ActionFixInput, "no transaction outputs")
+	}
+	var total Amount
+	for _, output := range b.outputs {
+		var err error
+		if total, err = total.Add(AmountOf(output.Value)); err != nil {
+			return nil, err
+		}
+	}
+
+	available, err := b.source.GetSpendables(*b.account.ProgramHash())
+	if err != nil {
+		return nil, err
+	}
+
+	// Select inputs for the fee of the size, then the size with the inputs,
+	// until the selected inputs pay the fee of their own size
+	var fee Amount
+	for round := 0; round < maxFeeRounds; round++ {
+		target, err := total.Add(fee)
+		if err != nil {
+			return nil, err
+		}
+		selected, err := b.selector.Select(available, target.Fixed64())
+		if err != nil {
+			return nil, err
+		}
+		tx := b.newTransaction(selected, target.Fixed64())
+
+		size := tx.GetSize() + standardSignatureSize
+		needed, err := b.feeRate.FeeForSize(size)
+		if err != nil {
+			return nil, err
+		}
+		if needed <= fee {
+			return tx, nil
+		}
+		fee = needed
+	}
+	return nil, errors.New("fee of the transaction size can not be settled")
+}
+
+func (b *TxBuilder) newTransaction(selected []*Spendable, target Fixed64) *core.Transaction {
+	nonce := core.NewAttribute(core.Nonce, []byte(strconv.FormatInt(rand.Int63(), 10)))
+	attributes := append([]*core.Attribute{&nonce}, b.attributes...)
+
+	lockTime := b.lockTime
+	var inputs []*core.Input
+	var value Fixed64
+	for _, spendable := range selected {
+		input := &core.Input{Previous: spendable.Op}
+		if spendable.LockTime > 0 {
+			input.Sequence = math.MaxUint32 - 1
+			if spendable.LockTime > lockTime {
+				lockTime = spendable.LockTime
+			}
+		}
+		inputs = append(inputs, input)
+		value += spendable.Value
+	}
+
+	outputs := append([]*core.Output(nil), b.outputs...)
+	if value > target {
+		outputs = append(outputs, &core.Output{
+			AssetID:     SystemAssetID,
+			Value:       value - target,
+			ProgramHash: b.change,
+		})
+	}
+
+	tx := &core.Transaction{
+		TxType:     core.TransferAsset,
+		Payload:    &core.PayloadTransferAsset{},
+		Attributes: attributes,
+		Inputs:     inputs,
+		Outputs:    outputs,
+		Programs:   []*core.Program{{Code: b.account.RedeemScript()}},
+		LockTime:   lockTime,
+	}
+	if len(b.crossChain.OutputIndexes) > 0 {
+		payload := b.crossChain
+		tx.TxType = core.TransferCrossChainAsset
+		tx.Payload = &payload
+	}
+	return tx
+}
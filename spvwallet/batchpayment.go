@@ -0,0 +1,143 @@
+package spvwallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// The max number of outputs of a transaction, more payments are split
+	// into batches, so a transaction stays well below the size limit of nodes
+	MaxTransferOutputs = 1000
+
+	// The app data namespace of the output labels, keyed by "txid:index"
+	OutputLabelsNamespace = "outputlabels"
+)
+
+// Keep the labels of the transfers, the outputs of a created transaction
+// are in the order of the transfers, followed by the change
+func (wallet *WalletImpl) putOutputLabels(txn *Transaction, outputs []*Transfer) error {
+	txId := txn.Hash()
+	for index, output := range outputs {
+		if output.Label == "" {
+			continue
+		}
+		err := wallet.PutAppData(OutputLabelsNamespace, outputLabelKey(txId, uint16(index)), []byte(output.Label))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the labels of the outputs of a transaction created by the wallet,
+// by the output index, outputs without labels are not included
+func (wallet *WalletImpl) GetOutputLabels(txId Uint256) (map[uint16]string, error) {
+	values, err := wallet.GetAppDataAll(OutputLabelsNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := txId.String() + ":"
+	labels := make(map[uint16]string)
+	for key, value := range values {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		index, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 16)
+		if err != nil {
+			continue
+		}
+		labels[uint16(index)] = string(value)
+	}
+	return labels, nil
+}
+
+func outputLabelKey(txId Uint256, index uint16) string {
+	return fmt.Sprint(txId.String(), ":", index)
+}
+
+/*
+Pay many recipients in one transaction for the sendmany RPC method. The fee is the
+fixed fee if given, or estimated for the confirmation target by the size of the
+transaction with all the outputs, the change goes back to the from address, or to
+the internal chain if it is an HD address. The
+service has no access to the keystore, so the transaction is signed by the remote
+signing service, which must be configured.
+*/
+func (wallet *SPVWallet) SendMany(from string, payments []*rpc.Payment, fee, target string) (*Uint256, error) {
+	remote := config.Values().RemoteSigner
+	if remote.Address == "" {
+		return nil, errors.New("sendmany signs by the remote signing service, set RemoteSigner.Address")
+	}
+
+	transfers := make([]*Transfer, 0, len(payments))
+	for _, payment := range payments {
+		amount, err := sdk.ParseAmount(payment.Amount)
+		if err != nil {
+			return nil, errors.New("invalid amount of " + payment.Address + ", " + err.Error())
+		}
+		value := amount.Fixed64()
+		transfers = append(transfers, &Transfer{
+			Address:     payment.Address,
+			Value:       &value,
+			LockedUntil: payment.Lock,
+			Label:       payment.Label,
+		})
+	}
+
+	// The wallet on the data store of the service, without the keystore
+	payer := &WalletImpl{Database: &DatabaseImpl{lock: new(sync.RWMutex), DataStore: wallet.dataStore}}
+
+	var txn *Transaction
+	switch {
+	case fee != "":
+		amount, err := sdk.ParseAmount(fee)
+		if err != nil {
+			return nil, errors.New("invalid transaction fee, " + err.Error())
+		}
+		value := amount.Fixed64()
+		txn, err = payer.CreateMultiOutputTransaction(from, &value, transfers...)
+		if err != nil {
+			return nil, err
+		}
+	case target != "":
+		confirmTarget, err := ParseConfirmTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		txn, err = payer.CreateTransactionWithTarget(from, confirmTarget, 0, transfers...)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("specify the fee or the confirmation target")
+	}
+
+	signer, err := NewRemoteSigner(remote.Address, remote.CertFile, remote.KeyFile, remote.CAFile, remote.AuditFile)
+	if err != nil {
+		return nil, err
+	}
+	defer signer.Close()
+	txn, err = payer.SignWith(signer, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallet.SendTransaction(*txn)
+	if err != nil {
+		return nil, err
+	}
+	txId := txn.Hash()
+	return &txId, payer.markTargetSent(txId)
+}
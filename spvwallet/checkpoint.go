@@ -0,0 +1,221 @@
+package spvwallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Record a sync checkpoint every this number of blocks by default
+const DefaultSyncCheckpointInterval = 1000
+
+/*
+SyncCheckpoint is a record of the committed sync state on a height. The wallet
+data below the checkpoint was consistent with the headers when it was recorded,
+so the consistency check on open walks the headers back to the checkpoint only,
+instead of the lowest wallet transaction.
+*/
+type SyncCheckpoint struct {
+	Height uint32
+	Hash   Uint256
+	// The number of times the wallet addresses changed when recorded
+	FilterGeneration uint32
+	// The hash and number of the confirmed outputs unspent on the height
+	UTXOHash Uint256
+	UTXOs    uint32
+}
+
+func (cp *SyncCheckpoint) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := WriteUint32(buf, cp.Height)
+	if err != nil {
+		return nil, err
+	}
+	err = cp.Hash.Serialize(buf)
+	if err != nil {
+		return nil, err
+	}
+	err = WriteUint32(buf, cp.FilterGeneration)
+	if err != nil {
+		return nil, err
+	}
+	err = cp.UTXOHash.Serialize(buf)
+	if err != nil {
+		return nil, err
+	}
+	err = WriteUint32(buf, cp.UTXOs)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cp *SyncCheckpoint) Deserialize(data []byte) error {
+	r := bytes.NewReader(data)
+	var err error
+	cp.Height, err = ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	err = cp.Hash.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	cp.FilterGeneration, err = ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	err = cp.UTXOHash.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	cp.UTXOs, err = ReadUint32(r)
+	return err
+}
+
+// Get the last sync checkpoint, nil if none recorded
+func (wallet *SPVWallet) SyncCheckpoint() (*SyncCheckpoint, error) {
+	data, err := wallet.dataStore.Info().Get(db.SyncCheckpointKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := new(SyncCheckpoint)
+	err = checkpoint.Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func syncCheckpointInterval() uint32 {
+	if interval := config.Values().SyncCheckpointInterval; interval > 0 {
+		return interval
+	}
+	return DefaultSyncCheckpointInterval
+}
+
+// Record a sync checkpoint when the new chain tip reaches the interval, and drop
+// the checkpoint above the new chain tip after a rollback
+func (wallet *SPVWallet) updateSyncCheckpoint(tip *StoreHeader) {
+	checkpoint, err := wallet.SyncCheckpoint()
+	if err != nil {
+		log.Error("Get sync checkpoint failed,", err)
+		return
+	}
+	if checkpoint != nil && checkpoint.Height > tip.Height {
+		err = wallet.dataStore.Info().Delete(db.SyncCheckpointKey)
+		if err != nil {
+			log.Error("Delete sync checkpoint failed,", err)
+		}
+	}
+
+	// The transactions of the block are committed before the header
+	if tip.Height == 0 || tip.Height%syncCheckpointInterval() != 0 ||
+		tip.Height != wallet.dataStore.Info().ChainHeight() {
+		return
+	}
+
+	utxoHash, utxos, err := wallet.utxoSummary(tip.Height)
+	if err != nil {
+		log.Error("Summarize UTXOs for sync checkpoint failed,", err)
+		return
+	}
+	checkpoint = &SyncCheckpoint{
+		Height:           tip.Height,
+		Hash:             tip.Hash(),
+		FilterGeneration: wallet.filterGeneration(),
+		UTXOHash:         utxoHash,
+		UTXOs:            utxos,
+	}
+	data, err := checkpoint.Serialize()
+	if err != nil {
+		log.Error("Serialize sync checkpoint failed,", err)
+		return
+	}
+	err = wallet.dataStore.Info().Put(db.SyncCheckpointKey, data)
+	if err != nil {
+		log.Error("Save sync checkpoint failed,", err)
+		return
+	}
+	log.Debugf("Sync checkpoint recorded on height %d, %d UTXOs", checkpoint.Height, checkpoint.UTXOs)
+}
+
+// Hash the confirmed outputs unspent on the height, outputs received or spent
+// after the height are left out, so the summary of a height does not change
+func (wallet *SPVWallet) utxoSummary(height uint32) (Uint256, uint32, error) {
+	utxos, err := wallet.dataStore.UTXOs().GetAll()
+	if err != nil {
+		return Uint256{}, 0, err
+	}
+	stxos, err := wallet.dataStore.STXOs().GetAll()
+	if err != nil {
+		return Uint256{}, 0, err
+	}
+
+	var outputs []*db.UTXO
+	for _, utxo := range utxos {
+		if utxo.AtHeight != 0 && utxo.AtHeight <= height {
+			outputs = append(outputs, utxo)
+		}
+	}
+	for _, stxo := range stxos {
+		if stxo.AtHeight == 0 || stxo.AtHeight > height {
+			continue
+		}
+		// Spent after the height, or spent by an unconfirmed transaction
+		if stxo.SpendHeight == 0 || stxo.SpendHeight > height {
+			utxo := stxo.UTXO
+			outputs = append(outputs, &utxo)
+		}
+	}
+
+	keys := make([][]byte, 0, len(outputs))
+	for _, output := range outputs {
+		key := output.Op.Bytes()
+		var value [12]byte
+		binary.LittleEndian.PutUint64(value[:8], uint64(output.Value))
+		binary.LittleEndian.PutUint32(value[8:], output.AtHeight)
+		keys = append(keys, append(key, value[:]...))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write(key)
+	}
+	var summary Uint256
+	copy(summary[:], hash.Sum(nil))
+	return summary, uint32(len(keys)), nil
+}
+
+// The number of times the wallet addresses changed, a checkpoint recorded
+// with an older generation was synced with fewer addresses in the filter
+func (wallet *SPVWallet) filterGeneration() uint32 {
+	data, err := wallet.dataStore.Info().Get(db.FilterGenerationKey)
+	if err != nil || len(data) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
+
+func (wallet *SPVWallet) nextFilterGeneration() {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], wallet.filterGeneration()+1)
+	err := wallet.dataStore.Info().Put(db.FilterGenerationKey, data[:])
+	if err != nil {
+		log.Error("Save filter generation failed,", err)
+	}
+}
@@ -3,15 +3,19 @@ package account
 import (
 	"os"
 	"fmt"
+	"encoding/json"
 	"errors"
 	"strings"
 	"io/ioutil"
+	"time"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/crypto"
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/cli"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 
 	"github.com/urfave/cli"
 )
@@ -30,6 +34,32 @@ func listBalanceInfo(wallet Wallet) error {
 	return ShowAccounts(addrs, nil, wallet)
 }
 
+func listBalanceAt(wallet Wallet, height uint32) error {
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		log.Error("Get addresses error:", err)
+		return errors.New("get wallet addresses failed")
+	}
+
+	// print header
+	fmt.Printf("%5s %34s %-20s %6s\n", "INDEX", "ADDRESS", "BALANCE", "TYPE")
+	fmt.Println("-----", strings.Repeat("-", 34), strings.Repeat("-", 20), "------")
+
+	var total Fixed64
+	for i, addr := range addrs {
+		balance, err := wallet.GetBalanceAt(addr.Hash(), height)
+		if err != nil {
+			return err
+		}
+		total += balance
+		fmt.Printf("%5d %34s %-20s %6s\n", i+1, addr.String(), balance.String(), addr.TypeName())
+		fmt.Println("-----", strings.Repeat("-", 34), strings.Repeat("-", 20), "------")
+	}
+
+	fmt.Println("Total balance as of height", height, "is", total.String())
+	return nil
+}
+
 func newSubAccount(password []byte, wallet Wallet) error {
 	var err error
 	password, err = GetPassword(password, false)
@@ -51,6 +81,105 @@ func newSubAccount(password []byte, wallet Wallet) error {
 	return ShowAccounts(addrs, programHash, wallet)
 }
 
+// Show the address to receive the next payment, a fresh HD address,
+// or a payment request URI of it to share as a link or QR code
+func showReceiveAddress(context *cli.Context, password []byte, wallet Wallet) error {
+	programHash, err := wallet.GetReceiveAddress()
+	if err == ErrNoHDAccount {
+		// The keystore sets up the HD account when opened with the password
+		password, err = GetPassword(password, false)
+		if err != nil {
+			return err
+		}
+		err = wallet.VerifyPassword(password)
+		if err != nil {
+			return err
+		}
+		programHash, err = wallet.GetReceiveAddress()
+	}
+	if err != nil {
+		return err
+	}
+
+	address, err := programHash.ToAddress()
+	if err != nil {
+		return err
+	}
+	if !context.Bool("uri") {
+		fmt.Println(address)
+		return nil
+	}
+
+	request := &sdk.PaymentRequest{Address: address, Memo: context.String("memo")}
+	if amountStr := context.String("amount"); amountStr != "" {
+		request.Amount, err = sdk.ParseAmount(amountStr)
+		if err != nil {
+			return err
+		}
+	}
+	if expiryStr := context.String("expiry"); expiryStr != "" {
+		expiry, err := time.ParseDuration(expiryStr)
+		if err != nil || expiry <= 0 {
+			return errors.New("invalid expiry, expect a duration like 24h")
+		}
+		request.Expires = time.Now().Add(expiry)
+	}
+	fmt.Println(request.String())
+	return nil
+}
+
+func importPrivateKey(context *cli.Context, password []byte, wallet Wallet, key string) error {
+	var err error
+	password, err = GetPassword(password, false)
+	if err != nil {
+		return err
+	}
+
+	programHash, err := wallet.ImportPrivateKey(password, key, uint32(context.Int("birthday")))
+	if err != nil {
+		return err
+	}
+
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		log.Error("Get addresses error:", err)
+		return errors.New("get wallet addresses failed")
+	}
+
+	fmt.Println("Private key imported, rescanning blocks from height", context.Int("birthday"))
+	return ShowAccounts(addrs, programHash, wallet)
+}
+
+func archiveAddress(wallet Wallet, address string) error {
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return errors.New("invalid address " + address)
+	}
+
+	err = wallet.ArchiveAddress(programHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Address archived, it is no longer added to the filter:", address)
+	return nil
+}
+
+func unarchiveAddress(context *cli.Context, wallet Wallet, address string) error {
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return errors.New("invalid address " + address)
+	}
+
+	err = wallet.UnarchiveAddress(programHash, uint32(context.Int("rescanfrom")))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Address unarchived, rescanning blocks from height", context.Int("rescanfrom"))
+	return nil
+}
+
 func addMultiSignAccount(context *cli.Context, wallet Wallet, content string) error {
 	// Get address content from file or cli input
 	publicKeys, err := getPublicKeys(content)
@@ -85,6 +214,164 @@ func addMultiSignAccount(context *cli.Context, wallet Wallet, content string) er
 	return ShowAccounts(addrs, programHash, wallet)
 }
 
+func listAssets(wallet Wallet) error {
+	assets, err := wallet.GetAssets()
+	if err != nil {
+		log.Error("Get assets error:", err)
+		return errors.New("get registered assets failed")
+	}
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		log.Error("Get addresses error:", err)
+		return errors.New("get wallet addresses failed")
+	}
+
+	// Sum up wallet balance by asset, ELA outputs have an empty asset id
+	balances := make(map[Uint256]Fixed64)
+	for _, addr := range addrs {
+		utxos, err := wallet.GetAddressUTXOs(addr.Hash())
+		if err != nil {
+			return errors.New("get " + addr.String() + " UTXOs failed")
+		}
+		for _, utxo := range utxos {
+			assetID := utxo.AssetID
+			if utxo.IsSystemAsset() {
+				assetID = SystemAssetId
+			}
+			balances[assetID] += utxo.Value
+		}
+	}
+
+	// print header
+	fmt.Printf("%64s %-16s %9s %-20s %8s\n", "ASSET ID", "NAME", "PRECISION", "BALANCE", "HEIGHT")
+	fmt.Println(strings.Repeat("-", 64), strings.Repeat("-", 16), "---------", strings.Repeat("-", 20), "--------")
+
+	for _, asset := range assets {
+		balance := balances[asset.ID]
+		fmt.Printf("%64s %-16s %9d %-20s %8d\n", asset.ID.String(), asset.Name, asset.Precision,
+			balance.String(), asset.Height)
+		fmt.Println(strings.Repeat("-", 64), strings.Repeat("-", 16), "---------", strings.Repeat("-", 20), "--------")
+	}
+
+	return nil
+}
+
+func showAddrClusters(wallet Wallet) error {
+	clusters, err := wallet.GetAddrClusters()
+	if err != nil {
+		log.Error("Get address clusters error:", err)
+		return errors.New("get wallet address clusters failed")
+	}
+
+	// print header
+	fmt.Printf("%7s %4s %34s %6s\n", "CLUSTER", "SIZE", "ADDRESS", "TYPE")
+	fmt.Println("-------", "----", strings.Repeat("-", 34), "------")
+
+	for i, cluster := range clusters {
+		for _, addr := range cluster {
+			fmt.Printf("%7d %4d %34s %6s\n", i+1, len(cluster), addr.String(), addr.TypeName())
+		}
+		fmt.Println("-------", "----", strings.Repeat("-", 34), "------")
+	}
+
+	fmt.Println(len(clusters), "clusters, addresses in the same cluster are linkable on-chain by co-spending")
+	return nil
+}
+
+type exportAddr struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	Script  string `json:"script"`
+}
+
+func exportAccounts(wallet Wallet, fileName string) error {
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		log.Error("Get addresses error:", err)
+		return errors.New("get wallet addresses failed")
+	}
+
+	var exports []exportAddr
+	for _, addr := range addrs {
+		exports = append(exports, exportAddr{
+			Address: addr.String(),
+			Type:    addr.TypeName(),
+			Path:    addr.Path(),
+			Script:  BytesToHexString(addr.Script()),
+		})
+	}
+
+	content, err := json.MarshalIndent(exports, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(fileName, content, 0666)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(len(exports), "accounts exported to file:", fileName)
+	return nil
+}
+
+func exportDelta(context *cli.Context, password []byte, wallet Wallet, fileName string) error {
+	var err error
+	password, err = GetPassword(password, false)
+	if err != nil {
+		return err
+	}
+
+	// Export changes since last export, or everything if full
+	var since db.DeltaSeq
+	if !context.Bool("full") {
+		since, err = wallet.GetDeltaSeq()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, seq, err := wallet.ExportDelta(password, since)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(fileName, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = wallet.PutDeltaSeq(seq)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Wallet state exported to file:", fileName)
+	return nil
+}
+
+func importDelta(password []byte, wallet Wallet, fileName string) error {
+	var err error
+	password, err = GetPassword(password, false)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	addrs, txs, err := wallet.ImportDelta(password, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(addrs, "addresses added,", txs, "transactions to be found by rescan")
+	return nil
+}
+
 func getPublicKeys(content string) ([]*crypto.PublicKey, error) {
 	// Content can not be empty
 	if content == "" {
@@ -166,6 +453,15 @@ func accountAction(context *cli.Context) {
 		return
 	}
 
+	// show a fresh receive address
+	if context.Bool("receive") {
+		if err := showReceiveAddress(context, []byte(pass), wallet); err != nil {
+			fmt.Println("error: get receive address failed,", err)
+			cli.ShowCommandHelpAndExit(context, "receive", 5)
+		}
+		return
+	}
+
 	// add multi sign account
 	if pubKeysStr := context.String("addmultisig"); pubKeysStr != "" {
 		if err := addMultiSignAccount(context, wallet, pubKeysStr); err != nil {
@@ -175,6 +471,42 @@ func accountAction(context *cli.Context) {
 		return
 	}
 
+	// import a private key and rescan it's transactions
+	if key := context.String("import"); key != "" {
+		if err := importPrivateKey(context, []byte(pass), wallet, key); err != nil {
+			fmt.Println("error: import private key failed,", err)
+			cli.ShowCommandHelpAndExit(context, "import", 9)
+		}
+		return
+	}
+
+	// archive a fully spent address to leave it out of the filter
+	if address := context.String("archive"); address != "" {
+		if err := archiveAddress(wallet, address); err != nil {
+			fmt.Println("error: archive address failed,", err)
+			cli.ShowCommandHelpAndExit(context, "archive", 11)
+		}
+		return
+	}
+
+	// unarchive an address and rescan it's transactions
+	if address := context.String("unarchive"); address != "" {
+		if err := unarchiveAddress(context, wallet, address); err != nil {
+			fmt.Println("error: unarchive address failed,", err)
+			cli.ShowCommandHelpAndExit(context, "unarchive", 11)
+		}
+		return
+	}
+
+	// show addresses balance as of the given height
+	if context.IsSet("height") {
+		if err := listBalanceAt(wallet, uint32(context.Int("height"))); err != nil {
+			fmt.Println("error: list balance at height failed,", err)
+			cli.ShowCommandHelpAndExit(context, "height", 6)
+		}
+		return
+	}
+
 	// show addresses balance in this wallet
 	if context.Bool("balance") {
 		if err := listBalanceInfo(wallet); err != nil {
@@ -183,6 +515,51 @@ func accountAction(context *cli.Context) {
 		}
 		return
 	}
+
+	// show registered assets and the wallet balance of each
+	if context.Bool("assets") {
+		if err := listAssets(wallet); err != nil {
+			fmt.Println("error: list assets failed,", err)
+			cli.ShowCommandHelpAndExit(context, "assets", 6)
+		}
+		return
+	}
+
+	// show address clusters by co-spending
+	if context.Bool("clusters") {
+		if err := showAddrClusters(wallet); err != nil {
+			fmt.Println("error: show address clusters failed,", err)
+			cli.ShowCommandHelpAndExit(context, "clusters", 8)
+		}
+		return
+	}
+
+	// export wallet state changes for another device sharing the keystore
+	if fileName := context.String("syncexport"); fileName != "" {
+		if err := exportDelta(context, []byte(pass), wallet, fileName); err != nil {
+			fmt.Println("error: export wallet state failed,", err)
+			cli.ShowCommandHelpAndExit(context, "syncexport", 10)
+		}
+		return
+	}
+
+	// import wallet state changes exported by another device
+	if fileName := context.String("syncimport"); fileName != "" {
+		if err := importDelta([]byte(pass), wallet, fileName); err != nil {
+			fmt.Println("error: import wallet state failed,", err)
+			cli.ShowCommandHelpAndExit(context, "syncimport", 10)
+		}
+		return
+	}
+
+	// export addresses with derivation paths in this wallet
+	if fileName := context.String("export"); fileName != "" {
+		if err := exportAccounts(wallet, fileName); err != nil {
+			fmt.Println("error: export accounts failed,", err)
+			cli.ShowCommandHelpAndExit(context, "export", 7)
+		}
+		return
+	}
 }
 
 func NewCommand() cli.Command {
@@ -201,6 +578,28 @@ func NewCommand() cli.Command {
 				Name:  "new, n",
 				Usage: "create a new sub account",
 			},
+			cli.BoolFlag{
+				Name: "receive, r",
+				Usage: "show the address to receive the next payment, a new HD address\n" +
+					"\tm/44'/2305'/0'/0/i is derived once the last one has received funds",
+			},
+			cli.BoolFlag{
+				Name: "uri",
+				Usage: "with --receive, show an elastos: payment request URI of the address instead,\n" +
+					"\tuse [--amount] [--memo] [--expiry] to request an amount with a memo until the expiry",
+			},
+			cli.StringFlag{
+				Name:  "amount",
+				Usage: "the amount in ELA requested by --uri",
+			},
+			cli.StringFlag{
+				Name:  "memo",
+				Usage: "the memo of the payment requested by --uri",
+			},
+			cli.StringFlag{
+				Name:  "expiry",
+				Usage: "the time the payment request of --uri is valid for, like 24h",
+			},
 			cli.StringFlag{
 				Name: "addmultisig, multi",
 				Usage: "add a multi-sign account with signers public keys\n" +
@@ -212,10 +611,65 @@ func NewCommand() cli.Command {
 				Usage: "the M value to specify how many signatures are needed to create a valid transaction",
 				Value: 0,
 			},
+			cli.StringFlag{
+				Name: "import, i",
+				Usage: "import a private key in WIF or hex format, blocks are rescanned to find it's transactions\n" +
+					"\tuse --birthday to specify the height to rescan from",
+			},
+			cli.IntFlag{
+				Name:  "birthday",
+				Usage: "the height of the first transaction of the imported private key, 0 to rescan from genesis",
+				Value: 0,
+			},
+			cli.StringFlag{
+				Name: "archive",
+				Usage: "archive a fully spent address, it is left out of the filter to shrink it,\n" +
+					"\tit's transactions are still shown in the history",
+			},
+			cli.StringFlag{
+				Name: "unarchive",
+				Usage: "unarchive an address, blocks are rescanned to find payments received while archived\n" +
+					"\tuse --rescanfrom to specify the height to rescan from",
+			},
+			cli.IntFlag{
+				Name:  "rescanfrom",
+				Usage: "the height to rescan from when unarchiving an address, 0 to rescan from genesis",
+				Value: 0,
+			},
 			cli.BoolFlag{
 				Name:  "balance, b",
 				Usage: "show accounts balances",
 			},
+			cli.IntFlag{
+				Name:  "height",
+				Usage: "show accounts balances as of the given height, unconfirmed transactions are not counted",
+			},
+			cli.BoolFlag{
+				Name:  "assets",
+				Usage: "show registered assets seen by the wallet and the wallet balance of each",
+			},
+			cli.BoolFlag{
+				Name:  "clusters, c",
+				Usage: "show addresses grouped by co-spending, addresses in the same cluster are linkable on-chain",
+			},
+			cli.StringFlag{
+				Name: "export, e",
+				Usage: "export accounts to the given file in JSON format, including address, type,\n" +
+					"\tderivation path and redeem script, for hardware wallets and external signers",
+			},
+			cli.StringFlag{
+				Name: "syncexport",
+				Usage: "export addresses, transactions and payees changed since last export to the given file,\n" +
+					"\tencrypted by the keystore, for another device sharing the keystore to import",
+			},
+			cli.BoolFlag{
+				Name:  "full",
+				Usage: "export all addresses, transactions and payees with --syncexport",
+			},
+			cli.StringFlag{
+				Name:  "syncimport",
+				Usage: "import addresses, transactions and payees from a file exported by --syncexport",
+			},
 		),
 		Action: accountAction,
 		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
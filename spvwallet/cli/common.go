@@ -129,6 +129,9 @@ func ShowAccounts(addrs []*db.Addr, newAddr *Uint168, wallet walt.Wallet) error
 			return errors.New("get " + addr.String() + " UTXOs failed")
 		}
 		for _, utxo := range UTXOs {
+			if !utxo.IsSystemAsset() {
+				continue
+			}
 			if utxo.LockTime < currentHeight {
 				available += utxo.Value
 			} else {
@@ -139,6 +142,10 @@ func ShowAccounts(addrs []*db.Addr, newAddr *Uint168, wallet walt.Wallet) error
 		if newAddr != nil && newAddr.IsEqual(*addr.Hash()) {
 			format = "\033[0;32m" + format + "\033[m"
 		}
+		// Archived addresses are dimmed
+		if addr.Archived() {
+			format = "\033[0;90m" + format + "\033[m"
+		}
 
 		fmt.Printf(format, i+1, addr.String(), available.String(), "("+locked.String()+")", addr.TypeName())
 		fmt.Println("-----", strings.Repeat("-", 34), strings.Repeat("-", 42), "------")
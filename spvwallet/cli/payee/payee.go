@@ -0,0 +1,145 @@
+package payee
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	walt "github.com/elastos/Elastos.ELA.SPV/spvwallet"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	"github.com/urfave/cli"
+)
+
+func addPayee(context *cli.Context, wallet walt.Wallet, name string) error {
+	address := context.String("address")
+	if address == "" {
+		return errors.New("use --address to specify the payee address")
+	}
+
+	err := wallet.AddPayee(name, address, context.String("memo"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Payee", name, "saved")
+	return nil
+}
+
+func showPayees(payees []*db.Payee) error {
+	// print header
+	fmt.Printf("%-20s %34s %-20s %s\n", "NAME", "ADDRESS", "LAST USED", "MEMO")
+	fmt.Println(strings.Repeat("-", 20), strings.Repeat("-", 34), strings.Repeat("-", 20), strings.Repeat("-", 20))
+
+	for _, payee := range payees {
+		address, err := payee.Address.ToAddress()
+		if err != nil {
+			return err
+		}
+		var lastUsed string
+		if !payee.LastUsed.IsZero() {
+			lastUsed = payee.LastUsed.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-20s %34s %-20s %s\n", payee.Name, address, lastUsed, payee.Memo)
+	}
+
+	return nil
+}
+
+func payeeAction(context *cli.Context) {
+	if context.NumFlags() == 0 {
+		cli.ShowSubcommandHelp(context)
+		os.Exit(0)
+	}
+
+	wallet, err := walt.Open()
+	if err != nil {
+		fmt.Println("error: open wallet failed,", err)
+		os.Exit(2)
+	}
+
+	// add or update a payee
+	if name := context.String("add"); name != "" {
+		if err := addPayee(context, wallet, name); err != nil {
+			fmt.Println("error: add payee failed,", err)
+			cli.ShowCommandHelpAndExit(context, "add", 3)
+		}
+		return
+	}
+
+	// delete a payee
+	if name := context.String("delete"); name != "" {
+		if err := wallet.DeletePayee(name); err != nil {
+			fmt.Println("error: delete payee failed,", err)
+			cli.ShowCommandHelpAndExit(context, "delete", 4)
+		}
+		fmt.Println("Payee", name, "deleted")
+		return
+	}
+
+	// search payees by name or memo
+	if query := context.String("search"); query != "" {
+		payees, err := wallet.SearchPayees(query)
+		if err == nil {
+			err = showPayees(payees)
+		}
+		if err != nil {
+			fmt.Println("error: search payees failed,", err)
+			cli.ShowCommandHelpAndExit(context, "search", 5)
+		}
+		return
+	}
+
+	// list payees
+	if context.Bool("list") {
+		payees, err := wallet.GetPayees()
+		if err == nil {
+			err = showPayees(payees)
+		}
+		if err != nil {
+			fmt.Println("error: list payees failed,", err)
+			cli.ShowCommandHelpAndExit(context, "list", 5)
+		}
+		return
+	}
+}
+
+func NewCommand() cli.Command {
+	return cli.Command{
+		Name:        "payee",
+		Usage:       "payee [command] [args]",
+		Description: "manage the address book, use the payee name with transaction --payee to pay it",
+		ArgsUsage:   "[args]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "add",
+				Usage: "use --add NAME --address [--memo] to add a payee, or update the payee with the name",
+			},
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "the address of the payee",
+			},
+			cli.StringFlag{
+				Name:  "memo",
+				Usage: "the memo attached to transactions paying the payee by default",
+			},
+			cli.BoolFlag{
+				Name:  "list, l",
+				Usage: "list payees, the most recently used first",
+			},
+			cli.StringFlag{
+				Name:  "search, s",
+				Usage: "search payees by name or memo",
+			},
+			cli.StringFlag{
+				Name:  "delete",
+				Usage: "delete the payee with the name",
+			},
+		},
+		Action: payeeAction,
+		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
+			return cli.NewExitError(err, 1)
+		},
+	}
+}
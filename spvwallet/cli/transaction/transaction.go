@@ -11,8 +11,10 @@ import (
 	"io/ioutil"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/cli"
 	walt "github.com/elastos/Elastos.ELA.SPV/spvwallet"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 
 	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
@@ -25,19 +27,28 @@ func CreateTransaction(c *cli.Context, wallet walt.Wallet) error {
 	if err != nil {
 		return err
 	}
-	return output(txn)
+	err = output(txn)
+	if err != nil {
+		return err
+	}
+	return showSignerPaths(wallet, txn)
 }
 
 func createTransaction(c *cli.Context, wallet walt.Wallet) (*Transaction, error) {
+	if targetStr := c.String("target"); targetStr != "" {
+		return createTransactionWithTarget(c, wallet, targetStr)
+	}
+
 	feeStr := c.String("fee")
 	if feeStr == "" {
-		return nil, errors.New("use --fee to specify transfer fee")
+		return nil, errors.New("use --fee to specify transfer fee, or --target to estimate it")
 	}
 
-	fee, err := StringToFixed64(feeStr)
+	feeAmount, err := sdk.ParseAmount(feeStr)
 	if err != nil {
 		return nil, errors.New("invalid transaction fee")
 	}
+	fee := feeAmount.Fixed64()
 
 	from := c.String("from")
 	if from == "" {
@@ -51,16 +62,16 @@ func createTransaction(c *cli.Context, wallet walt.Wallet) (*Transaction, error)
 
 	multiOutput := c.String("file")
 	if multiOutput != "" {
-		txn, err = createMultiOutputTransaction(c, wallet, multiOutput, from, fee)
+		txn, err = createMultiOutputTransaction(c, wallet, multiOutput, from, &fee)
 		if err != nil {
 			return nil, err
 		}
 		return txn, nil
 	}
 
-	to := c.String("to")
-	if to == "" {
-		return nil, errors.New("use --to to specify receiver address")
+	// Pay a payment request URI, the amount of the request is paid if it has one
+	if uri := c.String("uri"); uri != "" {
+		return createPaymentRequestTransaction(c, wallet, uri, from, &fee)
 	}
 
 	amountStr := c.String("amount")
@@ -68,14 +79,29 @@ func createTransaction(c *cli.Context, wallet walt.Wallet) (*Transaction, error)
 		return nil, errors.New("use --amount to specify transfer amount")
 	}
 
-	amount, err := StringToFixed64(amountStr)
+	transferAmount, err := sdk.ParseAmount(amountStr)
 	if err != nil {
 		return nil, errors.New("invalid transaction amount")
 	}
+	amount := transferAmount.Fixed64()
+
+	// Pay a payee in the address book
+	if payee := c.String("payee"); payee != "" {
+		txn, err = wallet.CreatePayeeTransaction(from, payee, &amount, &fee)
+		if err != nil {
+			return nil, errors.New("create transaction failed: " + err.Error())
+		}
+		return txn, nil
+	}
+
+	to := c.String("to")
+	if to == "" {
+		return nil, errors.New("use --to to specify receiver address, or --payee to pay a payee")
+	}
 
 	lockStr := c.String("lock")
 	if lockStr == "" {
-		txn, err = wallet.CreateTransaction(from, to, amount, fee)
+		txn, err = wallet.CreateTransaction(from, to, &amount, &fee)
 		if err != nil {
 			return nil, errors.New("create transaction failed: " + err.Error())
 		}
@@ -84,7 +110,7 @@ func createTransaction(c *cli.Context, wallet walt.Wallet) (*Transaction, error)
 		if err != nil {
 			return nil, errors.New("invalid lock height")
 		}
-		txn, err = wallet.CreateLockedTransaction(from, to, amount, fee, uint32(lock))
+		txn, err = wallet.CreateLockedTransaction(from, to, &amount, &fee, uint32(lock))
 		if err != nil {
 			return nil, errors.New("create transaction failed: " + err.Error())
 		}
@@ -93,30 +119,117 @@ func createTransaction(c *cli.Context, wallet walt.Wallet) (*Transaction, error)
 	return txn, nil
 }
 
-func createMultiOutputTransaction(c *cli.Context, wallet walt.Wallet, path, from string, fee *Fixed64) (*Transaction, error) {
-	if _, err := os.Stat(path); err != nil {
-		return nil, errors.New("invalid multi output file path")
+func createPaymentRequestTransaction(c *cli.Context, wallet walt.Wallet, uri, from string, fee *Fixed64) (*Transaction, error) {
+	request, err := sdk.ParsePaymentURI(uri)
+	if err != nil {
+		return nil, err
 	}
-	file, err := os.OpenFile(path, os.O_RDONLY, 0666)
+
+	var amount *Fixed64
+	if amountStr := c.String("amount"); amountStr != "" {
+		transferAmount, err := sdk.ParseAmount(amountStr)
+		if err != nil {
+			return nil, errors.New("invalid transaction amount")
+		}
+		if request.Amount > 0 && transferAmount != request.Amount {
+			return nil, errors.New("--amount differs from the amount of the payment request")
+		}
+		value := transferAmount.Fixed64()
+		amount = &value
+	}
+
+	txn, err := wallet.CreatePaymentRequestTransaction(from, request, amount, fee)
 	if err != nil {
-		return nil, errors.New("open multi output file failed")
+		return nil, errors.New("create transaction failed: " + err.Error())
 	}
+	return txn, nil
+}
 
-	scanner := bufio.NewScanner(file)
-	var multiOutput []*walt.Transfer
-	for scanner.Scan() {
-		columns := strings.Split(scanner.Text(), ",")
-		if len(columns) < 2 {
-			return nil, errors.New(fmt.Sprint("invalid multi output line:", columns))
+// Create a transaction paying the fee estimated for the confirmation target
+func createTransactionWithTarget(c *cli.Context, wallet walt.Wallet, targetStr string) (*Transaction, error) {
+	target, err := walt.ParseConfirmTarget(targetStr)
+	if err != nil {
+		return nil, err
+	}
+
+	from := c.String("from")
+	if from == "" {
+		from, err = SelectAccount(wallet)
+		if err != nil {
+			return nil, err
 		}
-		amountStr := strings.TrimSpace(columns[1])
-		amount, err := StringToFixed64(amountStr)
+	}
+
+	var outputs []*walt.Transfer
+	if path := c.String("file"); path != "" {
+		outputs, err = readMultiOutput(path)
 		if err != nil {
-			return nil, errors.New("invalid multi output transaction amount: " + amountStr)
+			return nil, err
+		}
+	} else {
+		to := c.String("to")
+		if to == "" {
+			return nil, errors.New("use --to to specify receiver address")
+		}
+		amount, err := sdk.ParseAmount(c.String("amount"))
+		if err != nil {
+			return nil, errors.New("use --amount to specify a valid transfer amount")
 		}
-		address := strings.TrimSpace(columns[0])
-		multiOutput = append(multiOutput, &walt.Transfer{address, amount})
-		log.Trace("Multi output address:", address, ", amount:", amountStr)
+		value := amount.Fixed64()
+		outputs = append(outputs, &walt.Transfer{Address: to, Value: &value})
+	}
+
+	var lock uint64
+	if lockStr := c.String("lock"); lockStr != "" {
+		lock, err = strconv.ParseUint(lockStr, 10, 32)
+		if err != nil {
+			return nil, errors.New("invalid lock height")
+		}
+	}
+
+	txn, err := wallet.CreateTransactionWithTarget(from, target, uint32(lock), outputs...)
+	if err != nil {
+		return nil, errors.New("create transaction failed: " + err.Error())
+	}
+	return txn, nil
+}
+
+// Show the transactions created with confirmation targets and whether the targets were met
+func showFeeTargets(wallet walt.Wallet) error {
+	reports, err := wallet.GetFeeTargetReports()
+	if err != nil {
+		return err
+	}
+
+	// print header
+	fmt.Printf("%64s %-10s %-14s %-12s %8s %6s %7s\n", "TXID", "TARGET", "FEE RATE", "FEE", "SENT AT", "BLOCKS", "RESULT")
+	fmt.Println(strings.Repeat("-", 64), strings.Repeat("-", 10), strings.Repeat("-", 14), strings.Repeat("-", 12),
+		"--------", "------", "-------")
+
+	var met, missed int
+	for _, report := range reports {
+		result := "pending"
+		if !report.Pending {
+			if report.Met {
+				result = "met"
+				met++
+			} else {
+				result = "missed"
+				missed++
+			}
+		}
+		fmt.Printf("%64s %-10s %-14s %-12s %8d %6d %7s\n", report.TxId.String(), report.Target.String(),
+			report.FeeRate.String(), report.Fee.String(), report.SentHeight, report.Blocks, result)
+	}
+
+	fmt.Println(met, "met,", missed, "missed confirmation targets")
+	return nil
+}
+
+func createMultiOutputTransaction(c *cli.Context, wallet walt.Wallet, path, from string, fee *Fixed64) (*Transaction, error) {
+	multiOutput, err := readMultiOutput(path)
+	if err != nil {
+		return nil, err
 	}
 
 	lockStr := c.String("lock")
@@ -140,6 +253,51 @@ func createMultiOutputTransaction(c *cli.Context, wallet walt.Wallet, path, from
 	return txn, nil
 }
 
+// Read the [address,amount,label,lock] lines of a multi output file, the label
+// and lock height are optional
+func readMultiOutput(path string) ([]*walt.Transfer, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.New("invalid multi output file path")
+	}
+	file, err := os.OpenFile(path, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, errors.New("open multi output file failed")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var multiOutput []*walt.Transfer
+	for scanner.Scan() {
+		columns := strings.Split(scanner.Text(), ",")
+		if len(columns) < 2 {
+			return nil, errors.New(fmt.Sprint("invalid multi output line:", columns))
+		}
+		amountStr := strings.TrimSpace(columns[1])
+		amount, err := sdk.ParseAmount(amountStr)
+		if err != nil {
+			return nil, errors.New("invalid multi output transaction amount: " + amountStr)
+		}
+		value := amount.Fixed64()
+		transfer := &walt.Transfer{Address: strings.TrimSpace(columns[0]), Value: &value}
+		// Optional label and lock height columns of the output
+		if len(columns) > 2 {
+			transfer.Label = strings.TrimSpace(columns[2])
+		}
+		if len(columns) > 3 {
+			lockStr := strings.TrimSpace(columns[3])
+			lock, err := strconv.ParseUint(lockStr, 10, 32)
+			if err != nil {
+				return nil, errors.New("invalid multi output lock height: " + lockStr)
+			}
+			transfer.LockedUntil = uint32(lock)
+		}
+		multiOutput = append(multiOutput, transfer)
+		log.Trace("Multi output address:", transfer.Address, ", amount:", amountStr)
+	}
+
+	return multiOutput, nil
+}
+
 func SignTransaction(password []byte, context *cli.Context, wallet walt.Wallet) error {
 	txn, err := getTransaction(context)
 	if err != nil {
@@ -151,7 +309,11 @@ func SignTransaction(password []byte, context *cli.Context, wallet walt.Wallet)
 		return err
 	}
 
-	return output(txn)
+	err = output(txn)
+	if err != nil {
+		return err
+	}
+	return showSignerPaths(wallet, txn)
 }
 
 func signTransaction(password []byte, wallet walt.Wallet, txn *Transaction) (*Transaction, error) {
@@ -160,6 +322,16 @@ func signTransaction(password []byte, wallet walt.Wallet, txn *Transaction) (*Tr
 		return nil, errors.New("transaction was fully signed, no need more sign")
 	}
 
+	// Sign by the remote signing service if configured, no password needed
+	if remote := config.Values().RemoteSigner; remote.Address != "" {
+		signer, err := walt.NewRemoteSigner(remote.Address, remote.CertFile, remote.KeyFile, remote.CAFile, remote.AuditFile)
+		if err != nil {
+			return nil, err
+		}
+		defer signer.Close()
+		return wallet.SignWith(signer, txn)
+	}
+
 	password, err = GetPassword(password, false)
 	if err != nil {
 		return nil, err
@@ -200,6 +372,33 @@ func SendTransaction(password []byte, context *cli.Context, wallet walt.Wallet)
 	return nil
 }
 
+// Merge the signatures of the transaction files signed by cosigners separately
+func MergeTransactions(context *cli.Context) error {
+	var txns []*Transaction
+	for _, path := range strings.Split(context.String("merge"), ",") {
+		rawData, err := ioutil.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			return errors.New("read transaction file failed, " + err.Error())
+		}
+		data, err := HexStringToBytes(strings.TrimSpace(string(rawData)))
+		if err != nil {
+			return errors.New("decode transaction content failed")
+		}
+		var txn Transaction
+		err = txn.Deserialize(bytes.NewReader(data))
+		if err != nil {
+			return errors.New("deserialize transaction failed")
+		}
+		txns = append(txns, &txn)
+	}
+
+	txn, err := walt.MergeSignatures(txns...)
+	if err != nil {
+		return err
+	}
+	return output(txn)
+}
+
 func getContent(context *cli.Context) (*string, error) {
 	var content string
 	// If parameter with file path is not empty, read content from file
@@ -289,6 +488,67 @@ func output(txn *Transaction) error {
 	return nil
 }
 
+// Print the derivation paths of the signers in this wallet, so the transaction
+// can be signed by hardware wallets or external signers
+func showSignerPaths(wallet walt.Wallet, txn *Transaction) error {
+	if len(txn.Programs) == 0 {
+		return errors.New("transaction has no program")
+	}
+	haveSign, needSign, _ := crypto.GetSignStatus(txn.Programs[0].Code, txn.Programs[0].Parameter)
+	if haveSign == needSign {
+		return nil
+	}
+
+	paths, err := wallet.GetSignerPaths(txn)
+	if err != nil {
+		return err
+	}
+
+	for programHash, path := range paths {
+		address, err := programHash.ToAddress()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Signer:", address, "derivation path:", path)
+	}
+
+	return nil
+}
+
+// Export the wallet transaction history to the file in CSV or JSON format
+func exportHistory(context *cli.Context, wallet walt.Wallet) error {
+	fileName := context.String("file")
+	if fileName == "" {
+		return errors.New("use --file to specify the export file path")
+	}
+
+	records, err := wallet.GetHistory()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch context.String("format") {
+	case "", "csv":
+		err = walt.WriteHistoryCSV(file, records)
+	case "json":
+		err = walt.WriteHistoryJSON(file, records)
+	default:
+		return errors.New("unknown export format, use csv or json")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Exported", len(records), "transactions to", fileName)
+	return nil
+}
+
 func transactionAction(context *cli.Context) {
 	if context.NumFlags() == 0 {
 		cli.ShowSubcommandHelp(context)
@@ -302,6 +562,15 @@ func transactionAction(context *cli.Context) {
 		os.Exit(2)
 	}
 
+	if name := context.String("coins"); name != "" {
+		selector, err := sdk.GetCoinSelector(name)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		wallet.SetCoinSelector(selector)
+	}
+
 	// create transaction
 	if context.Bool("create") {
 		if err := CreateTransaction(context, wallet); err != nil {
@@ -326,14 +595,38 @@ func transactionAction(context *cli.Context) {
 
 		}
 	}
+
+	// merge signatures of cosigners
+	if context.String("merge") != "" {
+		if err := MergeTransactions(context); err != nil {
+			fmt.Println("error:", err)
+			cli.ShowCommandHelpAndExit(context, "merge", 706)
+		}
+	}
+
+	// show whether confirmation targets were met
+	if context.Bool("targets") {
+		if err := showFeeTargets(wallet); err != nil {
+			fmt.Println("error:", err)
+			cli.ShowCommandHelpAndExit(context, "targets", 705)
+		}
+	}
+
+	// export transaction history
+	if context.Bool("history") {
+		if err := exportHistory(context, wallet); err != nil {
+			fmt.Println("error:", err)
+			cli.ShowCommandHelpAndExit(context, "history", 704)
+		}
+	}
 }
 
 func NewCommand() cli.Command {
 	return cli.Command{
 		Name:        "transaction",
 		ShortName:   "tx",
-		Usage:       "use [--create, --sign, --send], to create, sign or send a transaction",
-		Description: "create, sign or send transaction",
+		Usage:       "use [--create, --sign, --send, --history], to create, sign, send a transaction or export history",
+		Description: "create, sign or send transaction, or export transaction history",
 		ArgsUsage:   "[args]",
 		Flags: append(CommonFlags,
 			cli.BoolFlag{
@@ -351,6 +644,20 @@ func NewCommand() cli.Command {
 					"\tor use [--from] --to --amount --fee [--lock], or [--from] --file --fee [--lock]\n" +
 					"\tto create a standard transaction, or multi output transaction and send it",
 			},
+			cli.StringFlag{
+				Name: "merge",
+				Usage: "merge the signatures of a multi sign transaction signed by cosigners separately,\n" +
+					"\tthe transaction file paths separated by comma",
+			},
+			cli.BoolFlag{
+				Name: "history",
+				Usage: "use --file [--format] to export the transaction history with amounts, fees,\n" +
+					"\tcounterpart addresses, times and running balances for accounting",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "the export format of the transaction history, csv by default or json",
+			},
 			cli.StringFlag{
 				Name: "from",
 				Usage: "the spend address of the transaction\n" +
@@ -361,6 +668,15 @@ func NewCommand() cli.Command {
 				Name:  "to",
 				Usage: "the receive address of the transaction",
 			},
+			cli.StringFlag{
+				Name:  "payee",
+				Usage: "pay the payee with the name in the address book instead of --to, with the memo of the payee",
+			},
+			cli.StringFlag{
+				Name: "uri",
+				Usage: "pay a payment request like elastos:<address>?amount=&memo=&exp= instead of --to,\n" +
+					"\t--amount is needed only if the request has no amount",
+			},
 			cli.StringFlag{
 				Name:  "amount",
 				Usage: "the transfer amount of the transaction",
@@ -369,6 +685,20 @@ func NewCommand() cli.Command {
 				Name:  "fee",
 				Usage: "the transfer fee of the transaction",
 			},
+			cli.StringFlag{
+				Name: "target",
+				Usage: "estimate the fee for a confirmation target instead of --fee,\n" +
+					"\tfast, normal, economy or the number of blocks to be confirmed in",
+			},
+			cli.BoolFlag{
+				Name:  "targets",
+				Usage: "show the transactions created with --target and whether their targets were met",
+			},
+			cli.StringFlag{
+				Name: "coins",
+				Usage: "how the UTXOs to spend are chosen, default, largest-first, smallest-first,\n" +
+					"\tbranch-and-bound or random, overrides CoinSelection in config",
+			},
 			cli.StringFlag{
 				Name:  "lock",
 				Usage: "the lock time to specify when the received asset can be spent",
@@ -379,8 +709,8 @@ func NewCommand() cli.Command {
 			},
 			cli.StringFlag{
 				Name: "file",
-				Usage: "the file path to specify a CSV format file path with [address,amount] as multi output content\n" +
-					"\tor the transaction file path with the hex string content to be signed or sent",
+				Usage: "the file path to specify a CSV format file path with [address,amount,label,lock] as multi output content,\n" +
+					"\tlabel and lock are optional, or the transaction file path with the hex string content to be signed or sent",
 			},
 		),
 		Action: transactionAction,
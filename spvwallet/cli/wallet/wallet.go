@@ -2,7 +2,10 @@ package wallet
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/elastos/Elastos.ELA.SPV/sdk/conformance"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/cli"
 
@@ -132,3 +135,130 @@ func NewResetCommand() cli.Command {
 		},
 	}
 }
+
+func repairWallet(context *cli.Context) {
+	report, err := RepairWallet()
+	if err != nil {
+		fmt.Println("--WALLET REPAIR FAILED--", err)
+		return
+	}
+
+	fmt.Println("Chain height:", report.ChainHeight)
+	fmt.Println("Transactions replayed:", report.Txs)
+	fmt.Println("UTXOs:", report.UTXOs, "STXOs:", report.STXOs, "Assets:", report.Assets)
+	fmt.Println("--WALLET HAS BEEN REPAIRED--")
+}
+
+func runDoctor(context *cli.Context) {
+	failed := 0
+	for _, finding := range Doctor() {
+		fmt.Println(finding)
+		if !finding.Passed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Println("--", failed, "CHECKS FAILED --")
+		return
+	}
+	fmt.Println("--ALL CHECKS PASSED--")
+}
+
+func runConformance(context *cli.Context) {
+	var nodes []string
+	for _, node := range strings.Split(context.String("nodes"), ",") {
+		if node = strings.TrimSpace(node); node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+
+	reports := Conformance(nodes)
+	conformance.WriteMatrix(os.Stdout, reports)
+	for _, report := range reports {
+		if !report.Passed() {
+			fmt.Println("--CONFORMANCE CHECKS FAILED--")
+			return
+		}
+	}
+	fmt.Println("--ALL NODES CONFORM--")
+}
+
+func previewRollback(context *cli.Context) {
+	preview, err := PreviewRollback(uint32(context.Int("height")))
+	if err != nil {
+		fmt.Println("--PREVIEW ROLLBACK FAILED--", err)
+		return
+	}
+
+	fmt.Println("Rollback from chain height", preview.ChainHeight, "to height", preview.Height)
+	fmt.Println("Transactions deleted:", len(preview.Txs))
+	for _, tx := range preview.Txs {
+		fmt.Println("\t", tx.TxId.String(), "at height", tx.Height)
+	}
+	fmt.Println("UTXOs deleted:", len(preview.RemovedUTXOs))
+	for _, utxo := range preview.RemovedUTXOs {
+		fmt.Println("\t", utxo.Op.TxID.String(), utxo.Op.Index, utxo.Value.String())
+	}
+	fmt.Println("UTXOs unspent again:", len(preview.RestoredUTXOs))
+	for _, stxo := range preview.RestoredUTXOs {
+		fmt.Println("\t", stxo.Op.TxID.String(), stxo.Op.Index, stxo.Value.String())
+	}
+	fmt.Println("STXOs deleted:", len(preview.RemovedSTXOs), "Assets deleted:", len(preview.Assets))
+}
+
+func NewRepairCommand() cli.Command {
+	return cli.Command{
+		Name:   "repair",
+		Usage:  "rebuild utxos, stxos and assets from stored transactions and headers, stop the wallet service first",
+		Action: repairWallet,
+		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
+			return cli.NewExitError(err, 1)
+		},
+	}
+}
+
+func NewPreviewRollbackCommand() cli.Command {
+	return cli.Command{
+		Name:  "previewrollback",
+		Usage: "show the transactions and utxos affected by rolling back to a height, nothing is changed",
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "height",
+				Usage: "the height to roll back to",
+			},
+		},
+		Action: previewRollback,
+		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
+			return cli.NewExitError(err, 1)
+		},
+	}
+}
+
+func NewConformanceCommand() cli.Command {
+	return cli.Command{
+		Name:  "conformance",
+		Usage: "check nodes support the protocol messages used by the SPV wallet, and print a compatibility matrix",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "nodes",
+				Usage: "comma separated node hosts to check, the seeds in config are checked if not set",
+			},
+		},
+		Action: runConformance,
+		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
+			return cli.NewExitError(err, 1)
+		},
+	}
+}
+
+func NewDoctorCommand() cli.Command {
+	return cli.Command{
+		Name:   "doctor",
+		Usage:  "self-test seeds resolution, connectivity, clock skew, store writability and disk space",
+		Action: runDoctor,
+		OnUsageError: func(c *cli.Context, err error, subCommand bool) error {
+			return cli.NewExitError(err, 1)
+		},
+	}
+}
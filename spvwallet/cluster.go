@@ -0,0 +1,62 @@
+package spvwallet
+
+import (
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Group the addresses in this wallet by co-spending, addresses that ever been
+// used as inputs of the same transaction are linkable on-chain, so they are put
+// into the same cluster. Clusters are sorted by size from the largest.
+func (wallet *WalletImpl) GetAddrClusters() ([][]*Addr, error) {
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Union-find set of address indexes
+	parents := make([]int, len(addrs))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	// Union the addresses spent by the same transaction
+	spenders := make(map[Uint256]int)
+	for i, addr := range addrs {
+		stxos, err := wallet.GetAddressSTXOs(addr.Hash())
+		if err != nil {
+			return nil, err
+		}
+		for _, stxo := range stxos {
+			if j, ok := spenders[stxo.SpendTxId]; ok {
+				parents[find(i)] = find(j)
+				continue
+			}
+			spenders[stxo.SpendTxId] = i
+		}
+	}
+
+	groups := make(map[int][]*Addr)
+	for i, addr := range addrs {
+		root := find(i)
+		groups[root] = append(groups[root], addr)
+	}
+
+	clusters := make([][]*Addr, 0, len(groups))
+	for _, group := range groups {
+		clusters = append(clusters, group)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return len(clusters[i]) > len(clusters[j]) })
+
+	return clusters, nil
+}
@@ -0,0 +1,28 @@
+package spvwallet
+
+import (
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+)
+
+var ErrNotEnoughFunds error = sdk.NewReason("insufficient_funds", sdk.CategoryFunds, sdk.ActionAddFunds,
+	"[Wallet], Available token is not enough")
+
+// Set the coin selector of the transactions created by the wallet,
+// nil means the CoinSelection in config
+func (wallet *WalletImpl) SetCoinSelector(selector sdk.CoinSelector) {
+	wallet.coinSelector = selector
+}
+
+func (wallet *WalletImpl) getCoinSelector() sdk.CoinSelector {
+	if wallet.coinSelector != nil {
+		return wallet.coinSelector
+	}
+	selector, err := sdk.GetCoinSelector(config.Values().CoinSelection)
+	if err != nil {
+		log.Warn(err, ", using the default")
+		return sdk.DefaultCoinSelector
+	}
+	return selector
+}
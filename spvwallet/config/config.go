@@ -2,13 +2,22 @@ package config
 
 import (
 	"bytes"
-	"io/ioutil"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 )
 
 const (
 	ConfigFilename = "./config.json"
+
+	// Environment variables named by this prefix and the upper case key path,
+	// like SPV_PRINTLEVEL or SPV_REMOTESIGNER_ADDRESS, override the config file
+	EnvPrefix = "SPV_"
+
+	// Environment variable of the config file path
+	EnvConfigFile = EnvPrefix + "CONFIG"
 )
 
 var config *Config // The single instance of config
@@ -16,29 +25,245 @@ var config *Config // The single instance of config
 type Config struct {
 	PrintLevel uint8
 	SeedList   []string
+	// Host names of DNS seeders to discover peers, SeedList is used if none resolved
+	DNSSeeds []string
+	// The network magic number, 0 means the ELA main net
+	Magic uint32
+	// The genesis block header in hex, for chains derived from Elastos,
+	// empty means the first header is trusted from peers
+	GenesisHeader string
+	// Blocks the synced chain must pass through, in "height:hash" format
+	Checkpoints []string
+	// Consensus rules by activation height, to follow hard forks without upgrading
+	Rules []RulesConfig
+	// The storage driver registered by db.RegisterDriver(), "bolt", "badger", "leveldb",
+	// "memory" or a custom driver, empty means "bolt". The built-in
+	// bolt, badger and leveldb drivers choose the headers store, they all keep the
+	// wallet data in sqlite
+	StoreDriver string
+	// Keep only every HeaderPruneInterval full headers, 0 means do not prune,
+	// only the bolt backend supports pruning
+	HeaderPruneInterval uint32
+	// Record a sync checkpoint every SyncCheckpointInterval blocks, the consistency
+	// check on open starts from it, 0 means the default 1000
+	SyncCheckpointInterval uint32
+	// Encrypt the wallet database at rest with this passphrase, empty means not
+	// encrypted. Set it by the SPV_DATABASEPASSPHRASE environment variable instead
+	// of the config file, which is plaintext too
+	DatabasePassphrase string
+	// Reorganizes deeper than FinalityDepth need operator to accept, 0 means no limit
+	FinalityDepth uint32
+	// Peers announcing best blocks within SplitHeightThreshold heights are expected on
+	// the same chain, a split is alerted when they disagree longer than SplitAlertSeconds,
+	// 0 means the defaults 6 and 300
+	SplitHeightThreshold uint32
+	SplitAlertSeconds    uint32
+	// Serve the explorer web UI on this port, 0 means disabled
+	ExplorerPort uint16
+	// The host the explorer listens on, empty means 127.0.0.1, so only local
+	// clients see the wallet, set 0.0.0.0 to serve other hosts
+	ExplorerHost string
+	// Expire transactions unconfirmed longer than TxExpiryHours and release
+	// their inputs, 0 means never expire
+	TxExpiryHours uint32
+	// Refuse the address of a peer reached the ban score for BanDurationHours,
+	// 0 means the default 24 hours
+	BanDurationHours uint32
+	// Number of outbound connections to keep, dropped connections are replaced,
+	// 0 means the default 6
+	TargetOutbound int
+	// Rotate one outbound connection to a fresh address every PeerChurnMinutes,
+	// persistent peers and the sync peer are kept, 0 means never rotate
+	PeerChurnMinutes uint32
+	// Peers always kept connected in host:port format, unlike SeedList the port
+	// is not replaced, and they are reconnected whenever dropped
+	PersistentPeers []string
+	// Trusted nodes in SeedList that support the compressed transport,
+	// standard ELA nodes do not support it
+	CompressedSeeds []string
+	// Verify headers match their hashes when reading them from the headers store,
+	// corrupted headers are downloaded again
+	VerifyOnRead bool
+	// Do not accept relayed transactions, only transactions in blocks are committed
+	BlocksOnly bool
+	// Download and validate the header chain before requesting blocks,
+	// faster on fresh installs, with peers supporting headers messages
+	HeadersFirst bool
+	// Download the blocks from all connected peers instead of the sync peer only
+	ParallelDownload bool
+	// Answer getheaders requests of other light clients connected to the listening port
+	ServeHeaders bool
+	// Sync by compact block filters with peers serving them, the wallet addresses
+	// are not sent to these peers, standard ELA nodes do not serve compact filters
+	CompactFilters bool
+	// Do not relay addresses of connected peers to other peers
+	DisableAddrGossip bool
+	// Services bitfield advertised in the version message, 0 means none,
+	// set it for nodes that gate behavior on the services of a peer
+	Services uint64
+	// Keep headers and wallet data in memory and write nothing to the working
+	// directory, for tests and short-lived services, all data is lost on exit
+	Ephemeral bool
+	// Max number of relayed transactions kept waiting for their unconfirmed parents,
+	// 0 means the default 100, negative disables the orphan pool
+	MaxOrphanTxs int
+	// Evict orphan transactions older than OrphanTxExpiryMinutes, 0 means the default 20 minutes
+	OrphanTxExpiryMinutes uint32
+	// Watch contracts whose scripts match these templates, script hex strings
+	// with <key> wildcards for public keys, like channel scripts across counterparties
+	WatchTemplates []string
+	// Goroutine pool sizes, for tuning on small devices
+	Concurrency ConcurrencyConfig
+	// Dial peer connections through a SOCKS5 proxy, like Tor or a corporate proxy
+	Proxy ProxyConfig
+	// Sign transactions by a remote signing service instead of the keystore
+	RemoteSigner RemoteSignerConfig
+	// How the UTXOs spent by created transactions are chosen, default, largest-first,
+	// smallest-first, branch-and-bound or random, empty means default
+	CoinSelection string
+	// Limits enforced when signing transactions, no limits by default
+	SpendPolicy SpendPolicyConfig
+	// Messages of the failure reasons in RPC responses by reason code, in the
+	// language of the wallet UI, {name} is replaced by the param of the reason
+	ReasonMessages map[string]string
+}
+
+type SpendPolicyConfig struct {
+	// Max amount in ELA paid to other addresses by one transaction, empty means no limit
+	MaxTxAmount string
+	// Max amount in ELA paid to other addresses in 24 hours, empty means no limit
+	MaxDailyAmount string
+	// Only these addresses can be paid, empty means any address
+	Whitelist []string
+	// A transaction paying more than this amount in ELA must be confirmed by the
+	// signer if it can reauthenticate, like a remote signer, empty means never
+	ReauthAmount string
+	// Other signers are only delayed, the transaction above ReauthAmount is
+	// refused the first time and signed when it is signed again after this delay.
+	// Signing again takes the same password, it gives time to notice the spend
+	// but it is not a second credential.
+	SpendDelayMinutes uint32
+}
+
+type RulesConfig struct {
+	// The height the rules activate at
+	Height uint32
+	// Block header versions accepted, empty means any
+	HeaderVersions []uint32
+	// Transaction types accepted, like 2 for TransferAsset, empty means any
+	TxTypes []uint32
+	// The max proof of work target in compact form, 0 means the default
+	PowLimitBits uint32
+	// Blocks are confirmed by DPoS arbiters from the height
+	DPoS bool
+}
+
+type ConcurrencyConfig struct {
+	// Workers verifying transaction signatures, 0 means the number of CPUs
+	VerifyWorkers int
+	// Max transaction requests in flight per block, 0 means the sync profile limits
+	MaxRequestsInFlight int
+	// Workers notifying the wallet of chain changes, 0 means a goroutine per notification
+	NotifyWorkers int
 }
 
-func (config *Config) readConfigFile() error {
-	data, err := ioutil.ReadFile(ConfigFilename)
+type ProxyConfig struct {
+	// The SOCKS5 proxy address in host:port format, empty means dial directly,
+	// host names of peers are resolved by the proxy
+	Addr string
+	// Username and password authentication, empty means no authentication
+	Username string
+	Password string
+}
+
+type RemoteSignerConfig struct {
+	// The gRPC address of the signing service, like "signer.example:20880",
+	// empty means sign with the keystore
+	Address string
+	// Client certificate and key to authenticate to the signing service
+	CertFile string
+	KeyFile  string
+	// CA certificate to verify the signing service
+	CAFile string
+	// Signing requests are appended to this file, or printed to log if empty
+	AuditFile string
+}
+
+// Read the config file, JSON or TOML if the name ends with .toml,
+// unknown keys are refused so typos are not ignored silently
+func (config *Config) readConfigFile(path string) error {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 	// Remove the UTF-8 Byte Order Mark
 	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
 
-	err = json.Unmarshal(data, config)
+	if strings.HasSuffix(path, ".toml") {
+		values, err := parseTOML(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		data, err = json.Marshal(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+// Load the config in layers, each overriding the previous one: the config file,
+// environment variables, then overrides like "PrintLevel=5" or "RemoteSigner.Address=...".
+// Empty path means the file in SPV_CONFIG, or ./config.json, which may be absent.
+// Unknown keys in any layer are refused.
+func Load(path string, overrides []string) error {
+	loaded := new(Config)
+
+	if path == "" {
+		path = os.Getenv(EnvConfigFile)
+	}
+	if path == "" {
+		path = ConfigFilename
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			path = ""
+		}
+	}
+	if path != "" {
+		err := loaded.readConfigFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := loaded.applyEnv(os.Environ())
 	if err != nil {
 		return err
 	}
+
+	for _, override := range overrides {
+		err = loaded.Set(override)
+		if err != nil {
+			return err
+		}
+	}
+
+	config = loaded
 	return nil
 }
 
 func Values() *Config {
 	if config == nil {
-		config = new(Config)
-		err := config.readConfigFile()
+		err := Load("", nil)
 		if err != nil {
-			fmt.Println("Read config file error:", err)
+			fmt.Println("Load config error:", err)
+			config = new(Config)
 		}
 	}
 	return config
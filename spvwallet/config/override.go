@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Set a config value by an override like "PrintLevel=5" or "RemoteSigner.Address=...",
+// key paths are case insensitive and lists are separated by commas
+func (config *Config) Set(override string) error {
+	sep := strings.Index(override, "=")
+	if sep < 0 {
+		return errors.New("invalid config override " + override + ", expect key=value")
+	}
+	key, value := strings.TrimSpace(override[:sep]), strings.TrimSpace(override[sep+1:])
+
+	field, ok := config.field(strings.Split(key, "."))
+	if !ok {
+		return errors.New("unknown config key " + key)
+	}
+	err := setValue(field, value)
+	if err != nil {
+		return fmt.Errorf("invalid value of config key %s: %s", key, err)
+	}
+	return nil
+}
+
+// Apply the environment variables with the EnvPrefix, an unknown variable is refused
+func (config *Config) applyEnv(environ []string) error {
+	for _, env := range environ {
+		if !strings.HasPrefix(env, EnvPrefix) || strings.HasPrefix(env, EnvConfigFile+"=") {
+			continue
+		}
+		sep := strings.Index(env, "=")
+		if sep < 0 {
+			continue
+		}
+		name, value := env[:sep], env[sep+1:]
+
+		field, ok := config.field(strings.Split(strings.TrimPrefix(name, EnvPrefix), "_"))
+		if !ok {
+			return errors.New("unknown config environment variable " + name)
+		}
+		err := setValue(field, value)
+		if err != nil {
+			return fmt.Errorf("invalid value of environment variable %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Find the field by the key path, the names are case insensitive
+func (config *Config) field(path []string) (reflect.Value, bool) {
+	value := reflect.ValueOf(config).Elem()
+	for _, name := range path {
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		value = value.FieldByNameFunc(func(field string) bool {
+			return strings.EqualFold(field, name)
+		})
+		if !value.IsValid() {
+			return reflect.Value{}, false
+		}
+	}
+	return value, value.Kind() != reflect.Struct
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.New("unsupported list type")
+		}
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return errors.New("unsupported type " + field.Kind().String())
+	}
+	return nil
+}
+
+// Print the effective config after all layers are applied
+func (config *Config) Print(w io.Writer) error {
+	// Do not print the passphrase
+	printed := *config
+	if printed.DatabasePassphrase != "" {
+		printed.DatabasePassphrase = "******"
+	}
+	data, err := json.MarshalIndent(&printed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse the subset of TOML used by the config file, [table] headers, key = value pairs
+// of strings, integers, booleans and arrays of them, and # comments
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		// Table header
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNo)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" || strings.Contains(name, ".") {
+				return nil, fmt.Errorf("line %d: unsupported table name %q", lineNo, name)
+			}
+			if _, ok := root[name]; ok {
+				return nil, fmt.Errorf("line %d: duplicated table %s", lineNo, name)
+			}
+			table = make(map[string]interface{})
+			root[name] = table
+			continue
+		}
+
+		sep := strings.Index(line, "=")
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: expect key = value", lineNo)
+		}
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", lineNo)
+		}
+
+		// Arrays may span multiple lines until the brackets are balanced
+		for strings.HasPrefix(value, "[") && !bracketsBalanced(value) && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+
+		parser := &tomlParser{str: value}
+		v, err := parser.value()
+		if err == nil && strings.TrimSpace(parser.str[parser.pos:]) != "" {
+			err = errors.New("unexpected characters after value")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if _, ok := table[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicated key %s", lineNo, key)
+		}
+		table[key] = v
+	}
+	return root, nil
+}
+
+// Remove the comment from the line, # in strings is kept
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func bracketsBalanced(str string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+type tomlParser struct {
+	str string
+	pos int
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.str) && (p.str[p.pos] == ' ' || p.str[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.str) {
+		return nil, errors.New("missing value")
+	}
+
+	switch p.str[p.pos] {
+	case '"':
+		end := p.pos + 1
+		for ; end < len(p.str) && p.str[end] != '"'; end++ {
+			if p.str[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.str) {
+			return nil, errors.New("unterminated string")
+		}
+		str, err := strconv.Unquote(p.str[p.pos : end+1])
+		if err != nil {
+			return nil, errors.New("invalid string " + p.str[p.pos:end+1])
+		}
+		p.pos = end + 1
+		return str, nil
+
+	case '\'':
+		end := strings.IndexByte(p.str[p.pos+1:], '\'')
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		str := p.str[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return str, nil
+
+	case '[':
+		p.pos++
+		array := make([]interface{}, 0)
+		for {
+			p.skipSpace()
+			if p.pos < len(p.str) && p.str[p.pos] == ']' {
+				p.pos++
+				return array, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+			p.skipSpace()
+			if p.pos < len(p.str) && p.str[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			if p.pos < len(p.str) && p.str[p.pos] == ']' {
+				continue
+			}
+			return nil, errors.New("unterminated array")
+		}
+	}
+
+	end := p.pos
+	for end < len(p.str) && !strings.ContainsRune(" \t,]", rune(p.str[end])) {
+		end++
+	}
+	token := p.str[p.pos:end]
+	p.pos = end
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	// Decimal integers have no leading zero in TOML, 010 is not octal,
+	// other bases have the 0x, 0o or 0b prefix
+	digits := strings.TrimLeft(token, "+-")
+	if len(digits) > 1 && digits[0] == '0' && strings.IndexByte("xob", digits[1]) < 0 {
+		return nil, errors.New("leading zero in integer " + token)
+	}
+	n, err := strconv.ParseInt(strings.Replace(token, "_", "", -1), 0, 64)
+	if err != nil {
+		return nil, errors.New("unsupported value " + token)
+	}
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		value map[string]interface{}
+	}{
+		{"values", `
+Magic = 7630401
+Foundation = "8ZNizBf4KhhPjeJRGpox6rPcHE5Np6tFx3"
+PrintLevel = 0x1
+Debug = true
+SeedList = ['127.0.0.1:20866', "127.0.0.1:20867"]
+MaxOutbound = 1_000`, map[string]interface{}{
+			"Magic":       int64(7630401),
+			"Foundation":  "8ZNizBf4KhhPjeJRGpox6rPcHE5Np6tFx3",
+			"PrintLevel":  int64(1),
+			"Debug":       true,
+			"SeedList":    []interface{}{"127.0.0.1:20866", "127.0.0.1:20867"},
+			"MaxOutbound": int64(1000),
+		}},
+		{"tables", `
+Magic = 1 # the network
+[SpendPolicy] # limits
+MaxTxAmount = "100"
+[RPC]
+Port = 20477`, map[string]interface{}{
+			"Magic":       int64(1),
+			"SpendPolicy": map[string]interface{}{"MaxTxAmount": "100"},
+			"RPC":         map[string]interface{}{"Port": int64(20477)},
+		}},
+		{"# in strings", `
+Password = "pass#word" # comment
+Literal = 'pass#word' # comment
+Escaped = "quote\"#" # comment
+Tab = "a\tb"`, map[string]interface{}{
+			"Password": "pass#word",
+			"Literal":  "pass#word",
+			"Escaped":  "quote\"#",
+			"Tab":      "a\tb",
+		}},
+		{"] in strings", `
+Peers = ["[::1]:20866", 'a]', "]]"]
+Empty = []`, map[string]interface{}{
+			"Peers": []interface{}{"[::1]:20866", "a]", "]]"},
+			"Empty": []interface{}{},
+		}},
+		{"multi-line arrays", `
+SeedList = [
+	"127.0.0.1:20866", # first
+	"[::1]:20866",     # has ] in the string
+	'#not a comment',
+]
+Nested = [
+	[1, 2],
+	["]"]
+]
+After = "kept"`, map[string]interface{}{
+			"SeedList": []interface{}{"127.0.0.1:20866", "[::1]:20866", "#not a comment"},
+			"Nested":   []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"]"}},
+			"After":    "kept",
+		}},
+	}
+	for _, test := range tests {
+		value, err := parseTOML([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: parse failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: parsed %v, want %v", test.name, value, test.value)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unterminated string", `Name = "abc`},
+		{"unterminated literal string", `Name = 'abc`},
+		{"comment in unterminated string", `Name = "abc # def`},
+		{"unterminated array", "List = [1, 2"},
+		{"unterminated multi-line array", "List = [\n1,\n2\n"},
+		{"missing comma", "List = [1 2]"},
+		{"missing value", "Name ="},
+		{"missing key", "= 1"},
+		{"no value", "Name"},
+		{"trailing characters", `Name = "abc" def`},
+		{"float", "Rate = 1.5"},
+		{"leading zero", "Port = 010"},
+		{"duplicated key", "Name = 1\nName = 2"},
+		{"duplicated table", "[RPC]\n[RPC]"},
+		{"dotted table", "[RPC.TLS]"},
+		{"invalid table header", "[RPC"},
+	}
+	for _, test := range tests {
+		if value, err := parseTOML([]byte(test.data)); err == nil {
+			t.Errorf("%s: parsed %v, want an error", test.name, value)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package spvwallet
+
+import (
+	"sort"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+)
+
+// Check the wallet data against the headers store when the wallet opened.
+// If the headers store was deleted or truncated, or the wallet store is not
+// consistent with the stored headers, rollback the wallet data and the chain tip
+// to the last height they agree on, so the blocks after it will be synchronized again.
+func (wallet *SPVWallet) checkConsistency() error {
+	chainHeight := wallet.dataStore.Info().ChainHeight()
+
+	txs, err := wallet.dataStore.Txs().GetAll()
+	if err != nil {
+		return err
+	}
+
+	// Collect the heights that have wallet transactions on it
+	var heights []uint32
+	var heightMap = make(map[uint32]bool)
+	var lowest, highest = chainHeight, uint32(0)
+	for _, tx := range txs {
+		// Skip unconfirmed transactions
+		if tx.Height == 0 || heightMap[tx.Height] {
+			continue
+		}
+		heightMap[tx.Height] = true
+		heights = append(heights, tx.Height)
+		if tx.Height < lowest {
+			lowest = tx.Height
+		}
+		if tx.Height > highest {
+			highest = tx.Height
+		}
+	}
+
+	// The rescan point is the highest height both wallet and headers reached
+	var rescanPoint = chainHeight
+	var tipHeight uint32
+	tip, err := wallet.headers.GetTip()
+	if err != nil {
+		tip = nil
+		rescanPoint = 0
+	} else {
+		tipHeight = tip.Height
+		if tipHeight < rescanPoint {
+			rescanPoint = tipHeight
+		}
+	}
+
+	// Walk back from tip to make sure the headers of transaction heights are linked,
+	// the headers below the last sync checkpoint were linked when it was recorded
+	if rescanPoint > 0 {
+		floor := lowest
+		if rescanPoint < floor {
+			floor = rescanPoint
+		}
+		checkpoint, err := wallet.SyncCheckpoint()
+		if err != nil {
+			log.Warn("Get sync checkpoint failed, ", err)
+			checkpoint = nil
+		}
+		if checkpoint != nil && (checkpoint.Height <= floor || checkpoint.Height > rescanPoint) {
+			checkpoint = nil
+		}
+
+		if checkpoint != nil {
+			hash, err := wallet.headers.GetAncestor(tip, checkpoint.Height)
+			if err != nil || !hash.IsEqual(checkpoint.Hash) {
+				log.Warnf("Sync checkpoint on height %d not on the chain, check from height %d",
+					checkpoint.Height, floor)
+				checkpoint = nil
+			} else {
+				wallet.checkSyncCheckpoint(checkpoint)
+			}
+		}
+
+		if checkpoint == nil {
+			_, err = wallet.headers.GetAncestor(tip, floor)
+			if err != nil {
+				log.Warn("Headers store truncated, ", err)
+				rescanPoint = 0
+			}
+		}
+	}
+
+	// Find the full header to rewind to, the header on rescan point may
+	// have been pruned, then move rescan point back to a stored one
+	var rewindTo *StoreHeader
+	for rescanPoint > 0 {
+		hash, err := wallet.headers.GetAncestor(tip, rescanPoint)
+		if err == nil {
+			rewindTo, err = wallet.headers.GetHeader(*hash)
+			if err == nil {
+				break
+			}
+		}
+		rescanPoint--
+	}
+
+	if rescanPoint == chainHeight && rescanPoint == tipHeight && highest <= rescanPoint {
+		return nil
+	}
+
+	log.Warnf("Wallet data not consistent with headers, chain height %d, rescan from height %d",
+		chainHeight, rescanPoint+1)
+
+	// Rollback wallet data from the highest height
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	for _, height := range heights {
+		if height <= rescanPoint {
+			break
+		}
+		err = wallet.dataStore.Rollback(height)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Rewind chain tip to the rescan point
+	if rescanPoint == 0 && tip != nil {
+		err = wallet.headers.Reset()
+	} else if rescanPoint != tipHeight {
+		err = wallet.headers.Put(rewindTo, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	wallet.dataStore.Info().SaveChainHeight(rescanPoint)
+
+	return nil
+}
+
+// Check the wallet outputs on the checkpoint height still match the checkpoint,
+// a mismatch means the wallet data was changed outside the sync, run the repair
+func (wallet *SPVWallet) checkSyncCheckpoint(checkpoint *SyncCheckpoint) {
+	// Addresses added since may have outputs below the checkpoint found by a rescan
+	if wallet.filterGeneration() != checkpoint.FilterGeneration {
+		return
+	}
+
+	utxoHash, utxos, err := wallet.utxoSummary(checkpoint.Height)
+	if err != nil {
+		log.Warn("Summarize UTXOs failed, ", err)
+		return
+	}
+	if !utxoHash.IsEqual(checkpoint.UTXOHash) {
+		log.Warnf("Wallet outputs on height %d do not match the sync checkpoint, %d UTXOs recorded, %d found,"+
+			" run the wallet repair to rebuild them", checkpoint.Height, checkpoint.UTXOs, utxos)
+	}
+}
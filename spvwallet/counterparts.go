@@ -0,0 +1,111 @@
+package spvwallet
+
+import (
+	"encoding/json"
+
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// The app data namespace of the counterparts of wallet transactions, keyed by txid
+	CounterpartsNamespace = "counterparts"
+
+	// Directions of wallet transactions
+	DirectionReceived = "received"
+	DirectionSent     = "sent"
+	DirectionSelf     = "self"
+)
+
+// TxCounterparts tells which external addresses sent to the wallet or were paid
+// by it in a transaction, outputs back to the wallet are change and not included
+type TxCounterparts struct {
+	Direction string
+	Addresses []string
+}
+
+/*
+Get the counterparts of a transaction. If it spends from the wallet, they are the
+addresses of the outputs not to the wallet, and it's a self transfer if there are
+none. Otherwise it's received, and they are the addresses of the input programs,
+the outputs not to the wallet are the change of the sender, not counterparts.
+*/
+func txCounterparts(tx *Transaction, spends bool, owned func(Uint168) bool) (*TxCounterparts, error) {
+	var hashes []Uint168
+	if spends {
+		for _, output := range tx.Outputs {
+			if !owned(output.ProgramHash) {
+				hashes = append(hashes, output.ProgramHash)
+			}
+		}
+	} else {
+		for _, program := range tx.Programs {
+			hash, err := crypto.ToProgramHash(program.Code)
+			if err != nil {
+				continue
+			}
+			if !owned(*hash) {
+				hashes = append(hashes, *hash)
+			}
+		}
+	}
+
+	counterparts := &TxCounterparts{Direction: DirectionReceived}
+	if spends {
+		counterparts.Direction = DirectionSent
+		if len(hashes) == 0 {
+			counterparts.Direction = DirectionSelf
+		}
+	}
+	added := make(map[Uint168]bool)
+	for _, hash := range hashes {
+		if added[hash] {
+			continue
+		}
+		added[hash] = true
+		address, err := hash.ToAddress()
+		if err != nil {
+			return nil, err
+		}
+		counterparts.Addresses = append(counterparts.Addresses, address)
+	}
+	return counterparts, nil
+}
+
+// Store the counterparts of a committed transaction, the transaction committed
+// again when confirmed keeps the counterparts stored when first committed, as the
+// outputs it spends are STXOs already
+func (wallet *SPVWallet) putCounterparts(storeTx *StoreTx, spends bool) error {
+	key := storeTx.TxId.String()
+	if _, err := wallet.dataStore.AppData().Get(CounterpartsNamespace, key); err == nil {
+		return nil
+	}
+	counterparts, err := txCounterparts(&storeTx.Data, spends, wallet.getAddrFilter().ContainAddr)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(counterparts)
+	if err != nil {
+		return err
+	}
+	return wallet.dataStore.AppData().Put(CounterpartsNamespace, key, data)
+}
+
+// Get the stored counterparts of wallet transactions by txid
+func (wallet *WalletImpl) getStoredCounterparts() (map[string]*TxCounterparts, error) {
+	values, err := wallet.GetAppDataAll(CounterpartsNamespace)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]*TxCounterparts, len(values))
+	for txId, value := range values {
+		var counterparts TxCounterparts
+		if json.Unmarshal(value, &counterparts) == nil {
+			stored[txId] = &counterparts
+		}
+	}
+	return stored, nil
+}
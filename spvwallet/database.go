@@ -1,19 +1,49 @@
 package spvwallet
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
 	"sync"
+	"time"
+
+	spvdb "github.com/elastos/Elastos.ELA.SPV/db"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 )
 
 type Database interface {
-	AddAddress(address *Uint168, script []byte, addrType int) error
+	AddAddress(address *Uint168, script []byte, addrType int, path string) error
+	SetAddressPath(address *Uint168, path string) error
 	GetAddress(address *Uint168) (*Addr, error)
 	GetAddrs() ([]*Addr, error)
+	SetAddressArchived(address *Uint168, archived bool) error
 	DeleteAddress(address *Uint168) error
 	GetAddressUTXOs(address *Uint168) ([]*UTXO, error)
 	GetAddressSTXOs(address *Uint168) ([]*STXO, error)
+	GetBalanceAt(address *Uint168, height uint32) (Fixed64, error)
+	GetAssets() ([]*RegisteredAsset, error)
+	AddPayee(name, address, memo string) error
+	GetPayee(name string) (*Payee, error)
+	GetPayees() ([]*Payee, error)
+	SearchPayees(query string) ([]*Payee, error)
+	DeletePayee(name string) error
+	TouchPayee(name string) error
+	PutAppData(namespace, key string, value []byte) error
+	GetAppData(namespace, key string) ([]byte, error)
+	GetAppDataAll(namespace string) (map[string][]byte, error)
+	DeleteAppData(namespace, key string) error
+	GetTxs() ([]*spvdb.StoreTx, error)
+	IterateTxs(height uint32) (*TxIterator, error)
+	GetSpendLog() (*SpendLog, error)
+	GetDelta(since DeltaSeq) (*StoreDelta, error)
+	GetDeltaSeq() (DeltaSeq, error)
+	PutDeltaSeq(seq DeltaSeq) error
+	UpdateSpendLog(update func(log *SpendLog) error) error
+	GetFeeTargetLog() (*FeeTargetLog, error)
+	PutFeeTargetLog(log *FeeTargetLog) error
 	ChainHeight() uint32
 	Reset() error
 }
@@ -22,7 +52,7 @@ var instance Database
 
 func GetDatabase() (Database, error) {
 	if instance == nil {
-		dataStore, err := NewSQLiteDB()
+		dataStore, err := openDataStore()
 		if err != nil {
 			return nil, err
 		}
@@ -41,11 +71,19 @@ type DatabaseImpl struct {
 	DataStore
 }
 
-func (db *DatabaseImpl) AddAddress(address *Uint168, script []byte, addrType int) error {
+func (db *DatabaseImpl) AddAddress(address *Uint168, script []byte, addrType int, path string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.DataStore.Addrs().Put(address, script, addrType, path)
+}
+
+// Set the path of an address saved without one, like by earlier versions
+func (db *DatabaseImpl) SetAddressPath(address *Uint168, path string) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	return db.DataStore.Addrs().Put(address, script, addrType)
+	return db.DataStore.Addrs().SetPath(address, path)
 }
 
 func (db *DatabaseImpl) GetAddress(address *Uint168) (*Addr, error) {
@@ -62,6 +100,25 @@ func (db *DatabaseImpl) GetAddrs() ([]*Addr, error) {
 	return db.DataStore.Addrs().GetAll()
 }
 
+// Mark the address archived or active, an address still having
+// UTXOs can not be archived
+func (db *DatabaseImpl) SetAddressArchived(address *Uint168, archived bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if archived {
+		utxos, err := db.DataStore.UTXOs().GetAddrAll(address)
+		if err != nil {
+			return err
+		}
+		if len(utxos) > 0 {
+			return errors.New("address has unspent outputs, only fully spent addresses can be archived")
+		}
+	}
+
+	return db.DataStore.Addrs().SetArchived(address, archived)
+}
+
 func (db *DatabaseImpl) DeleteAddress(address *Uint168) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -83,6 +140,290 @@ func (db *DatabaseImpl) GetAddressSTXOs(address *Uint168) ([]*STXO, error) {
 	return db.DataStore.STXOs().GetAddrAll(address)
 }
 
+// Get the balance of the address as of the given height, which is the outputs
+// confirmed at or below the height and not spent at or below it.
+// Unconfirmed transactions are not counted.
+func (db *DatabaseImpl) GetBalanceAt(address *Uint168, height uint32) (Fixed64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if height > db.DataStore.Info().ChainHeight() {
+		return 0, errors.New("height is beyond the synced chain height")
+	}
+
+	utxos, err := db.DataStore.UTXOs().GetAddrAll(address)
+	if err != nil {
+		return 0, err
+	}
+	stxos, err := db.DataStore.STXOs().GetAddrAll(address)
+	if err != nil {
+		return 0, err
+	}
+
+	var balance Fixed64
+	for _, utxo := range utxos {
+		if !utxo.IsSystemAsset() {
+			continue
+		}
+		if utxo.AtHeight != 0 && utxo.AtHeight <= height {
+			balance += utxo.Value
+		}
+	}
+	for _, stxo := range stxos {
+		if !stxo.IsSystemAsset() || stxo.AtHeight == 0 || stxo.AtHeight > height {
+			continue
+		}
+		// Spent after the height, or spent by an unconfirmed transaction
+		if stxo.SpendHeight == 0 || stxo.SpendHeight > height {
+			balance += stxo.Value
+		}
+	}
+
+	return balance, nil
+}
+
+// Get the registered assets, the system asset ELA comes first. Only registrations
+// of assets controlled by or sent to wallet addresses can be seen by the SPV wallet.
+func (db *DatabaseImpl) GetAssets() ([]*RegisteredAsset, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	assets, err := db.DataStore.Assets().GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	systemAsset := &RegisteredAsset{ID: SystemAssetId, Name: "ELA", Precision: 0x08}
+	for i, asset := range assets {
+		if asset.ID == SystemAssetId {
+			systemAsset = asset
+			assets = append(assets[:i], assets[i+1:]...)
+			break
+		}
+	}
+	return append([]*RegisteredAsset{systemAsset}, assets...), nil
+}
+
+// Add a payee to the address book, or update the payee with the same name
+func (db *DatabaseImpl) AddPayee(name, address, memo string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("payee name is empty")
+	}
+	programHash, err := Uint168FromAddress(address)
+	if err != nil {
+		return errors.New("invalid payee address")
+	}
+
+	payee := &Payee{Name: name, Address: *programHash, Memo: memo}
+	// Keep the last used time when updating a payee
+	if old, err := db.DataStore.Payees().Get(name); err == nil {
+		payee.LastUsed = old.LastUsed
+	}
+	return db.DataStore.Payees().Put(payee)
+}
+
+func (db *DatabaseImpl) GetPayee(name string) (*Payee, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	payee, err := db.DataStore.Payees().Get(name)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("payee " + name + " not found")
+	}
+	return payee, err
+}
+
+func (db *DatabaseImpl) GetPayees() ([]*Payee, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.DataStore.Payees().GetAll()
+}
+
+func (db *DatabaseImpl) SearchPayees(query string) ([]*Payee, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.DataStore.Payees().Search(query)
+}
+
+func (db *DatabaseImpl) DeletePayee(name string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.DataStore.Payees().Delete(name)
+}
+
+// Set the last used time of the payee to now
+func (db *DatabaseImpl) TouchPayee(name string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.DataStore.Payees().Touch(name, time.Now())
+}
+
+// Put application data into the namespace, use a namespace
+// of the application name to avoid clashes with other applications
+func (db *DatabaseImpl) PutAppData(namespace, key string, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.DataStore.AppData().Put(namespace, key, value)
+}
+
+func (db *DatabaseImpl) GetAppData(namespace, key string) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	value, err := db.DataStore.AppData().Get(namespace, key)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("app data " + namespace + "/" + key + " not found")
+	}
+	return value, err
+}
+
+func (db *DatabaseImpl) GetAppDataAll(namespace string) (map[string][]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.DataStore.AppData().GetAll(namespace)
+}
+
+func (db *DatabaseImpl) DeleteAppData(namespace, key string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.DataStore.AppData().Delete(namespace, key)
+}
+
+func (db *DatabaseImpl) GetTxs() ([]*spvdb.StoreTx, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.DataStore.Txs().GetAll()
+}
+
+// Iterate confirmed transactions by height from the given height,
+// the iterator must be closed after the iteration
+func (db *DatabaseImpl) IterateTxs(height uint32) (*TxIterator, error) {
+	return db.DataStore.Txs().Iterate(height)
+}
+
+// Get the spend log for the spend policy, empty if not saved yet
+func (db *DatabaseImpl) GetSpendLog() (*SpendLog, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.getSpendLog()
+}
+
+// Update the spend log by the function and save it, the log is read and saved
+// under the database lock, so concurrent updates are not lost. Nothing is saved
+// if the function returns an error.
+func (db *DatabaseImpl) UpdateSpendLog(update func(log *SpendLog) error) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	spendLog, err := db.getSpendLog()
+	if err != nil {
+		return err
+	}
+	if err := update(spendLog); err != nil {
+		return err
+	}
+	data, err := json.Marshal(spendLog)
+	if err != nil {
+		return err
+	}
+	return db.DataStore.Info().Put(SpendLogKey, data)
+}
+
+func (db *DatabaseImpl) getSpendLog() (*SpendLog, error) {
+	spendLog := &SpendLog{Pending: make(map[string]int64)}
+	data, err := db.DataStore.Info().Get(SpendLogKey)
+	if err == sql.ErrNoRows {
+		return spendLog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, spendLog)
+	if err != nil {
+		return nil, err
+	}
+	if spendLog.Pending == nil {
+		spendLog.Pending = make(map[string]int64)
+	}
+	return spendLog, nil
+}
+
+// Get the transactions created with confirmation targets, empty if not saved yet
+func (db *DatabaseImpl) GetFeeTargetLog() (*FeeTargetLog, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	feeLog := new(FeeTargetLog)
+	data, err := db.DataStore.Info().Get(FeeTargetsKey)
+	if err == sql.ErrNoRows {
+		return feeLog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, feeLog)
+	if err != nil {
+		return nil, err
+	}
+	return feeLog, nil
+}
+
+func (db *DatabaseImpl) PutFeeTargetLog(feeLog *FeeTargetLog) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	data, err := json.Marshal(feeLog)
+	if err != nil {
+		return err
+	}
+	return db.DataStore.Info().Put(FeeTargetsKey, data)
+}
+
+func (db *DatabaseImpl) GetDelta(since DeltaSeq) (*StoreDelta, error) {
+	return db.DataStore.GetDelta(since)
+}
+
+// Get the position of the last exported store delta, zero if never exported
+func (db *DatabaseImpl) GetDeltaSeq() (DeltaSeq, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var seq DeltaSeq
+	data, err := db.DataStore.Info().Get(DeltaSeqKey)
+	if err == sql.ErrNoRows {
+		return seq, nil
+	}
+	if err != nil {
+		return seq, err
+	}
+	err = json.Unmarshal(data, &seq)
+	return seq, err
+}
+
+func (db *DatabaseImpl) PutDeltaSeq(seq DeltaSeq) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	data, err := json.Marshal(seq)
+	if err != nil {
+		return err
+	}
+	return db.DataStore.Info().Put(DeltaSeqKey, data)
+}
+
 func (db *DatabaseImpl) ChainHeight() uint32 {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
@@ -94,7 +435,7 @@ func (db *DatabaseImpl) Reset() error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	headers, err := NewHeadersDB()
+	headers, err := openHeaders()
 	if err != nil {
 		return err
 	}
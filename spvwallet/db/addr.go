@@ -7,16 +7,24 @@ const (
 	TypeSub    = 1 << 1
 	TypeMulti  = 1 << 2
 	TypeNotify = 1 << 3
+	// Address of a private key imported into the keystore
+	TypeImported = 1 << 4
+	// Contract address found by a watched script template
+	TypeWatch = 1 << 5
+	// Address derived by a BIP44 path of the HD account
+	TypeHD = 1 << 6
 )
 
 type Addr struct {
 	hash     *Uint168
 	script   []byte
 	addrType int
+	path     string
+	archived bool
 }
 
-func NewAddr(hash *Uint168, script []byte, addrType int) *Addr {
-	return &Addr{hash: hash, script: script, addrType: addrType}
+func NewAddr(hash *Uint168, script []byte, addrType int, path string) *Addr {
+	return &Addr{hash: hash, script: script, addrType: addrType, path: path}
 }
 
 func (addr *Addr) Hash() *Uint168 {
@@ -36,6 +44,28 @@ func (addr *Addr) Type() int {
 	return addr.addrType
 }
 
+// The path of the key behind this address in the keystore, the BIP44 path of
+// HD addresses, or the index of main and sub accounts like account/1. Empty if
+// the address is not derived from the keystore
+func (addr *Addr) Path() string {
+	return addr.path
+}
+
+// The BIP32 derivation path of the key behind this address, empty if the key is
+// not derived by BIP32, like main and sub accounts and imported keys
+func (addr *Addr) DerivationPath() string {
+	if addr.addrType != TypeHD {
+		return ""
+	}
+	return addr.path
+}
+
+// Archived addresses are not added to the filter, their transactions
+// are still kept in the wallet history
+func (addr *Addr) Archived() bool {
+	return addr.archived
+}
+
 func (addr *Addr) TypeName() string {
 	switch addr.addrType {
 	case TypeMaster:
@@ -46,6 +76,12 @@ func (addr *Addr) TypeName() string {
 		return "MULTI"
 	case TypeNotify:
 		return "NOTIFY"
+	case TypeImported:
+		return "IMPORTED"
+	case TypeWatch:
+		return "WATCH"
+	case TypeHD:
+		return "HD"
 	default:
 		return ""
 	}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"bytes"
 	"database/sql"
-	"sync"
+	"encoding/binary"
+	"errors"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
@@ -10,29 +12,96 @@ import (
 const CreateAddrsDB = `CREATE TABLE IF NOT EXISTS Addrs(
 				Hash BLOB NOT NULL PRIMARY KEY,
 				Script BLOB,
-				Type INTEGER NOT NULL
+				Type INTEGER NOT NULL,
+				Path TEXT NOT NULL DEFAULT '',
+				Archived INTEGER NOT NULL DEFAULT 0
 			);`
 
 type AddrsDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 }
 
-func NewAddrsDB(db *sql.DB, lock *sync.RWMutex) (Addrs, error) {
+// The schema version of the Addrs table, tables of earlier versions are
+// upgraded when the database is opened
+const AddrsVersion = 1
+
+func NewAddrsDB(db *sql.DB, lock StoreLock) (Addrs, error) {
 	_, err := db.Exec(CreateAddrsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &AddrsDB{RWMutex: lock, DB: db}, nil
+
+	// The version is saved in the Info table, which is created before
+	var version uint32
+	var value []byte
+	err = db.QueryRow("SELECT Value FROM Info WHERE Key=?", AddrsVersionKey).Scan(&value)
+	switch err {
+	case nil:
+		binary.Read(bytes.NewReader(value), binary.LittleEndian, &version)
+	case sql.ErrNoRows:
+	default:
+		return nil, err
+	}
+	if version < AddrsVersion {
+		err = upgradeAddrs(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AddrsDB{StoreLock: lock, DB: db}, nil
+}
+
+// Upgrade the Addrs table created by earlier versions and save the version,
+// the paths are updated with the version, so they are updated only once
+func upgradeAddrs(db *sql.DB) error {
+	// Addrs table created by earlier versions do not have the Path column
+	err := addColumnIfNotExists(db, "Addrs", "Path", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfNotExists(db, "Addrs", "Archived", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// Earlier versions saved the keystore index of main and sub accounts like a
+	// derivation path m/1, they are not derived by BIP32, so keep it as account/1
+	_, err = tx.Exec(`UPDATE Addrs SET Path='account/'||substr(Path,3)
+			WHERE Type IN (?,?) AND Path GLOB 'm/[0-9]*' AND Path NOT GLOB 'm/*/*'`, TypeMaster, TypeSub)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`UPDATE Addrs SET Path='account/0' WHERE Type=? AND Path=''`, TypeMaster)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint32(AddrsVersion))
+	_, err = tx.Exec("INSERT OR REPLACE INTO Info(Key, Value) VALUES(?,?)", AddrsVersionKey, buf.Bytes())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 // put a script to database
-func (db *AddrsDB) Put(hash *Uint168, script []byte, addrType int) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *AddrsDB) Put(hash *Uint168, script []byte, addrType int, path string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	sql := "INSERT OR REPLACE INTO Addrs(Hash, Script, Type) VALUES(?,?,?)"
-	_, err := db.Exec(sql, hash.Bytes(), script, addrType)
+	sql := "INSERT OR REPLACE INTO Addrs(Hash, Script, Type, Path) VALUES(?,?,?,?)"
+	_, err = db.Exec(sql, hash.Bytes(), script, addrType, path)
 	if err != nil {
 		return err
 	}
@@ -45,15 +114,19 @@ func (db *AddrsDB) Get(hash *Uint168) (*Addr, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	row := db.QueryRow(`SELECT Script, Type FROM Addrs WHERE Hash=?`, hash.Bytes())
+	row := db.QueryRow(`SELECT Script, Type, Path, Archived FROM Addrs WHERE Hash=?`, hash.Bytes())
 	var script []byte
 	var addrType int
-	err := row.Scan(&script, &addrType)
+	var path string
+	var archived bool
+	err := row.Scan(&script, &addrType, &path, &archived)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewAddr(hash, script, addrType), nil
+	addr := NewAddr(hash, script, addrType, path)
+	addr.archived = archived
+	return addr, nil
 }
 
 // get all Addrs from database
@@ -62,7 +135,7 @@ func (db *AddrsDB) GetAll() ([]*Addr, error) {
 	defer db.RUnlock()
 
 	var addrs []*Addr
-	rows, err := db.Query("SELECT Hash, Script, Type FROM Addrs")
+	rows, err := db.Query("SELECT Hash, Script, Type, Path, Archived FROM Addrs")
 	if err != nil {
 		return addrs, err
 	}
@@ -72,7 +145,9 @@ func (db *AddrsDB) GetAll() ([]*Addr, error) {
 		var hashBytes []byte
 		var script []byte
 		var addrType int
-		err = rows.Scan(&hashBytes, &script, &addrType)
+		var path string
+		var archived bool
+		err = rows.Scan(&hashBytes, &script, &addrType, &path, &archived)
 		if err != nil {
 			return addrs, err
 		}
@@ -80,18 +155,57 @@ func (db *AddrsDB) GetAll() ([]*Addr, error) {
 		if err != nil {
 			return addrs, err
 		}
-		addrs = append(addrs, NewAddr(hash, script, addrType))
+		addr := NewAddr(hash, script, addrType, path)
+		addr.archived = archived
+		addrs = append(addrs, addr)
 	}
 
 	return addrs, nil
 }
 
+// Mark the address archived or active, putting the address again makes it active.
+// The address gets a new row id, so the change is in the next store delta.
+func (db *AddrsDB) SetArchived(hash *Uint168, archived bool) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	result, err := db.Exec(`UPDATE Addrs SET Archived=?, rowid=(SELECT MAX(rowid)+1 FROM Addrs)
+			WHERE Hash=?`, archived, hash.Bytes())
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("address not found in wallet")
+	}
+
+	return nil
+}
+
+// Set the path of the address saved without one
+func (db *AddrsDB) SetPath(hash *Uint168, path string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec(`UPDATE Addrs SET Path=? WHERE Hash=? AND Path=''`, path, hash.Bytes())
+	return err
+}
+
 // delete a script from database
-func (db *AddrsDB) Delete(hash *Uint168) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *AddrsDB) Delete(hash *Uint168) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	_, err := db.Exec("DELETE FROM Addrs WHERE Hash=?", hash.Bytes())
+	_, err = db.Exec("DELETE FROM Addrs WHERE Hash=?", hash.Bytes())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestAddrsPathUpgrade(t *testing.T) {
+	sqlDB, err := OpenMemoryDB("addrsupgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	// The Addrs table of earlier versions has no Archived column, and keeps
+	// the keystore index of accounts like a derivation path
+	_, err = sqlDB.Exec(`CREATE TABLE Addrs(
+				Hash BLOB NOT NULL PRIMARY KEY,
+				Script BLOB,
+				Type INTEGER NOT NULL,
+				Path TEXT NOT NULL DEFAULT ''
+			);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, sub, hd, later := Uint168{1}, Uint168{2}, Uint168{3}, Uint168{4}
+	insert := "INSERT INTO Addrs(Hash, Type, Path) VALUES(?,?,?)"
+	for _, addr := range []struct {
+		hash     Uint168
+		addrType int
+		path     string
+	}{
+		{master, TypeMaster, ""},
+		{sub, TypeSub, "m/1"},
+		{hd, TypeSub, "m/44'/2305'/0'/0/1"},
+	} {
+		if _, err := sqlDB.Exec(insert, addr.hash.Bytes(), addr.addrType, addr.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lock := new(sync.RWMutex)
+	info, err := NewInfoDB(sqlDB, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := NewAddrsDB(sqlDB, lock)
+	if err != nil {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+	if _, err := info.Get(AddrsVersionKey); err != nil {
+		t.Errorf("version not saved: %v", err)
+	}
+
+	// An address saved after the upgrade with a path like the ones upgraded
+	// is kept as it is when the database is opened again
+	if _, err := sqlDB.Exec(insert, later.Bytes(), TypeSub, "m/2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAddrsDB(sqlDB, lock); err != nil {
+		t.Fatalf("open again failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash Uint168
+		path string
+	}{
+		{"master account", master, "account/0"},
+		{"sub account", sub, "account/1"},
+		{"HD address", hd, "m/44'/2305'/0'/0/1"},
+		{"saved after the upgrade", later, "m/2"},
+	}
+	for _, test := range tests {
+		addr, err := addrs.Get(&test.hash)
+		if err != nil {
+			t.Fatalf("%s: get failed: %v", test.name, err)
+		}
+		if addr.Path() != test.path {
+			t.Errorf("%s: path %q, want %q", test.name, addr.Path(), test.path)
+		}
+	}
+}
+
+func TestResetKeepsAddrsVersion(t *testing.T) {
+	db, err := newMemSQLiteDB(new(sync.RWMutex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Info().Put(ChainHeightKey, []byte{1, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reset(); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	// The Addrs table is kept with its version, the other info is cleared
+	if _, err := db.Info().Get(AddrsVersionKey); err != nil {
+		t.Errorf("version of the kept Addrs table cleared: %v", err)
+	}
+	if _, err := db.Info().Get(ChainHeightKey); err == nil {
+		t.Errorf("chain height not cleared")
+	}
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const CreateAppDataDB = `CREATE TABLE IF NOT EXISTS AppData(
+				Namespace TEXT NOT NULL,
+				Key TEXT NOT NULL,
+				Value BLOB NOT NULL,
+				PRIMARY KEY(Namespace, Key)
+			);`
+
+// AppDataDB keeps application data, like settings, sync cursors and feature flags,
+// in namespaces of the wallet database, so embedders do not need another database.
+// It is kept when the wallet database is reset, like the addresses and payees.
+type AppDataDB struct {
+	StoreLock
+	*sql.DB
+}
+
+func NewAppDataDB(db *sql.DB, lock StoreLock) (AppData, error) {
+	_, err := db.Exec(CreateAppDataDB)
+	if err != nil {
+		return nil, err
+	}
+	return &AppDataDB{StoreLock: lock, DB: db}, nil
+}
+
+// put a value into the namespace, replace the value of the same key
+func (db *AppDataDB) Put(namespace, key string, value []byte) (err error) {
+	if namespace == "" {
+		return errors.New("app data namespace is empty")
+	}
+
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec("INSERT OR REPLACE INTO AppData(Namespace, Key, Value) VALUES(?,?,?)", namespace, key, value)
+	return err
+}
+
+// get the value of the key in the namespace, sql.ErrNoRows if not found
+func (db *AppDataDB) Get(namespace, key string) ([]byte, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var value []byte
+	err := db.QueryRow("SELECT Value FROM AppData WHERE Namespace=? AND Key=?", namespace, key).Scan(&value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// get all the keys and values in the namespace
+func (db *AppDataDB) GetAll(namespace string) (map[string][]byte, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	rows, err := db.Query("SELECT Key, Value FROM AppData WHERE Namespace=?", namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// delete the key in the namespace
+func (db *AppDataDB) Delete(namespace, key string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec("DELETE FROM AppData WHERE Namespace=? AND Key=?", namespace, key)
+	return err
+}
+
+// delete all the keys in the namespace
+func (db *AppDataDB) DeleteNamespace(namespace string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec("DELETE FROM AppData WHERE Namespace=?", namespace)
+	return err
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const CreateAssetsDB = `CREATE TABLE IF NOT EXISTS Assets(
+				Id BLOB NOT NULL PRIMARY KEY,
+				Name TEXT NOT NULL,
+				Description TEXT NOT NULL DEFAULT '',
+				Precision INTEGER NOT NULL,
+				AssetType INTEGER NOT NULL,
+				Amount BLOB NOT NULL,
+				Controller BLOB NOT NULL,
+				Height INTEGER NOT NULL
+			);`
+
+// An asset registered by a register asset transaction
+type RegisteredAsset struct {
+	// The asset id, which is the hash of the register asset transaction
+	ID Uint256
+
+	Name        string
+	Description string
+	Precision   byte
+	AssetType   byte
+
+	// The total amount registered
+	Amount Fixed64
+
+	// The program hash of the asset controller
+	Controller Uint168
+
+	// Block height where the asset was registered
+	Height uint32
+}
+
+type AssetsDB struct {
+	StoreLock
+	*sql.DB
+}
+
+func NewAssetsDB(db *sql.DB, lock StoreLock) (Assets, error) {
+	_, err := db.Exec(CreateAssetsDB)
+	if err != nil {
+		return nil, err
+	}
+	return &AssetsDB{StoreLock: lock, DB: db}, nil
+}
+
+// put a registered asset to database
+func (db *AssetsDB) Put(asset *RegisteredAsset) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	amountBytes, err := asset.Amount.Bytes()
+	if err != nil {
+		return err
+	}
+
+	sql := `INSERT OR REPLACE INTO Assets(Id, Name, Description, Precision, AssetType, Amount, Controller, Height)
+			VALUES(?,?,?,?,?,?,?,?)`
+	_, err = db.Exec(sql, asset.ID.Bytes(), asset.Name, asset.Description, asset.Precision, asset.AssetType,
+		amountBytes, asset.Controller.Bytes(), asset.Height)
+	return err
+}
+
+// get a registered asset from database
+func (db *AssetsDB) Get(id *Uint256) (*RegisteredAsset, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	sql := `SELECT Id, Name, Description, Precision, AssetType, Amount, Controller, Height FROM Assets WHERE Id=?`
+	return scanAsset(db.QueryRow(sql, id.Bytes()))
+}
+
+// get all registered assets from database
+func (db *AssetsDB) GetAll() ([]*RegisteredAsset, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var assets []*RegisteredAsset
+	rows, err := db.Query(`SELECT Id, Name, Description, Precision, AssetType, Amount, Controller, Height
+			FROM Assets ORDER BY Height`)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return assets, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+func scanAsset(row interface {
+	Scan(dest ...interface{}) error
+}) (*RegisteredAsset, error) {
+	var idBytes []byte
+	var amountBytes []byte
+	var controllerBytes []byte
+	var asset RegisteredAsset
+	err := row.Scan(&idBytes, &asset.Name, &asset.Description, &asset.Precision, &asset.AssetType,
+		&amountBytes, &controllerBytes, &asset.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := Uint256FromBytes(idBytes)
+	if err != nil {
+		return nil, err
+	}
+	asset.ID = *id
+
+	amount, err := Fixed64FromBytes(amountBytes)
+	if err != nil {
+		return nil, err
+	}
+	asset.Amount = *amount
+
+	controller, err := Uint168FromBytes(controllerBytes)
+	if err != nil {
+		return nil, err
+	}
+	asset.Controller = *controller
+
+	return &asset, nil
+}
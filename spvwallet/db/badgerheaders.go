@@ -0,0 +1,301 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.Utility/common"
+
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	BadgerHeadersDir = "headers"
+
+	// Headers are small, keep them in the LSM tree instead of the value log,
+	// so only the overwritten chain tip produces garbage in value log
+	BadgerValueThreshold = 4 << 10
+	// Value log files are small, so GC can rewrite them quickly
+	BadgerValueLogFileSize = 64 << 20
+	// Run value log GC in this interval, and rewrite files with this ratio of garbage
+	BadgerGCInterval     = time.Minute * 10
+	BadgerGCDiscardRatio = 0.5
+)
+
+var (
+	badgerHeaderPrefix = []byte("h")
+	badgerChainTipKey  = []byte("ChainTip")
+)
+
+// BadgerHeadersDB implements Headers using badger DB, which has lower write
+// amplification than B+ tree stores on flash storage devices. Only the headers
+// are kept in badger, they take most of the writes during sync, the "badger"
+// driver keeps the wallet data in sqlite
+type BadgerHeadersDB struct {
+	*sync.RWMutex
+	db    *badger.DB
+	cache *HeaderCache
+	quit  chan struct{}
+
+	verifyOnRead bool
+}
+
+func NewBadgerHeadersDB() (Headers, error) {
+	db, err := openBadger()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := &BadgerHeadersDB{
+		RWMutex: new(sync.RWMutex),
+		db:      db,
+		cache:   newHeaderCache(100),
+		quit:    make(chan struct{}),
+	}
+
+	go headers.runValueLogGC()
+
+	return headers, nil
+}
+
+func openBadger() (*badger.DB, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = BadgerHeadersDir
+	opts.ValueDir = BadgerHeadersDir
+	opts.ValueThreshold = BadgerValueThreshold
+	opts.ValueLogFileSize = BadgerValueLogFileSize
+	// Headers can be synced again, so do not sync every write
+	opts.SyncWrites = false
+	return badger.Open(opts)
+}
+
+func (h *BadgerHeadersDB) runValueLogGC() {
+	ticker := time.NewTicker(BadgerGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.RLock()
+			// Run GC until no more files can be rewritten
+			for h.db.RunValueLogGC(BadgerGCDiscardRatio) == nil {
+			}
+			h.RUnlock()
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// Add a new header to blockchain
+func (h *BadgerHeadersDB) Put(header *db.StoreHeader, newTip bool) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.cache.Set(header)
+	if newTip {
+		h.cache.tip = header
+	}
+	return h.db.Update(func(txn *badger.Txn) error {
+
+		bytes, err := header.Serialize()
+		if err != nil {
+			return err
+		}
+
+		err = txn.Set(headerKey(header.Hash()), bytes)
+		if err != nil {
+			return err
+		}
+
+		if newTip {
+			err = txn.Set(badgerChainTipKey, bytes)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Get previous block of the given header
+func (h *BadgerHeadersDB) GetPrevious(header *db.StoreHeader) (*db.StoreHeader, error) {
+	if header.Height == 1 {
+		return &db.StoreHeader{TotalWork: new(big.Int)}, nil
+	}
+	return h.GetHeader(header.Previous)
+}
+
+// Get full header with it's hash
+func (h *BadgerHeadersDB) GetHeader(hash common.Uint256) (header *db.StoreHeader, err error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	header, err = h.cache.Get(hash)
+	if err == nil {
+		return header, nil
+	}
+
+	err = h.db.View(func(txn *badger.Txn) error {
+		header, err = getBadgerHeader(txn, headerKey(hash))
+		if _, ok := err.(*headerDecodeError); ok {
+			return &db.ErrCorruptedRecord{Hash: hash}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return header, verifyHeader(hash, header, h.verifyOnRead)
+}
+
+// Get the header on chain tip
+func (h *BadgerHeadersDB) GetTip() (header *db.StoreHeader, err error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	if h.cache.tip != nil {
+		return h.cache.tip, nil
+	}
+
+	err = h.db.View(func(txn *badger.Txn) error {
+		header, err = getBadgerHeader(txn, badgerChainTipKey)
+		return err
+	})
+
+	if err != nil {
+		log.Error("Headers db get tip err,", err)
+		return nil, err
+	}
+
+	return header, err
+}
+
+// Get the hash of the ancestor of the given header on the given height
+func (h *BadgerHeadersDB) GetAncestor(header *db.StoreHeader, height uint32) (*common.Uint256, error) {
+	if header.Height < height {
+		return nil, errors.New("ancestor height is higher than the header")
+	}
+
+	var err error
+	for header.Height > height {
+		header, err = h.GetHeader(header.Previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hash := header.Hash()
+	return &hash, nil
+}
+
+// Create a block locator from the chain tip
+func (h *BadgerHeadersDB) GetBlockLocatorHashes() []*common.Uint256 {
+	var ret []*common.Uint256
+	header, err := h.GetTip()
+	if err != nil { // No headers stored return empty locator
+		return ret
+	}
+
+	step := uint32(1)
+	start := 0
+	for {
+		if start >= 9 {
+			step *= 2
+			start = 0
+		}
+		hash := header.Hash()
+		ret = append(ret, &hash)
+		if len(ret) >= MaxBlockLocatorHashes || header.Height <= step {
+			break
+		}
+		ancestor, err := h.GetAncestor(header, header.Height-step)
+		if err != nil {
+			break
+		}
+		header, err = h.GetHeader(*ancestor)
+		if err != nil {
+			break
+		}
+		start += 1
+	}
+
+	return ret
+}
+
+func (h *BadgerHeadersDB) SetVerifyOnRead(verify bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.verifyOnRead = verify
+}
+
+// Reset database, clear all data
+func (h *BadgerHeadersDB) Reset() error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.cache = newHeaderCache(100)
+
+	// Remove the database files and reopen it, which is faster
+	// than deleting all the keys in transactions
+	err := h.db.Close()
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(BadgerHeadersDir)
+	if err != nil {
+		return err
+	}
+	h.db, err = openBadger()
+	return err
+}
+
+// Close db
+func (h *BadgerHeadersDB) Close() {
+	h.Lock()
+	close(h.quit)
+	h.db.Close()
+	log.Debug("Headers DB closed")
+}
+
+func headerKey(hash common.Uint256) []byte {
+	key := make([]byte, 0, len(badgerHeaderPrefix)+common.UINT256SIZE)
+	key = append(key, badgerHeaderPrefix...)
+	return append(key, hash.Bytes()...)
+}
+
+func getBadgerHeader(txn *badger.Txn, key []byte) (*db.StoreHeader, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, errors.New(fmt.Sprintf("Header %x does not exist in database", key))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var header db.StoreHeader
+	err = header.Deserialize(headerBytes)
+	if err != nil {
+		return nil, &headerDecodeError{err}
+	}
+
+	return &header, nil
+}
+
+// headerDecodeError is returned when a stored header can not be decoded
+type headerDecodeError struct {
+	error
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"github.com/elastos/Elastos.ELA.SPV/db"
 
 	. "github.com/elastos/Elastos.ELA/core"
@@ -13,8 +15,19 @@ type DataStore interface {
 	Txs() Txs
 	UTXOs() UTXOs
 	STXOs() STXOs
+	Assets() Assets
+	Payees() Payees
+	Misbehaviors() Misbehaviors
+	AppData() AppData
 
 	Rollback(height uint32) error
+	// Expire unconfirmed transactions received before the given time,
+	// move the spent UTXOs back and return the expired transaction ids
+	ExpireTxs(before time.Time) ([]Uint256, error)
+	// Get the addresses and transactions added or updated since the given position
+	GetDelta(since DeltaSeq) (*StoreDelta, error)
+	// Delete all UTXOs, STXOs and registered assets, to rebuild them from transactions
+	ClearOutputs() error
 	// Reset database, clear all data
 	Reset() error
 
@@ -39,8 +52,8 @@ type Info interface {
 }
 
 type Addrs interface {
-	// put a address to database
-	Put(hash *Uint168, script []byte, addrType int) error
+	// put a address and the derivation path of it to database
+	Put(hash *Uint168, script []byte, addrType int, path string) error
 
 	// get a address from database
 	Get(hash *Uint168) (*Addr, error)
@@ -48,6 +61,12 @@ type Addrs interface {
 	// get all addresss from database
 	GetAll() ([]*Addr, error)
 
+	// mark a address archived or active, archived addresses are not added to the filter
+	SetArchived(hash *Uint168, archived bool) error
+
+	// set the path of a address saved without one
+	SetPath(hash *Uint168, path string) error
+
 	// delete a address from database
 	Delete(hash *Uint168) error
 }
@@ -65,6 +84,9 @@ type Txs interface {
 	// Fetch all transactions from the given height
 	GetAllFrom(height uint32) ([]*db.StoreTx, error)
 
+	// Iterate confirmed transactions from the given height on a snapshot of database
+	Iterate(height uint32) (*TxIterator, error)
+
 	// Update the height of a transaction
 	UpdateHeight(txId *Uint256, height uint32) error
 
@@ -105,3 +127,59 @@ type STXOs interface {
 	// delete a stxo from database
 	Delete(outPoint *OutPoint) error
 }
+
+type Assets interface {
+	// put a registered asset to database
+	Put(asset *RegisteredAsset) error
+
+	// get a registered asset from database
+	Get(id *Uint256) (*RegisteredAsset, error)
+
+	// get all registered assets from database
+	GetAll() ([]*RegisteredAsset, error)
+}
+
+type Payees interface {
+	// put a payee to database, replace the payee with the same name
+	Put(payee *Payee) error
+
+	// get a payee by name from database
+	Get(name string) (*Payee, error)
+
+	// get all payees from database, the most recently used first
+	GetAll() ([]*Payee, error)
+
+	// search payees by name or memo containing the query, case insensitive
+	Search(query string) ([]*Payee, error)
+
+	// update the last used time of a payee
+	Touch(name string, lastUsed time.Time) error
+
+	// delete a payee from database
+	Delete(name string) error
+}
+
+type AppData interface {
+	// put a value into the namespace, replace the value of the same key
+	Put(namespace, key string, value []byte) error
+
+	// get the value of the key in the namespace
+	Get(namespace, key string) ([]byte, error)
+
+	// get all the keys and values in the namespace
+	GetAll(namespace string) (map[string][]byte, error)
+
+	// delete the key in the namespace
+	Delete(namespace, key string) error
+
+	// delete all the keys in the namespace
+	DeleteNamespace(namespace string) error
+}
+
+type Misbehaviors interface {
+	// Put a ban score event of a peer, records out of retention are deleted
+	Put(record *db.MisbehaviorRecord) error
+
+	// Fetch the records since the given time, of all peers if addr is empty
+	GetAll(since time.Time, addr string) ([]*db.MisbehaviorRecord, error)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// DeltaSeq is the position of a store delta, the last row ids of the
+// addresses, transactions and payees included in it
+type DeltaSeq struct {
+	Addrs  int64
+	Txs    int64
+	Payees int64
+}
+
+type DeltaAddr struct {
+	Hash     Uint168
+	Script   []byte
+	Type     int
+	Path     string
+	Archived bool
+}
+
+type DeltaTx struct {
+	TxId   Uint256
+	Height uint32
+}
+
+// DeltaPayee is an address book entry, the label of a payee address
+type DeltaPayee struct {
+	Name    string
+	Address Uint168
+	Memo    string
+}
+
+// StoreDelta is the addresses, transactions and payees changed since a DeltaSeq,
+// devices sharing a wallet exchange them to converge their state. Application
+// data and deletions stay on the device.
+type StoreDelta struct {
+	Seq    DeltaSeq
+	Addrs  []DeltaAddr
+	Txs    []DeltaTx
+	Payees []DeltaPayee
+}
+
+// Get the addresses, transactions and payees added or updated since the given position
+func (db *SQLiteDB) GetDelta(since DeltaSeq) (*StoreDelta, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	delta := &StoreDelta{Seq: since}
+	rows, err := db.Query(`SELECT rowid, Hash, Script, Type, Path, Archived FROM Addrs
+			WHERE rowid>? ORDER BY rowid`, since.Addrs)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hashBytes []byte
+		var addr DeltaAddr
+		err = rows.Scan(&delta.Seq.Addrs, &hashBytes, &addr.Script, &addr.Type, &addr.Path, &addr.Archived)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hash, err := Uint168FromBytes(hashBytes)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		addr.Hash = *hash
+		delta.Addrs = append(delta.Addrs, addr)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT rowid, Hash, Height FROM TXNs
+			WHERE rowid>? ORDER BY rowid`, since.Txs)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hashBytes []byte
+		var tx DeltaTx
+		err = rows.Scan(&delta.Seq.Txs, &hashBytes, &tx.Height)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		txId, err := Uint256FromBytes(hashBytes)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tx.TxId = *txId
+		delta.Txs = append(delta.Txs, tx)
+	}
+	rows.Close()
+
+	// Payees are replaced when updated, so an updated payee has a new row id
+	rows, err = db.Query(`SELECT rowid, Name, Address, Memo FROM Payees
+			WHERE rowid>? ORDER BY rowid`, since.Payees)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var addressBytes []byte
+		var payee DeltaPayee
+		err = rows.Scan(&delta.Seq.Payees, &payee.Name, &addressBytes, &payee.Memo)
+		if err != nil {
+			return nil, err
+		}
+		address, err := Uint168FromBytes(addressBytes)
+		if err != nil {
+			return nil, err
+		}
+		payee.Address = *address
+		delta.Payees = append(delta.Payees, payee)
+	}
+
+	return delta, rows.Err()
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+func TestGetDelta(t *testing.T) {
+	store, err := NewMemSQLiteDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	first, second := &Uint168{1}, &Uint168{2}
+	steps := []struct {
+		name   string
+		change func() error
+		addrs  []Uint168
+		payees []string
+	}{
+		{"addresses added", func() error {
+			if err := store.Addrs().Put(first, nil, TypeMaster, "account/0"); err != nil {
+				return err
+			}
+			return store.Addrs().Put(second, nil, TypeSub, "account/1")
+		}, []Uint168{*first, *second}, nil},
+		{"nothing changed", func() error { return nil }, nil, nil},
+		{"address archived", func() error {
+			return store.Addrs().SetArchived(first, true)
+		}, []Uint168{*first}, nil},
+		{"payee added", func() error {
+			return store.Payees().Put(&Payee{Name: "alice", Address: *second, Memo: "rent"})
+		}, nil, []string{"alice"}},
+		{"payee updated", func() error {
+			return store.Payees().Put(&Payee{Name: "alice", Address: *second, Memo: "food"})
+		}, nil, []string{"alice"}},
+	}
+
+	var since DeltaSeq
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: change failed: %v", step.name, err)
+		}
+		delta, err := store.GetDelta(since)
+		if err != nil {
+			t.Fatalf("%s: get delta failed: %v", step.name, err)
+		}
+		since = delta.Seq
+
+		if len(delta.Addrs) != len(step.addrs) {
+			t.Fatalf("%s: %d addresses in delta, want %d", step.name, len(delta.Addrs), len(step.addrs))
+		}
+		for i, hash := range step.addrs {
+			if delta.Addrs[i].Hash != hash {
+				t.Errorf("%s: address %d is %x, want %x", step.name, i, delta.Addrs[i].Hash, hash)
+			}
+		}
+		if len(delta.Payees) != len(step.payees) {
+			t.Fatalf("%s: %d payees in delta, want %d", step.name, len(delta.Payees), len(step.payees))
+		}
+		for i, name := range step.payees {
+			if delta.Payees[i].Name != name {
+				t.Errorf("%s: payee %d is %s, want %s", step.name, i, delta.Payees[i].Name, name)
+			}
+		}
+	}
+
+	delta, err := store.GetDelta(DeltaSeq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range delta.Addrs {
+		if addr.Archived != (addr.Hash == *first) {
+			t.Errorf("address %x archived %v in full delta", addr.Hash, addr.Archived)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !purego
+// +build !purego
+
+package db
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The default sqlite driver, requires cgo to build
+const DriverName = "sqlite3"
@@ -0,0 +1,12 @@
+//go:build purego
+// +build purego
+
+package db
+
+import (
+	_ "modernc.org/sqlite"
+)
+
+// The pure Go sqlite driver, build with `-tags purego` to use it
+// on platforms without a C toolchain
+const DriverName = "sqlite"
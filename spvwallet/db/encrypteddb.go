@@ -0,0 +1,614 @@
+package db
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	EncryptedDBName = "./spv_wallet.db.enc"
+
+	// The lock file of the encrypted database, processes sharing the wallet
+	// take it while writing the encrypted file
+	EncryptedLockName = EncryptedDBName + ".lock"
+
+	// Parameters of the scrypt key derivation
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	scryptSalt   = 16
+
+	// How long a write waits for the lock file held by another process
+	// before it is refused
+	LockTimeout = 30 * time.Second
+)
+
+var encryptedMagic = []byte("SPVENC1")
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted encrypted database")
+
+var ErrLockTimeout = errors.New("encrypted database is locked by another process, timed out waiting for it")
+
+/*
+EncryptedSQLiteDB keeps the wallet data encrypted at rest. The database is loaded
+into memory on open, and written to EncryptedDBName encrypted by AES-GCM with a key
+derived from the passphrase by scrypt, so addresses and transaction history never
+touch the disk in plaintext. A plaintext wallet database found on the first open is
+imported and removed. Headers are public chain data and stay in the headers store.
+
+Processes sharing the wallet, like the SPV service and the CLI, each keep a copy in
+memory. A write takes the lock file, loads the encrypted file if another process
+changed it, and writes the changes back before releasing the lock, so no process
+overwrites the writes of another. A write is refused if the lock file is not taken
+within LockTimeout or the changes of another process fail to load, and returns the
+error of writing the encrypted file. A read loads the encrypted file first if another
+process changed it.
+
+Every write rewrites the whole file, so the writes of a block are batched by
+BeginBatch() and EndBatch(), the lock file is held and the file is written once
+for the block. The file is synced to disk before it replaces the previous one.
+*/
+type EncryptedSQLiteDB struct {
+	*SQLiteDB
+	salt []byte
+	key  []byte
+
+	lock     *encryptedLock
+	fileLock *fileLock
+
+	// The hash of the data in the encrypted file, unchanged data is not written again
+	written [sha256.Size]byte
+
+	// The state of the encrypted file when last read or written by this process
+	fileInfoLock sync.Mutex
+	fileInfo     os.FileInfo
+}
+
+// encryptedLock is the StoreLock of the encrypted database, it syncs the data in
+// memory with the encrypted file shared with other processes
+type encryptedLock struct {
+	sync.RWMutex
+	db *EncryptedSQLiteDB
+	// The lock file is held by this process
+	locked bool
+	// The lock file is held until the open batches end
+	batches int
+}
+
+// Take the lock file and load the changes of other processes, the write lock
+// must be held. A write is refused if the lock file is not taken in time or the
+// changes of other processes fail to load, writing the data in memory would
+// overwrite them.
+func (l *encryptedLock) acquire() error {
+	if l.locked {
+		return nil
+	}
+	if err := l.db.fileLock.lock(LockTimeout); err != nil {
+		return err
+	}
+	if err := l.db.reload(); err != nil {
+		l.db.fileLock.unlock()
+		return err
+	}
+	l.locked = true
+	return nil
+}
+
+// Take the write lock and the lock file, the write lock is not held if an
+// error is returned
+func (l *encryptedLock) LockWrite() error {
+	l.RWMutex.Lock()
+	if err := l.acquire(); err != nil {
+		l.RWMutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Write the changes to the encrypted file and release the lock file, the
+// changes of a batch are written when the batch ends and EndBatch() returns
+// the error of writing them
+func (l *encryptedLock) UnlockWrite() error {
+	var err error
+	if l.locked && l.batches == 0 {
+		err = l.release()
+	}
+	l.RWMutex.Unlock()
+	return err
+}
+
+// Lock and Unlock are LockWrite and UnlockWrite for the callers which can not
+// return an error, the errors are logged
+func (l *encryptedLock) Lock() {
+	l.RWMutex.Lock()
+	if err := l.acquire(); err != nil {
+		log.Error("Encrypted db lock err,", err)
+	}
+}
+
+func (l *encryptedLock) Unlock() {
+	if err := l.UnlockWrite(); err != nil {
+		log.Error("Encrypted db flush err,", err)
+	}
+}
+
+// Write the changes to the encrypted file and release the lock file, the
+// write lock must be held
+func (l *encryptedLock) release() error {
+	err := l.db.flush()
+	if unlockErr := l.db.fileLock.unlock(); err == nil {
+		err = unlockErr
+	}
+	l.locked = false
+	return err
+}
+
+// Load the changes of other processes before reading
+func (l *encryptedLock) RLock() {
+	if l.db.fileChanged() {
+		l.Lock()
+		l.Unlock()
+	}
+	l.RWMutex.RLock()
+}
+
+// The rows of a table, values are the types returned by the sqlite driver
+type tableDump struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func NewEncryptedSQLiteDB(passphrase []byte) (*EncryptedSQLiteDB, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty database passphrase")
+	}
+
+	fileLock, err := newFileLock(EncryptedLockName)
+	if err != nil {
+		return nil, err
+	}
+	db := &EncryptedSQLiteDB{fileLock: fileLock}
+	db.lock = &encryptedLock{db: db}
+	db.SQLiteDB, err = newMemSQLiteDB(db.lock)
+	if err != nil {
+		fileLock.close()
+		return nil, err
+	}
+
+	// Another process may be creating the encrypted file
+	err = fileLock.lock(LockTimeout)
+	if err == nil {
+		var data []byte
+		data, err = ioutil.ReadFile(EncryptedDBName)
+		switch {
+		case err == nil:
+			err = db.open(data, passphrase)
+		case os.IsNotExist(err):
+			err = db.create(passphrase)
+		}
+		fileLock.unlock()
+	}
+	if err != nil {
+		db.DB.Close()
+		fileLock.close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Decrypt the encrypted file and load the tables into memory
+func (db *EncryptedSQLiteDB) open(data, passphrase []byte) error {
+	salt, sealed, err := parseEncrypted(data)
+	if err != nil {
+		return err
+	}
+	db.salt = salt
+	db.key, err = scrypt.Key(passphrase, db.salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return err
+	}
+
+	plain, err := db.decrypt(sealed)
+	if err != nil {
+		return err
+	}
+	var tables []tableDump
+	err = gob.NewDecoder(bytes.NewReader(plain)).Decode(&tables)
+	if err != nil {
+		return err
+	}
+	db.written = sha256.Sum256(plain)
+	db.setFileInfo()
+
+	return db.load(tables, false)
+}
+
+// Split the encrypted file into the salt and the sealed data
+func parseEncrypted(data []byte) (salt, sealed []byte, err error) {
+	if !bytes.HasPrefix(data, encryptedMagic) || len(data) < len(encryptedMagic)+scryptSalt {
+		return nil, nil, errors.New("unknown encrypted database format")
+	}
+	data = data[len(encryptedMagic):]
+	return data[:scryptSalt], data[scryptSalt:], nil
+}
+
+// Load the encrypted file if another process changed it since this process
+// read or wrote it, the write lock and the lock file must be held
+func (db *EncryptedSQLiteDB) reload() error {
+	if !db.fileChanged() {
+		return nil
+	}
+	data, err := ioutil.ReadFile(EncryptedDBName)
+	if err != nil {
+		return err
+	}
+	salt, sealed, err := parseEncrypted(data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(salt, db.salt) {
+		return errors.New("encrypted database was recreated by another process, open it again")
+	}
+	plain, err := db.decrypt(sealed)
+	if err != nil {
+		return err
+	}
+	if hash := sha256.Sum256(plain); hash != db.written {
+		var tables []tableDump
+		err = gob.NewDecoder(bytes.NewReader(plain)).Decode(&tables)
+		if err != nil {
+			return err
+		}
+		err = db.load(tables, true)
+		if err != nil {
+			return err
+		}
+		db.written = hash
+	}
+	db.setFileInfo()
+	return nil
+}
+
+// Check if the encrypted file is not the one this process read or wrote last,
+// it is replaced by a rename on every write
+func (db *EncryptedSQLiteDB) fileChanged() bool {
+	info, err := os.Stat(EncryptedDBName)
+	if err != nil {
+		return false
+	}
+	db.fileInfoLock.Lock()
+	defer db.fileInfoLock.Unlock()
+
+	last := db.fileInfo
+	return last == nil || !os.SameFile(last, info) || last.Size() != info.Size() ||
+		!last.ModTime().Equal(info.ModTime())
+}
+
+func (db *EncryptedSQLiteDB) setFileInfo() {
+	info, err := os.Stat(EncryptedDBName)
+	if err != nil {
+		return
+	}
+	db.fileInfoLock.Lock()
+	db.fileInfo = info
+	db.fileInfoLock.Unlock()
+}
+
+// Derive a key with a new salt, import the plaintext database if any, and
+// write the encrypted file before removing the plaintext one
+func (db *EncryptedSQLiteDB) create(passphrase []byte) error {
+	db.salt = make([]byte, scryptSalt)
+	_, err := io.ReadFull(rand.Reader, db.salt)
+	if err != nil {
+		return err
+	}
+	db.key, err = scrypt.Key(passphrase, db.salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(DBName)
+	if os.IsNotExist(err) {
+		return db.flush()
+	}
+
+	log.Info("Encrypt the plaintext wallet database", DBName)
+	plainDB, err := NewSQLiteDB()
+	if err != nil {
+		return err
+	}
+	tables, err := dumpTables(plainDB.DB)
+	plainDB.Close()
+	if err != nil {
+		return err
+	}
+	err = db.load(tables, false)
+	if err != nil {
+		return err
+	}
+	err = db.flush()
+	if err != nil {
+		return err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err = os.Remove(DBName + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert the dumped rows into the tables in memory, which are created with
+// the current schema before loading, clear deletes the rows in memory first
+func (db *EncryptedSQLiteDB) load(tables []tableDump, clear bool) error {
+	var names []string
+	if clear {
+		var err error
+		if names, err = tableNames(db.DB); err != nil {
+			return err
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err = tx.Exec("DELETE FROM " + name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, table := range tables {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(table.Columns)), ",")
+		stmt, err := tx.Prepare("INSERT OR REPLACE INTO " + table.Name + "(" +
+			strings.Join(table.Columns, ",") + ") VALUES(" + placeholders + ")")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, row := range table.Rows {
+			_, err = stmt.Exec(row...)
+			if err != nil {
+				stmt.Close()
+				tx.Rollback()
+				return err
+			}
+		}
+		stmt.Close()
+	}
+	return tx.Commit()
+}
+
+// Get the names of the wallet tables
+func tableNames(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Read all rows of the wallet tables
+func dumpTables(db *sql.DB) ([]tableDump, error) {
+	names, err := tableNames(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]tableDump, 0, len(names))
+	for _, name := range names {
+		table, err := dumpTable(db, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, *table)
+	}
+	return tables, nil
+}
+
+func dumpTable(db *sql.DB, name string) (*tableDump, error) {
+	rows, err := db.Query("SELECT * FROM " + name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	table := &tableDump{Name: name, Columns: columns}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		values := make([]interface{}, len(columns))
+		for i := range row {
+			values[i] = &row[i]
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, rows.Err()
+}
+
+// Write the tables to the encrypted file if changed, the file is replaced
+// by a rename, so a crash leaves the previous version. The write lock and
+// the lock file must be held.
+func (db *EncryptedSQLiteDB) flush() error {
+	tables, err := dumpTables(db.DB)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	err = gob.NewEncoder(buf).Encode(tables)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(buf.Bytes())
+	if hash == db.written {
+		return nil
+	}
+
+	sealed, err := db.encrypt(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, len(encryptedMagic)+len(db.salt)+len(sealed))
+	data = append(data, encryptedMagic...)
+	data = append(data, db.salt...)
+	data = append(data, sealed...)
+
+	err = writeFileSync(EncryptedDBName, data)
+	if err != nil {
+		return err
+	}
+	db.written = hash
+	db.setFileInfo()
+	return nil
+}
+
+// Replace the file with the data by a rename, the new file and the rename
+// are synced to disk, so a crash leaves either the previous or the new file
+func writeFileSync(name string, data []byte) error {
+	tmpName := name + ".tmp"
+	file, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	err = os.Rename(tmpName, name)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// Seal the data with a random nonce, which is put before the cipher text
+func (db *EncryptedSQLiteDB) encrypt(plain []byte) ([]byte, error) {
+	aead, err := db.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, encryptedMagic), nil
+}
+
+func (db *EncryptedSQLiteDB) decrypt(sealed []byte) ([]byte, error) {
+	aead, err := db.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], encryptedMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+func (db *EncryptedSQLiteDB) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(db.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Start a batch, the writes until EndBatch() are written to the encrypted file
+// at once. The lock file is held by the batch, other processes wait until it ends.
+func (db *EncryptedSQLiteDB) BeginBatch() error {
+	db.lock.RWMutex.Lock()
+	defer db.lock.RWMutex.Unlock()
+
+	if err := db.lock.acquire(); err != nil {
+		return err
+	}
+	db.lock.batches++
+	return nil
+}
+
+// End the batch, the writes are written to the encrypted file when the
+// last open batch ends
+func (db *EncryptedSQLiteDB) EndBatch() error {
+	db.lock.RWMutex.Lock()
+	defer db.lock.RWMutex.Unlock()
+
+	if db.lock.batches == 0 {
+		return errors.New("no batch to end")
+	}
+	db.lock.batches--
+	if db.lock.batches > 0 || !db.lock.locked {
+		return nil
+	}
+	return db.lock.release()
+}
+
+// Reset the wallet data under the write lock, so the encrypted file is written
+func (db *EncryptedSQLiteDB) Reset() (err error) {
+	if err := db.lock.LockWrite(); err != nil {
+		return err
+	}
+	defer unlockWrite(db.lock, &err)
+
+	return db.SQLiteDB.Reset()
+}
+
+// Close the database, every write is already in the encrypted file
+func (db *EncryptedSQLiteDB) Close() {
+	db.lock.RWMutex.Lock()
+	db.DB.Close()
+	db.fileLock.close()
+	log.Debug("Encrypted DB closed")
+}
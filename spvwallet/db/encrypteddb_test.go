@@ -0,0 +1,188 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEncryptedDBSharedWrites(t *testing.T) {
+	passphrase := []byte("passphrase")
+
+	inTempDir(t, func() {
+		// Two processes open the same wallet, like the service and the CLI
+		first, err := NewEncryptedSQLiteDB(passphrase)
+		if err != nil {
+			t.Fatalf("open first failed: %v", err)
+		}
+		second, err := NewEncryptedSQLiteDB(passphrase)
+		if err != nil {
+			t.Fatalf("open second failed: %v", err)
+		}
+
+		writes := []struct {
+			name   string
+			writer *EncryptedSQLiteDB
+			reader *EncryptedSQLiteDB
+			key    string
+			value  string
+		}{
+			{"first to second", first, second, "a", "1"},
+			{"second to first", second, first, "b", "2"},
+			{"overwrite", first, second, "b", "3"},
+		}
+		for _, write := range writes {
+			if err := write.writer.Info().Put(write.key, []byte(write.value)); err != nil {
+				t.Fatalf("%s: put failed: %v", write.name, err)
+			}
+			value, err := write.reader.Info().Get(write.key)
+			if err != nil {
+				t.Fatalf("%s: get failed: %v", write.name, err)
+			}
+			if !bytes.Equal(value, []byte(write.value)) {
+				t.Errorf("%s: got %q, want %q", write.name, value, write.value)
+			}
+		}
+
+		// Writes of one process are not lost by the writes of the other
+		if value, err := second.Info().Get("a"); err != nil || string(value) != "1" {
+			t.Errorf("write of first lost, got %q, %v", value, err)
+		}
+
+		// Every write is in the file without closing the databases
+		third, err := NewEncryptedSQLiteDB(passphrase)
+		if err != nil {
+			t.Fatalf("open third failed: %v", err)
+		}
+		for key, want := range map[string]string{"a": "1", "b": "3"} {
+			value, err := third.Info().Get(key)
+			if err != nil || string(value) != want {
+				t.Errorf("reopened %s: got %q, %v, want %q", key, value, err, want)
+			}
+		}
+		third.Close()
+		second.Close()
+		first.Close()
+
+		if _, err := NewEncryptedSQLiteDB([]byte("wrong")); err == nil {
+			t.Error("open with a wrong passphrase succeeded")
+		}
+	})
+}
+
+func TestEncryptedDBBatch(t *testing.T) {
+	passphrase := []byte("passphrase")
+
+	inTempDir(t, func() {
+		db, err := NewEncryptedSQLiteDB(passphrase)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		before, err := os.Stat(EncryptedDBName)
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+
+		if err := db.BeginBatch(); err != nil {
+			t.Fatalf("begin batch failed: %v", err)
+		}
+		for _, key := range []string{"a", "b"} {
+			if err := db.Info().Put(key, []byte(key)); err != nil {
+				t.Fatalf("put %s failed: %v", key, err)
+			}
+		}
+		db.Info().SaveChainHeight(100)
+		// The writes of the batch are not written one by one
+		if info, err := os.Stat(EncryptedDBName); err != nil || !os.SameFile(before, info) {
+			t.Errorf("encrypted file written during the batch, %v", err)
+		}
+		if err := db.EndBatch(); err != nil {
+			t.Fatalf("end batch failed: %v", err)
+		}
+		if err := db.EndBatch(); err == nil {
+			t.Error("ended a batch not begun")
+		}
+
+		reopened, err := NewEncryptedSQLiteDB(passphrase)
+		if err != nil {
+			t.Fatalf("reopen failed: %v", err)
+		}
+		for _, key := range []string{"a", "b"} {
+			if value, err := reopened.Info().Get(key); err != nil || string(value) != key {
+				t.Errorf("reopened %s: got %q, %v", key, value, err)
+			}
+		}
+		if height := reopened.Info().ChainHeight(); height != 100 {
+			t.Errorf("reopened chain height %d, want 100", height)
+		}
+		reopened.Close()
+		db.Close()
+	})
+}
+
+func TestEncryptedDBRefusedWrites(t *testing.T) {
+	inTempDir(t, func() {
+		db, err := NewEncryptedSQLiteDB([]byte("passphrase"))
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		defer db.Close()
+		data, err := ioutil.ReadFile(EncryptedDBName)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+
+		// The changes of another process fail to load, the write is refused
+		// instead of overwriting them
+		if err := ioutil.WriteFile(EncryptedDBName, []byte("changed"), 0600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if err := db.Info().Put("a", []byte("1")); err == nil {
+			t.Error("write over changes not loaded succeeded")
+		}
+		if err := db.BeginBatch(); err == nil {
+			t.Error("batch over changes not loaded begun")
+		}
+		if written, _ := ioutil.ReadFile(EncryptedDBName); string(written) != "changed" {
+			t.Error("changes of another process overwritten")
+		}
+
+		if err := ioutil.WriteFile(EncryptedDBName, data, 0600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if err := db.Info().Put("a", []byte("1")); err != nil {
+			t.Errorf("write after the file is restored failed: %v", err)
+		}
+	})
+}
+
+func TestFileLockTimeout(t *testing.T) {
+	inTempDir(t, func() {
+		holder, err := newFileLock(EncryptedLockName)
+		if err != nil {
+			t.Fatalf("new lock failed: %v", err)
+		}
+		defer holder.close()
+		waiter, err := newFileLock(EncryptedLockName)
+		if err != nil {
+			t.Fatalf("new lock failed: %v", err)
+		}
+		defer waiter.close()
+
+		if err := holder.lock(time.Second); err != nil {
+			t.Fatalf("lock failed: %v", err)
+		}
+		if err := waiter.lock(50 * time.Millisecond); err != ErrLockTimeout {
+			t.Errorf("lock held by another got %v, want %v", err, ErrLockTimeout)
+		}
+		if err := holder.unlock(); err != nil {
+			t.Fatalf("unlock failed: %v", err)
+		}
+		if err := waiter.lock(time.Second); err != nil {
+			t.Errorf("lock released by another failed: %v", err)
+		}
+		waiter.unlock()
+	})
+}
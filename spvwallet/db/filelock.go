@@ -0,0 +1,19 @@
+package db
+
+// Take the lock shared with other processes by the lock file at the path, it
+// waits until no other process holds it, up to LockTimeout. Call the returned
+// function to release it.
+func LockFile(path string) (func() error, error) {
+	l, err := newFileLock(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.lock(LockTimeout); err != nil {
+		l.close()
+		return nil, err
+	}
+	return func() error {
+		defer l.close()
+		return l.unlock()
+	}, nil
+}
@@ -0,0 +1,59 @@
+//go:build windows
+// +build windows
+
+package db
+
+import (
+	"os"
+	"time"
+)
+
+// A lock file older than this is left by a crashed process, the lock is
+// held only while writing the wallet data
+const staleLockAge = time.Minute
+
+// fileLock is a lock shared with other processes by a lock file, which
+// exists while the lock is held
+type fileLock struct {
+	path string
+}
+
+func newFileLock(path string) (*fileLock, error) {
+	return &fileLock{path: path}, nil
+}
+
+// Wait until no other process holds the lock and take it, ErrLockTimeout
+// is returned if it is not taken within the timeout
+func (l *fileLock) lock(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return file.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if info, err := os.Stat(l.path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(l.path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func (l *fileLock) unlock() error {
+	return os.Remove(l.path)
+}
+
+func (l *fileLock) close() error {
+	return nil
+}
+
+// Directories can not be synced on windows, the rename is synced by the file system
+func syncDir(path string) error {
+	return nil
+}
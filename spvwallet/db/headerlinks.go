@@ -0,0 +1,177 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.Utility/common"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	MaxBlockLocatorHashes = 100
+
+	// Full headers within this depth from the chain tip are never pruned,
+	// so new headers can be verified and reorganizes can be handled
+	PruneKeepRecent = 1000
+)
+
+var BKTHeaderLinks = []byte("HeaderLinks")
+
+// headerLink is the compact record stored for every header, it links a header
+// to it's previous header and a skip ancestor, so the chain can still be walked
+// and located after the full header has been pruned.
+type headerLink struct {
+	Height    uint32
+	Previous  common.Uint256
+	Skip      common.Uint256
+	TotalWork *big.Int
+}
+
+func newHeaderLink(header *db.StoreHeader) *headerLink {
+	return &headerLink{
+		Height:    header.Height,
+		Previous:  header.Previous,
+		TotalWork: header.TotalWork,
+	}
+}
+
+func (l *headerLink) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := common.WriteUint32(buf, l.Height)
+	if err != nil {
+		return nil, err
+	}
+	err = l.Previous.Serialize(buf)
+	if err != nil {
+		return nil, err
+	}
+	err = l.Skip.Serialize(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	biBytes := l.TotalWork.Bytes()
+	pad := make([]byte, 32-len(biBytes))
+	buf.Write(append(pad, biBytes...))
+	return buf.Bytes(), nil
+}
+
+func (l *headerLink) Deserialize(b []byte) error {
+	r := bytes.NewReader(b)
+	var err error
+	l.Height, err = common.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	err = l.Previous.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	err = l.Skip.Deserialize(r)
+	if err != nil {
+		return err
+	}
+
+	biBytes := make([]byte, 32)
+	_, err = r.Read(biBytes)
+	if err != nil {
+		return err
+	}
+	l.TotalWork = new(big.Int).SetBytes(biBytes)
+
+	return nil
+}
+
+// skipHeight returns the height the skip pointer of the given height points to,
+// which is the height with the lowest set bit cleared.
+func skipHeight(height uint32) uint32 {
+	return height & (height - 1)
+}
+
+// Get the link of the given hash, headers stored before links were introduced
+// do not have a link record, so build one from the full header.
+func getLink(tx *bolt.Tx, hash common.Uint256) (*headerLink, error) {
+	linkBytes := tx.Bucket(BKTHeaderLinks).Get(hash.Bytes())
+	if linkBytes == nil {
+		header, err := getHeader(tx, BKTHeaders, hash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		return newHeaderLink(header), nil
+	}
+
+	var link headerLink
+	err := link.Deserialize(linkBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Get the hash of the ancestor on the given height, by walking back
+// with skip pointers where possible and previous pointers otherwise.
+func getAncestor(tx *bolt.Tx, hash common.Uint256, height uint32) (*common.Uint256, error) {
+	var empty common.Uint256
+	for {
+		link, err := getLink(tx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if link.Height < height {
+			return nil, errors.New("ancestor height is higher than the header")
+		}
+		if link.Height == height {
+			return &hash, nil
+		}
+		if skip := skipHeight(link.Height); skip >= height && !link.Skip.IsEqual(empty) {
+			hash = link.Skip
+		} else {
+			hash = link.Previous
+		}
+	}
+}
+
+// Save the link record of the header, the skip pointer is found by
+// walking back from the previous header.
+func putLink(tx *bolt.Tx, header *db.StoreHeader) error {
+	link := newHeaderLink(header)
+	if skip := skipHeight(header.Height); skip > 0 {
+		ancestor, err := getAncestor(tx, header.Previous, skip)
+		if err == nil {
+			link.Skip = *ancestor
+		}
+	}
+
+	bytes, err := link.Serialize()
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(BKTHeaderLinks).Put(header.Hash().Bytes(), bytes)
+}
+
+// Delete the full header that fall out of the recent window of the new tip,
+// unless it's on a checkpoint height which is a multiple of the prune interval.
+func pruneHeader(tx *bolt.Tx, tip *db.StoreHeader, interval uint32) error {
+	if tip.Height <= PruneKeepRecent {
+		return nil
+	}
+
+	height := tip.Height - PruneKeepRecent
+	if height%interval == 0 {
+		return nil
+	}
+
+	hash, err := getAncestor(tx, tip.Hash(), height)
+	if err != nil {
+		// Nothing to prune if the chain can not be walked back
+		return nil
+	}
+
+	return tx.Bucket(BKTHeaders).Delete(hash.Bytes())
+}
@@ -28,6 +28,16 @@ type Headers interface {
 	// Get the header on chain tip
 	GetTip() (*db.StoreHeader, error)
 
+	// Get the hash of the ancestor of the given header on the given height
+	GetAncestor(header *db.StoreHeader, height uint32) (*common.Uint256, error)
+
+	// Create a block locator from the chain tip
+	GetBlockLocatorHashes() []*common.Uint256
+
+	// Verify the header hash matches the key when reading a header,
+	// a mismatch is returned as *db.ErrCorruptedRecord
+	SetVerifyOnRead(verify bool)
+
 	// Reset database, clear all data
 	Reset() error
 
@@ -40,6 +50,12 @@ type HeadersDB struct {
 	*sync.RWMutex
 	*bolt.DB
 	cache *HeaderCache
+
+	// Keep only every pruneInterval full headers out of the recent window,
+	// zero means do not prune headers
+	pruneInterval uint32
+
+	verifyOnRead bool
 }
 
 var (
@@ -49,6 +65,17 @@ var (
 )
 
 func NewHeadersDB() (Headers, error) {
+	return newHeadersDB(0)
+}
+
+// Create a headers db that keeps only every interval full headers and the
+// recent ones, older headers are kept as compact link records.
+// Headers stored before pruning was enabled will not be pruned.
+func NewPrunedHeadersDB(interval uint32) (Headers, error) {
+	return newHeadersDB(interval)
+}
+
+func newHeadersDB(pruneInterval uint32) (Headers, error) {
 	db, err := bolt.Open("headers.bin", 0644, &bolt.Options{InitialMmapSize: 5000000})
 	if err != nil {
 		return nil, err
@@ -63,13 +90,18 @@ func NewHeadersDB() (Headers, error) {
 		if err != nil {
 			return err
 		}
+		_, err = btx.CreateBucketIfNotExists(BKTHeaderLinks)
+		if err != nil {
+			return err
+		}
 		return nil
 	})
 
 	headers := &HeadersDB{
-		RWMutex: new(sync.RWMutex),
-		DB:      db,
-		cache:   newHeaderCache(100),
+		RWMutex:       new(sync.RWMutex),
+		DB:            db,
+		cache:         newHeaderCache(100),
+		pruneInterval: pruneInterval,
 	}
 
 	headers.initCache()
@@ -117,11 +149,20 @@ func (h *HeadersDB) Put(header *db.StoreHeader, newTip bool) error {
 			return err
 		}
 
+		err = putLink(tx, header)
+		if err != nil {
+			return err
+		}
+
 		if newTip {
 			err = tx.Bucket(BKTChainTip).Put(KEYChainTip, bytes)
 			if err != nil {
 				return err
 			}
+
+			if h.pruneInterval > 0 {
+				return pruneHeader(tx, header, h.pruneInterval)
+			}
 		}
 
 		return nil
@@ -160,7 +201,7 @@ func (h *HeadersDB) GetHeader(hash common.Uint256) (header *db.StoreHeader, err
 		return nil, err
 	}
 
-	return header, err
+	return header, verifyHeader(hash, header, h.verifyOnRead)
 }
 
 // Get the header on chain tip
@@ -190,17 +231,98 @@ func (h *HeadersDB) GetTip() (header *db.StoreHeader, err error) {
 	return header, err
 }
 
+// Get the hash of the ancestor of the given header on the given height
+func (h *HeadersDB) GetAncestor(header *db.StoreHeader, height uint32) (hash *common.Uint256, err error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	err = h.View(func(tx *bolt.Tx) error {
+		hash, err = getAncestor(tx, header.Hash(), height)
+		return err
+	})
+
+	return hash, err
+}
+
+// Create a block locator from the chain tip, the hashes are found by link
+// records, so it works with pruned headers
+func (h *HeadersDB) GetBlockLocatorHashes() []*common.Uint256 {
+	var ret []*common.Uint256
+	tip, err := h.GetTip()
+	if err != nil { // No headers stored return empty locator
+		return ret
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+
+	h.View(func(tx *bolt.Tx) error {
+		hash := tip.Hash()
+		height := tip.Height
+		step := uint32(1)
+		start := 0
+		for {
+			if start >= 9 {
+				step *= 2
+				start = 0
+			}
+			// A new variable for each hash, they must not share one address
+			locatorHash := hash
+			ret = append(ret, &locatorHash)
+			if len(ret) >= MaxBlockLocatorHashes || height <= step {
+				break
+			}
+			height -= step
+			ancestor, err := getAncestor(tx, hash, height)
+			if err != nil {
+				break
+			}
+			hash = *ancestor
+			start += 1
+		}
+		return nil
+	})
+
+	return ret
+}
+
+func (h *HeadersDB) SetVerifyOnRead(verify bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.verifyOnRead = verify
+}
+
 func (h *HeadersDB) Reset() error {
 	h.Lock()
 	defer h.Unlock()
 
+	h.cache = newHeaderCache(100)
 	return h.Update(func(tx *bolt.Tx) error {
 		err := tx.DeleteBucket(BKTHeaders)
 		if err != nil {
 			return err
 		}
+		err = tx.DeleteBucket(BKTChainTip)
+		if err != nil {
+			return err
+		}
+		err = tx.DeleteBucket(BKTHeaderLinks)
+		if err != nil {
+			return err
+		}
 
-		return tx.DeleteBucket(BKTChainTip)
+		// Recreate buckets so the headers db can be used after reset
+		_, err = tx.CreateBucket(BKTHeaders)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(BKTChainTip)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(BKTHeaderLinks)
+		return err
 	})
 }
 
@@ -220,12 +342,24 @@ func getHeader(tx *bolt.Tx, bucket []byte, key []byte) (*db.StoreHeader, error)
 	var header db.StoreHeader
 	err := header.Deserialize(headerBytes)
 	if err != nil {
+		// A header record that can not be decoded is corrupted
+		if hash, e := common.Uint256FromBytes(key); e == nil {
+			return nil, &db.ErrCorruptedRecord{Hash: *hash}
+		}
 		return nil, err
 	}
 
 	return &header, nil
 }
 
+// Verify the header read from database matches the hash it is stored with
+func verifyHeader(hash common.Uint256, header *db.StoreHeader, verify bool) error {
+	if verify && !header.Hash().IsEqual(hash) {
+		return &db.ErrCorruptedRecord{Hash: hash}
+	}
+	return nil
+}
+
 type HeaderCache struct {
 	sync.RWMutex
 	size    int
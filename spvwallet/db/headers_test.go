@@ -0,0 +1,291 @@
+package db
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA/core"
+)
+
+// Put a chain of the given length into the headers store, returns the headers by height
+func putTestChain(t *testing.T, headers Headers, length uint32) []*db.StoreHeader {
+	chain := make([]*db.StoreHeader, length+1)
+	var previous common.Uint256
+	for height := uint32(1); height <= length; height++ {
+		header := &db.StoreHeader{
+			Header: core.Header{
+				Version:  1,
+				Previous: previous,
+				Nonce:    height,
+				Height:   height,
+			},
+			TotalWork: big.NewInt(int64(height)),
+		}
+		if err := headers.Put(header, true); err != nil {
+			t.Fatalf("put header %d failed: %v", height, err)
+		}
+		chain[height] = header
+		previous = header.Hash()
+	}
+	return chain
+}
+
+// Run the test in a temporary working directory, the bolt store opens its file there
+func inTempDir(t *testing.T, test func()) {
+	dir, err := ioutil.TempDir("", "spvheaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	test()
+}
+
+func TestGetBlockLocatorHashes(t *testing.T) {
+	stores := []struct {
+		name string
+		open func() (Headers, error)
+	}{
+		{"bolt", NewHeadersDB},
+		{"memory", func() (Headers, error) { return NewMemHeadersDB(), nil }},
+		{"leveldb", NewLevelDBHeadersDB},
+	}
+	lengths := []uint32{1, 5, 12, 300}
+
+	for _, store := range stores {
+		for _, length := range lengths {
+			inTempDir(t, func() {
+				headers, err := store.open()
+				if err != nil {
+					t.Fatalf("%s: open failed: %v", store.name, err)
+				}
+				defer headers.Close()
+				chain := putTestChain(t, headers, length)
+
+				locator := headers.GetBlockLocatorHashes()
+				if len(locator) == 0 {
+					t.Fatalf("%s, length %d: empty locator", store.name, length)
+				}
+				if !locator[0].IsEqual(chain[length].Hash()) {
+					t.Errorf("%s, length %d: locator does not start at the tip", store.name, length)
+				}
+
+				// Hashes must be distinct and walk back to lower heights
+				lastHeight := length + 1
+				seen := make(map[common.Uint256]bool)
+				for i, hash := range locator {
+					if seen[*hash] {
+						t.Fatalf("%s, length %d: locator hash %d is a duplicate", store.name, length, i)
+					}
+					seen[*hash] = true
+					header, err := headers.GetHeader(*hash)
+					if err != nil {
+						t.Fatalf("%s, length %d: locator hash %d not stored: %v", store.name, length, i, err)
+					}
+					if header.Height >= lastHeight {
+						t.Errorf("%s, length %d: locator height %d after %d", store.name, length, header.Height, lastHeight)
+					}
+					if !chain[header.Height].Hash().IsEqual(*hash) {
+						t.Errorf("%s, length %d: locator hash %d is not on the chain", store.name, length, i)
+					}
+					lastHeight = header.Height
+				}
+			})
+		}
+	}
+}
+
+func TestLevelDBHeaderKeys(t *testing.T) {
+	inTempDir(t, func() {
+		headers, err := NewLevelDBHeadersDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain := putTestChain(t, headers, 20)
+		// Reopen, so the headers are read from the database instead of the cache
+		headers.Close()
+		headers, err = NewLevelDBHeadersDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer headers.Close()
+
+		for height := uint32(1); height <= 20; height++ {
+			header, err := headers.GetHeader(chain[height].Hash())
+			if err != nil {
+				t.Fatalf("get header %d failed: %v", height, err)
+			}
+			if header.Height != height {
+				t.Errorf("header %d read on height %d", height, header.Height)
+			}
+		}
+		if _, err := headers.GetHeader(common.Uint256{1}); err == nil {
+			t.Error("got a header not stored")
+		}
+	})
+}
+
+// Put a branch of the given length on the parent, the nonce tells it from other branches
+func putTestBranch(t *testing.T, headers Headers, parent *db.StoreHeader, length, nonce uint32, newTip bool) []*db.StoreHeader {
+	var branch []*db.StoreHeader
+	for i := uint32(1); i <= length; i++ {
+		header := &db.StoreHeader{
+			Header: core.Header{
+				Version:  1,
+				Previous: parent.Hash(),
+				Nonce:    nonce + i,
+				Height:   parent.Height + 1,
+			},
+			TotalWork: big.NewInt(int64(parent.Height + 1)),
+		}
+		if err := headers.Put(header, newTip); err != nil {
+			t.Fatalf("put branch header %d failed: %v", header.Height, err)
+		}
+		branch = append(branch, header)
+		parent = header
+	}
+	return branch
+}
+
+func TestPrunedHeaders(t *testing.T) {
+	const interval = 10
+	// Prune past several intervals out of the recent window
+	const length = PruneKeepRecent + 5*interval + 7
+	const oldest = length - PruneKeepRecent
+
+	inTempDir(t, func() {
+		headers, err := NewPrunedHeadersDB(interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain := putTestChain(t, headers, length)
+		// Reopen, so the headers are read from the database instead of the cache
+		headers.Close()
+		headers, err = NewPrunedHeadersDB(interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer headers.Close()
+		tip := chain[length]
+
+		// Full headers are kept on the checkpoint heights and in the recent window
+		for height := uint32(1); height <= length; height++ {
+			_, err := headers.GetHeader(chain[height].Hash())
+			kept := height > oldest || height%interval == 0
+			if kept && err != nil {
+				t.Errorf("header %d pruned: %v", height, err)
+			}
+			if !kept && err == nil {
+				t.Errorf("header %d not pruned", height)
+			}
+		}
+
+		// Ancestors are found by the link records across the pruned ranges
+		for _, from := range []*db.StoreHeader{tip, chain[4*interval], chain[oldest+1]} {
+			for height := uint32(1); height <= from.Height; height++ {
+				hash, err := headers.GetAncestor(from, height)
+				if err != nil {
+					t.Fatalf("ancestor %d of %d failed: %v", height, from.Height, err)
+				}
+				if !hash.IsEqual(chain[height].Hash()) {
+					t.Errorf("ancestor %d of %d is not on the chain", height, from.Height)
+				}
+			}
+		}
+		onChain := make(map[common.Uint256]uint32)
+		for height := uint32(1); height <= length; height++ {
+			onChain[chain[height].Hash()] = height
+		}
+		locator := headers.GetBlockLocatorHashes()
+		for i, hash := range locator {
+			if _, ok := onChain[*hash]; !ok {
+				t.Errorf("locator hash %d is not on the chain", i)
+			}
+		}
+		if len(locator) == 0 || onChain[*locator[len(locator)-1]] > oldest {
+			t.Errorf("locator does not reach the pruned headers")
+		}
+
+		// Previous headers are walked back through the recent window, and end
+		// with an error on the first pruned header
+		header := tip
+		for header.Height > oldest+1 {
+			previous, err := headers.GetPrevious(header)
+			if err != nil {
+				t.Fatalf("previous of %d failed: %v", header.Height, err)
+			}
+			if !previous.Hash().IsEqual(chain[header.Height-1].Hash()) {
+				t.Fatalf("previous of %d is not on the chain", header.Height)
+			}
+			header = previous
+		}
+		if _, err := headers.GetPrevious(header); err == nil {
+			t.Errorf("got the pruned previous header of %d", header.Height)
+		}
+
+		// A reorganize in the recent window finds the fork point by previous
+		// headers, like the rollback of the blockchain
+		fork := putTestBranch(t, headers, chain[length-5], 8, 1<<20, true)
+		majority, minority := fork[len(fork)-1], tip
+		for majority.Height > minority.Height {
+			if majority, err = headers.GetPrevious(majority); err != nil {
+				t.Fatalf("previous of the fork failed: %v", err)
+			}
+		}
+		for !majority.Hash().IsEqual(minority.Hash()) {
+			if majority, err = headers.GetPrevious(majority); err != nil {
+				t.Fatalf("previous of the fork failed: %v", err)
+			}
+			if minority, err = headers.GetPrevious(minority); err != nil {
+				t.Fatalf("previous of the old tip failed: %v", err)
+			}
+		}
+		if majority.Height != length-5 {
+			t.Errorf("fork point on %d, want %d", majority.Height, length-5)
+		}
+		forkTip := fork[len(fork)-1]
+		for height := uint32(1); height <= forkTip.Height; height++ {
+			want := chain[height]
+			if height > length-5 {
+				want = fork[height-(length-4)]
+			}
+			hash, err := headers.GetAncestor(forkTip, height)
+			if err != nil || !hash.IsEqual(want.Hash()) {
+				t.Errorf("ancestor %d of the fork tip is not on the fork, %v", height, err)
+			}
+		}
+		// The new tip prunes out of its own recent window, checkpoints are kept
+		for height := oldest + 1; height <= forkTip.Height-PruneKeepRecent; height++ {
+			_, err := headers.GetHeader(chain[height].Hash())
+			if height%interval == 0 && err != nil {
+				t.Errorf("checkpoint %d pruned after the reorganize: %v", height, err)
+			}
+			if height%interval != 0 && err == nil {
+				t.Errorf("header %d not pruned after the reorganize", height)
+			}
+		}
+
+		// A fork below the recent window is linked through the pruned headers,
+		// but the fork point can not be found by previous headers
+		deep := putTestBranch(t, headers, chain[3*interval+3], 2, 2<<20, false)
+		hash, err := headers.GetAncestor(deep[1], 2*interval+1)
+		if err != nil || !hash.IsEqual(chain[2*interval+1].Hash()) {
+			t.Errorf("ancestor of the deep fork is not on the chain, %v", err)
+		}
+		if _, err := headers.GetPrevious(deep[0]); err == nil {
+			t.Errorf("got the pruned parent of the deep fork")
+		}
+	})
+}
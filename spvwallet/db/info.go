@@ -2,7 +2,6 @@ package db
 
 import (
 	"database/sql"
-	"sync"
 	"encoding/binary"
 	"bytes"
 )
@@ -13,20 +12,30 @@ const CreateInfoDB = `CREATE TABLE IF NOT EXISTS Info(
 			);`
 
 const (
-	ChainHeightKey = "ChainHeight"
+	ChainHeightKey   = "ChainHeight"
+	SyncStatsKey     = "SyncStats"
+	ResponseStatsKey = "ResponseStats"
+	SpendLogKey      = "SpendLog"
+	DeltaSeqKey      = "DeltaSeq"
+	FeeTargetsKey    = "FeeTargets"
+	// The last sync checkpoint and the number of times the wallet addresses changed
+	SyncCheckpointKey   = "SyncCheckpoint"
+	FilterGenerationKey = "FilterGeneration"
+	// The schema version of the Addrs table, so it is upgraded only once
+	AddrsVersionKey = "AddrsVersion"
 )
 
 type InfoDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 }
 
-func NewInfoDB(db *sql.DB, lock *sync.RWMutex) (Info, error) {
+func NewInfoDB(db *sql.DB, lock StoreLock) (Info, error) {
 	_, err := db.Exec(CreateInfoDB)
 	if err != nil {
 		return nil, err
 	}
-	return &InfoDB{RWMutex: lock, DB: db}, nil
+	return &InfoDB{StoreLock: lock, DB: db}, nil
 }
 
 // get chain height
@@ -49,11 +58,13 @@ func (db *InfoDB) SaveChainHeight(height uint32) {
 }
 
 // put key and value into db
-func (db *InfoDB) Put(key string, value []byte) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *InfoDB) Put(key string, value []byte) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	_, err := db.Exec("INSERT OR REPLACE INTO Info(Key, Value) VALUES(?,?)", key, value)
+	_, err = db.Exec("INSERT OR REPLACE INTO Info(Key, Value) VALUES(?,?)", key, value)
 	if err != nil {
 		return err
 	}
@@ -78,11 +89,13 @@ func (db *InfoDB) Get(key string) ([]byte, error) {
 }
 
 // delete value by key
-func (db *InfoDB) Delete(key string) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *InfoDB) Delete(key string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	_, err := db.Exec("DELETE FROM Info WHERE key=?", key)
+	_, err = db.Exec("DELETE FROM Info WHERE key=?", key)
 	if err != nil {
 		return err
 	}
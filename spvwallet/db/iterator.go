@@ -0,0 +1,156 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// MainChainIndex is implemented by headers stores indexing the main chain by height,
+// the header iterator gets the hashes in the range from the index instead of walking
+// back from the chain tip
+type MainChainIndex interface {
+	// Get the hashes of the main chain headers from height from to height to, both are included
+	GetMainChainHashes(from, to uint32) ([]Uint256, error)
+}
+
+// HeaderIterator iterates the headers on the main chain by height from low to high.
+// The chain is fixed when the iterator is created, so a reorganize during the
+// iteration does not change the result, headers are read one by one on Next().
+type HeaderIterator struct {
+	headers Headers
+	hashes  []Uint256
+	index   int
+	current *db.StoreHeader
+	err     error
+}
+
+// Create a header iterator from height from to height to, both are included,
+// to of 0 means the chain tip. Only the hashes in the range are kept in memory,
+// iterate a long chain in ranges to limit memory usage.
+func NewHeaderIterator(headers Headers, from, to uint32) (*HeaderIterator, error) {
+	header, err := headers.GetTip()
+	if err != nil {
+		return nil, err
+	}
+	if to == 0 || to > header.Height {
+		to = header.Height
+	}
+	if from > to {
+		return nil, errors.New("from height is greater than to height")
+	}
+
+	if index, ok := headers.(MainChainIndex); ok {
+		hashes, err := index.GetMainChainHashes(from, to)
+		if err != nil {
+			return nil, err
+		}
+		return &HeaderIterator{headers: headers, hashes: hashes}, nil
+	}
+
+	for header.Height > to {
+		header, err = headers.GetPrevious(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hashes := make([]Uint256, to-from+1)
+	for i := len(hashes) - 1; i >= 0; i-- {
+		hashes[i] = header.Hash()
+		if i == 0 {
+			break
+		}
+		header, err = headers.GetPrevious(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &HeaderIterator{headers: headers, hashes: hashes}, nil
+}
+
+// Move to the next header, returns false when finished or an error occurred
+func (it *HeaderIterator) Next() bool {
+	if it.err != nil || it.index >= len(it.hashes) {
+		return false
+	}
+	it.current, it.err = it.headers.GetHeader(it.hashes[it.index])
+	it.index++
+	return it.err == nil
+}
+
+// The current header
+func (it *HeaderIterator) Header() *db.StoreHeader {
+	return it.current
+}
+
+// The error occurred during the iteration
+func (it *HeaderIterator) Err() error {
+	return it.err
+}
+
+// TxIterator iterates the confirmed wallet transactions by height from low to high.
+// It reads from a snapshot of the database, transactions committed during the
+// iteration are not included, and the sync is not blocked.
+type TxIterator struct {
+	tx      *sql.Tx
+	rows    *sql.Rows
+	current *db.StoreTx
+	err     error
+}
+
+// Move to the next transaction, returns false when finished or an error occurred
+func (it *TxIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+
+	var txIdBytes []byte
+	var height uint32
+	var rawData []byte
+	var timestamp uint32
+	it.err = it.rows.Scan(&txIdBytes, &height, &rawData, &timestamp)
+	if it.err != nil {
+		return false
+	}
+
+	txId, err := Uint256FromBytes(txIdBytes)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	var tx Transaction
+	it.err = tx.DeserializeUnsigned(bytes.NewReader(rawData))
+	if it.err != nil {
+		return false
+	}
+
+	it.current = &db.StoreTx{TxId: *txId, Height: height, Timestamp: timestamp, Data: tx}
+	return true
+}
+
+// The current transaction
+func (it *TxIterator) Tx() *db.StoreTx {
+	return it.current
+}
+
+// The error occurred during the iteration
+func (it *TxIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+// Close the iterator to release the snapshot, it must be called after the iteration
+func (it *TxIterator) Close() error {
+	it.rows.Close()
+	return it.tx.Rollback()
+}
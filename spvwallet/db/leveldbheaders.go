@@ -0,0 +1,460 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.Utility/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	LevelDBHeadersDir = "headers.ldb"
+
+	// Headers put during sync are written in batches of this size, or after
+	// the flush interval, unwritten headers are downloaded again after a crash
+	LevelDBBatchSize     = 1000
+	LevelDBFlushInterval = time.Second * 2
+
+	// Block cache and write buffer sizes, headers are read mostly from the
+	// recent blocks, and written in order during sync
+	LevelDBCacheSize   = 16 << 20
+	LevelDBWriteBuffer = 16 << 20
+)
+
+var (
+	// Headers keyed by the height and the hash, so headers put during sync are
+	// appended in key order, the hash keys only point to the height
+	levelHeaderPrefix = []byte("H")
+	levelHashPrefix   = []byte("x")
+	levelHeightPrefix = []byte("n")
+	levelChainTipKey  = []byte("ChainTip")
+)
+
+/*
+LevelDBHeadersDB implements Headers using LevelDB, it keeps a height index of
+the main chain, so ancestors and ranges of headers are found by the index
+instead of walking back from the chain tip, which is slow on long chains.
+
+Each kind of record has a key prefix of its own, like a column family, so the
+records of a kind are kept in their own tables. The headers are keyed by the
+height before the hash, so the headers put during sync come in key order, and
+compaction moves their tables down the levels without rewriting them. Only the
+small entries from the hash to the height come in random order and are rewritten
+by compaction. The wallet data and the transactions are kept in the sqlite
+database, so header writes never rewrite them.
+*/
+type LevelDBHeadersDB struct {
+	*sync.RWMutex
+	db    *leveldb.DB
+	cache *HeaderCache
+	quit  chan struct{}
+
+	// Writes not flushed yet, and the headers and index entries in them,
+	// a nil index entry is deleted
+	batch          *leveldb.Batch
+	pendingHeaders map[common.Uint256]*db.StoreHeader
+	pendingIndex   map[uint32]*common.Uint256
+
+	verifyOnRead bool
+}
+
+func NewLevelDBHeadersDB() (Headers, error) {
+	db, err := openLevelDB()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := &LevelDBHeadersDB{
+		RWMutex: new(sync.RWMutex),
+		db:      db,
+		cache:   newHeaderCache(100),
+		quit:    make(chan struct{}),
+	}
+	headers.resetPending()
+
+	go headers.runFlush()
+
+	return headers, nil
+}
+
+func openLevelDB() (*leveldb.DB, error) {
+	return leveldb.OpenFile(LevelDBHeadersDir, &opt.Options{
+		BlockCacheCapacity: LevelDBCacheSize,
+		WriteBuffer:        LevelDBWriteBuffer,
+		// Headers can be synced again, so do not sync every write
+		NoSync: true,
+	})
+}
+
+func (h *LevelDBHeadersDB) resetPending() {
+	h.batch = new(leveldb.Batch)
+	h.pendingHeaders = make(map[common.Uint256]*db.StoreHeader)
+	h.pendingIndex = make(map[uint32]*common.Uint256)
+}
+
+func (h *LevelDBHeadersDB) runFlush() {
+	ticker := time.NewTicker(LevelDBFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.Lock()
+			err := h.flush()
+			h.Unlock()
+			if err != nil {
+				log.Error("Headers db flush err,", err)
+			}
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// Write the pending batch, the headers and the chain tip in it are written at once
+func (h *LevelDBHeadersDB) flush() error {
+	if h.batch.Len() == 0 {
+		return nil
+	}
+	err := h.db.Write(h.batch, nil)
+	if err != nil {
+		return err
+	}
+	h.resetPending()
+	return nil
+}
+
+// Add a new header to blockchain
+func (h *LevelDBHeadersDB) Put(header *db.StoreHeader, newTip bool) error {
+	h.Lock()
+	defer h.Unlock()
+
+	bytes, err := header.Serialize()
+	if err != nil {
+		return err
+	}
+
+	hash := header.Hash()
+	h.batch.Put(levelHeaderKey(header.Height, hash), bytes)
+	h.batch.Put(levelHashKey(hash), levelHeightKey(header.Height)[len(levelHeightPrefix):])
+	h.pendingHeaders[hash] = header
+	h.cache.Set(header)
+
+	if newTip {
+		h.batch.Put(levelChainTipKey, bytes)
+		h.cache.tip = header
+
+		err = h.indexMainChain(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.batch.Len() >= LevelDBBatchSize {
+		return h.flush()
+	}
+	return nil
+}
+
+// Point the height index to the new chain tip and its ancestors up to the fork
+// point, and remove the entries above the tip left by a longer chain
+func (h *LevelDBHeadersDB) indexMainChain(tip *db.StoreHeader) error {
+	for height := tip.Height + 1; ; height++ {
+		_, err := h.getIndex(height)
+		if err != nil {
+			break
+		}
+		h.batch.Delete(levelHeightKey(height))
+		h.pendingIndex[height] = nil
+	}
+
+	header := tip
+	for {
+		hash := header.Hash()
+		h.batch.Put(levelHeightKey(header.Height), hash.Bytes())
+		h.pendingIndex[header.Height] = &hash
+		if header.Height <= 1 {
+			return nil
+		}
+
+		previous, err := h.getIndex(header.Height - 1)
+		if err == nil && previous.IsEqual(header.Previous) {
+			return nil
+		}
+		header, err = h.getHeader(header.Previous)
+		if err != nil {
+			// The chain starts from a trusted header, its previous is not stored
+			return nil
+		}
+	}
+}
+
+// Get previous block of the given header
+func (h *LevelDBHeadersDB) GetPrevious(header *db.StoreHeader) (*db.StoreHeader, error) {
+	if header.Height == 1 {
+		return &db.StoreHeader{TotalWork: new(big.Int)}, nil
+	}
+	return h.GetHeader(header.Previous)
+}
+
+// Get full header with it's hash
+func (h *LevelDBHeadersDB) GetHeader(hash common.Uint256) (*db.StoreHeader, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.getHeader(hash)
+}
+
+func (h *LevelDBHeadersDB) getHeader(hash common.Uint256) (*db.StoreHeader, error) {
+	if header, ok := h.pendingHeaders[hash]; ok {
+		return header, nil
+	}
+
+	header, err := h.cache.Get(hash)
+	if err == nil {
+		return header, nil
+	}
+
+	heightBytes, err := h.db.Get(levelHashKey(hash), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, errors.New(fmt.Sprintf("Header %s does not exist in database", hash.String()))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(heightBytes) != 4 {
+		return nil, &db.ErrCorruptedRecord{Hash: hash}
+	}
+	header, err = h.readHeader(levelHeaderKey(binary.BigEndian.Uint32(heightBytes), hash))
+	if _, ok := err.(*headerDecodeError); ok {
+		return nil, &db.ErrCorruptedRecord{Hash: hash}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return header, verifyHeader(hash, header, h.verifyOnRead)
+}
+
+func (h *LevelDBHeadersDB) readHeader(key []byte) (*db.StoreHeader, error) {
+	headerBytes, err := h.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, errors.New(fmt.Sprintf("Header %x does not exist in database", key))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var header db.StoreHeader
+	err = header.Deserialize(headerBytes)
+	if err != nil {
+		return nil, &headerDecodeError{err}
+	}
+
+	return &header, nil
+}
+
+// Get the hash of the main chain header on the height
+func (h *LevelDBHeadersDB) getIndex(height uint32) (*common.Uint256, error) {
+	if hash, ok := h.pendingIndex[height]; ok {
+		if hash == nil {
+			return nil, leveldb.ErrNotFound
+		}
+		return hash, nil
+	}
+
+	hashBytes, err := h.db.Get(levelHeightKey(height), nil)
+	if err != nil {
+		return nil, err
+	}
+	return common.Uint256FromBytes(hashBytes)
+}
+
+// Get the header on chain tip
+func (h *LevelDBHeadersDB) GetTip() (*db.StoreHeader, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	if h.cache.tip != nil {
+		return h.cache.tip, nil
+	}
+
+	header, err := h.readHeader(levelChainTipKey)
+	if err != nil {
+		log.Error("Headers db get tip err,", err)
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// Get the hash of the ancestor of the given header on the given height
+func (h *LevelDBHeadersDB) GetAncestor(header *db.StoreHeader, height uint32) (*common.Uint256, error) {
+	if header.Height < height {
+		return nil, errors.New("ancestor height is higher than the header")
+	}
+
+	// Headers on the main chain find the ancestor by the height index
+	h.RLock()
+	hash, err := h.getIndex(header.Height)
+	if err == nil && hash.IsEqual(header.Hash()) {
+		hash, err = h.getIndex(height)
+		if err == nil {
+			h.RUnlock()
+			return hash, nil
+		}
+	}
+	h.RUnlock()
+
+	for header.Height > height {
+		header, err = h.GetHeader(header.Previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ancestor := header.Hash()
+	return &ancestor, nil
+}
+
+// Get the hashes of the main chain headers from height from to height to, both
+// are included, read by an iterator over the height index
+func (h *LevelDBHeadersDB) GetMainChainHashes(from, to uint32) ([]common.Uint256, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	// Iterate the index in the database with the pending entries
+	err := h.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]common.Uint256, 0, to-from+1)
+	iter := h.db.NewIterator(&util.Range{Start: levelHeightKey(from), Limit: levelHeightKey(to + 1)}, nil)
+	defer iter.Release()
+	for iter.Next() {
+		height := binary.BigEndian.Uint32(iter.Key()[len(levelHeightPrefix):])
+		if height != from+uint32(len(hashes)) {
+			return nil, errors.New(fmt.Sprint("height index missing height ", from+uint32(len(hashes))))
+		}
+		hash, err := common.Uint256FromBytes(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, *hash)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if len(hashes) != cap(hashes) {
+		return nil, errors.New(fmt.Sprint("height index missing height ", from+uint32(len(hashes))))
+	}
+
+	return hashes, nil
+}
+
+// Create a block locator from the chain tip
+func (h *LevelDBHeadersDB) GetBlockLocatorHashes() []*common.Uint256 {
+	var ret []*common.Uint256
+	header, err := h.GetTip()
+	if err != nil { // No headers stored return empty locator
+		return ret
+	}
+
+	step := uint32(1)
+	start := 0
+	for {
+		if start >= 9 {
+			step *= 2
+			start = 0
+		}
+		hash := header.Hash()
+		ret = append(ret, &hash)
+		if len(ret) >= MaxBlockLocatorHashes || header.Height <= step {
+			break
+		}
+		ancestor, err := h.GetAncestor(header, header.Height-step)
+		if err != nil {
+			break
+		}
+		header, err = h.GetHeader(*ancestor)
+		if err != nil {
+			break
+		}
+		start += 1
+	}
+
+	return ret
+}
+
+func (h *LevelDBHeadersDB) SetVerifyOnRead(verify bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.verifyOnRead = verify
+}
+
+// Reset database, clear all data
+func (h *LevelDBHeadersDB) Reset() error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.cache = newHeaderCache(100)
+	h.resetPending()
+
+	// Remove the database files and reopen it, which is faster
+	// than deleting all the keys in batches
+	err := h.db.Close()
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(LevelDBHeadersDir)
+	if err != nil {
+		return err
+	}
+	h.db, err = openLevelDB()
+	return err
+}
+
+// Close db
+func (h *LevelDBHeadersDB) Close() {
+	h.Lock()
+	close(h.quit)
+	err := h.flush()
+	if err != nil {
+		log.Error("Headers db flush err,", err)
+	}
+	h.db.Close()
+	log.Debug("Headers DB closed")
+}
+
+func levelHeaderKey(height uint32, hash common.Uint256) []byte {
+	key := make([]byte, len(levelHeaderPrefix)+4, len(levelHeaderPrefix)+4+common.UINT256SIZE)
+	copy(key, levelHeaderPrefix)
+	binary.BigEndian.PutUint32(key[len(levelHeaderPrefix):], height)
+	return append(key, hash.Bytes()...)
+}
+
+func levelHashKey(hash common.Uint256) []byte {
+	key := make([]byte, 0, len(levelHashPrefix)+common.UINT256SIZE)
+	key = append(key, levelHashPrefix...)
+	return append(key, hash.Bytes()...)
+}
+
+// Heights are big endian, so the index is iterated in height order
+func levelHeightKey(height uint32) []byte {
+	key := make([]byte, len(levelHeightPrefix)+4)
+	copy(key, levelHeightPrefix)
+	binary.BigEndian.PutUint32(key[len(levelHeightPrefix):], height)
+	return key
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	"github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// MemHeadersDB implements Headers in memory, for the ephemeral mode,
+// all headers are lost when the process exits
+type MemHeadersDB struct {
+	*sync.RWMutex
+	headers map[common.Uint256]*db.StoreHeader
+	tip     *db.StoreHeader
+}
+
+func NewMemHeadersDB() Headers {
+	return &MemHeadersDB{
+		RWMutex: new(sync.RWMutex),
+		headers: make(map[common.Uint256]*db.StoreHeader),
+	}
+}
+
+// Add a new header to blockchain
+func (h *MemHeadersDB) Put(header *db.StoreHeader, newTip bool) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.headers[header.Hash()] = header
+	if newTip {
+		h.tip = header
+	}
+	return nil
+}
+
+// Get previous block of the given header
+func (h *MemHeadersDB) GetPrevious(header *db.StoreHeader) (*db.StoreHeader, error) {
+	if header.Height == 1 {
+		return &db.StoreHeader{TotalWork: new(big.Int)}, nil
+	}
+	return h.GetHeader(header.Previous)
+}
+
+// Get full header with it's hash
+func (h *MemHeadersDB) GetHeader(hash common.Uint256) (*db.StoreHeader, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.getHeader(hash)
+}
+
+func (h *MemHeadersDB) getHeader(hash common.Uint256) (*db.StoreHeader, error) {
+	header, ok := h.headers[hash]
+	if !ok {
+		return nil, fmt.Errorf("Header %s does not exist in database", hash.String())
+	}
+	return header, nil
+}
+
+// Get the header on chain tip
+func (h *MemHeadersDB) GetTip() (*db.StoreHeader, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	if h.tip == nil {
+		return nil, errors.New("no headers in database")
+	}
+	return h.tip, nil
+}
+
+// Get the hash of the ancestor of the given header on the given height
+func (h *MemHeadersDB) GetAncestor(header *db.StoreHeader, height uint32) (*common.Uint256, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.getAncestor(header, height)
+}
+
+func (h *MemHeadersDB) getAncestor(header *db.StoreHeader, height uint32) (*common.Uint256, error) {
+	if height > header.Height {
+		return nil, errors.New("ancestor height is higher than the header")
+	}
+	var err error
+	for header.Height > height {
+		header, err = h.getHeader(header.Previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hash := header.Hash()
+	return &hash, nil
+}
+
+// Create a block locator from the chain tip
+func (h *MemHeadersDB) GetBlockLocatorHashes() []*common.Uint256 {
+	h.RLock()
+	defer h.RUnlock()
+
+	var ret []*common.Uint256
+	if h.tip == nil { // No headers stored return empty locator
+		return ret
+	}
+
+	header := h.tip
+	step := uint32(1)
+	start := 0
+	for {
+		if start >= 9 {
+			step *= 2
+			start = 0
+		}
+		hash := header.Hash()
+		ret = append(ret, &hash)
+		if len(ret) >= MaxBlockLocatorHashes || header.Height <= step {
+			break
+		}
+		ancestor, err := h.getAncestor(header, header.Height-step)
+		if err != nil {
+			break
+		}
+		header = h.headers[*ancestor]
+		start += 1
+	}
+
+	return ret
+}
+
+// Headers in memory are not serialized, so they can not be corrupted
+func (h *MemHeadersDB) SetVerifyOnRead(verify bool) {}
+
+func (h *MemHeadersDB) Reset() error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.headers = make(map[common.Uint256]*db.StoreHeader)
+	h.tip = nil
+	return nil
+}
+
+func (h *MemHeadersDB) Close() {}
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+)
+
+// The max number of connections to an in-memory database
+const MaxMemoryConns = 10
+
+var memoryDBs uint32
+
+// Open a new sqlite database in memory, name is used to tell databases apart in
+// logs. The connections share the same database by the shared cache, which is
+// dropped when the last connection is closed, so idle connections are kept open.
+func OpenMemoryDB(name string) (*sql.DB, error) {
+	dataSource := fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", name, atomic.AddUint32(&memoryDBs, 1))
+	db, err := sql.Open(DriverName, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(MaxMemoryConns)
+	db.SetMaxIdleConns(MaxMemoryConns)
+	return db, nil
+}
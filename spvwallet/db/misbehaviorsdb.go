@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const CreateMisbehaviorsDB = `CREATE TABLE IF NOT EXISTS Misbehaviors(
+				Id INTEGER PRIMARY KEY AUTOINCREMENT,
+				Time INTEGER NOT NULL,
+				PeerId INTEGER NOT NULL,
+				Addr TEXT NOT NULL,
+				Reason TEXT NOT NULL,
+				MsgHash BLOB NOT NULL,
+				Delta INTEGER NOT NULL,
+				Score INTEGER NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_misbehaviors_time ON Misbehaviors (Time);`
+
+const (
+	// Misbehaviors older than the retention are deleted
+	MisbehaviorRetention = time.Hour * 24 * 30
+	// Max number of misbehaviors kept, the oldest are deleted first
+	MaxMisbehaviors = 10000
+)
+
+type MisbehaviorsDB struct {
+	StoreLock
+	*sql.DB
+}
+
+func NewMisbehaviorsDB(db *sql.DB, lock StoreLock) (Misbehaviors, error) {
+	_, err := db.Exec(CreateMisbehaviorsDB)
+	if err != nil {
+		return nil, err
+	}
+	return &MisbehaviorsDB{StoreLock: lock, DB: db}, nil
+}
+
+// Put a misbehavior record and delete the records out of retention
+func (m *MisbehaviorsDB) Put(record *db.MisbehaviorRecord) (err error) {
+	if err := lockWrite(m.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(m.StoreLock, &err)
+
+	tx, err := m.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO Misbehaviors(Time, PeerId, Addr, Reason, MsgHash, Delta, Score)
+			VALUES(?,?,?,?,?,?,?)`, record.Time.Unix(), int64(record.PeerId), record.Addr,
+		record.Reason, record.MsgHash.Bytes(), record.Delta, record.Score)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Misbehaviors WHERE Time<?", time.Now().Add(-MisbehaviorRetention).Unix())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM Misbehaviors WHERE Id NOT IN
+			(SELECT Id FROM Misbehaviors ORDER BY Id DESC LIMIT ?)`, MaxMisbehaviors)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get the misbehavior records since the given time, filtered by the peer
+// address if addr is not empty
+func (m *MisbehaviorsDB) GetAll(since time.Time, addr string) ([]*db.MisbehaviorRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	rows, err := m.Query(`SELECT Time, PeerId, Addr, Reason, MsgHash, Delta, Score FROM Misbehaviors
+			WHERE Time>=? AND (?='' OR Addr=?) ORDER BY Id`, since.Unix(), addr, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*db.MisbehaviorRecord
+	for rows.Next() {
+		var timestamp, peerId int64
+		var msgHash []byte
+		record := new(db.MisbehaviorRecord)
+		err = rows.Scan(&timestamp, &peerId, &record.Addr, &record.Reason, &msgHash, &record.Delta, &record.Score)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := Uint256FromBytes(msgHash)
+		if err != nil {
+			return nil, err
+		}
+		record.Time = time.Unix(timestamp, 0)
+		record.PeerId = uint64(peerId)
+		record.MsgHash = *hash
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
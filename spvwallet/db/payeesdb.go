@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const CreatePayeesDB = `CREATE TABLE IF NOT EXISTS Payees(
+				Name TEXT NOT NULL PRIMARY KEY,
+				Address BLOB NOT NULL,
+				Memo TEXT NOT NULL DEFAULT '',
+				LastUsed INTEGER NOT NULL DEFAULT 0
+			);`
+
+// Payee is an entry of the address book
+type Payee struct {
+	Name string
+	// The program hash of the payee address
+	Address Uint168
+	// The memo attached to transactions paying the payee by default
+	Memo string
+	// When the payee was last paid, zero if never
+	LastUsed time.Time
+}
+
+type PayeesDB struct {
+	StoreLock
+	*sql.DB
+}
+
+func NewPayeesDB(db *sql.DB, lock StoreLock) (Payees, error) {
+	_, err := db.Exec(CreatePayeesDB)
+	if err != nil {
+		return nil, err
+	}
+	return &PayeesDB{StoreLock: lock, DB: db}, nil
+}
+
+// put a payee to database, replace the payee with the same name
+func (db *PayeesDB) Put(payee *Payee) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	var lastUsed int64
+	if !payee.LastUsed.IsZero() {
+		lastUsed = payee.LastUsed.Unix()
+	}
+	sql := "INSERT OR REPLACE INTO Payees(Name, Address, Memo, LastUsed) VALUES(?,?,?,?)"
+	_, err = db.Exec(sql, payee.Name, payee.Address.Bytes(), payee.Memo, lastUsed)
+	return err
+}
+
+// get a payee by name from database
+func (db *PayeesDB) Get(name string) (*Payee, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	row := db.QueryRow("SELECT Name, Address, Memo, LastUsed FROM Payees WHERE Name=?", name)
+	return scanPayee(row)
+}
+
+// get all payees from database, the most recently used first
+func (db *PayeesDB) GetAll() ([]*Payee, error) {
+	return db.query("SELECT Name, Address, Memo, LastUsed FROM Payees ORDER BY LastUsed DESC, Name")
+}
+
+// search payees by name or memo containing the query, case insensitive
+func (db *PayeesDB) Search(query string) ([]*Payee, error) {
+	// Escape the LIKE wildcards in the query
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	return db.query(`SELECT Name, Address, Memo, LastUsed FROM Payees
+			WHERE Name LIKE ? ESCAPE '\' OR Memo LIKE ? ESCAPE '\' ORDER BY LastUsed DESC, Name`, pattern, pattern)
+}
+
+// update the last used time of a payee
+func (db *PayeesDB) Touch(name string, lastUsed time.Time) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec("UPDATE Payees SET LastUsed=? WHERE Name=?", lastUsed.Unix(), name)
+	return err
+}
+
+// delete a payee from database
+func (db *PayeesDB) Delete(name string) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec("DELETE FROM Payees WHERE Name=?", name)
+	return err
+}
+
+func (db *PayeesDB) query(query string, args ...interface{}) ([]*Payee, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	var payees []*Payee
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return payees, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payee, err := scanPayee(rows)
+		if err != nil {
+			return payees, err
+		}
+		payees = append(payees, payee)
+	}
+
+	return payees, nil
+}
+
+func scanPayee(row interface {
+	Scan(dest ...interface{}) error
+}) (*Payee, error) {
+	var payee Payee
+	var addressBytes []byte
+	var lastUsed int64
+	err := row.Scan(&payee.Name, &addressBytes, &payee.Memo, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := Uint168FromBytes(addressBytes)
+	if err != nil {
+		return nil, err
+	}
+	payee.Address = *address
+	if lastUsed != 0 {
+		payee.LastUsed = time.Unix(lastUsed, 0)
+	}
+
+	return &payee, nil
+}
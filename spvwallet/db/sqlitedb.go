@@ -4,19 +4,60 @@ import (
 	"database/sql"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/log"
 
-	_ "github.com/mattn/go-sqlite3"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 const (
-	DriverName = "sqlite3"
-	DBName     = "./spv_wallet.db"
+	DBName = "./spv_wallet.db"
 )
 
+// StoreLock guards the stores sharing a wallet database, reads take the read
+// lock and writes the write lock
+type StoreLock interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// WriteLocker is an optional interface of StoreLock, a lock which saves the
+// writes when released implements it, so a write which can not be saved is
+// refused or returns the error of saving it
+type WriteLocker interface {
+	// Take the write lock, it is not held if an error is returned
+	LockWrite() error
+
+	// Save the writes and release the write lock
+	UnlockWrite() error
+}
+
+// Take the write lock of a store
+func lockWrite(lock StoreLock) error {
+	if l, ok := lock.(WriteLocker); ok {
+		return l.LockWrite()
+	}
+	lock.Lock()
+	return nil
+}
+
+// Release the write lock of a store, the error of saving the writes is
+// returned in err if the write itself did not fail
+func unlockWrite(lock StoreLock, err *error) {
+	l, ok := lock.(WriteLocker)
+	if !ok {
+		lock.Unlock()
+		return
+	}
+	if saveErr := l.UnlockWrite(); *err == nil {
+		*err = saveErr
+	}
+}
+
 type SQLiteDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 
 	info  Info
@@ -24,6 +65,11 @@ type SQLiteDB struct {
 	txs   Txs
 	utxos UTXOs
 	stxos STXOs
+
+	assets       Assets
+	payees       Payees
+	misbehaviors Misbehaviors
+	appData      AppData
 }
 
 func NewSQLiteDB() (*SQLiteDB, error) {
@@ -32,9 +78,32 @@ func NewSQLiteDB() (*SQLiteDB, error) {
 		fmt.Println("Open sqlite db error:", err)
 		return nil, err
 	}
-	// Use the same lock
-	lock := new(sync.RWMutex)
+	// Write ahead log mode, so readers like transaction iterators read
+	// from a snapshot without blocking writers
+	_, err = db.Exec("PRAGMA journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	return newSQLiteDB(db, new(sync.RWMutex))
+}
+
+// Create a wallet database in memory for the ephemeral mode,
+// all data is lost when the database is closed
+func NewMemSQLiteDB() (*SQLiteDB, error) {
+	return newMemSQLiteDB(new(sync.RWMutex))
+}
 
+func newMemSQLiteDB(lock StoreLock) (*SQLiteDB, error) {
+	db, err := OpenMemoryDB("spvwallet")
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteDB(db, lock)
+}
+
+// Create the stores of the database, they use the same lock
+func newSQLiteDB(db *sql.DB, lock StoreLock) (*SQLiteDB, error) {
 	// Create info db
 	infoDB, err := NewInfoDB(db, lock)
 	if err != nil {
@@ -61,15 +130,41 @@ func NewSQLiteDB() (*SQLiteDB, error) {
 		return nil, err
 	}
 
+	// Create assets db
+	assetsDB, err := NewAssetsDB(db, lock)
+	if err != nil {
+		return nil, err
+	}
+	// Create payees db
+	payeesDB, err := NewPayeesDB(db, lock)
+	if err != nil {
+		return nil, err
+	}
+	// Create misbehaviors db
+	misbehaviorsDB, err := NewMisbehaviorsDB(db, lock)
+	if err != nil {
+		return nil, err
+	}
+	// Create app data db
+	appDataDB, err := NewAppDataDB(db, lock)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SQLiteDB{
-		RWMutex: lock,
-		DB:      db,
+		StoreLock: lock,
+		DB:        db,
 
 		info:  infoDB,
 		addrs: addrsDB,
 		utxos: utxosDB,
 		stxos: stxosDB,
 		txs:   txnsDB,
+
+		assets:       assetsDB,
+		payees:       payeesDB,
+		misbehaviors: misbehaviorsDB,
+		appData:      appDataDB,
 	}, nil
 }
 
@@ -93,9 +188,27 @@ func (db *SQLiteDB) STXOs() STXOs {
 	return db.stxos
 }
 
-func (db *SQLiteDB) Rollback(height uint32) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *SQLiteDB) Assets() Assets {
+	return db.assets
+}
+
+func (db *SQLiteDB) Payees() Payees {
+	return db.payees
+}
+
+func (db *SQLiteDB) Misbehaviors() Misbehaviors {
+	return db.misbehaviors
+}
+
+func (db *SQLiteDB) AppData() AppData {
+	return db.appData
+}
+
+func (db *SQLiteDB) Rollback(height uint32) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -109,8 +222,8 @@ func (db *SQLiteDB) Rollback(height uint32) error {
 	}
 
 	// Rollback STXOs, move UTXOs back first, then delete the STXOs
-	_, err = tx.Exec(`INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash)
-						SELECT OutPoint, Value, LockTime, AtHeight, ScriptHash FROM STXOs WHERE SpendHeight=?`, height)
+	_, err = tx.Exec(`INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID)
+						SELECT OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID FROM STXOs WHERE SpendHeight=?`, height)
 	if err != nil {
 		return err
 	}
@@ -125,20 +238,163 @@ func (db *SQLiteDB) Rollback(height uint32) error {
 		return err
 	}
 
+	// Rollback assets registered in the block
+	_, err = tx.Exec("DELETE FROM Assets WHERE Height=?", height)
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+func (db *SQLiteDB) ExpireTxs(before time.Time) (_ []Uint256, err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return nil, err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	rows, err := db.Query("SELECT Hash FROM TXNs WHERE Height=0 AND Timestamp<?", before.Unix())
+	if err != nil {
+		return nil, err
+	}
+	var txIds []Uint256
+	for rows.Next() {
+		var hashBytes []byte
+		err = rows.Scan(&hashBytes)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		txId, err := Uint256FromBytes(hashBytes)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		txIds = append(txIds, *txId)
+	}
+	rows.Close()
+
+	if len(txIds) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Unconfirmed transactions spending the outputs of an expired transaction
+	// can not be confirmed either, expire them too
+	expired := make(map[Uint256]bool, len(txIds))
+	for _, txId := range txIds {
+		expired[txId] = true
+	}
+	for i := 0; i < len(txIds); i++ {
+		children, err := spendingTxs(tx, txIds[i])
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		for _, child := range children {
+			if !expired[child] {
+				expired[child] = true
+				txIds = append(txIds, child)
+			}
+		}
+	}
+
+	for _, txId := range txIds {
+		// Move the UTXOs spent by the transaction back, then delete the STXOs
+		_, err = tx.Exec(`INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID)
+						SELECT OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID FROM STXOs
+						WHERE SpendHash=? AND SpendHeight=0`, txId.Bytes())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		_, err = tx.Exec("DELETE FROM STXOs WHERE SpendHash=? AND SpendHeight=0", txId.Bytes())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		// Delete the outputs of the transaction, the first 32 bytes of
+		// a serialized OutPoint is the transaction id
+		_, err = tx.Exec("DELETE FROM UTXOs WHERE substr(OutPoint,1,32)=? AND AtHeight=0", txId.Bytes())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		_, err = tx.Exec("DELETE FROM STXOs WHERE substr(OutPoint,1,32)=? AND AtHeight=0", txId.Bytes())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		_, err = tx.Exec("DELETE FROM TXNs WHERE Hash=? AND Height=0", txId.Bytes())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return txIds, tx.Commit()
+}
+
+// Get the unconfirmed transactions spending the outputs of the transaction
+func spendingTxs(tx *sql.Tx, txId Uint256) ([]Uint256, error) {
+	rows, err := tx.Query(`SELECT DISTINCT SpendHash FROM STXOs
+					WHERE substr(OutPoint,1,32)=? AND SpendHeight=0`, txId.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txIds []Uint256
+	for rows.Next() {
+		var hashBytes []byte
+		err = rows.Scan(&hashBytes)
+		if err != nil {
+			return nil, err
+		}
+		spendHash, err := Uint256FromBytes(hashBytes)
+		if err != nil {
+			return nil, err
+		}
+		txIds = append(txIds, *spendHash)
+	}
+	return txIds, rows.Err()
+}
+
+func (db *SQLiteDB) ClearOutputs() (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
+
+	_, err = db.Exec(`DELETE FROM UTXOs;
+						DELETE FROM STXOs;
+						DELETE FROM Assets;`)
+	return err
+}
+
 func (db *SQLiteDB) Reset() error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	// Drop all tables except Addrs
-	_, err = tx.Exec(`DROP TABLE IF EXISTS Info;
-							DROP TABLE IF EXISTS UTXOs;
+	// Drop all tables except Addrs, Payees and AppData
+	_, err = tx.Exec(`DROP TABLE IF EXISTS UTXOs;
 							DROP TABLE IF EXISTS STXOs;
-							DROP TABLE IF EXISTS TXNs;`)
+							DROP TABLE IF EXISTS TXNs;
+							DROP TABLE IF EXISTS Assets;`)
+	if err != nil {
+		return err
+	}
+	// Clear the info except the version of the kept Addrs table, so it is not
+	// upgraded again
+	_, err = tx.Exec("DELETE FROM Info WHERE Key<>?", AddrsVersionKey)
 	if err != nil {
 		return err
 	}
@@ -146,6 +402,40 @@ func (db *SQLiteDB) Reset() error {
 	return tx.Commit()
 }
 
+// Add a column to the table if it's not exist, this is used to
+// upgrade tables that created by earlier versions.
+func addColumnIfNotExists(db *sql.DB, table, column, define string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		fields := make([]sql.RawBytes, len(columns))
+		for i := range fields {
+			values[i] = &fields[i]
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return err
+		}
+		// The second field of table_info is the column name
+		if string(fields[1]) == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + define)
+	return err
+}
+
 func (db *SQLiteDB) Close() {
 	db.Lock()
 	db.DB.Close()
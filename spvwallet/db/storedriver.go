@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Driver opens the stores of a storage backend. The headers store keeps the block
+// headers, the data store keeps the addresses, transactions, UTXOs, STXOs and the
+// state values of the Info store. Register a driver by RegisterDriver() in the init
+// function of its package, then select it by name in the StoreDriver config.
+type Driver interface {
+	// Open the headers store
+	OpenHeaders(options *Options) (Headers, error)
+
+	// Open the wallet data store
+	OpenDataStore(options *Options) (DataStore, error)
+}
+
+// Options passed to the driver when opening the stores
+type Options struct {
+	// Keep only every HeaderPruneInterval full headers, 0 means do not prune,
+	// drivers not supporting pruning ignore it
+	HeaderPruneInterval uint32
+	// Encrypt the wallet data at rest with the passphrase, nil means not encrypted,
+	// drivers not supporting encryption refuse it
+	Passphrase []byte
+}
+
+var (
+	driversLock sync.RWMutex
+	drivers     = make(map[string]Driver)
+)
+
+func init() {
+	RegisterDriver("bolt", &sqliteDriver{openHeaders: func(options *Options) (Headers, error) {
+		return newHeadersDB(options.HeaderPruneInterval)
+	}})
+	RegisterDriver("badger", &sqliteDriver{openHeaders: func(options *Options) (Headers, error) {
+		return NewBadgerHeadersDB()
+	}})
+	RegisterDriver("leveldb", &sqliteDriver{openHeaders: func(options *Options) (Headers, error) {
+		return NewLevelDBHeadersDB()
+	}})
+	RegisterDriver("memory", &sqliteDriver{memory: true, openHeaders: func(options *Options) (Headers, error) {
+		return NewMemHeadersDB(), nil
+	}})
+}
+
+// Make a storage driver available by the name, like sql.Register(), it panics
+// if the driver is nil or a driver is already registered by the name
+func RegisterDriver(name string, driver Driver) {
+	driversLock.Lock()
+	defer driversLock.Unlock()
+
+	if driver == nil {
+		panic("db: register driver is nil")
+	}
+	if _, ok := drivers[name]; ok {
+		panic("db: register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Get the storage driver registered by the name
+func GetDriver(name string) (Driver, error) {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, errors.New("unknown storage driver " + name)
+	}
+	return driver, nil
+}
+
+// Get the sorted names of the registered storage drivers
+func Drivers() []string {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The built-in drivers keep the wallet data in sqlite, and the headers
+// in the store of their own, tuned for header writes
+type sqliteDriver struct {
+	openHeaders func(options *Options) (Headers, error)
+	// Keep the wallet data in memory, all data is lost on close
+	memory bool
+}
+
+func (d *sqliteDriver) OpenHeaders(options *Options) (Headers, error) {
+	return d.openHeaders(options)
+}
+
+func (d *sqliteDriver) OpenDataStore(options *Options) (DataStore, error) {
+	var db DataStore
+	var err error
+	switch {
+	case d.memory:
+		// Nothing is written to disk, no need to encrypt
+		db, err = NewMemSQLiteDB()
+	case options.Passphrase != nil:
+		db, err = NewEncryptedSQLiteDB(options.Passphrase)
+	default:
+		db, err = NewSQLiteDB()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"database/sql"
-	"sync"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	. "github.com/elastos/Elastos.ELA/core"
@@ -15,35 +14,43 @@ const CreateSTXOsDB = `CREATE TABLE IF NOT EXISTS STXOs(
 				AtHeight INTEGER NOT NULL,
 				SpendHash BLOB NOT NULL,
 				SpendHeight INTEGER NOT NULL,
-				ScriptHash BLOB NOT NULL
+				ScriptHash BLOB NOT NULL,
+				AssetID BLOB
 			);`
 
 type STXOsDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 }
 
-func NewSTXOsDB(db *sql.DB, lock *sync.RWMutex) (STXOs, error) {
+func NewSTXOsDB(db *sql.DB, lock StoreLock) (STXOs, error) {
 	_, err := db.Exec(CreateSTXOsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &STXOsDB{RWMutex: lock, DB: db}, nil
+	// STXOs table created by earlier versions do not have the AssetID column
+	err = addColumnIfNotExists(db, "STXOs", "AssetID", "BLOB")
+	if err != nil {
+		return nil, err
+	}
+	return &STXOsDB{StoreLock: lock, DB: db}, nil
 }
 
 // Move a UTXO to STXO
-func (db *STXOsDB) FromUTXO(outPoint *OutPoint, spendTxId *Uint256, spendHeight uint32) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *STXOsDB) FromUTXO(outPoint *OutPoint, spendTxId *Uint256, spendHeight uint32) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	sql := `INSERT OR REPLACE INTO STXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash, SpendHash, SpendHeight)
-			SELECT UTXOs.OutPoint, UTXOs.Value, UTXOs.LockTime, UTXOs.AtHeight, UTXOs.ScriptHash, ?, ? FROM UTXOs
-			WHERE OutPoint=?`
+	sql := `INSERT OR REPLACE INTO STXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID, SpendHash, SpendHeight)
+			SELECT UTXOs.OutPoint, UTXOs.Value, UTXOs.LockTime, UTXOs.AtHeight, UTXOs.ScriptHash, UTXOs.AssetID, ?, ?
+			FROM UTXOs WHERE OutPoint=?`
 	_, err = tx.Exec(sql, spendTxId.Bytes(), spendHeight, outPoint.Bytes())
 	if err != nil {
 		return err
@@ -62,14 +69,15 @@ func (db *STXOsDB) Get(outPoint *OutPoint) (*STXO, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	sql := `SELECT Value, LockTime, AtHeight, SpendHash, SpendHeight FROM STXOs WHERE OutPoint=?`
+	sql := `SELECT Value, LockTime, AtHeight, AssetID, SpendHash, SpendHeight FROM STXOs WHERE OutPoint=?`
 	row := db.QueryRow(sql, outPoint.Bytes())
 	var valueBytes []byte
 	var lockTime uint32
 	var atHeight uint32
+	var assetIDBytes []byte
 	var spendHashBytes []byte
 	var spendHeight uint32
-	err := row.Scan(&valueBytes, &lockTime, &atHeight, &spendHashBytes, &spendHeight)
+	err := row.Scan(&valueBytes, &lockTime, &atHeight, &assetIDBytes, &spendHashBytes, &spendHeight)
 	if err != nil {
 		return nil, err
 	}
@@ -79,8 +87,12 @@ func (db *STXOsDB) Get(outPoint *OutPoint) (*STXO, error) {
 	if err != nil {
 		return nil, err
 	}
+	assetID, err := assetIDFromBytes(assetIDBytes)
+	if err != nil {
+		return nil, err
+	}
 
-	var utxo = UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight}
+	var utxo = UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight, AssetID: assetID}
 	spendHash, err := Uint256FromBytes(spendHashBytes)
 	if err != nil {
 		return nil, err
@@ -94,7 +106,7 @@ func (db *STXOsDB) GetAddrAll(hash *Uint168) ([]*STXO, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	sql := "SELECT OutPoint, Value, LockTime, AtHeight, SpendHash, SpendHeight FROM STXOs WHERE ScriptHash=?"
+	sql := "SELECT OutPoint, Value, LockTime, AtHeight, AssetID, SpendHash, SpendHeight FROM STXOs WHERE ScriptHash=?"
 	rows, err := db.Query(sql, hash.Bytes())
 	if err != nil {
 		return []*STXO{}, err
@@ -108,7 +120,7 @@ func (db *STXOsDB) GetAll() ([]*STXO, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	rows, err := db.Query("SELECT OutPoint, Value, LockTime, AtHeight, SpendHash, SpendHeight FROM STXOs")
+	rows, err := db.Query("SELECT OutPoint, Value, LockTime, AtHeight, AssetID, SpendHash, SpendHeight FROM STXOs")
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +138,8 @@ func (db *STXOsDB) getSTXOs(rows *sql.Rows) ([]*STXO, error) {
 		var atHeight uint32
 		var spendHashBytes []byte
 		var spendHeight uint32
-		err := rows.Scan(&opBytes, &valueBytes, &lockTime, &atHeight, &spendHashBytes, &spendHeight)
+		var assetIDBytes []byte
+		err := rows.Scan(&opBytes, &valueBytes, &lockTime, &atHeight, &assetIDBytes, &spendHashBytes, &spendHeight)
 		if err != nil {
 			return stxos, err
 		}
@@ -140,7 +153,11 @@ func (db *STXOsDB) getSTXOs(rows *sql.Rows) ([]*STXO, error) {
 		if err != nil {
 			return stxos, err
 		}
-		var utxo = UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight}
+		assetID, err := assetIDFromBytes(assetIDBytes)
+		if err != nil {
+			return stxos, err
+		}
+		var utxo = UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight, AssetID: assetID}
 		spendHash, err := Uint256FromBytes(spendHashBytes)
 		if err != nil {
 			return stxos, err
@@ -153,11 +170,13 @@ func (db *STXOsDB) getSTXOs(rows *sql.Rows) ([]*STXO, error) {
 }
 
 // delete a stxo from database
-func (db *STXOsDB) Delete(outPoint *OutPoint) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *STXOsDB) Delete(outPoint *OutPoint) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	_, err := db.Exec("DELETE FROM STXOs WHERE OutPoint=?", outPoint.Bytes())
+	_, err = db.Exec("DELETE FROM STXOs WHERE OutPoint=?", outPoint.Bytes())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// TxNode is an unconfirmed transaction in the dependency graph
+type TxNode struct {
+	TxId Uint256
+	Size uint32
+	// Fee is nil if the value of any input is unknown
+	Fee *Fixed64
+	// Unconfirmed transactions spent by this transaction
+	Parents []Uint256
+	// Unconfirmed transactions spending this transaction
+	Children []Uint256
+	// The length of the longest unconfirmed ancestors chain, 0 if all parents are confirmed
+	Depth int
+	// Total fees and size of all unconfirmed descendants, unknown fees are not counted
+	DescendantFees Fixed64
+	DescendantSize uint32
+	// Total fees and size of this transaction and all unconfirmed ancestors,
+	// they must be confirmed together with this transaction
+	PackageFees Fixed64
+	PackageSize uint32
+}
+
+// The fee rate of the package in sela per KB
+func (node *TxNode) PackageFeeRate() sdk.FeeRate {
+	return sdk.FeeRateOf(sdk.AmountOf(node.PackageFees), int(node.PackageSize))
+}
+
+// TxGraph shows which unconfirmed transaction spends which in the wallet
+type TxGraph struct {
+	nodes map[Uint256]*TxNode
+}
+
+// Build the dependency graph of the unconfirmed transactions in txs,
+// confirmed transactions are used to find the input values.
+func NewTxGraph(txs []*db.StoreTx) *TxGraph {
+	graph := &TxGraph{nodes: make(map[Uint256]*TxNode)}
+
+	all := make(map[Uint256]*db.StoreTx, len(txs))
+	for _, tx := range txs {
+		all[tx.TxId] = tx
+		if tx.Height == 0 {
+			graph.nodes[tx.TxId] = &TxNode{TxId: tx.TxId, Size: uint32(tx.Data.GetSize())}
+		}
+	}
+
+	for txId, node := range graph.nodes {
+		tx := all[txId]
+		var input, output Fixed64
+		feeKnown := true
+		for _, in := range tx.Data.Inputs {
+			prevId := in.Previous.TxID
+			if parent, ok := graph.nodes[prevId]; ok && !containsTx(node.Parents, prevId) {
+				node.Parents = append(node.Parents, prevId)
+				parent.Children = append(parent.Children, txId)
+			}
+			prev, ok := all[prevId]
+			if !ok || int(in.Previous.Index) >= len(prev.Data.Outputs) {
+				feeKnown = false
+				continue
+			}
+			input += prev.Data.Outputs[in.Previous.Index].Value
+		}
+		for _, out := range tx.Data.Outputs {
+			output += out.Value
+		}
+		if feeKnown && len(tx.Data.Inputs) > 0 {
+			fee := input - output
+			node.Fee = &fee
+		}
+	}
+
+	depths := make(map[Uint256]int)
+	for txId, node := range graph.nodes {
+		node.Depth = graph.depth(txId, depths)
+
+		for _, ancestor := range graph.Ancestors(txId) {
+			node.PackageFees += graph.nodes[ancestor].fee()
+			node.PackageSize += graph.nodes[ancestor].Size
+		}
+		node.PackageFees += node.fee()
+		node.PackageSize += node.Size
+
+		for _, descendant := range graph.Descendants(txId) {
+			node.DescendantFees += graph.nodes[descendant].fee()
+			node.DescendantSize += graph.nodes[descendant].Size
+		}
+	}
+
+	return graph
+}
+
+// Get the node of an unconfirmed transaction, nil if it is not in the graph
+func (graph *TxGraph) Get(txId Uint256) *TxNode {
+	return graph.nodes[txId]
+}
+
+// Get all nodes ordered by depth, parents are always before their children
+func (graph *TxGraph) Nodes() []*TxNode {
+	nodes := make([]*TxNode, 0, len(graph.nodes))
+	for _, node := range graph.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Depth < nodes[j].Depth
+	})
+	return nodes
+}
+
+// Get all unconfirmed transactions the given transaction depends on
+func (graph *TxGraph) Ancestors(txId Uint256) []Uint256 {
+	return graph.walk(txId, func(node *TxNode) []Uint256 { return node.Parents })
+}
+
+// Get all unconfirmed transactions depending on the given transaction
+func (graph *TxGraph) Descendants(txId Uint256) []Uint256 {
+	return graph.walk(txId, func(node *TxNode) []Uint256 { return node.Children })
+}
+
+func (graph *TxGraph) walk(txId Uint256, next func(node *TxNode) []Uint256) []Uint256 {
+	node, ok := graph.nodes[txId]
+	if !ok {
+		return nil
+	}
+
+	visited := make(map[Uint256]bool)
+	var result []Uint256
+	queue := next(node)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		result = append(result, id)
+		queue = append(queue, next(graph.nodes[id])...)
+	}
+	return result
+}
+
+func (graph *TxGraph) depth(txId Uint256, depths map[Uint256]int) int {
+	if depth, ok := depths[txId]; ok {
+		return depth
+	}
+	depth := 0
+	for _, parent := range graph.nodes[txId].Parents {
+		if d := graph.depth(parent, depths) + 1; d > depth {
+			depth = d
+		}
+	}
+	depths[txId] = depth
+	return depth
+}
+
+func (node *TxNode) fee() Fixed64 {
+	if node.Fee == nil {
+		return 0
+	}
+	return *node.Fee
+}
+
+func containsTx(txIds []Uint256, txId Uint256) bool {
+	for _, id := range txIds {
+		if id == txId {
+			return true
+		}
+	}
+	return false
+}
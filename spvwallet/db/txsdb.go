@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"math"
-	"sync"
+	"time"
 
 	"github.com/elastos/Elastos.ELA.SPV/db"
 
@@ -15,35 +15,53 @@ import (
 const CreateTXNDB = `CREATE TABLE IF NOT EXISTS TXNs(
 				Hash BLOB NOT NULL PRIMARY KEY,
 				Height INTEGER NOT NULL,
-				RawData BLOB NOT NULL
+				RawData BLOB NOT NULL,
+				Timestamp INTEGER NOT NULL DEFAULT 0
 			);`
 
 type TxsDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 }
 
-func NewTxsDB(db *sql.DB, lock *sync.RWMutex) (Txs, error) {
+func NewTxsDB(db *sql.DB, lock StoreLock) (Txs, error) {
 	_, err := db.Exec(CreateTXNDB)
 	if err != nil {
 		return nil, err
 	}
-	return &TxsDB{RWMutex: lock, DB: db}, nil
+	// TXNs table created by earlier versions do not have the Timestamp column
+	err = addColumnIfNotExists(db, "TXNs", "Timestamp", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, err
+	}
+	// The receive time of their transactions is unknown, count it from now
+	// on, so they are not expired at once
+	_, err = db.Exec("UPDATE TXNs SET Timestamp=? WHERE Timestamp=0", time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	return &TxsDB{StoreLock: lock, DB: db}, nil
 }
 
 // Put a new transaction to database
-func (t *TxsDB) Put(storeTx *db.StoreTx) error {
-	t.Lock()
-	defer t.Unlock()
+func (t *TxsDB) Put(storeTx *db.StoreTx) (err error) {
+	if err := lockWrite(t.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(t.StoreLock, &err)
 
 	buf := new(bytes.Buffer)
-	err := storeTx.Data.SerializeUnsigned(buf)
+	err = storeTx.Data.SerializeUnsigned(buf)
 	if err != nil {
 		return err
 	}
 
-	sql := `INSERT OR REPLACE INTO TXNs(Hash, Height, RawData) VALUES(?,?,?)`
-	_, err = t.Exec(sql, storeTx.TxId.Bytes(), storeTx.Height, buf.Bytes())
+	// Use the block timestamp for confirmed transactions, otherwise
+	// keep the timestamp when the transaction was first received
+	sql := `INSERT OR REPLACE INTO TXNs(Hash, Height, RawData, Timestamp) VALUES(?,?,?,
+				COALESCE(NULLIF(?,0), (SELECT Timestamp FROM TXNs WHERE Hash=?), ?))`
+	_, err = t.Exec(sql, storeTx.TxId.Bytes(), storeTx.Height, buf.Bytes(),
+		storeTx.Timestamp, storeTx.TxId.Bytes(), time.Now().Unix())
 	if err != nil {
 		return err
 	}
@@ -56,10 +74,11 @@ func (t *TxsDB) Get(txId *Uint256) (*db.StoreTx, error) {
 	t.RLock()
 	defer t.RUnlock()
 
-	row := t.QueryRow(`SELECT Height, RawData FROM TXNs WHERE Hash=?`, txId.Bytes())
+	row := t.QueryRow(`SELECT Height, RawData, Timestamp FROM TXNs WHERE Hash=?`, txId.Bytes())
 	var height uint32
 	var rawData []byte
-	err := row.Scan(&height, &rawData)
+	var timestamp uint32
+	err := row.Scan(&height, &rawData, &timestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +88,7 @@ func (t *TxsDB) Get(txId *Uint256) (*db.StoreTx, error) {
 		return nil, err
 	}
 
-	return &db.StoreTx{TxId: *txId, Height: height, Data: tx}, nil
+	return &db.StoreTx{TxId: *txId, Height: height, Timestamp: timestamp, Data: tx}, nil
 }
 
 // Fetch all transactions from database
@@ -82,7 +101,7 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 	t.RLock()
 	defer t.RUnlock()
 
-	sql := "SELECT Hash, Height, RawData FROM TXNs"
+	sql := "SELECT Hash, Height, RawData, Timestamp FROM TXNs"
 	if height != math.MaxUint32 {
 		sql += " WHERE Height=?"
 	}
@@ -97,7 +116,8 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 		var txIdBytes []byte
 		var height uint32
 		var rawData []byte
-		err := rows.Scan(&txIdBytes, &height, &rawData)
+		var timestamp uint32
+		err := rows.Scan(&txIdBytes, &height, &rawData, &timestamp)
 		if err != nil {
 			return txns, err
 		}
@@ -113,18 +133,38 @@ func (t *TxsDB) GetAllFrom(height uint32) ([]*db.StoreTx, error) {
 			return nil, err
 		}
 
-		txns = append(txns, &db.StoreTx{TxId: *txId, Height: height, Data: tx})
+		txns = append(txns, &db.StoreTx{TxId: *txId, Height: height, Timestamp: timestamp, Data: tx})
 	}
 
 	return txns, nil
 }
 
+// Iterate confirmed transactions from the given height in a read transaction,
+// the table is not locked, so it does not block the sync
+func (t *TxsDB) Iterate(height uint32) (*TxIterator, error) {
+	tx, err := t.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT Hash, Height, RawData, Timestamp FROM TXNs
+			WHERE Height>=? AND Height>0 ORDER BY Height`, height)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &TxIterator{tx: tx, rows: rows}, nil
+}
+
 // Update the height of a transaction
-func (t *TxsDB) UpdateHeight(txId *Uint256, height uint32) error {
-	t.Lock()
-	defer t.Unlock()
+func (t *TxsDB) UpdateHeight(txId *Uint256, height uint32) (err error) {
+	if err := lockWrite(t.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(t.StoreLock, &err)
 
-	_, err := t.Exec("UPDATE TXNs SET Height=? WHERE Hash=?", height, txId.Bytes())
+	_, err = t.Exec("UPDATE TXNs SET Height=? WHERE Hash=?", height, txId.Bytes())
 	if err != nil {
 		return err
 	}
@@ -133,11 +173,13 @@ func (t *TxsDB) UpdateHeight(txId *Uint256, height uint32) error {
 }
 
 // Delete a transaction from the db
-func (t *TxsDB) Delete(txId *Uint256) error {
-	t.Lock()
-	defer t.Unlock()
+func (t *TxsDB) Delete(txId *Uint256) (err error) {
+	if err := lockWrite(t.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(t.StoreLock, &err)
 
-	_, err := t.Exec("DELETE FROM TXNs WHERE Hash=?", txId.Bytes())
+	_, err = t.Exec("DELETE FROM TXNs WHERE Hash=?", txId.Bytes())
 	if err != nil {
 		return err
 	}
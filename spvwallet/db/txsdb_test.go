@@ -0,0 +1,125 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestTxsTimestampMigration(t *testing.T) {
+	sqlDB, err := OpenMemoryDB("txsmigration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	// The TXNs table of earlier versions has no Timestamp column
+	_, err = sqlDB.Exec(`CREATE TABLE TXNs(
+				Hash BLOB NOT NULL PRIMARY KEY,
+				Height INTEGER NOT NULL,
+				RawData BLOB NOT NULL
+			);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txId := Uint256{1}
+	_, err = sqlDB.Exec("INSERT INTO TXNs(Hash, Height, RawData) VALUES(?,0,?)", txId.Bytes(), []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Unix()
+	if _, err := NewTxsDB(sqlDB, new(sync.RWMutex)); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	var timestamp int64
+	err = sqlDB.QueryRow("SELECT Timestamp FROM TXNs WHERE Hash=?", txId.Bytes()).Scan(&timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp < before {
+		t.Errorf("migrated timestamp %d, want the migration time %d or later", timestamp, before)
+	}
+}
+
+func TestExpireTxsChildren(t *testing.T) {
+	parent, child, grandchild := Uint256{1}, Uint256{2}, Uint256{3}
+
+	tests := []struct {
+		name      string
+		parentAge time.Duration
+		expired   []Uint256
+		utxos     int
+	}{
+		{"parent not expired", 0, nil, 1},
+		{"parent expired with its children", 2 * time.Hour, []Uint256{parent, child, grandchild}, 0},
+	}
+
+	for _, test := range tests {
+		store, err := NewMemSQLiteDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		received := map[Uint256]time.Time{
+			parent:     now.Add(-test.parentAge),
+			child:      now,
+			grandchild: now,
+		}
+		for txId, at := range received {
+			_, err = store.Exec("INSERT INTO TXNs(Hash, Height, RawData, Timestamp) VALUES(?,0,?,?)",
+				txId.Bytes(), []byte{0}, at.Unix())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The child spends the parent output, the grandchild spends the child output
+		spends := []struct {
+			op    OutPoint
+			spend Uint256
+		}{
+			{OutPoint{TxID: parent, Index: 0}, child},
+			{OutPoint{TxID: child, Index: 0}, grandchild},
+		}
+		for _, s := range spends {
+			_, err = store.Exec(`INSERT INTO STXOs(OutPoint, Value, LockTime, AtHeight, SpendHash, SpendHeight, ScriptHash)
+					VALUES(?,?,0,0,?,0,?)`, s.op.Bytes(), []byte{0}, s.spend.Bytes(), []byte{0})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		grandchildOutput := OutPoint{TxID: grandchild, Index: 0}
+		_, err = store.Exec(`INSERT INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash)
+				VALUES(?,?,0,0,?)`, grandchildOutput.Bytes(), []byte{0}, []byte{0})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txIds, err := store.ExpireTxs(now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("%s: expire failed: %v", test.name, err)
+		}
+		if len(txIds) != len(test.expired) {
+			t.Fatalf("%s: expired %d transactions, want %d", test.name, len(txIds), len(test.expired))
+		}
+		for i, txId := range test.expired {
+			if !txIds[i].IsEqual(txId) {
+				t.Errorf("%s: expired %s at %d, want %s", test.name, txIds[i].String(), i, txId.String())
+			}
+		}
+
+		var utxos int
+		err = store.QueryRow("SELECT COUNT(*) FROM UTXOs").Scan(&utxos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if utxos != test.utxos {
+			t.Errorf("%s: %d UTXOs left, want %d", test.name, utxos, test.utxos)
+		}
+		store.Close()
+	}
+}
@@ -20,6 +20,33 @@ type UTXO struct {
 
 	// Block height where this tx was confirmed, 0 for unconfirmed
 	AtHeight uint32
+
+	// The asset of the output, empty for the system asset ELA
+	AssetID Uint256
+}
+
+// Check if the output is of the system asset ELA
+func (utxo *UTXO) IsSystemAsset() bool {
+	return utxo.AssetID == Uint256{}
+}
+
+// The system asset is stored as NULL, so rows created by earlier versions are ELA
+func assetIDBytes(assetID Uint256) []byte {
+	if assetID == (Uint256{}) {
+		return nil
+	}
+	return assetID.Bytes()
+}
+
+func assetIDFromBytes(b []byte) (Uint256, error) {
+	if len(b) == 0 {
+		return Uint256{}, nil
+	}
+	assetID, err := Uint256FromBytes(b)
+	if err != nil {
+		return Uint256{}, err
+	}
+	return *assetID, nil
 }
 
 func (utxo *UTXO) String() string {
@@ -2,7 +2,6 @@ package db
 
 import (
 	"database/sql"
-	"sync"
 
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	. "github.com/elastos/Elastos.ELA/core"
@@ -13,33 +12,42 @@ const CreateUTXOsDB = `CREATE TABLE IF NOT EXISTS UTXOs(
 				Value BLOB NOT NULL,
 				LockTime INTEGER NOT NULL,
 				AtHeight INTEGER NOT NULL,
-				ScriptHash BLOB NOT NULL
+				ScriptHash BLOB NOT NULL,
+				AssetID BLOB
 			);`
 
 type UTXOsDB struct {
-	*sync.RWMutex
+	StoreLock
 	*sql.DB
 }
 
-func NewUTXOsDB(db *sql.DB, lock *sync.RWMutex) (UTXOs, error) {
+func NewUTXOsDB(db *sql.DB, lock StoreLock) (UTXOs, error) {
 	_, err := db.Exec(CreateUTXOsDB)
 	if err != nil {
 		return nil, err
 	}
-	return &UTXOsDB{RWMutex: lock, DB: db}, nil
+	// UTXOs table created by earlier versions do not have the AssetID column
+	err = addColumnIfNotExists(db, "UTXOs", "AssetID", "BLOB")
+	if err != nil {
+		return nil, err
+	}
+	return &UTXOsDB{StoreLock: lock, DB: db}, nil
 }
 
 // put a utxo to database
-func (db *UTXOsDB) Put(hash *Uint168, utxo *UTXO) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *UTXOsDB) Put(hash *Uint168, utxo *UTXO) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
 	valueBytes, err := utxo.Value.Bytes()
 	if err != nil {
 		return err
 	}
-	sql := "INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash) VALUES(?,?,?,?,?)"
-	_, err = db.Exec(sql, utxo.Op.Bytes(), valueBytes, utxo.LockTime, utxo.AtHeight, hash.Bytes())
+	sql := "INSERT OR REPLACE INTO UTXOs(OutPoint, Value, LockTime, AtHeight, ScriptHash, AssetID) VALUES(?,?,?,?,?,?)"
+	_, err = db.Exec(sql, utxo.Op.Bytes(), valueBytes, utxo.LockTime, utxo.AtHeight, hash.Bytes(),
+		assetIDBytes(utxo.AssetID))
 	if err != nil {
 		return err
 	}
@@ -52,11 +60,12 @@ func (db *UTXOsDB) Get(outPoint *OutPoint) (*UTXO, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	row := db.QueryRow(`SELECT Value, LockTime, AtHeight FROM UTXOs WHERE OutPoint=?`, outPoint.Bytes())
+	row := db.QueryRow(`SELECT Value, LockTime, AtHeight, AssetID FROM UTXOs WHERE OutPoint=?`, outPoint.Bytes())
 	var valueBytes []byte
 	var lockTime uint32
 	var atHeight uint32
-	err := row.Scan(&valueBytes, &lockTime, &atHeight)
+	var assetIDBytes []byte
+	err := row.Scan(&valueBytes, &lockTime, &atHeight, &assetIDBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -66,8 +75,12 @@ func (db *UTXOsDB) Get(outPoint *OutPoint) (*UTXO, error) {
 	if err != nil {
 		return nil, err
 	}
+	assetID, err := assetIDFromBytes(assetIDBytes)
+	if err != nil {
+		return nil, err
+	}
 
-	return &UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight}, nil
+	return &UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight, AssetID: assetID}, nil
 }
 
 // get utxos of the given script hash from database
@@ -76,7 +89,7 @@ func (db *UTXOsDB) GetAddrAll(hash *Uint168) ([]*UTXO, error) {
 	defer db.RUnlock()
 
 	rows, err := db.Query(
-		"SELECT OutPoint, Value, LockTime, AtHeight FROM UTXOs WHERE ScriptHash=?", hash.Bytes())
+		"SELECT OutPoint, Value, LockTime, AtHeight, AssetID FROM UTXOs WHERE ScriptHash=?", hash.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +102,7 @@ func (db *UTXOsDB) GetAll() ([]*UTXO, error) {
 	db.RLock()
 	defer db.RUnlock()
 
-	rows, err := db.Query("SELECT OutPoint, Value, LockTime, AtHeight FROM UTXOs")
+	rows, err := db.Query("SELECT OutPoint, Value, LockTime, AtHeight, AssetID FROM UTXOs")
 	if err != nil {
 		return []*UTXO{}, err
 	}
@@ -105,7 +118,8 @@ func (db *UTXOsDB) getUTXOs(rows *sql.Rows) ([]*UTXO, error) {
 		var valueBytes []byte
 		var lockTime uint32
 		var atHeight uint32
-		err := rows.Scan(&opBytes, &valueBytes, &lockTime, &atHeight)
+		var assetIDBytes []byte
+		err := rows.Scan(&opBytes, &valueBytes, &lockTime, &atHeight, &assetIDBytes)
 		if err != nil {
 			return utxos, err
 		}
@@ -119,18 +133,25 @@ func (db *UTXOsDB) getUTXOs(rows *sql.Rows) ([]*UTXO, error) {
 		if err != nil {
 			return utxos, err
 		}
-		utxos = append(utxos, &UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight})
+		assetID, err := assetIDFromBytes(assetIDBytes)
+		if err != nil {
+			return utxos, err
+		}
+		utxos = append(utxos, &UTXO{Op: *outPoint, Value: *value, LockTime: lockTime, AtHeight: atHeight,
+			AssetID: assetID})
 	}
 
 	return utxos, nil
 }
 
 // delete a utxo from database
-func (db *UTXOsDB) Delete(outPoint *OutPoint) error {
-	db.Lock()
-	defer db.Unlock()
+func (db *UTXOsDB) Delete(outPoint *OutPoint) (err error) {
+	if err := lockWrite(db.StoreLock); err != nil {
+		return err
+	}
+	defer unlockWrite(db.StoreLock, &err)
 
-	_, err := db.Exec("DELETE FROM UTXOs WHERE OutPoint=?", outPoint.Bytes())
+	_, err = db.Exec("DELETE FROM UTXOs WHERE OutPoint=?", outPoint.Bytes())
 	if err != nil {
 		return err
 	}
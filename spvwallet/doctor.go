@@ -0,0 +1,229 @@
+package spvwallet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	spvnet "github.com/elastos/Elastos.ELA.SPV/net"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/sdk/conformance"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+)
+
+const (
+	DoctorDialTimeout = time.Second * 5
+	// Nodes reject blocks more than two hours ahead of their clock
+	MaxClockSkew = time.Hour * 2
+	// Warn if free disk space is less than this
+	MinFreeSpace = 1 << 30
+)
+
+// Finding is the result of one self-test check
+type Finding struct {
+	Check  string
+	Passed bool
+	Detail string
+	// What to do to fix the problem, empty if passed
+	Advice string
+}
+
+func (f *Finding) String() string {
+	status := "OK"
+	if !f.Passed {
+		status = "FAIL"
+	}
+	str := fmt.Sprintf("[%4s] %s: %s", status, f.Check, f.Detail)
+	if f.Advice != "" {
+		str += "\n       " + f.Advice
+	}
+	return str
+}
+
+// Doctor runs the self-test checks of seed resolution, outbound connectivity,
+// clock skew, store writability and disk space, most startup problems are one of them.
+func Doctor() []*Finding {
+	var findings []*Finding
+
+	seeds := config.Values().SeedList
+	if len(seeds) == 0 {
+		findings = append(findings, &Finding{
+			Check:  "seeds",
+			Detail: "no seeds in SeedList",
+			Advice: "add seed nodes as host:port to SeedList in " + config.ConfigFilename,
+		})
+	}
+	for _, seed := range seeds {
+		findings = append(findings, checkSeed(seed)...)
+	}
+
+	findings = append(findings, checkClockSkew())
+	findings = append(findings, checkStoreWritable())
+	findings = append(findings, checkDiskSpace())
+
+	return findings
+}
+
+// Run the protocol conformance checks against the nodes, the seeds in SeedList if
+// no node is given. Nodes are connected on the SPV server port like the wallet does.
+func Conformance(nodes []string) []*conformance.Report {
+	if len(nodes) == 0 {
+		nodes = config.Values().SeedList
+	}
+
+	cfg := &conformance.Config{Magic: config.Values().Magic}
+	if proxy := config.Values().Proxy; proxy.Addr != "" {
+		cfg.Proxy = &spvnet.Proxy{Addr: proxy.Addr, Username: proxy.Username, Password: proxy.Password}
+	}
+
+	reports := make([]*conformance.Report, 0, len(nodes))
+	for _, node := range nodes {
+		host, _, err := net.SplitHostPort(node)
+		if err != nil {
+			host = node
+		}
+		reports = append(reports, conformance.Run(net.JoinHostPort(host, fmt.Sprint(sdk.SPVServerPort)), cfg))
+	}
+	return reports
+}
+
+func checkSeed(seed string) []*Finding {
+	host, port, err := net.SplitHostPort(seed)
+	if err != nil {
+		return []*Finding{{
+			Check:  "seed " + seed,
+			Detail: err.Error(),
+			Advice: "seeds must be in host:port format",
+		}}
+	}
+
+	// Host names are resolved by the proxy, do not leak them to the local DNS
+	proxy := config.Values().Proxy
+	var findings []*Finding
+	if net.ParseIP(host) == nil && proxy.Addr == "" {
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			return append(findings, &Finding{
+				Check:  "resolve " + host,
+				Detail: err.Error(),
+				Advice: "check DNS settings, or use the seed IP address instead",
+			})
+		}
+		findings = append(findings, &Finding{
+			Check:  "resolve " + host,
+			Passed: true,
+			Detail: fmt.Sprint("resolved to ", ips),
+		})
+	}
+
+	var conn net.Conn
+	if proxy.Addr != "" {
+		conn, err = (&spvnet.Proxy{Addr: proxy.Addr, Username: proxy.Username, Password: proxy.Password}).
+			Dial(net.JoinHostPort(host, port), DoctorDialTimeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(host, port), DoctorDialTimeout)
+	}
+	if err != nil {
+		return append(findings, &Finding{
+			Check:  "connect " + seed,
+			Detail: err.Error(),
+			Advice: "check the seed is online and outbound connections to port " + port + " are allowed by firewall",
+		})
+	}
+	conn.Close()
+
+	return append(findings, &Finding{
+		Check:  "connect " + seed,
+		Passed: true,
+		Detail: "connected",
+	})
+}
+
+// Compare local clock with the time of the latest block in wallet,
+// a block time far ahead means the local clock is behind.
+func checkClockSkew() *Finding {
+	finding := &Finding{Check: "clock skew"}
+
+	database, err := GetDatabase()
+	if err != nil {
+		finding.Detail = "open wallet database failed, " + err.Error()
+		finding.Advice = "check the wallet database file " + db.DBName
+		return finding
+	}
+	txs, err := database.GetTxs()
+	if err != nil {
+		finding.Detail = "read wallet transactions failed, " + err.Error()
+		return finding
+	}
+
+	var latest uint32
+	for _, tx := range txs {
+		if tx.Height > 0 && tx.Timestamp > latest {
+			latest = tx.Timestamp
+		}
+	}
+	if latest == 0 {
+		finding.Passed = true
+		finding.Detail = "no block time in wallet to compare with, skipped"
+		return finding
+	}
+
+	skew := time.Unix(int64(latest), 0).Sub(time.Now())
+	if skew > MaxClockSkew {
+		finding.Detail = fmt.Sprint("local clock is at least ", skew.Truncate(time.Minute), " behind")
+		finding.Advice = "synchronize the system clock, for example enable NTP"
+		return finding
+	}
+
+	finding.Passed = true
+	finding.Detail = "local clock is not behind the latest block time"
+	return finding
+}
+
+// Check the working directory, where stores are created, is writable
+func checkStoreWritable() *Finding {
+	finding := &Finding{Check: "store writable"}
+
+	file, err := ioutil.TempFile(".", "doctor")
+	if err != nil {
+		finding.Detail = err.Error()
+		finding.Advice = "run the wallet in a directory writable by the current user"
+		return finding
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write([]byte("doctor"))
+	if err != nil {
+		finding.Detail = err.Error()
+		finding.Advice = "run the wallet in a directory writable by the current user"
+		return finding
+	}
+
+	finding.Passed = true
+	finding.Detail = "working directory is writable"
+	return finding
+}
+
+func checkDiskSpace() *Finding {
+	finding := &Finding{Check: "disk space"}
+
+	free, err := freeSpace(".")
+	if err != nil {
+		finding.Passed = true
+		finding.Detail = "can not get free disk space, " + err.Error() + ", skipped"
+		return finding
+	}
+	if free < MinFreeSpace {
+		finding.Detail = fmt.Sprint("only ", free>>20, "MB free")
+		finding.Advice = fmt.Sprint("free up at least ", MinFreeSpace>>20, "MB for the headers and wallet stores")
+		return finding
+	}
+
+	finding.Passed = true
+	finding.Detail = fmt.Sprint(free>>20, "MB free")
+	return finding
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package spvwallet
+
+import "errors"
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("not supported on windows")
+}
@@ -0,0 +1,369 @@
+package explorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+const (
+	// Number of recent transactions shown on the index page
+	RecentTxsCount = 20
+
+	// The explorer shows the wallet addresses and balances, it listens on
+	// the loopback interface if no host is given
+	DefaultHost = "127.0.0.1"
+)
+
+// DataSource is where the explorer gets data from, SPVWallet implements it
+type DataSource interface {
+	Blockchain() *sdk.Blockchain
+	PeerManager() *net.PeerManager
+	DataStore() db.DataStore
+	Stats() sdk.SyncStats
+	RuntimeStats() sdk.RuntimeStats
+}
+
+// Explorer is a minimal web UI showing sync status, recent wallet transactions,
+// connected peers, and transaction or address lookup
+type Explorer struct {
+	http.Server
+	source DataSource
+}
+
+func New(source DataSource, host string, port uint16) *Explorer {
+	explorer := &Explorer{source: source}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", explorer.index)
+	mux.HandleFunc("/tx", explorer.tx)
+	mux.HandleFunc("/address", explorer.address)
+	mux.HandleFunc("/pending", explorer.pending)
+	mux.HandleFunc("/api/peers", explorer.peers)
+	mux.HandleFunc("/api/runtime", explorer.runtime)
+	mux.HandleFunc("/metrics", explorer.metrics)
+
+	if host == "" {
+		host = DefaultHost
+	}
+	explorer.Server = http.Server{Addr: fmt.Sprint(host, ":", port), Handler: mux}
+	return explorer
+}
+
+func (explorer *Explorer) Start() {
+	go func() {
+		err := explorer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("Explorer start failed:", err)
+		}
+	}()
+	log.Info("Explorer started at", explorer.Addr)
+}
+
+type peerInfo struct {
+	ID     uint64
+	Addr   string
+	Height uint64
+	State  string
+}
+
+type txInfo struct {
+	TxId   string
+	Height uint32
+	Type   int
+}
+
+type outputInfo struct {
+	Address string
+	Value   string
+}
+
+func (explorer *Explorer) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	chain := explorer.source.Blockchain()
+	tip := chain.ChainTip()
+
+	var peers []peerInfo
+	for _, peer := range explorer.source.PeerManager().ConnectedPeers() {
+		peers = append(peers, peerInfo{
+			ID:     peer.ID(),
+			Addr:   peer.Addr().String(),
+			Height: peer.Height(),
+			State:  peer.PeerState.String(),
+		})
+	}
+
+	txs, err := explorer.source.DataStore().Txs().GetAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Unconfirmed transactions first, then from the highest
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Height == 0 || txs[j].Height == 0 {
+			return txs[i].Height == 0 && txs[j].Height != 0
+		}
+		return txs[i].Height > txs[j].Height
+	})
+	if len(txs) > RecentTxsCount {
+		txs = txs[:RecentTxsCount]
+	}
+	var recent []txInfo
+	for _, tx := range txs {
+		recent = append(recent, txInfo{
+			TxId:   tx.TxId.String(),
+			Height: tx.Height,
+			Type:   int(tx.Data.TxType),
+		})
+	}
+
+	explorer.render(w, indexTemplate, map[string]interface{}{
+		"Height":  chain.Height(),
+		"TipHash": tip.Hash().String(),
+		"Syncing": chain.IsSyncing(),
+		"Stats":   explorer.source.Stats(),
+		"Peers":   peers,
+		"Txs":     recent,
+	})
+}
+
+func (explorer *Explorer) tx(w http.ResponseWriter, r *http.Request) {
+	txId, err := sdk.ParseHash(r.URL.Query().Get("hash"))
+	if err != nil {
+		http.Error(w, "invalid transaction hash", http.StatusBadRequest)
+		return
+	}
+
+	storeTx, err := explorer.source.DataStore().Txs().Get(txId)
+	if err != nil {
+		http.Error(w, "transaction not found in wallet", http.StatusNotFound)
+		return
+	}
+
+	var outputs []outputInfo
+	for _, output := range storeTx.Data.Outputs {
+		address, _ := output.ProgramHash.ToAddress()
+		outputs = append(outputs, outputInfo{Address: address, Value: output.Value.String()})
+	}
+
+	explorer.render(w, txTemplate, map[string]interface{}{
+		"TxId":    storeTx.TxId.String(),
+		"Height":  storeTx.Height,
+		"Type":    int(storeTx.Data.TxType),
+		"Inputs":  len(storeTx.Data.Inputs),
+		"Outputs": outputs,
+	})
+}
+
+func (explorer *Explorer) address(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("addr")
+	hash, err := Uint168FromAddress(address)
+	if err != nil {
+		http.Error(w, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	utxos, err := explorer.source.DataStore().UTXOs().GetAddrAll(hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stxos, err := explorer.source.DataStore().STXOs().GetAddrAll(hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var balance Fixed64
+	for _, utxo := range utxos {
+		if utxo.IsSystemAsset() {
+			balance += utxo.Value
+		}
+	}
+
+	explorer.render(w, addressTemplate, map[string]interface{}{
+		"Address": address,
+		"Balance": balance.String(),
+		"UTXOs":   utxos,
+		"STXOs":   stxos,
+	})
+}
+
+type pendingTx struct {
+	TxId           string   `json:"txid"`
+	Size           uint32   `json:"size"`
+	Fee            string   `json:"fee,omitempty"`
+	Parents        []string `json:"parents"`
+	Children       []string `json:"children"`
+	Depth          int      `json:"depth"`
+	DescendantFees string   `json:"descendantfees"`
+	DescendantSize uint32   `json:"descendantsize"`
+	PackageFeeRate string   `json:"packagefeerate"`
+}
+
+// Serve the dependency graph of unconfirmed wallet transactions in JSON format
+func (explorer *Explorer) pending(w http.ResponseWriter, r *http.Request) {
+	txs, err := explorer.source.DataStore().Txs().GetAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nodes := db.NewTxGraph(txs).Nodes()
+	pending := make([]pendingTx, 0, len(nodes))
+	for _, node := range nodes {
+		tx := pendingTx{
+			TxId:           node.TxId.String(),
+			Size:           node.Size,
+			Parents:        txIdStrings(node.Parents),
+			Children:       txIdStrings(node.Children),
+			Depth:          node.Depth,
+			DescendantFees: node.DescendantFees.String(),
+			DescendantSize: node.DescendantSize,
+			PackageFeeRate: node.PackageFeeRate().String(),
+		}
+		if node.Fee != nil {
+			tx.Fee = node.Fee.String()
+		}
+		pending = append(pending, tx)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+func txIdStrings(txIds []Uint256) []string {
+	strs := make([]string, 0, len(txIds))
+	for _, txId := range txIds {
+		strs = append(strs, txId.String())
+	}
+	return strs
+}
+
+type peerDiversity struct {
+	Total         int            `json:"total"`
+	Subnets       map[string]int `json:"subnets"`
+	Versions      map[string]int `json:"versions"`
+	Services      map[string]int `json:"services"`
+	LargestSubnet string         `json:"largestsubnet"`
+	LargestShare  float64        `json:"largestshare"`
+}
+
+// Serve the diversity of the peer set in JSON format
+func (explorer *Explorer) peers(w http.ResponseWriter, r *http.Request) {
+	diversity := explorer.source.PeerManager().Diversity()
+	result := peerDiversity{
+		Total:    diversity.Total,
+		Subnets:  diversity.Subnets,
+		Versions: make(map[string]int),
+		Services: make(map[string]int),
+	}
+	for version, count := range diversity.Versions {
+		result.Versions[fmt.Sprint(version)] = count
+	}
+	for service, count := range diversity.Services {
+		result.Services[fmt.Sprintf("0x%x", service)] = count
+	}
+	var largest int
+	result.LargestSubnet, largest = diversity.LargestSubnet()
+	if diversity.Total > 0 {
+		result.LargestShare = float64(largest) / float64(diversity.Total)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Serve the peer diversity in the Prometheus text format, so it can be scraped
+// and alerted on, like when one subnet holds most of the peers
+func (explorer *Explorer) metrics(w http.ResponseWriter, r *http.Request) {
+	diversity := explorer.source.PeerManager().Diversity()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP spv_peers Number of connected and standby peers.")
+	fmt.Fprintln(w, "# TYPE spv_peers gauge")
+	fmt.Fprintln(w, "spv_peers", diversity.Total)
+
+	fmt.Fprintln(w, "# HELP spv_peers_by_subnet Number of peers per network group.")
+	fmt.Fprintln(w, "# TYPE spv_peers_by_subnet gauge")
+	subnets := make([]string, 0, len(diversity.Subnets))
+	for subnet := range diversity.Subnets {
+		subnets = append(subnets, subnet)
+	}
+	sort.Strings(subnets)
+	for _, subnet := range subnets {
+		fmt.Fprintf(w, "spv_peers_by_subnet{subnet=%q} %d\n", subnet, diversity.Subnets[subnet])
+	}
+
+	fmt.Fprintln(w, "# HELP spv_peers_by_version Number of peers per protocol version.")
+	fmt.Fprintln(w, "# TYPE spv_peers_by_version gauge")
+	versions := make([]uint32, 0, len(diversity.Versions))
+	for version := range diversity.Versions {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, version := range versions {
+		fmt.Fprintf(w, "spv_peers_by_version{version=\"%d\"} %d\n", version, diversity.Versions[version])
+	}
+
+	fmt.Fprintln(w, "# HELP spv_peers_by_service Number of peers per service bit.")
+	fmt.Fprintln(w, "# TYPE spv_peers_by_service gauge")
+	services := make([]uint64, 0, len(diversity.Services))
+	for service := range diversity.Services {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i] < services[j] })
+	for _, service := range services {
+		fmt.Fprintf(w, "spv_peers_by_service{service=\"0x%x\"} %d\n", service, diversity.Services[service])
+	}
+
+	_, largest := diversity.LargestSubnet()
+	fmt.Fprintln(w, "# HELP spv_peers_largest_subnet Number of peers in the largest network group.")
+	fmt.Fprintln(w, "# TYPE spv_peers_largest_subnet gauge")
+	fmt.Fprintln(w, "spv_peers_largest_subnet", largest)
+
+	stats := explorer.source.RuntimeStats()
+	fmt.Fprintln(w, "# HELP spv_goroutines Number of goroutines of the process.")
+	fmt.Fprintln(w, "# TYPE spv_goroutines gauge")
+	fmt.Fprintln(w, "spv_goroutines", stats.Goroutines)
+
+	fmt.Fprintln(w, "# HELP spv_subsystem_goroutines Number of goroutines per subsystem.")
+	fmt.Fprintln(w, "# TYPE spv_subsystem_goroutines gauge")
+	for _, subsystem := range stats.Subsystems {
+		fmt.Fprintf(w, "spv_subsystem_goroutines{subsystem=%q} %d\n", subsystem.Name, subsystem.Goroutines)
+	}
+
+	fmt.Fprintln(w, "# HELP spv_subsystem_queue_depth Number of jobs queued per subsystem.")
+	fmt.Fprintln(w, "# TYPE spv_subsystem_queue_depth gauge")
+	for _, subsystem := range stats.Subsystems {
+		fmt.Fprintf(w, "spv_subsystem_queue_depth{subsystem=%q} %d\n", subsystem.Name, subsystem.QueueDepth)
+	}
+}
+
+// Serve the goroutine counts and queue depths of the SPV service subsystems as
+// JSON, to tune the pool sizes on small devices
+func (explorer *Explorer) runtime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explorer.source.RuntimeStats())
+}
+
+func (explorer *Explorer) render(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := tmpl.Execute(w, data)
+	if err != nil {
+		log.Error("Explorer render page error:", err)
+	}
+}
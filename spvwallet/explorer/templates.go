@@ -0,0 +1,80 @@
+package explorer
+
+import "html/template"
+
+const header = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SPV Wallet Explorer</title>
+<style>
+body { font-family: monospace; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1><a href="/">SPV Wallet Explorer</a></h1>
+<form action="/tx">Transaction <input name="hash" size="70"> <input type="submit" value="Lookup"></form>
+<form action="/address">Address <input name="addr" size="40"> <input type="submit" value="Lookup"></form>
+`
+
+const footer = `</body>
+</html>
+`
+
+var indexTemplate = template.Must(template.New("index").Parse(header + `
+<h2>Sync Status</h2>
+<table>
+<tr><th>Height</th><td>{{.Height}}</td></tr>
+<tr><th>Tip</th><td>{{.TipHash}}</td></tr>
+<tr><th>Syncing</th><td>{{.Syncing}}</td></tr>
+<tr><th>Blocks</th><td>{{.Stats.Blocks}}</td></tr>
+<tr><th>Download avg / max</th><td>{{.Stats.Download.Average}} / {{.Stats.Download.Max}}</td></tr>
+<tr><th>Verify avg / max</th><td>{{.Stats.Verify.Average}} / {{.Stats.Verify.Max}}</td></tr>
+<tr><th>Commit avg / max</th><td>{{.Stats.Commit.Average}} / {{.Stats.Commit.Max}}</td></tr>
+</table>
+<h2>Peers</h2>
+<table>
+<tr><th>ID</th><th>Address</th><th>Height</th><th>State</th></tr>
+{{range .Peers}}<tr><td>{{.ID}}</td><td>{{.Addr}}</td><td>{{.Height}}</td><td>{{.State}}</td></tr>
+{{end}}</table>
+<h2>Recent Transactions</h2>
+<table>
+<tr><th>TxId</th><th>Height</th><th>Type</th></tr>
+{{range .Txs}}<tr><td><a href="/tx?hash={{.TxId}}">{{.TxId}}</a></td><td>{{if .Height}}{{.Height}}{{else}}unconfirmed{{end}}</td><td>{{.Type}}</td></tr>
+{{end}}</table>
+` + footer))
+
+var txTemplate = template.Must(template.New("tx").Parse(header + `
+<h2>Transaction</h2>
+<table>
+<tr><th>TxId</th><td>{{.TxId}}</td></tr>
+<tr><th>Height</th><td>{{if .Height}}{{.Height}}{{else}}unconfirmed{{end}}</td></tr>
+<tr><th>Type</th><td>{{.Type}}</td></tr>
+<tr><th>Inputs</th><td>{{.Inputs}}</td></tr>
+</table>
+<h2>Outputs</h2>
+<table>
+<tr><th>Address</th><th>Value</th></tr>
+{{range .Outputs}}<tr><td><a href="/address?addr={{.Address}}">{{.Address}}</a></td><td>{{.Value}}</td></tr>
+{{end}}</table>
+` + footer))
+
+var addressTemplate = template.Must(template.New("address").Parse(header + `
+<h2>Address</h2>
+<table>
+<tr><th>Address</th><td>{{.Address}}</td></tr>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+</table>
+<h2>Unspent Outputs</h2>
+<table>
+<tr><th>TxId</th><th>Index</th><th>Value</th><th>Height</th></tr>
+{{range .UTXOs}}<tr><td><a href="/tx?hash={{.Op.TxID.String}}">{{.Op.TxID.String}}</a></td><td>{{.Op.Index}}</td><td>{{.Value.String}}</td><td>{{.AtHeight}}</td></tr>
+{{end}}</table>
+<h2>Spent Outputs</h2>
+<table>
+<tr><th>TxId</th><th>Index</th><th>Value</th><th>Spent By</th><th>Spent Height</th></tr>
+{{range .STXOs}}<tr><td><a href="/tx?hash={{.Op.TxID.String}}">{{.Op.TxID.String}}</a></td><td>{{.Op.Index}}</td><td>{{.Value.String}}</td><td><a href="/tx?hash={{.SpendTxId.String}}">{{.SpendTxId.String}}</a></td><td>{{.SpendHeight}}</td></tr>
+{{end}}</table>
+` + footer))
@@ -0,0 +1,275 @@
+package spvwallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// ConfirmTarget is the number of blocks a transaction is expected to be confirmed in
+type ConfirmTarget uint32
+
+const (
+	TargetFast    ConfirmTarget = 1
+	TargetNormal  ConfirmTarget = 6
+	TargetEconomy ConfirmTarget = 36
+)
+
+const (
+	// The minimal fee of a transaction accepted by the nodes
+	MinTxFee = Fixed64(100)
+	// The size of a signature parameter in a program
+	SignatureSize = 65
+	// The number of recent transactions of a target the estimation is based on
+	FeeEstimateWindow = 20
+	// The number of fee target records kept in the wallet database
+	MaxFeeTargetRecords = 500
+)
+
+// The fee rates in sela per KB used before the wallet has sent transactions with the target
+var defaultFeeRates = map[ConfirmTarget]sdk.FeeRate{
+	TargetFast:    10000,
+	TargetNormal:  1000,
+	TargetEconomy: 100,
+}
+
+// Parse a confirmation target from a preset name fast, normal or economy, or a number of blocks
+func ParseConfirmTarget(str string) (ConfirmTarget, error) {
+	switch str {
+	case "fast":
+		return TargetFast, nil
+	case "normal":
+		return TargetNormal, nil
+	case "economy":
+		return TargetEconomy, nil
+	}
+	blocks, err := strconv.ParseUint(str, 10, 32)
+	if err != nil || blocks == 0 {
+		return 0, errors.New("invalid confirmation target, use fast, normal, economy or a number of blocks")
+	}
+	return ConfirmTarget(blocks), nil
+}
+
+func (target ConfirmTarget) String() string {
+	switch target {
+	case TargetFast:
+		return "fast"
+	case TargetNormal:
+		return "normal"
+	case TargetEconomy:
+		return "economy"
+	}
+	return strconv.FormatUint(uint64(target), 10) + " blocks"
+}
+
+// The default fee rate of the nearest preset not faster than the target
+func (target ConfirmTarget) defaultFeeRate() sdk.FeeRate {
+	switch {
+	case target < TargetNormal:
+		return defaultFeeRates[TargetFast]
+	case target < TargetEconomy:
+		return defaultFeeRates[TargetNormal]
+	}
+	return defaultFeeRates[TargetEconomy]
+}
+
+// FeeTargetRecord is a transaction created with a confirmation target
+type FeeTargetRecord struct {
+	TxId    Uint256
+	Target  ConfirmTarget
+	FeeRate sdk.FeeRate
+	Fee     Fixed64
+	// Chain height when the transaction was sent, 0 if not sent yet
+	SentHeight uint32
+}
+
+// FeeTargetLog keeps the transactions created with confirmation targets,
+// it is saved in the wallet database
+type FeeTargetLog struct {
+	Records []*FeeTargetRecord
+}
+
+// FeeTargetReport tells if a transaction sent with a confirmation target met the target
+type FeeTargetReport struct {
+	FeeTargetRecord
+	// Height the transaction was confirmed at, 0 if not confirmed yet
+	Height uint32
+	// Blocks taken to confirm the transaction, or passed since sent if not confirmed yet
+	Blocks uint32
+	Met    bool
+	// The target is not reached yet, so it's unknown if it will be met
+	Pending bool
+}
+
+// Estimate the fee rate in sela per KB for the target. It is the lowest fee rate
+// of the recent transactions that met the target, raised by half when more than
+// a fifth of them missed it. If none is known yet, it is estimated by the SPV
+// service from the observed transactions, or the preset rate if not running.
+func (wallet *WalletImpl) EstimateFeeRate(target ConfirmTarget) (sdk.FeeRate, error) {
+	reports, err := wallet.GetFeeTargetReports()
+	if err != nil {
+		return 0, err
+	}
+
+	var resolved []*FeeTargetReport
+	for i := len(reports) - 1; i >= 0 && len(resolved) < FeeEstimateWindow; i-- {
+		if reports[i].Target == target && reports[i].SentHeight != 0 && !reports[i].Pending {
+			resolved = append(resolved, reports[i])
+		}
+	}
+
+	rate := target.defaultFeeRate()
+	if observed, err := rpc.GetClient().EstimateFee(uint32(target)); err == nil && observed > 0 {
+		rate = sdk.FeeRate(observed)
+	}
+	var lowest sdk.FeeRate
+	var missed int
+	for _, report := range resolved {
+		if !report.Met {
+			missed++
+			continue
+		}
+		if lowest == 0 || report.FeeRate < lowest {
+			lowest = report.FeeRate
+		}
+	}
+	if lowest > 0 {
+		rate = lowest
+	}
+	if missed*5 > len(resolved) {
+		rate += rate / 2
+	}
+	return rate, nil
+}
+
+// Estimate the fee rate for the RPC clients from the observed transactions
+func (wallet *SPVWallet) EstimateFee(targetBlocks uint32) (int64, error) {
+	rate, err := wallet.FeeEstimator().EstimateFee(targetBlocks)
+	return int64(rate), err
+}
+
+// Create a transaction paying the fee estimated for the confirmation target,
+// the target is recorded to report if it was met after the transaction is sent
+func (wallet *WalletImpl) CreateTransactionWithTarget(fromAddress string, target ConfirmTarget, lockedUntil uint32, outputs ...*Transfer) (*Transaction, error) {
+	rate, err := wallet.EstimateFeeRate(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create with the minimal fee to know the size, then with the fee of the size,
+	// more inputs may be selected for the higher fee, so repeat until it's enough
+	fee := MinTxFee
+	var txn *Transaction
+	for {
+		txn, err = wallet.createTransaction(fromAddress, &fee, lockedUntil, outputs...)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := rate.FeeForSize(signedSize(txn))
+		if err != nil {
+			return nil, err
+		}
+		required := amount.Fixed64()
+		if required < MinTxFee {
+			required = MinTxFee
+		}
+		if fee >= required {
+			break
+		}
+		fee = required
+	}
+
+	feeLog, err := wallet.GetFeeTargetLog()
+	if err != nil {
+		return nil, err
+	}
+	feeLog.Records = append(feeLog.Records, &FeeTargetRecord{
+		TxId:    txn.Hash(),
+		Target:  target,
+		FeeRate: rate,
+		Fee:     fee,
+	})
+	if len(feeLog.Records) > MaxFeeTargetRecords {
+		feeLog.Records = feeLog.Records[len(feeLog.Records)-MaxFeeTargetRecords:]
+	}
+	err = wallet.PutFeeTargetLog(feeLog)
+	if err != nil {
+		return nil, err
+	}
+
+	return txn, wallet.putOutputLabels(txn, outputs)
+}
+
+// Mark the transaction created with a confirmation target as sent at the current height
+func (wallet *WalletImpl) markTargetSent(txId Uint256) error {
+	feeLog, err := wallet.GetFeeTargetLog()
+	if err != nil {
+		return err
+	}
+	for _, record := range feeLog.Records {
+		if record.TxId == txId && record.SentHeight == 0 {
+			record.SentHeight = wallet.ChainHeight()
+			return wallet.PutFeeTargetLog(feeLog)
+		}
+	}
+	return nil
+}
+
+// Get the transactions created with confirmation targets and whether the targets were met
+func (wallet *WalletImpl) GetFeeTargetReports() ([]*FeeTargetReport, error) {
+	feeLog, err := wallet.GetFeeTargetLog()
+	if err != nil {
+		return nil, err
+	}
+	txs, err := wallet.GetTxs()
+	if err != nil {
+		return nil, err
+	}
+	heights := make(map[Uint256]uint32, len(txs))
+	for _, tx := range txs {
+		heights[tx.TxId] = tx.Height
+	}
+
+	chainHeight := wallet.ChainHeight()
+	reports := make([]*FeeTargetReport, 0, len(feeLog.Records))
+	for _, record := range feeLog.Records {
+		report := &FeeTargetReport{FeeTargetRecord: *record, Height: heights[record.TxId]}
+		switch {
+		case record.SentHeight == 0:
+			report.Pending = true
+		case report.Height != 0:
+			report.Blocks = report.Height - record.SentHeight
+			report.Met = report.Blocks <= uint32(record.Target)
+		default:
+			report.Blocks = chainHeight - record.SentHeight
+			report.Pending = report.Blocks <= uint32(record.Target)
+		}
+		reports = append(reports, report)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].SentHeight < reports[j].SentHeight
+	})
+	return reports, nil
+}
+
+// The size of the transaction after all signatures are added
+func signedSize(txn *Transaction) int {
+	buf := new(bytes.Buffer)
+	txn.Serialize(buf)
+	size := buf.Len()
+	for _, program := range txn.Programs {
+		haveSign, needSign, err := crypto.GetSignStatus(program.Code, program.Parameter)
+		if err == nil && needSign > haveSign {
+			size += (needSign - haveSign) * SignatureSize
+		}
+	}
+	return size
+}
@@ -0,0 +1,317 @@
+package spvwallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	. "github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+
+	"github.com/itchyny/base58-go"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// Child indexes from this one are hardened, derived from the private key only
+	HardenedKeyStart = 0x80000000
+
+	// The BIP44 purpose and the coin type of ELA registered in SLIP-0044
+	BIP44Purpose = 44
+	ELACoinType  = 2305
+
+	// The external chain of an HD account derives receive addresses,
+	// the internal chain derives change addresses
+	ExternalChain = 0
+	InternalChain = 1
+
+	// The version bytes of a serialized public extended key, the same as the
+	// BIP32 xpub, so the string starts with "xpub"
+	PublicExtendedKeyVersion = 0x0488B21E
+
+	// version | depth | parent fingerprint | child index | chain code | public key
+	extendedKeyLength = 4 + 1 + 4 + 4 + 32 + 33
+)
+
+// The HMAC key of the master key, the same as BIP32
+var masterKeySalt = []byte("Bitcoin seed")
+
+var ErrInvalidChild = errors.New("invalid child key, use the next index")
+
+/*
+ExtendedKey is a BIP32 key with its chain code, children are derived from it by
+index. ELA keys are on the P-256 curve instead of secp256k1, the derivation is
+otherwise the same. A public extended key derives the public keys of the
+non-hardened children, so addresses are derived without the private key.
+*/
+type ExtendedKey struct {
+	privateKey []byte // nil if it's a public extended key
+	publicKey  *crypto.PublicKey
+	chainCode  []byte
+	depth      uint8
+	// The first 4 bytes of the hash160 of the parent public key, and the
+	// index of this key, both 0 for the master key
+	parentFingerprint uint32
+	index             uint32
+}
+
+// Create the master extended key from a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	mac := hmac.New(sha512.New, masterKeySalt)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, errors.New("invalid seed, the master key is out of range")
+	}
+	return newPrivateExtendedKey(sum[:32], sum[32:], 0), nil
+}
+
+func newPrivateExtendedKey(privateKey, chainCode []byte, depth uint8) *ExtendedKey {
+	return &ExtendedKey{
+		privateKey: privateKey,
+		publicKey:  crypto.NewPubKey(privateKey),
+		chainCode:  chainCode,
+		depth:      depth,
+	}
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.privateKey != nil
+}
+
+func (k *ExtendedKey) PrivateKey() []byte {
+	return k.privateKey
+}
+
+func (k *ExtendedKey) PublicKey() *crypto.PublicKey {
+	return k.publicKey
+}
+
+// Get the public extended key of this key
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	return &ExtendedKey{publicKey: k.publicKey, chainCode: k.chainCode, depth: k.depth,
+		parentFingerprint: k.parentFingerprint, index: k.index}
+}
+
+// Get the first 4 bytes of the hash160 of the public key, children refer to
+// their parent by it
+func (k *ExtendedKey) Fingerprint() (uint32, error) {
+	point, err := k.publicKey.EncodePoint(true)
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(point)
+	hasher := ripemd160.New()
+	hasher.Write(sum[:])
+	return binary.BigEndian.Uint32(hasher.Sum(nil)[:4]), nil
+}
+
+// Derive the child key at the index, indexes from HardenedKeyStart are hardened
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == 255 {
+		return nil, errors.New("max derivation depth reached")
+	}
+
+	fingerprint, err := k.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	data := new(bytes.Buffer)
+	if index >= HardenedKeyStart {
+		if !k.IsPrivate() {
+			return nil, errors.New("can not derive a hardened child from a public key")
+		}
+		data.WriteByte(0)
+		data.Write(paddedKey(k.privateKey))
+	} else {
+		point, err := k.publicKey.EncodePoint(true)
+		if err != nil {
+			return nil, err
+		}
+		data.Write(point)
+	}
+	binary.Write(data, binary.BigEndian, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data.Bytes())
+	sum := mac.Sum(nil)
+
+	curve := elliptic.P256()
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidChild
+	}
+
+	if k.IsPrivate() {
+		key := new(big.Int).SetBytes(k.privateKey)
+		key.Add(key, tweak)
+		key.Mod(key, curve.Params().N)
+		if key.Sign() == 0 {
+			return nil, ErrInvalidChild
+		}
+		child := newPrivateExtendedKey(paddedKey(key.Bytes()), sum[32:], k.depth+1)
+		child.parentFingerprint, child.index = fingerprint, index
+		return child, nil
+	}
+
+	x, y := curve.ScalarBaseMult(sum[:32])
+	x, y = curve.Add(x, y, k.publicKey.X, k.publicKey.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+	return &ExtendedKey{
+		publicKey:         &crypto.PublicKey{X: x, Y: y},
+		chainCode:         sum[32:],
+		depth:             k.depth + 1,
+		parentFingerprint: fingerprint,
+		index:             index,
+	}, nil
+}
+
+// Derive the descendant key by the indexes of a path from this key
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	key := k
+	var err error
+	for _, index := range path {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Get the account of the key, it can not sign if this is a public extended key
+func (k *ExtendedKey) Account() (*Account, error) {
+	return NewAccount(k.privateKey, k.publicKey)
+}
+
+// Serialize the public extended key like a BIP32 xpub, the version, depth, parent
+// fingerprint, child index, chain code and compressed public key in base58 with a
+// checksum, to keep it in the keystore file
+func (k *ExtendedKey) PublicString() (string, error) {
+	point, err := k.publicKey.EncodePoint(true)
+	if err != nil {
+		return "", err
+	}
+	data := new(bytes.Buffer)
+	binary.Write(data, binary.BigEndian, uint32(PublicExtendedKeyVersion))
+	data.WriteByte(k.depth)
+	binary.Write(data, binary.BigEndian, k.parentFingerprint)
+	binary.Write(data, binary.BigEndian, k.index)
+	data.Write(k.chainCode)
+	data.Write(point)
+	data.Write(checksum(data.Bytes()))
+
+	// The version is not 0, so no leading zero byte is lost in the number
+	decimal := new(big.Int).SetBytes(data.Bytes()).String()
+	encoded, err := base58.BitcoinEncoding.Encode([]byte(decimal))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// Parse a public extended key serialized by PublicString()
+func ParsePublicExtendedKey(str string) (*ExtendedKey, error) {
+	decimal, err := base58.BitcoinEncoding.Decode([]byte(str))
+	if err != nil {
+		return nil, errors.New("invalid extended public key, not a base58 string")
+	}
+	value, ok := new(big.Int).SetString(string(decimal), 10)
+	if !ok {
+		return nil, errors.New("invalid extended public key, not a base58 string")
+	}
+	data := value.Bytes()
+	if len(data) != extendedKeyLength+4 {
+		return nil, errors.New("invalid extended public key length")
+	}
+	payload := data[:extendedKeyLength]
+	if !bytes.Equal(checksum(payload), data[extendedKeyLength:]) {
+		return nil, errors.New("invalid extended public key checksum")
+	}
+	if binary.BigEndian.Uint32(payload[:4]) != PublicExtendedKeyVersion {
+		return nil, errors.New("invalid extended public key version")
+	}
+	publicKey, err := crypto.DecodePoint(payload[45:])
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedKey{
+		publicKey:         publicKey,
+		chainCode:         payload[13:45],
+		depth:             payload[4],
+		parentFingerprint: binary.BigEndian.Uint32(payload[5:9]),
+		index:             binary.BigEndian.Uint32(payload[9:13]),
+	}, nil
+}
+
+// The first 4 bytes of the double sha256 of the data
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// Private keys are 32 bytes, big.Int drops the leading zeros
+func paddedKey(key []byte) []byte {
+	if len(key) >= 32 {
+		return key
+	}
+	padded := make([]byte, 32)
+	copy(padded[32-len(key):], key)
+	return padded
+}
+
+// Get the BIP44 path of the account, like m/44'/2305'/0'
+func HDAccountPath(account uint32) []uint32 {
+	return []uint32{HardenedKeyStart + BIP44Purpose, HardenedKeyStart + ELACoinType, HardenedKeyStart + account}
+}
+
+// Format the BIP44 path of an address, like m/44'/2305'/0'/0/5
+func HDAddressPath(account, chain, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", BIP44Purpose, ELACoinType, account, chain, index)
+}
+
+// Check if the path is an address of the HD account on the external or internal chain
+func isHDAddressPath(indexes []uint32) bool {
+	account := HDAccountPath(0)
+	return len(indexes) == 5 && indexes[0] == account[0] && indexes[1] == account[1] &&
+		indexes[2] == account[2] && (indexes[3] == ExternalChain || indexes[3] == InternalChain)
+}
+
+// Parse a derivation path like m/44'/2305'/0'/0/5 to the child indexes,
+// an index followed by ' or h is hardened
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, errors.New("derivation path must start with m")
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= HardenedKeyStart {
+			return nil, errors.New("invalid derivation path index " + part)
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
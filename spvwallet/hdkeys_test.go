@@ -0,0 +1,205 @@
+package spvwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The SLIP-0010 test vector 1 for NIST P-256, the derivation of ELA keys is the
+// same except for the HMAC key of the master key, so the chain starts from the
+// master key of the vector instead of the seed
+var p256Vectors = []struct {
+	name       string
+	index      uint32
+	chainCode  string
+	privateKey string
+	publicKey  string
+}{
+	{"m", 0,
+		"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+		"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+		"0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+	{"m/0H", HardenedKeyStart,
+		"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+		"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+		"0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+	{"m/0H/1", 1,
+		"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+		"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129",
+		"03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+	{"m/0H/1/2H", HardenedKeyStart + 2,
+		"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+		"694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7",
+		"0359cf160040778a4b14c5f4d7b76e327ccc8c4a6086dd9451b7482b5a4972dda0"},
+	{"m/0H/1/2H/2", 2,
+		"ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0",
+		"5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa",
+		"029f871f4cb9e1c97f9f4de9ccd0d4a2f2a171110c61178f84430062230833ff20"},
+}
+
+func vectorMasterKey() *ExtendedKey {
+	chainCode, _ := hex.DecodeString(p256Vectors[0].chainCode)
+	privateKey, _ := hex.DecodeString(p256Vectors[0].privateKey)
+	return newPrivateExtendedKey(privateKey, chainCode, 0)
+}
+
+func checkVector(t *testing.T, name string, key *ExtendedKey, chainCode, privateKey, publicKey string) {
+	if hex.EncodeToString(key.chainCode) != chainCode {
+		t.Errorf("%s: chain code %x, want %s", name, key.chainCode, chainCode)
+	}
+	if privateKey != "" && hex.EncodeToString(key.PrivateKey()) != privateKey {
+		t.Errorf("%s: private key %x, want %s", name, key.PrivateKey(), privateKey)
+	}
+	point, err := key.PublicKey().EncodePoint(true)
+	if err != nil {
+		t.Fatalf("%s: encode public key failed: %v", name, err)
+	}
+	if hex.EncodeToString(point) != publicKey {
+		t.Errorf("%s: public key %x, want %s", name, point, publicKey)
+	}
+}
+
+func TestChildVectors(t *testing.T) {
+	key := vectorMasterKey()
+	for i, test := range p256Vectors {
+		if i > 0 {
+			var err error
+			key, err = key.Child(test.index)
+			if err != nil {
+				t.Fatalf("%s: derive failed: %v", test.name, err)
+			}
+		}
+		if key.depth != uint8(i) {
+			t.Errorf("%s: depth %d, want %d", test.name, key.depth, i)
+		}
+		checkVector(t, test.name, key, test.chainCode, test.privateKey, test.publicKey)
+
+		// The neutered key keeps the chain code and public key only
+		public := key.Neuter()
+		if public.IsPrivate() {
+			t.Errorf("%s: neutered key is private", test.name)
+		}
+		checkVector(t, test.name+" neutered", public, test.chainCode, "", test.publicKey)
+	}
+}
+
+func TestPublicChild(t *testing.T) {
+	master := vectorMasterKey()
+	for _, path := range [][]uint32{
+		{0},
+		{1, 2},
+		{HardenedKeyStart, 1},
+		{HardenedKeyStart + 44, HardenedKeyStart + 2305, HardenedKeyStart, ExternalChain, 5},
+		{HardenedKeyStart + 44, HardenedKeyStart + 2305, HardenedKeyStart, InternalChain, 7},
+	} {
+		// Derive the hardened part of the path from the private key, and the rest
+		// from both the private key and the public key
+		hardened := 0
+		for hardened < len(path) && path[hardened] >= HardenedKeyStart {
+			hardened++
+		}
+		parent, err := master.Derive(path[:hardened])
+		if err != nil {
+			t.Fatalf("%v: derive failed: %v", path, err)
+		}
+		private, err := parent.Derive(path[hardened:])
+		if err != nil {
+			t.Fatalf("%v: private derive failed: %v", path, err)
+		}
+		public, err := parent.Neuter().Derive(path[hardened:])
+		if err != nil {
+			t.Fatalf("%v: public derive failed: %v", path, err)
+		}
+
+		if public.IsPrivate() {
+			t.Errorf("%v: public derivation has a private key", path)
+		}
+		if !bytes.Equal(private.chainCode, public.chainCode) {
+			t.Errorf("%v: chain code %x, want %x", path, public.chainCode, private.chainCode)
+		}
+		if private.PublicKey().X.Cmp(public.PublicKey().X) != 0 ||
+			private.PublicKey().Y.Cmp(public.PublicKey().Y) != 0 {
+			t.Errorf("%v: public derivation differs from the private derivation", path)
+		}
+		if private.depth != public.depth || private.index != public.index ||
+			private.parentFingerprint != public.parentFingerprint {
+			t.Errorf("%v: depth, index or parent fingerprint differ", path)
+		}
+	}
+
+	// Hardened children can not be derived from a public key
+	if _, err := master.Neuter().Child(HardenedKeyStart); err == nil {
+		t.Errorf("derived a hardened child from a public key")
+	}
+}
+
+func TestPublicString(t *testing.T) {
+	master := vectorMasterKey()
+	account, err := master.Derive(HDAccountPath(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := master.Derive(HDAccountPath(0)[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := parent.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.parentFingerprint != fingerprint || account.index != HardenedKeyStart {
+		t.Errorf("parent fingerprint %08x and index %x, want %08x and %x",
+			account.parentFingerprint, account.index, fingerprint, HardenedKeyStart)
+	}
+
+	for _, key := range []*ExtendedKey{master, account, account.Neuter()} {
+		str, err := key.PublicString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(str, "xpub") || len(str) != 111 {
+			t.Errorf("%s: not an xpub string", str)
+		}
+
+		parsed, err := ParsePublicExtendedKey(str)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", str, err)
+		}
+		if parsed.IsPrivate() {
+			t.Errorf("%s: parsed key is private", str)
+		}
+		again, err := parsed.PublicString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != str {
+			t.Errorf("%s: serialized again to %s", str, again)
+		}
+
+		// The parsed key derives the same addresses
+		want, err := key.Child(ExternalChain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parsed.Child(ExternalChain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want.PublicKey().X.Cmp(got.PublicKey().X) != 0 || !bytes.Equal(want.chainCode, got.chainCode) {
+			t.Errorf("%s: parsed key derives another child", str)
+		}
+
+		// A changed character fails the checksum
+		changed := []byte(str)
+		if changed[50] == 'a' {
+			changed[50] = 'b'
+		} else {
+			changed[50] = 'a'
+		}
+		if _, err := ParsePublicExtendedKey(string(changed)); err == nil {
+			t.Errorf("%s: parsed a changed string", str)
+		}
+	}
+}
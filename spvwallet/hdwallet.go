@@ -0,0 +1,330 @@
+package spvwallet
+
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
+
+	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// The number of unused addresses derived ahead of the last used one on each
+// chain of the HD account, the same as the BIP44 gap limit
+const HDGapLimit = 20
+
+var ErrNoHDAccount = errors.New("HD account not set up, verify the password once to set it up")
+
+// Derive the HD account from the master key, which is the seed, so a backup of
+// the keystore restores all HD addresses. The accounts up to the next indexes of
+// the external and internal chains are derived to sign with.
+func (store *KeystoreImpl) initHDAccounts(masterKey []byte) error {
+	master, err := NewMasterKey(masterKey)
+	if err != nil {
+		return err
+	}
+	account, err := master.Derive(HDAccountPath(0))
+	if err != nil {
+		return err
+	}
+
+	// Keystores created by earlier versions have no HD account
+	if store.HDAccountPublicKey == "" {
+		publicKey, err := account.Neuter().PublicString()
+		if err != nil {
+			return err
+		}
+		err = store.Update(func(file *KeystoreFile) error {
+			file.HDAccountPublicKey = publicKey
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	store.hd = nil
+	for _, chain := range []struct {
+		chain uint32
+		next  uint32
+	}{{ExternalChain, store.HDReceiveIndex}, {InternalChain, store.HDChangeIndex}} {
+		chainKey, err := account.Child(chain.chain)
+		if err != nil {
+			return err
+		}
+		for index := uint32(0); index < chain.next; index++ {
+			key, err := chainKey.Child(index)
+			if err == ErrInvalidChild {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hdAccount, err := key.Account()
+			if err != nil {
+				return err
+			}
+			store.hd = append(store.hd, hdAccount)
+		}
+	}
+	return nil
+}
+
+func (store *KeystoreImpl) GetHDAccounts() []*sdk.Account {
+	return store.hd
+}
+
+// Derive the account of the next index on the chain from the public key of the
+// HD account, the next index is saved in the keystore file. The account holds
+// no private key, the keystore derives it when opened with the password.
+func (store *KeystoreFile) NextHDAccount(chain uint32) (*sdk.Account, string, error) {
+	for {
+		accounts, paths, err := store.DeriveHDAccounts(chain, func(next uint32) uint32 { return next + 1 })
+		if err != nil {
+			return nil, "", err
+		}
+		// The index has no valid child, use the next one
+		if len(accounts) > 0 {
+			return accounts[0], paths[0], nil
+		}
+	}
+}
+
+/*
+Derive the accounts on the chain from the next index of the keystore file to the
+end index returned by the function of the next index, like the end of the gap
+limit, and save the advanced next index. Indexes without a valid child are skipped.
+Returns the accounts and their derivation paths.
+*/
+func (store *KeystoreFile) DeriveHDAccounts(chain uint32, end func(next uint32) uint32) ([]*sdk.Account, []string, error) {
+	var accounts []*sdk.Account
+	var paths []string
+	err := store.Update(func(file *KeystoreFile) error {
+		if file.HDAccountPublicKey == "" {
+			return ErrNoHDAccount
+		}
+		account, err := ParsePublicExtendedKey(file.HDAccountPublicKey)
+		if err != nil {
+			return err
+		}
+		chainKey, err := account.Child(chain)
+		if err != nil {
+			return err
+		}
+
+		next := &file.HDReceiveIndex
+		if chain == InternalChain {
+			next = &file.HDChangeIndex
+		}
+		for last := end(*next); *next < last; *next++ {
+			key, err := chainKey.Child(*next)
+			if err == ErrInvalidChild {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hdAccount, err := key.Account()
+			if err != nil {
+				return err
+			}
+			accounts = append(accounts, hdAccount)
+			paths = append(paths, HDAddressPath(0, chain, *next))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return accounts, paths, nil
+}
+
+/*
+Derive the HD addresses ahead of the last used address on the external and
+internal chains, so HDGapLimit unused addresses follow it, like the BIP44 account
+discovery. Payments to addresses of a restored keystore, or of another wallet
+sharing it, are found by the filter then. Returns the addresses added.
+*/
+func FillHDGap(store DataStore) ([]*Uint168, error) {
+	addrs, err := store.Addrs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	lastUsed := map[uint32]int64{ExternalChain: -1, InternalChain: -1}
+	known := make(map[Uint168]bool, len(addrs))
+	for _, addr := range addrs {
+		known[*addr.Hash()] = true
+		chain, index, ok := hdAddressIndex(addr)
+		if !ok || int64(index) <= lastUsed[chain] {
+			continue
+		}
+		used, err := addressUsed(store, addr.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			lastUsed[chain] = int64(index)
+		}
+	}
+
+	file, err := OpenKeystoreFile()
+	if err != nil {
+		return nil, err
+	}
+	var added []*Uint168
+	for _, chain := range []uint32{ExternalChain, InternalChain} {
+		gapEnd := uint32(lastUsed[chain] + 1 + HDGapLimit)
+		accounts, paths, err := file.DeriveHDAccounts(chain, func(next uint32) uint32 {
+			if next > gapEnd {
+				return next
+			}
+			return gapEnd
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, account := range accounts {
+			if known[*account.ProgramHash()] {
+				continue
+			}
+			err = store.Addrs().Put(account.ProgramHash(), account.RedeemScript(), TypeHD, paths[i])
+			if err != nil {
+				return nil, err
+			}
+			added = append(added, account.ProgramHash())
+		}
+	}
+	return added, nil
+}
+
+// Get the chain and the index of an HD address by its derivation path
+func hdAddressIndex(addr *Addr) (uint32, uint32, bool) {
+	if addr.Type() != TypeHD {
+		return 0, 0, false
+	}
+	indexes, err := ParseDerivationPath(addr.Path())
+	if err != nil || !isHDAddressPath(indexes) {
+		return 0, 0, false
+	}
+	return indexes[3], indexes[4], true
+}
+
+// Check if anything was received to the address
+func addressUsed(store DataStore, hash *Uint168) (bool, error) {
+	utxos, err := store.UTXOs().GetAddrAll(hash)
+	if err != nil {
+		return false, err
+	}
+	if len(utxos) > 0 {
+		return true, nil
+	}
+	stxos, err := store.STXOs().GetAddrAll(hash)
+	if err != nil {
+		return false, err
+	}
+	return len(stxos) > 0, nil
+}
+
+// Derive a new receive address of the HD account, no password needed
+func (wallet *WalletImpl) NewReceiveAddress() (*Uint168, error) {
+	return wallet.newHDAddress(ExternalChain)
+}
+
+func (wallet *WalletImpl) newHDAddress(chain uint32) (*Uint168, error) {
+	file, err := OpenKeystoreFile()
+	if err != nil {
+		return nil, err
+	}
+	account, path, err := file.NextHDAccount(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallet.AddAddress(account.ProgramHash(), account.RedeemScript(), TypeHD, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Notify SPV service to reload bloom filter with the new address
+	rpc.GetClient().NotifyNewAddress(account.ProgramHash().Bytes())
+
+	return account.ProgramHash(), nil
+}
+
+// Get the address to receive the next payment, it is the first unused receive
+// address of the HD account after the last used one, the addresses derived
+// ahead by the gap limit are given out in order, so every payer gets a fresh
+// address. A new one is derived if there is none.
+func (wallet *WalletImpl) GetReceiveAddress() (*Uint168, error) {
+	addr, err := wallet.nextUnusedHDAddress(ExternalChain)
+	if err != nil {
+		return nil, err
+	}
+	if addr == nil {
+		return wallet.NewReceiveAddress()
+	}
+	return addr.Hash(), nil
+}
+
+// Get the address to send the change of a transaction spent from the spender,
+// the change of HD addresses goes to an unused address on the internal chain,
+// other addresses get their change back
+func (wallet *WalletImpl) getChangeAddress(spender *Uint168) (*Uint168, error) {
+	addr, err := wallet.GetAddress(spender)
+	if err != nil || addr.Type() != TypeHD {
+		return spender, nil
+	}
+	change, err := wallet.nextUnusedHDAddress(InternalChain)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return wallet.newHDAddress(InternalChain)
+	}
+	return change.Hash(), nil
+}
+
+// Get the first unused HD address on the chain after the last used one, nil if
+// there is none
+func (wallet *WalletImpl) nextUnusedHDAddress(chain uint32) (*Addr, error) {
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	lastUsed := int64(-1)
+	unused := make(map[uint32]*Addr)
+	for _, addr := range addrs {
+		addrChain, index, ok := hdAddressIndex(addr)
+		if !ok || addrChain != chain {
+			continue
+		}
+		utxos, err := wallet.GetAddressUTXOs(addr.Hash())
+		if err != nil {
+			return nil, err
+		}
+		stxos, err := wallet.GetAddressSTXOs(addr.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if len(utxos) > 0 || len(stxos) > 0 {
+			if int64(index) > lastUsed {
+				lastUsed = int64(index)
+			}
+			continue
+		}
+		if !addr.Archived() {
+			unused[index] = addr
+		}
+	}
+
+	var next *Addr
+	var nextIndex uint32
+	for index, addr := range unused {
+		if int64(index) > lastUsed && (next == nil || index < nextIndex) {
+			next, nextIndex = addr, index
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,243 @@
+package spvwallet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// HistoryRecord is a wallet transaction with it's effect on the wallet balance
+type HistoryRecord struct {
+	TxId   string
+	Height uint32
+	// Block time of confirmed transactions, or the time first received,
+	// zero for transactions stored by earlier versions
+	Time time.Time
+	// The change of wallet balance, negative for spending
+	Amount Fixed64
+	// Fee is only known when all inputs are spent from this wallet
+	Fee *Fixed64
+	// DirectionReceived, DirectionSent or DirectionSelf
+	Direction string
+	// The addresses paid by this wallet, or that paid to it if received,
+	// change outputs are not counterparts
+	Counterparts []string
+	// The names of the counterparts in the address book
+	Payees []string
+	// Wallet balance after this transaction
+	Balance Fixed64
+}
+
+// Get the transaction history of this wallet, ordered by height from the
+// earliest, unconfirmed transactions are at the end.
+func (wallet *WalletImpl) GetHistory() ([]*HistoryRecord, error) {
+	addrs, err := wallet.GetAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Outputs spent from this wallet, they are the inputs with known values
+	owned := make(map[Uint168]bool)
+	spent := make(map[OutPoint]*STXO)
+	for _, addr := range addrs {
+		owned[*addr.Hash()] = true
+		stxos, err := wallet.GetAddressSTXOs(addr.Hash())
+		if err != nil {
+			return nil, err
+		}
+		for _, stxo := range stxos {
+			spent[stxo.Op] = stxo
+		}
+	}
+
+	// Payee names by address
+	payees, err := wallet.GetPayees()
+	if err != nil {
+		return nil, err
+	}
+	payeeNames := make(map[string]string, len(payees))
+	for _, payee := range payees {
+		address, err := payee.Address.ToAddress()
+		if err != nil {
+			return nil, err
+		}
+		payeeNames[address] = payee.Name
+	}
+
+	// Counterparts stored when the transactions were committed, transactions
+	// stored by earlier versions have none and are annotated here
+	stored, err := wallet.getStoredCounterparts()
+	if err != nil {
+		return nil, err
+	}
+	isOwned := func(hash Uint168) bool { return owned[hash] }
+
+	txs, err := wallet.GetTxs()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Height == 0 || txs[j].Height == 0 {
+			return txs[i].Height != 0 && txs[j].Height == 0
+		}
+		return txs[i].Height < txs[j].Height
+	})
+
+	var balance Fixed64
+	var records []*HistoryRecord
+	for _, storeTx := range txs {
+		var input, output, received, sent Fixed64
+		allOwned := true
+		for _, in := range storeTx.Data.Inputs {
+			stxo, ok := spent[in.Previous]
+			if !ok {
+				allOwned = false
+				continue
+			}
+			input += stxo.Value
+			sent += stxo.Value
+		}
+
+		for _, out := range storeTx.Data.Outputs {
+			output += out.Value
+			if owned[out.ProgramHash] {
+				received += out.Value
+			}
+		}
+
+		counterparts, ok := stored[storeTx.TxId.String()]
+		if !ok {
+			counterparts, err = txCounterparts(&storeTx.Data, sent > 0, isOwned)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var names []string
+		for _, address := range counterparts.Addresses {
+			if name, ok := payeeNames[address]; ok {
+				names = append(names, name)
+			}
+		}
+
+		record := &HistoryRecord{
+			TxId:         storeTx.TxId.String(),
+			Height:       storeTx.Height,
+			Amount:       received - sent,
+			Direction:    counterparts.Direction,
+			Counterparts: counterparts.Addresses,
+			Payees:       names,
+		}
+		if storeTx.Timestamp != 0 {
+			record.Time = time.Unix(int64(storeTx.Timestamp), 0).UTC()
+		}
+		// Coinbase has no fee, otherwise fee is known only when all inputs are owned
+		if len(storeTx.Data.Inputs) > 0 && allOwned && storeTx.Data.TxType != CoinBase {
+			fee := input - output
+			record.Fee = &fee
+		}
+		balance += record.Amount
+		record.Balance = balance
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Get the dependency graph of unconfirmed wallet transactions, which shows why
+// a transaction is pending and the package fee rate to bump it's fee.
+func (wallet *WalletImpl) GetTxGraph() (*TxGraph, error) {
+	txs, err := wallet.GetTxs()
+	if err != nil {
+		return nil, err
+	}
+	return NewTxGraph(txs), nil
+}
+
+// Write the history records in CSV format, amounts are formatted with a dot
+// as decimal separator and times in RFC3339, so the output is locale independent.
+func WriteHistoryCSV(w io.Writer, records []*HistoryRecord) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"txid", "height", "time", "amount", "fee", "counterparts", "balance", "payees", "direction"})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		var fee string
+		if record.Fee != nil {
+			fee = record.Fee.String()
+		}
+		err = writer.Write([]string{
+			record.TxId,
+			fmt.Sprint(record.Height),
+			formatTime(record.Time),
+			record.Amount.String(),
+			fee,
+			strings.Join(record.Counterparts, ";"),
+			record.Balance.String(),
+			strings.Join(record.Payees, ";"),
+			record.Direction,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type historyJSON struct {
+	TxId         string   `json:"txid"`
+	Height       uint32   `json:"height"`
+	Time         string   `json:"time"`
+	Amount       string   `json:"amount"`
+	Direction    string   `json:"direction"`
+	Fee          string   `json:"fee,omitempty"`
+	Counterparts []string `json:"counterparts"`
+	Payees       []string `json:"payees,omitempty"`
+	Balance      string   `json:"balance"`
+}
+
+// Write the history records in JSON format, amounts are written as decimal
+// strings to keep the precision.
+func WriteHistoryJSON(w io.Writer, records []*HistoryRecord) error {
+	list := make([]historyJSON, 0, len(records))
+	for _, record := range records {
+		item := historyJSON{
+			TxId:         record.TxId,
+			Height:       record.Height,
+			Time:         formatTime(record.Time),
+			Amount:       record.Amount.String(),
+			Direction:    record.Direction,
+			Counterparts: record.Counterparts,
+			Payees:       record.Payees,
+			Balance:      record.Balance.String(),
+		}
+		if record.Fee != nil {
+			item.Fee = record.Fee.String()
+		}
+		list = append(list, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(list)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	. "github.com/elastos/Elastos.ELA.SPV/sdk"
@@ -17,6 +19,8 @@ const (
 )
 
 type Keystore interface {
+	Signer
+
 	ChangePassword(old, new []byte) error
 
 	MainAccount() *Account
@@ -25,6 +29,19 @@ type Keystore interface {
 	GetAccountByIndex(index int) *Account
 	GetAccountByProgramHash(programHash *Uint168) *Account
 
+	ImportAccount(privateKey []byte) (*Account, error)
+	GetImportedAccounts() []*Account
+
+	// Accounts derived by the BIP44 paths of the HD account
+	GetHDAccounts() []*Account
+
+	// Key derived from the master key, to encrypt the wallet state shared between devices
+	SyncKey() []byte
+
+	// Advance the account indexes past the derivation paths of addresses created
+	// on another device sharing the keystore
+	AdvanceIndexes(paths []string) error
+
 	Json() (string, error)
 	FromJson(json string, password string) error
 }
@@ -37,6 +54,12 @@ type KeystoreImpl struct {
 	masterKey []byte
 
 	accounts []*Account
+
+	// Accounts of imported private keys, they are not derived from the master key
+	imported []*Account
+
+	// Accounts derived from the HD account on the external and internal chains
+	hd []*Account
 }
 
 func CreateKeystore(password []byte) (Keystore, error) {
@@ -91,7 +114,7 @@ func CreateKeystore(password []byte) (Keystore, error) {
 		return nil, err
 	}
 
-	err = keystoreFile.SaveToFile()
+	err = keystoreFile.create()
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +177,24 @@ func (store *KeystoreImpl) initAccounts(masterKey, privateKey []byte, publicKey
 		store.accounts = append(store.accounts, childAccount)
 	}
 
-	return nil
+	// initiate imported accounts
+	keysEncrypted, err := store.GetImportedKeysEncrypted()
+	if err != nil {
+		return err
+	}
+	for _, keyEncrypted := range keysEncrypted {
+		privateKey, publicKey, err := store.decryptKeyPair(masterKey, keyEncrypted)
+		if err != nil {
+			return err
+		}
+		account, err := NewAccount(privateKey, publicKey)
+		if err != nil {
+			return err
+		}
+		store.imported = append(store.imported, account)
+	}
+
+	return store.initHDAccounts(masterKey)
 }
 
 func (store *KeystoreImpl) verifyPassword(password []byte) error {
@@ -168,7 +208,7 @@ func (store *KeystoreImpl) verifyPassword(password []byte) error {
 	if IsEqualBytes(origin, passwordHash[:]) {
 		return nil
 	}
-	return errors.New("password wrong")
+	return NewReason("password_wrong", CategoryLock, ActionCheckPassword, "password wrong")
 }
 
 func (store *KeystoreImpl) ChangePassword(oldPassword, newPassword []byte) error {
@@ -206,16 +246,12 @@ func (store *KeystoreImpl) ChangePassword(oldPassword, newPassword []byte) error
 		return err
 	}
 
-	store.SetPasswordHash(newPasswordHash[:])
-	store.SetMasterKeyEncrypted(masterKeyEncrypted)
-	store.SetPrivateKeyEncrypted(privateKeyEncrypted)
-
-	err = store.SaveToFile()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.Update(func(file *KeystoreFile) error {
+		file.SetPasswordHash(newPasswordHash[:])
+		file.SetMasterKeyEncrypted(masterKeyEncrypted)
+		file.SetPrivateKeyEncrypted(privateKeyEncrypted)
+		return nil
+	})
 }
 
 func (store *KeystoreImpl) MainAccount() *Account {
@@ -223,27 +259,149 @@ func (store *KeystoreImpl) MainAccount() *Account {
 }
 
 func (store *KeystoreImpl) NewAccount() *Account {
-	// create sub account
-	privateKey, publicKey, err := crypto.GenerateSubKeyPair(
-		store.SubAccountsCount+1, store.masterKey, store.accounts[0].PrivateKey())
+	store.Lock()
+	defer store.Unlock()
+
+	// create sub account, the count may be advanced by another process
+	err := store.Update(func(file *KeystoreFile) error {
+		file.SubAccountsCount += 1
+		return store.deriveSubAccounts(file.SubAccountsCount)
+	})
 	if err != nil {
 		panic(fmt.Sprint("New sub account failed,", err))
 	}
 
+	return store.accounts[store.SubAccountsCount]
+}
+
+// Derive the sub accounts up to the count not derived yet
+func (store *KeystoreImpl) deriveSubAccounts(count int) error {
+	for i := len(store.accounts); i <= count; i++ {
+		privateKey, publicKey, err := crypto.GenerateSubKeyPair(i, store.masterKey, store.accounts[0].PrivateKey())
+		if err != nil {
+			return err
+		}
+		account, err := NewAccount(privateKey, publicKey)
+		if err != nil {
+			return err
+		}
+		store.accounts = append(store.accounts, account)
+	}
+	return nil
+}
+
+// Import an existing private key, it is encrypted with the master key
+// and saved in the keystore file
+func (store *KeystoreImpl) ImportAccount(privateKey []byte) (*Account, error) {
+	if len(privateKey) != 32 {
+		return nil, errors.New("invalid private key length")
+	}
+	publicKey := crypto.NewPubKey(privateKey)
+
 	account, err := NewAccount(privateKey, publicKey)
 	if err != nil {
-		panic(fmt.Sprint("New sub account failed,", err))
+		return nil, err
+	}
+	if store.GetAccountByProgramHash(account.ProgramHash()) != nil {
+		return nil, errors.New("private key already exist in keystore")
 	}
 
-	store.accounts = append(store.accounts, account)
+	keyEncrypted, err := store.encryptPrivateKey(store.masterKey, nil, privateKey, publicKey)
+	if err != nil {
+		return nil, err
+	}
 
-	store.SubAccountsCount += 1
-	err = store.SaveToFile()
+	err = store.Update(func(file *KeystoreFile) error {
+		file.AddImportedKeyEncrypted(keyEncrypted)
+		return nil
+	})
 	if err != nil {
-		panic(fmt.Sprint("New sub account failed,", err))
+		return nil, err
 	}
 
-	return account
+	store.imported = append(store.imported, account)
+	return account, nil
+}
+
+func (store *KeystoreImpl) GetImportedAccounts() []*Account {
+	return store.imported
+}
+
+// Devices sharing the keystore derive the same key, the master key itself is not exposed
+func (store *KeystoreImpl) SyncKey() []byte {
+	key := sha256.Sum256(append([]byte("spvwallet state sync"), store.masterKey...))
+	return key[:]
+}
+
+/*
+Advance the sub account count and the next HD indexes past the derivation paths,
+like the paths of addresses created on another device sharing the keystore, so
+this device does not create the same addresses again and derives their keys to
+sign with. The keystore file is updated once with all indexes.
+*/
+func (store *KeystoreImpl) AdvanceIndexes(paths []string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	err := store.Update(func(file *KeystoreFile) error {
+		subAccounts := file.SubAccountsCount
+		next := map[uint32]uint32{ExternalChain: file.HDReceiveIndex, InternalChain: file.HDChangeIndex}
+		for _, path := range paths {
+			if index, ok := parseAccountIndexPath(path); ok {
+				if index > subAccounts {
+					subAccounts = index
+				}
+				continue
+			}
+			indexes, err := ParseDerivationPath(path)
+			if err != nil {
+				continue
+			}
+			switch {
+			// Devices of earlier versions send sub account indexes like m/1
+			case len(indexes) == 1:
+				if int(indexes[0]) > subAccounts {
+					subAccounts = int(indexes[0])
+				}
+			case isHDAddressPath(indexes):
+				if chain, index := indexes[3], indexes[4]; index >= next[chain] {
+					next[chain] = index + 1
+				}
+			}
+		}
+
+		// Derive the sub accounts not derived yet, the file may be advanced by another process
+		err := store.deriveSubAccounts(subAccounts)
+		if err != nil {
+			return err
+		}
+		file.SubAccountsCount = subAccounts
+		file.HDReceiveIndex, file.HDChangeIndex = next[ExternalChain], next[InternalChain]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return store.initHDAccounts(store.masterKey)
+}
+
+// Get the path of the account at the given index in the keystore, the main
+// account is account/0 and sub accounts are account/1, account/2 ... They are
+// not derived by BIP32, so this is not a derivation path for external signers.
+func AccountIndexPath(index int) string {
+	return fmt.Sprint("account/", index)
+}
+
+// Parse the account index of a path by AccountIndexPath
+func parseAccountIndexPath(path string) (int, bool) {
+	if !strings.HasPrefix(path, "account/") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(path, "account/"))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
 }
 
 func (store *KeystoreImpl) GetAccounts() []*Account {
@@ -266,6 +424,16 @@ func (store *KeystoreImpl) GetAccountByProgramHash(programHash *Uint168) *Accoun
 			return account
 		}
 	}
+	for _, account := range store.imported {
+		if *account.ProgramHash() == *programHash {
+			return account
+		}
+	}
+	for _, account := range store.hd {
+		if *account.ProgramHash() == *programHash {
+			return account
+		}
+	}
 	return nil
 }
 
@@ -333,6 +501,11 @@ func (store *KeystoreImpl) decryptPrivateKey(masterKey, passwordKey []byte) ([]b
 	if err != nil {
 		return nil, nil, err
 	}
+
+	return store.decryptKeyPair(masterKey, privateKeyEncrypted)
+}
+
+func (store *KeystoreImpl) decryptKeyPair(masterKey, privateKeyEncrypted []byte) ([]byte, *crypto.PublicKey, error) {
 	if len(privateKeyEncrypted) != 96 {
 		return nil, nil, errors.New("invalid encrypted private key")
 	}
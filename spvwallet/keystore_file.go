@@ -7,13 +7,22 @@ import (
 	"os"
 	"sync"
 
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 const (
 	KeystoreFilename = "keystore.dat"
+
+	// The lock file serializing writes of the keystore file between processes,
+	// like the SPV service deriving HD addresses and the CLI
+	KeystoreLockName = KeystoreFilename + ".lock"
 )
 
+// Writes of the keystore file in this process are serialized by this lock
+var keystoreFileLock sync.Mutex
+
 type KeystoreFile struct {
 	sync.Mutex
 
@@ -25,6 +34,20 @@ type KeystoreFile struct {
 	PrivateKeyEncrypted string
 
 	SubAccountsCount int
+
+	// Imported private keys encrypted with the master key
+	ImportedKeysEncrypted []string
+
+	// The public extended key of the HD account m/44'/2305'/0', so addresses
+	// are derived without the password, and the next index to derive on the
+	// external (receive) and internal (change) chains
+	HDAccountPublicKey string
+	HDReceiveIndex     uint32
+	HDChangeIndex      uint32
+
+	// The keystore is not in the keystore file, it is created and not saved
+	// yet, or loaded from JSON
+	detached bool
 }
 
 func CreateKeystoreFile() (*KeystoreFile, error) {
@@ -34,7 +57,8 @@ func CreateKeystoreFile() (*KeystoreFile, error) {
 	}
 
 	file := &KeystoreFile{
-		Version: KeystoreVersion,
+		Version:  KeystoreVersion,
+		detached: true,
 	}
 
 	return file, nil
@@ -108,6 +132,23 @@ func (store *KeystoreFile) GetPrivetKeyEncrypted() ([]byte, error) {
 	return privateKeyEncrypted, nil
 }
 
+func (store *KeystoreFile) AddImportedKeyEncrypted(keyEncrypted []byte) {
+	store.ImportedKeysEncrypted = append(store.ImportedKeysEncrypted, BytesToHexString(keyEncrypted))
+}
+
+func (store *KeystoreFile) GetImportedKeysEncrypted() ([][]byte, error) {
+	var keys [][]byte
+	for _, keyEncrypted := range store.ImportedKeysEncrypted {
+		key, err := HexStringToBytes(keyEncrypted)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
 func (store *KeystoreFile) LoadFromFile() error {
 	store.Lock()
 	defer store.Unlock()
@@ -156,6 +197,60 @@ func (store *KeystoreFile) SaveToFile() error {
 	return nil
 }
 
+/*
+Reload the keystore file, change it by the function and save it, every change
+of the keystore file goes through here. The file is locked for other processes
+and this one meanwhile, so changes saved by others, like HD indexes advanced by
+the SPV service, are not overwritten. Nothing is saved if the function returns
+an error, and a detached keystore is changed in memory only.
+*/
+func (store *KeystoreFile) Update(update func(file *KeystoreFile) error) error {
+	keystoreFileLock.Lock()
+	defer keystoreFileLock.Unlock()
+
+	if store.detached {
+		return update(store)
+	}
+
+	unlock, err := db.LockFile(KeystoreLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = store.LoadFromFile()
+	if err != nil {
+		return err
+	}
+	err = update(store)
+	if err != nil {
+		return err
+	}
+	return store.SaveToFile()
+}
+
+// Save the keystore created by CreateKeystoreFile to the keystore file
+func (store *KeystoreFile) create() error {
+	keystoreFileLock.Lock()
+	defer keystoreFileLock.Unlock()
+
+	unlock, err := db.LockFile(KeystoreLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if FileExisted(KeystoreFilename) {
+		return errors.New("key store file already exist")
+	}
+	err = store.SaveToFile()
+	if err != nil {
+		return err
+	}
+	store.detached = false
+	return nil
+}
+
 func (store *KeystoreFile) Json() (string, error) {
 	store.Lock()
 	defer store.Unlock()
@@ -172,5 +267,6 @@ func (store *KeystoreFile) FromJson(str string) error {
 	store.Lock()
 	defer store.Unlock()
 
+	store.detached = true
 	return json.Unmarshal([]byte(str), store)
 }
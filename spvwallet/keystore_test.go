@@ -0,0 +1,69 @@
+package spvwallet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAdvanceIndexes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spvkeystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	keystore, err := CreateKeystore([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := keystore.(*KeystoreImpl)
+
+	tests := []struct {
+		name        string
+		paths       []string
+		subAccounts int
+		receive     uint32
+		change      uint32
+	}{
+		{"no paths", nil, 0, 0, 0},
+		{"sub account", []string{AccountIndexPath(2)}, 2, 0, 0},
+		{"lower sub account", []string{AccountIndexPath(1)}, 2, 0, 0},
+		{"sub account of earlier versions", []string{"m/1"}, 2, 0, 0},
+		{"receive and change", []string{HDAddressPath(0, ExternalChain, 4), HDAddressPath(0, InternalChain, 1)}, 2, 5, 2},
+		{"lower receive", []string{HDAddressPath(0, ExternalChain, 2)}, 2, 5, 2},
+		{"other HD account", []string{HDAddressPath(1, ExternalChain, 9)}, 2, 5, 2},
+		{"invalid path", []string{"", "x/1"}, 2, 5, 2},
+	}
+	for _, test := range tests {
+		if err := store.AdvanceIndexes(test.paths); err != nil {
+			t.Fatalf("%s: advance failed: %v", test.name, err)
+		}
+		if store.SubAccountsCount != test.subAccounts || len(store.GetAccounts()) != test.subAccounts+1 {
+			t.Errorf("%s: %d sub accounts, %d accounts, want %d sub accounts", test.name,
+				store.SubAccountsCount, len(store.GetAccounts()), test.subAccounts)
+		}
+		if store.HDReceiveIndex != test.receive || store.HDChangeIndex != test.change {
+			t.Errorf("%s: next indexes %d/%d, want %d/%d", test.name,
+				store.HDReceiveIndex, store.HDChangeIndex, test.receive, test.change)
+		}
+
+		// The indexes are saved to the keystore file
+		file, err := OpenKeystoreFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.SubAccountsCount != test.subAccounts || file.HDReceiveIndex != test.receive ||
+			file.HDChangeIndex != test.change {
+			t.Errorf("%s: indexes not saved", test.name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package spvwallet
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+/*
+Merge the signatures of the copies of a multi sign transaction signed by cosigners
+separately, so they do not have to pass one file around to sign in turn. The copies
+must be the same transaction, signatures are verified against the public keys of the
+redeem script and appended in the order of the keys, duplicates are dropped and
+signatures beyond the required M are left out.
+*/
+func MergeSignatures(txns ...*Transaction) (*Transaction, error) {
+	if len(txns) == 0 {
+		return nil, errors.New("no transactions to merge")
+	}
+	merged := txns[0]
+	if len(merged.Programs) != 1 {
+		return nil, errors.New("[Wallet], Transaction must have one program to merge signatures")
+	}
+	code := merged.Programs[0].Code
+	signType, err := crypto.GetScriptType(code)
+	if err != nil {
+		return nil, err
+	}
+	if signType != crypto.MULTISIG {
+		return nil, errors.New("[Wallet], Only multi sign transactions can be merged")
+	}
+
+	buf := new(bytes.Buffer)
+	merged.SerializeUnsigned(buf)
+	data := buf.Bytes()
+
+	keys, err := ParseMultisigPublicKeys(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the signer of each signature, signatures by the same key are the same
+	signatures := make(map[int][]byte)
+	for _, txn := range txns {
+		buf := new(bytes.Buffer)
+		txn.SerializeUnsigned(buf)
+		if !bytes.Equal(buf.Bytes(), data) || len(txn.Programs) != 1 ||
+			!bytes.Equal(txn.Programs[0].Code, code) {
+			return nil, errors.New("[Wallet], Transactions to merge are not the same transaction")
+		}
+
+		param := txn.Programs[0].Parameter
+		if len(param)%SignatureSize != 0 {
+			return nil, errors.New("[Wallet], Invalid multi sign parameter")
+		}
+		for i := 0; i < len(param); i += SignatureSize {
+			signature := param[i+1 : i+SignatureSize]
+			index := signerIndexOf(keys, data, signature)
+			if index < 0 {
+				return nil, errors.New("[Wallet], Signature of no signer in the redeem script")
+			}
+			signatures[index] = signature
+		}
+	}
+
+	indexes := make([]int, 0, len(signatures))
+	for index := range signatures {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	_, needSign, err := crypto.GetSignStatus(code, nil)
+	if err != nil {
+		return nil, err
+	}
+	var param []byte
+	for i, index := range indexes {
+		if i >= needSign {
+			break
+		}
+		param, err = crypto.AppendSignature(index, signatures[index], data, code, param)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged.Programs[0].Parameter = param
+	return merged, nil
+}
+
+// Get the public keys of a multi sign redeem script in order
+func ParseMultisigPublicKeys(code []byte) ([]*crypto.PublicKey, error) {
+	points, err := crypto.ParseMultisigScript(code)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*crypto.PublicKey, 0, len(points))
+	for _, point := range points {
+		// The keys are parsed with the push length byte before the point
+		if len(point) == crypto.PUBLICKEYLENGTH+1 {
+			point = point[1:]
+		}
+		key, err := crypto.DecodePoint(point)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func signerIndexOf(keys []*crypto.PublicKey, data, signature []byte) int {
+	for i, key := range keys {
+		if crypto.Verify(*key, data, signature) == nil {
+			return i
+		}
+	}
+	return -1
+}
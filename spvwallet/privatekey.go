@@ -0,0 +1,58 @@
+package spvwallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/itchyny/base58-go"
+)
+
+const (
+	WIFVersion    = 0x80
+	WIFCompressed = 0x01
+)
+
+// Decode a private key in WIF format or a 64 characters hex string
+func DecodePrivateKey(key string) ([]byte, error) {
+	if len(key) == 64 {
+		if privateKey, err := hex.DecodeString(key); err == nil {
+			return privateKey, nil
+		}
+	}
+	return decodeWIF(key)
+}
+
+func decodeWIF(wif string) ([]byte, error) {
+	decimal, err := base58.BitcoinEncoding.Decode([]byte(wif))
+	if err != nil {
+		return nil, errors.New("invalid private key, not a WIF or hex string")
+	}
+	value, ok := new(big.Int).SetString(string(decimal), 10)
+	if !ok {
+		return nil, errors.New("invalid private key, not a WIF or hex string")
+	}
+
+	// version | private key | [compressed flag] | checksum
+	data := value.Bytes()
+	if len(data) != 37 && len(data) != 38 {
+		return nil, errors.New("invalid WIF length")
+	}
+	if data[0] != WIFVersion {
+		return nil, errors.New("invalid WIF version")
+	}
+	if len(data) == 38 && data[33] != WIFCompressed {
+		return nil, errors.New("invalid WIF compressed flag")
+	}
+
+	payload, checksum := data[:len(data)-4], data[len(data)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, errors.New("invalid WIF checksum")
+	}
+
+	return payload[1:33], nil
+}
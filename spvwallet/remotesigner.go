@@ -0,0 +1,256 @@
+package spvwallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	RemoteSignerTimeout = 30 * time.Second
+
+	// The gRPC service of the signing service, messages are encoded by the
+	// signerCodec, so the service needs no generated protobuf code.
+	RemoteSignerService = "spvwallet.RemoteSigner"
+)
+
+func init() {
+	encoding.RegisterCodec(signerCodec{})
+}
+
+// signerCodec encodes the signer messages in JSON, registered as the "json"
+// content subtype of gRPC.
+type signerCodec struct{}
+
+func (signerCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (signerCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (signerCodec) Name() string { return "json" }
+
+// The request of the signing service methods, program hash, data and txid
+// are hex strings, amount is in ELA.
+type SignerRequest struct {
+	ProgramHash string `json:"programhash,omitempty"`
+	Data        string `json:"data,omitempty"`
+	TxId        string `json:"txid,omitempty"`
+	Amount      string `json:"amount,omitempty"`
+}
+
+// The response of the signing service methods, only the field of the method is set.
+type SignerResponse struct {
+	Contains  bool   `json:"contains,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Confirmed bool   `json:"confirmed,omitempty"`
+}
+
+// RemoteSignerServer is implemented by the signing service, and registered to
+// a gRPC server by RegisterRemoteSignerServer.
+type RemoteSignerServer interface {
+	// Returns if the service holds the key of the program hash
+	Contains(ctx context.Context, req *SignerRequest) (*SignerResponse, error)
+	// Returns the signature of the data by the key of the program hash
+	SignData(ctx context.Context, req *SignerRequest) (*SignerResponse, error)
+	// Confirms the transaction above the reauth amount of the spend policy
+	Reauth(ctx context.Context, req *SignerRequest) (*SignerResponse, error)
+}
+
+func RegisterRemoteSignerServer(s *grpc.Server, srv RemoteSignerServer) {
+	s.RegisterService(&remoteSignerServiceDesc, srv)
+}
+
+var remoteSignerServiceDesc = grpc.ServiceDesc{
+	ServiceName: RemoteSignerService,
+	HandlerType: (*RemoteSignerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Contains", Handler: remoteSignerHandler("Contains", RemoteSignerServer.Contains)},
+		{MethodName: "SignData", Handler: remoteSignerHandler("SignData", RemoteSignerServer.SignData)},
+		{MethodName: "Reauth", Handler: remoteSignerHandler("Reauth", RemoteSignerServer.Reauth)},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "remotesigner.go",
+}
+
+func remoteSignerHandler(method string, call func(RemoteSignerServer, context.Context, *SignerRequest) (*SignerResponse, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(SignerRequest)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(RemoteSignerServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + RemoteSignerService + "/" + method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(RemoteSignerServer), ctx, req.(*SignerRequest))
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// RemoteSigner forwards signing requests to an external signing service over
+// gRPC, both sides are authenticated by certificates (mutual TLS).
+type RemoteSigner struct {
+	conn *grpc.ClientConn
+
+	auditLock sync.Mutex
+	auditFile string
+}
+
+// Create a remote signer to the service address, like "signer.example:20880",
+// with the client certificate and key, and the CA certificate to verify the
+// signing service.
+// Every request is appended to the audit file, or printed to log if it is empty.
+func NewRemoteSigner(address, certFile, keyFile, caFile, auditFile string) (*RemoteSigner, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.New("load client certificate failed, " + err.Error())
+	}
+
+	caCert, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.New("read CA certificate failed, " + err.Error())
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("invalid CA certificate")
+	}
+
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		MinVersion:   tls.VersionTLS12,
+	})
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(signerCodec{}.Name())))
+	if err != nil {
+		return nil, errors.New("dial remote signer failed, " + err.Error())
+	}
+
+	return &RemoteSigner{conn: conn, auditFile: auditFile}, nil
+}
+
+// Close the connection to the signing service
+func (signer *RemoteSigner) Close() error {
+	return signer.conn.Close()
+}
+
+func (signer *RemoteSigner) Contains(programHash *Uint168) (bool, error) {
+	resp, err := signer.request("Contains", programHash, nil)
+	if err != nil {
+		return false, err
+	}
+	return resp.Contains, nil
+}
+
+func (signer *RemoteSigner) SignData(programHash *Uint168, data []byte) ([]byte, error) {
+	resp, err := signer.request("SignData", programHash, data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Signature == "" {
+		return nil, errors.New("invalid remote signer response")
+	}
+	return hex.DecodeString(resp.Signature)
+}
+
+// Ask the signing service to confirm the transaction above the reauth amount of
+// the spend policy. The service confirms it out of band, like by its operator,
+// the wallet signs it then without waiting for the reauth cooldown.
+func (signer *RemoteSigner) Reauthenticate(txId *Uint256, amount Fixed64) error {
+	req := &SignerRequest{TxId: txId.String(), Amount: amount.String()}
+	resp, err := signer.call("Reauth", "", txId.Bytes(), req)
+	if err != nil {
+		return err
+	}
+	if !resp.Confirmed {
+		return errors.New("transaction not confirmed by the signing service")
+	}
+	return nil
+}
+
+func (signer *RemoteSigner) request(method string, programHash *Uint168, data []byte) (*SignerResponse, error) {
+	req := &SignerRequest{ProgramHash: hex.EncodeToString(programHash.Bytes())}
+	if data != nil {
+		req.Data = hex.EncodeToString(data)
+	}
+	address, _ := programHash.ToAddress()
+	return signer.call(method, address, data, req)
+}
+
+func (signer *RemoteSigner) call(method, address string, data []byte, req *SignerRequest) (*SignerResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteSignerTimeout)
+	defer cancel()
+
+	start := time.Now()
+	resp := new(SignerResponse)
+	err := signer.conn.Invoke(ctx, "/"+RemoteSignerService+"/"+method, req, resp)
+	signer.audit(method, address, data, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+type auditRecord struct {
+	Time     string `json:"time"`
+	Method   string `json:"method"`
+	Address  string `json:"address,omitempty"`
+	DataHash string `json:"datahash,omitempty"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Record the signing request, the data is recorded by it's hash
+func (signer *RemoteSigner) audit(method, address string, data []byte, start time.Time, err error) {
+	record := auditRecord{
+		Time:     start.UTC().Format(time.RFC3339),
+		Method:   method,
+		Address:  address,
+		Duration: time.Since(start).String(),
+	}
+	if data != nil {
+		hash := sha256.Sum256(data)
+		record.DataHash = hex.EncodeToString(hash[:])
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	line, _ := json.Marshal(record)
+	if signer.auditFile == "" {
+		log.Info("Remote signer request:", string(line))
+		return
+	}
+
+	signer.auditLock.Lock()
+	defer signer.auditLock.Unlock()
+
+	file, err := os.OpenFile(signer.auditFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Error("Open remote signer audit file failed:", err)
+		return
+	}
+	defer file.Close()
+	file.Write(append(line, '\n'))
+}
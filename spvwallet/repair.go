@@ -0,0 +1,102 @@
+package spvwallet
+
+import (
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.SPV/log"
+
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+// RepairReport is the summary of the wallet data rebuilt by RepairWallet
+type RepairReport struct {
+	// Chain height after the wallet data is checked against the headers
+	ChainHeight uint32
+	// Number of stored transactions replayed
+	Txs int
+	// Number of rebuilt UTXOs, STXOs and registered assets
+	UTXOs  int
+	STXOs  int
+	Assets int
+}
+
+// RepairWallet rebuilds the UTXOs, STXOs and registered assets from the stored
+// transactions and the addresses in the wallet, after the wallet data is checked
+// against the stored headers. No network access is needed, so wallets corrupted
+// by past bugs are fixed without a rescan. The SPV service must not be running,
+// it is safe to run again if interrupted.
+func RepairWallet() (*RepairReport, error) {
+	headers, err := openHeaders()
+	if err != nil {
+		return nil, err
+	}
+	defer headers.Close()
+
+	dataStore, err := openDataStore()
+	if err != nil {
+		return nil, err
+	}
+	defer dataStore.Close()
+
+	wallet := &SPVWallet{headers: headers, dataStore: dataStore}
+
+	// Rollback transactions the headers do not agree with
+	err = wallet.checkConsistency()
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet.rebuildOutputs()
+}
+
+func (wallet *SPVWallet) rebuildOutputs() (*RepairReport, error) {
+	txs, err := wallet.dataStore.Txs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay by height, unconfirmed transactions last
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Height == 0 || txs[j].Height == 0 {
+			return txs[j].Height == 0 && txs[i].Height != 0
+		}
+		return txs[i].Height < txs[j].Height
+	})
+
+	err = wallet.dataStore.ClearOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{ChainHeight: wallet.dataStore.Info().ChainHeight(), Txs: len(txs)}
+
+	// Save all outputs before moving spent ones, the order of
+	// transactions in the same block is not stored
+	for _, tx := range txs {
+		hits, err := wallet.commitOutputs(tx)
+		if err != nil {
+			return nil, err
+		}
+		report.UTXOs += hits
+	}
+	for _, tx := range txs {
+		report.STXOs += wallet.commitInputs(tx)
+	}
+	report.UTXOs -= report.STXOs
+
+	for _, tx := range txs {
+		if tx.Data.TxType != RegisterAsset {
+			continue
+		}
+		err = wallet.putAsset(tx)
+		if err != nil {
+			return nil, err
+		}
+		report.Assets++
+	}
+
+	log.Infof("Wallet repaired at height %d, %d transactions replayed, %d UTXOs, %d STXOs",
+		report.ChainHeight, report.Txs, report.UTXOs, report.STXOs)
+
+	return report, nil
+}
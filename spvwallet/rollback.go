@@ -0,0 +1,89 @@
+package spvwallet
+
+import (
+	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+)
+
+// RollbackPreview is the wallet data affected by rolling back to a height,
+// as reported by PreviewRollback without performing the rollback
+type RollbackPreview struct {
+	// The height to roll back to and the current chain height
+	Height      uint32
+	ChainHeight uint32
+	// Transactions confirmed above the height, they are deleted
+	Txs []*StoreTx
+	// UTXOs created above the height, they are deleted
+	RemovedUTXOs []*db.UTXO
+	// STXOs spent above the height, created at or below it, they are unspent again
+	RestoredUTXOs []*db.STXO
+	// STXOs created and spent above the height, they are deleted
+	RemovedSTXOs []*db.STXO
+	// Assets registered above the height, they are deleted
+	Assets []*db.RegisteredAsset
+}
+
+// PreviewRollback reports the wallet transactions, UTXOs, STXOs and registered
+// assets affected by rolling back the wallet to the given height, nothing is
+// changed. The wallet database is read only, so it is safe to run while the
+// SPV service is running.
+func PreviewRollback(height uint32) (*RollbackPreview, error) {
+	dataStore, err := openDataStore()
+	if err != nil {
+		return nil, err
+	}
+	defer dataStore.Close()
+
+	wallet := &SPVWallet{dataStore: dataStore}
+	return wallet.PreviewRollback(height)
+}
+
+// Report the wallet data affected by rolling back to the given height without performing it
+func (wallet *SPVWallet) PreviewRollback(height uint32) (*RollbackPreview, error) {
+	preview := &RollbackPreview{Height: height, ChainHeight: wallet.dataStore.Info().ChainHeight()}
+
+	txs, err := wallet.dataStore.Txs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		if tx.Height > height {
+			preview.Txs = append(preview.Txs, tx)
+		}
+	}
+
+	utxos, err := wallet.dataStore.UTXOs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, utxo := range utxos {
+		if utxo.AtHeight > height {
+			preview.RemovedUTXOs = append(preview.RemovedUTXOs, utxo)
+		}
+	}
+
+	stxos, err := wallet.dataStore.STXOs().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, stxo := range stxos {
+		switch {
+		case stxo.AtHeight > height:
+			preview.RemovedSTXOs = append(preview.RemovedSTXOs, stxo)
+		case stxo.SpendHeight > height:
+			preview.RestoredUTXOs = append(preview.RestoredUTXOs, stxo)
+		}
+	}
+
+	assets, err := wallet.dataStore.Assets().GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		if asset.Height > height {
+			preview.Assets = append(preview.Assets, asset)
+		}
+	}
+
+	return preview, nil
+}
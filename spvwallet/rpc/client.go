@@ -27,7 +27,7 @@ func (client *Client) NotifyNewAddress(hash []byte) error {
 		},
 	)
 	if resp.Code != 0 {
-		return errors.New(resp.Result.(string))
+		return resp.err()
 	}
 	return nil
 }
@@ -42,7 +42,20 @@ func (client *Client) SendTransaction(tx *Transaction) error {
 		},
 	)
 	if resp.Code != 0 {
-		return errors.New(resp.Result.(string))
+		return resp.err()
+	}
+	return nil
+}
+
+func (client *Client) Rescan(height uint32) error {
+	resp := client.send(
+		&Req{
+			Method: "rescan",
+			Params: []interface{}{height},
+		},
+	)
+	if resp.Code != 0 {
+		return resp.err()
 	}
 	return nil
 }
@@ -71,3 +84,37 @@ func (client *Client) send(req *Req) (ret Resp) {
 
 	return ret
 }
+
+// Pay many recipients in one transaction signed by the remote signing service
+// of the SPV service, returns the transaction id
+func (client *Client) SendMany(from string, payments []*Payment, options *SendManyOptions) (string, error) {
+	resp := client.send(
+		&Req{
+			Method: "sendmany",
+			Params: []interface{}{from, payments, options},
+		},
+	)
+	if resp.Code != 0 {
+		return "", resp.err()
+	}
+	return resp.Result.(string), nil
+}
+
+// Estimate the fee rate in sela per KB for a transaction to be confirmed within
+// the target blocks, from the transactions observed by the SPV service
+func (client *Client) EstimateFee(targetBlocks uint32) (int64, error) {
+	resp := client.send(
+		&Req{
+			Method: "estimatefee",
+			Params: []interface{}{targetBlocks},
+		},
+	)
+	if resp.Code != 0 {
+		return 0, resp.err()
+	}
+	rate, ok := resp.Result.(float64)
+	if !ok {
+		return 0, errors.New("invalid fee rate in response")
+	}
+	return int64(rate), nil
+}
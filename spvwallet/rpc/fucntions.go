@@ -3,6 +3,10 @@ package rpc
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
 
 	. "github.com/elastos/Elastos.ELA/core"
 )
@@ -14,11 +18,11 @@ func (server *Server) NotifyNewAddress(req Req) Resp {
 	}
 	addr, err := hex.DecodeString(data)
 	if err != nil {
-		return FunctionError(err.Error())
+		return ReasonError(err)
 	}
 	err = server.handler.NotifyNewAddress(addr)
 	if err != nil {
-		return FunctionError(err.Error())
+		return ReasonError(err)
 	}
 	return Success("New address received")
 }
@@ -30,7 +34,7 @@ func (server *Server) SendTransaction(req Req) Resp {
 	}
 	txBytes, err := hex.DecodeString(data)
 	if err != nil {
-		return FunctionError(err.Error())
+		return ReasonError(err)
 	}
 	var tx Transaction
 	err = tx.Deserialize(bytes.NewReader(txBytes))
@@ -39,7 +43,91 @@ func (server *Server) SendTransaction(req Req) Resp {
 	}
 	err = server.handler.SendTransaction(tx)
 	if err != nil {
-		return FunctionError(err.Error())
+		return ReasonError(err)
 	}
 	return Success(tx.Hash().String())
 }
+
+func (server *Server) AcceptReorg(req Req) Resp {
+	if len(req.Params) < 1 {
+		return InvalidParameter
+	}
+	data, ok := req.Params[0].(string)
+	if !ok {
+		return InvalidParameter
+	}
+	// The fork point is given as printed in the reorganize refused alert
+	forkPoint, err := sdk.ParseHash(data)
+	if err != nil {
+		return ReasonError(err)
+	}
+	err = server.handler.AcceptReorg(*forkPoint)
+	if err != nil {
+		return ReasonError(err)
+	}
+	return Success("Reorganize accepted at fork point " + forkPoint.String())
+}
+
+func (server *Server) Rescan(req Req) Resp {
+	height, ok := req.Params[0].(float64)
+	if !ok {
+		return InvalidParameter
+	}
+	err := server.handler.Rescan(uint32(height))
+	if err != nil {
+		return ReasonError(err)
+	}
+	return Success(fmt.Sprint("Rescan started from height ", uint32(height)))
+}
+
+// Pay many recipients in one transaction, params are the from address, the
+// payments and the options with the fee or the confirmation target
+func (server *Server) SendMany(req Req) Resp {
+	if len(req.Params) < 3 {
+		return InvalidParameter
+	}
+	from, ok := req.Params[0].(string)
+	if !ok {
+		return InvalidParameter
+	}
+	var payments []*Payment
+	if err := reparse(req.Params[1], &payments); err != nil || len(payments) == 0 {
+		return InvalidParameter
+	}
+	var options SendManyOptions
+	if err := reparse(req.Params[2], &options); err != nil {
+		return InvalidParameter
+	}
+
+	txId, err := server.handler.SendMany(from, payments, options.Fee, options.Target)
+	if err != nil {
+		return ReasonError(err)
+	}
+	return Success(txId.String())
+}
+
+// Estimate the fee rate in sela per KB for the target blocks from the
+// transactions observed by the service
+func (server *Server) EstimateFee(req Req) Resp {
+	if len(req.Params) < 1 {
+		return InvalidParameter
+	}
+	target, ok := req.Params[0].(float64)
+	if !ok || target < 1 {
+		return InvalidParameter
+	}
+	rate, err := server.handler.EstimateFee(uint32(target))
+	if err != nil {
+		return ReasonError(err)
+	}
+	return Success(rate)
+}
+
+// Decode a param into the type, params are decoded as generic JSON values
+func reparse(param interface{}, v interface{}) error {
+	data, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -1,5 +1,12 @@
 package rpc
 
+import (
+	"errors"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+)
+
 const (
 	RPCPort = "20877"
 	RPCAddr = "http://127.0.0.1:" + RPCPort + "/spvwallet/"
@@ -10,31 +17,68 @@ type Req struct {
 	Params []interface{} `json:"params"`
 }
 
+// Payment is an output of the sendmany method, the amount is in ELA like "1.5",
+// the label is kept in the wallet and the output is locked until the lock height
+type Payment struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Label   string `json:"label,omitempty"`
+	Lock    uint32 `json:"lock,omitempty"`
+}
+
+// The options of the sendmany method, the fixed fee in ELA, or the
+// confirmation target to estimate the fee for
+type SendManyOptions struct {
+	Fee    string `json:"fee,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
 type Resp struct {
 	Code   int         `json:"code"`
 	Result interface{} `json:"result"`
+	// The metadata of the failure, so the wallet UI can show it in its language
+	Reason *sdk.Reason `json:"reason,omitempty"`
 }
 
 var (
-	MarshalRequestError    = Resp{301, "MarshalRequestError"}
-	PostRequestError       = Resp{302, "PostRequestError"}
-	ReadResponseError      = Resp{303, "ReadResponseError"}
-	UnmarshalResponseError = Resp{304, "UnmarshalResponseError"}
+	MarshalRequestError    = Resp{Code: 301, Result: "MarshalRequestError"}
+	PostRequestError       = Resp{Code: 302, Result: "PostRequestError"}
+	ReadResponseError      = Resp{Code: 303, Result: "ReadResponseError"}
+	UnmarshalResponseError = Resp{Code: 304, Result: "UnmarshalResponseError"}
 )
 
 var (
-	NonPostRequest        = Resp{401, "NonPostRequest"}
-	EmptyRequestBody      = Resp{402, "EmptyRequestBody"}
-	ReadRequestError      = Resp{403, "ReadRequestError"}
-	UnmarshalRequestError = Resp{404, "UnmarshalRequestError"}
-	InvalidMethod         = Resp{405, "InvalidMethod"}
-	InvalidParameter      = Resp{406, "InvalidParameter"}
+	NonPostRequest        = Resp{Code: 401, Result: "NonPostRequest"}
+	EmptyRequestBody      = Resp{Code: 402, Result: "EmptyRequestBody"}
+	ReadRequestError      = Resp{Code: 403, Result: "ReadRequestError"}
+	UnmarshalRequestError = Resp{Code: 404, Result: "UnmarshalRequestError"}
+	InvalidMethod         = Resp{Code: 405, Result: "InvalidMethod"}
+	InvalidParameter      = Resp{Code: 406, Result: "InvalidParameter"}
 )
 
 func Success(result interface{}) Resp {
-	return Resp{0, result}
+	return Resp{Code: 0, Result: result}
 }
 
 func FunctionError(error string) Resp {
-	return Resp{407, error}
+	return Resp{Code: 407, Result: error}
+}
+
+// The function error of the err, with its reason if it carries one, the result
+// is the message from the ReasonMessages in config if it has the reason code
+func ReasonError(err error) Resp {
+	reason := sdk.ReasonOf(err)
+	if reason == nil {
+		return FunctionError(err.Error())
+	}
+	return Resp{Code: 407, Result: reason.Localize(config.Values().ReasonMessages), Reason: reason}
+}
+
+// Get the error of a failed response, the reason if the response carries one
+func (resp *Resp) err() error {
+	if resp.Reason != nil {
+		return resp.Reason
+	}
+	message, _ := resp.Result.(string)
+	return errors.New(message)
 }
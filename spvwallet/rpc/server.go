@@ -8,11 +8,16 @@ import (
 
 	. "github.com/elastos/Elastos.ELA/core"
 	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 type RequestHandler interface {
 	NotifyNewAddress(hash []byte) error
 	SendTransaction(Transaction) error
+	AcceptReorg(forkPoint common.Uint256) error
+	Rescan(height uint32) error
+	SendMany(from string, payments []*Payment, fee, target string) (*common.Uint256, error)
+	EstimateFee(targetBlocks uint32) (int64, error)
 }
 
 func InitServer(handler RequestHandler) *Server {
@@ -21,6 +26,10 @@ func InitServer(handler RequestHandler) *Server {
 	server.methods = map[string]func(Req) Resp{
 		"notifynewaddress": server.NotifyNewAddress,
 		"sendtransaction":  server.SendTransaction,
+		"acceptreorg":      server.AcceptReorg,
+		"rescan":           server.Rescan,
+		"sendmany":         server.SendMany,
+		"estimatefee":      server.EstimateFee,
 	}
 	server.handler = handler
 	http.HandleFunc("/spvwallet/", server.handle)
@@ -0,0 +1,29 @@
+package spvwallet
+
+import (
+	"errors"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Signer holds private keys and signs transaction content with them,
+// the keystore is the local signer, a RemoteSigner keeps keys out of this process.
+type Signer interface {
+	// Returns if the signer holds the private key of the program hash
+	Contains(programHash *Uint168) (bool, error)
+
+	// Sign the data with the private key of the program hash
+	SignData(programHash *Uint168, data []byte) ([]byte, error)
+}
+
+func (store *KeystoreImpl) Contains(programHash *Uint168) (bool, error) {
+	return store.GetAccountByProgramHash(programHash) != nil, nil
+}
+
+func (store *KeystoreImpl) SignData(programHash *Uint168, data []byte) ([]byte, error) {
+	account := store.GetAccountByProgramHash(programHash)
+	if account == nil {
+		return nil, errors.New("private key not found in keystore")
+	}
+	return account.Sign(data)
+}
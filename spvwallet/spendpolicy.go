@@ -0,0 +1,286 @@
+package spvwallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+const (
+	// Spends in this period are counted to the daily limit
+	SpendPeriod = time.Hour * 24
+	// Delay before a transaction above the reauth amount can be signed again by
+	// a signer which can not reauthenticate, if SpendDelayMinutes is not set
+	DefaultSpendDelay = time.Minute * 10
+)
+
+// SpendRecord is a transaction signed under the spend policy
+type SpendRecord struct {
+	TxId   Uint256
+	Amount Fixed64
+	Time   int64
+}
+
+// SpendLog keeps the recent spends and the delayed transactions, it is saved
+// in the wallet database
+type SpendLog struct {
+	Spends []SpendRecord
+	// First sign attempt time of delayed transactions, by transaction id
+	Pending map[string]int64
+}
+
+type spendPolicy struct {
+	maxTxAmount    *sdk.Amount
+	maxDailyAmount *sdk.Amount
+	whitelist      map[Uint168]bool
+	reauthAmount   *sdk.Amount
+	spendDelay     time.Duration
+}
+
+func newSpendPolicy(cfg config.SpendPolicyConfig) (*spendPolicy, error) {
+	var err error
+	policy := &spendPolicy{spendDelay: DefaultSpendDelay}
+	if policy.maxTxAmount, err = parseLimit(cfg.MaxTxAmount); err != nil {
+		return nil, errors.New("invalid MaxTxAmount in spend policy")
+	}
+	if policy.maxDailyAmount, err = parseLimit(cfg.MaxDailyAmount); err != nil {
+		return nil, errors.New("invalid MaxDailyAmount in spend policy")
+	}
+	if policy.reauthAmount, err = parseLimit(cfg.ReauthAmount); err != nil {
+		return nil, errors.New("invalid ReauthAmount in spend policy")
+	}
+	if cfg.SpendDelayMinutes > 0 {
+		policy.spendDelay = time.Minute * time.Duration(cfg.SpendDelayMinutes)
+	}
+	if len(cfg.Whitelist) > 0 {
+		policy.whitelist = make(map[Uint168]bool)
+		for _, address := range cfg.Whitelist {
+			programHash, err := Uint168FromAddress(address)
+			if err != nil {
+				return nil, errors.New("invalid address in spend policy whitelist: " + address)
+			}
+			policy.whitelist[*programHash] = true
+		}
+	}
+
+	if policy.maxTxAmount == nil && policy.maxDailyAmount == nil &&
+		policy.reauthAmount == nil && policy.whitelist == nil {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// Parse an amount limit of the spend policy, nil if it is not set
+func parseLimit(str string) (*sdk.Amount, error) {
+	if str == "" {
+		return nil, nil
+	}
+	limit, err := sdk.ParseAmount(str)
+	if err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// Reauthenticator is implemented by signers confirming transactions above the
+// reauth amount of the spend policy by themselves, like a remote signing service
+// asking its operator. The wallet asks the signer to confirm, other signers are
+// only delayed until the transaction is signed again after the spend delay.
+type Reauthenticator interface {
+	// Confirm the transaction paying the amount to other addresses, returns
+	// an error if it is refused
+	Reauthenticate(txId *Uint256, amount Fixed64) error
+}
+
+// Check the transaction against the spend policy in config before signing it,
+// returns the policy and the amount to record by recordSpend after the
+// transaction is signed, the policy is nil if there is nothing to record.
+// Outputs to addresses of this wallet are not counted.
+func (wallet *WalletImpl) checkSpendPolicy(signer Signer, txn *Transaction) (*spendPolicy, sdk.Amount, error) {
+	policy, err := newSpendPolicy(config.Values().SpendPolicy)
+	if err != nil || policy == nil {
+		return nil, 0, err
+	}
+
+	amount, err := policy.checkOutputs(txn.Outputs, func(programHash *Uint168) bool {
+		_, err := wallet.GetAddress(programHash)
+		return err == nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	spendLog, err := wallet.GetSpendLog()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	txId := txn.Hash()
+	spent, recorded, err := pruneSpendLog(spendLog, txId, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Signing the same transaction again, like adding a multi-sign signature
+	if recorded {
+		return nil, 0, nil
+	}
+	if err := policy.checkDailyLimit(spent, amount); err != nil {
+		return nil, 0, err
+	}
+
+	if policy.reauthAmount != nil && amount > *policy.reauthAmount {
+		if reauth, ok := signer.(Reauthenticator); ok {
+			if err := reauth.Reauthenticate(&txId, amount.Fixed64()); err != nil {
+				return nil, 0, sdk.NewReason("policy_reauth_refused", sdk.CategoryPolicy, sdk.ActionReauthenticate,
+					fmt.Sprintf("spend policy requires reauthentication, amount %s exceeds %s, refused by the signer, %v",
+						amount.String(), policy.reauthAmount.String(), err),
+					"amount", amount.String(), "limit", policy.reauthAmount.String())
+			}
+		} else if err := wallet.checkSpendDelay(policy, txId, amount, now); err != nil {
+			return nil, 0, err
+		}
+	}
+	return policy, amount, nil
+}
+
+// Record the signed transaction as spent. The spend log is read again under the
+// database lock, so spends signed at the same time are counted to the daily limit.
+func (wallet *WalletImpl) recordSpend(policy *spendPolicy, txId Uint256, amount sdk.Amount) error {
+	now := time.Now()
+	return wallet.UpdateSpendLog(func(spendLog *SpendLog) error {
+		spent, recorded, err := pruneSpendLog(spendLog, txId, now)
+		if err != nil || recorded {
+			return err
+		}
+		if err := policy.checkDailyLimit(spent, amount); err != nil {
+			return err
+		}
+		delete(spendLog.Pending, txId.String())
+		spendLog.Spends = append(spendLog.Spends, SpendRecord{TxId: txId, Amount: amount.Fixed64(), Time: now.Unix()})
+		return nil
+	})
+}
+
+// Check the outputs against the whitelist and the transaction limit, returns
+// the amount paid to other addresses than the ones of this wallet
+func (policy *spendPolicy) checkOutputs(outputs []*Output, isOwn func(*Uint168) bool) (sdk.Amount, error) {
+	var err error
+	var amount sdk.Amount
+	for _, output := range outputs {
+		if isOwn(&output.ProgramHash) {
+			continue
+		}
+		if policy.whitelist != nil && !policy.whitelist[output.ProgramHash] {
+			address, _ := output.ProgramHash.ToAddress()
+			return 0, sdk.NewReason("policy_whitelist", sdk.CategoryPolicy, sdk.ActionChangePolicy,
+				"spend policy refused, address not in whitelist: "+address, "address", address)
+		}
+		if amount, err = amount.Add(sdk.AmountOf(output.Value)); err != nil {
+			return 0, err
+		}
+	}
+
+	if policy.maxTxAmount != nil && amount > *policy.maxTxAmount {
+		return 0, sdk.NewReason("policy_tx_limit", sdk.CategoryPolicy, sdk.ActionChangePolicy,
+			fmt.Sprintf("spend policy refused, amount %s exceeds the transaction limit %s",
+				amount.String(), policy.maxTxAmount.String()),
+			"amount", amount.String(), "limit", policy.maxTxAmount.String())
+	}
+	return amount, nil
+}
+
+// Delay the transaction above the reauth amount until it is signed again after
+// the spend delay, the first sign attempt is saved as pending
+func (wallet *WalletImpl) checkSpendDelay(policy *spendPolicy, txId Uint256, amount sdk.Amount, now time.Time) error {
+	var first int64
+	var pending bool
+	err := wallet.UpdateSpendLog(func(spendLog *SpendLog) error {
+		var err error
+		first, pending, err = markPending(spendLog, txId, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return policy.checkDelay(amount, first, pending, now)
+}
+
+// Save the first sign attempt of the transaction in the spend log, returns the
+// time of the first attempt and if it was pending already
+func markPending(spendLog *SpendLog, txId Uint256, now time.Time) (int64, bool, error) {
+	if _, _, err := pruneSpendLog(spendLog, txId, now); err != nil {
+		return 0, false, err
+	}
+	first, pending := spendLog.Pending[txId.String()]
+	if !pending {
+		first = now.Unix()
+		spendLog.Pending[txId.String()] = first
+	}
+	return first, pending, nil
+}
+
+// Refuse the delayed transaction until the spend delay passed since the first attempt
+func (policy *spendPolicy) checkDelay(amount sdk.Amount, first int64, pending bool, now time.Time) error {
+	if !pending {
+		return sdk.NewReason("policy_delay", sdk.CategoryPolicy, sdk.ActionWait,
+			fmt.Sprintf("spend policy delayed the transaction, amount %s exceeds %s, sign it again after %v to confirm",
+				amount.String(), policy.reauthAmount.String(), policy.spendDelay),
+			"amount", amount.String(), "limit", policy.reauthAmount.String(), "wait", policy.spendDelay.String())
+	}
+	if wait := policy.spendDelay - now.Sub(time.Unix(first, 0)); wait > 0 {
+		return sdk.NewReason("policy_delay_wait", sdk.CategoryPolicy, sdk.ActionWait,
+			fmt.Sprintf("spend policy delayed the transaction, sign it again after %v to confirm",
+				wait.Truncate(time.Second)),
+			"wait", wait.Truncate(time.Second).String())
+	}
+	return nil
+}
+
+func (policy *spendPolicy) checkDailyLimit(spent, amount sdk.Amount) error {
+	if policy.maxDailyAmount == nil {
+		return nil
+	}
+	total, err := spent.Add(amount)
+	if err != nil || total > *policy.maxDailyAmount {
+		return sdk.NewReason("policy_daily_limit", sdk.CategoryPolicy, sdk.ActionWait,
+			fmt.Sprintf("spend policy refused, amount %s exceeds the daily limit %s, spent %s in 24 hours",
+				amount.String(), policy.maxDailyAmount.String(), spent.String()),
+			"amount", amount.String(), "limit", policy.maxDailyAmount.String(), "spent", spent.String())
+	}
+	return nil
+}
+
+// Drop the spends and pending transactions out of the spend period, returns the
+// amount spent in the period and if the transaction is recorded already
+func pruneSpendLog(spendLog *SpendLog, txId Uint256, now time.Time) (sdk.Amount, bool, error) {
+	var err error
+	var spent sdk.Amount
+	var recorded bool
+	var spends []SpendRecord
+	for _, spend := range spendLog.Spends {
+		if now.Sub(time.Unix(spend.Time, 0)) > SpendPeriod {
+			continue
+		}
+		spends = append(spends, spend)
+		if spend.TxId.IsEqual(txId) {
+			recorded = true
+		}
+		if spent, err = spent.Add(sdk.AmountOf(spend.Amount)); err != nil {
+			return 0, false, err
+		}
+	}
+	spendLog.Spends = spends
+	for id, first := range spendLog.Pending {
+		if now.Sub(time.Unix(first, 0)) > SpendPeriod {
+			delete(spendLog.Pending, id)
+		}
+	}
+	return spent, recorded, nil
+}
@@ -0,0 +1,184 @@
+package spvwallet
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.SPV/sdk"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	. "github.com/elastos/Elastos.ELA/core"
+)
+
+func TestCheckDailyLimit(t *testing.T) {
+	limit := sdk.Amount(10 * sdk.SelaPerELA)
+	policy := &spendPolicy{maxDailyAmount: &limit}
+
+	tests := []struct {
+		name   string
+		spent  sdk.Amount
+		amount sdk.Amount
+		ok     bool
+	}{
+		{"below limit", 4 * sdk.SelaPerELA, 5 * sdk.SelaPerELA, true},
+		{"at limit", 5 * sdk.SelaPerELA, 5 * sdk.SelaPerELA, true},
+		{"above limit", 5 * sdk.SelaPerELA, 6 * sdk.SelaPerELA, false},
+		// Wrapping around must not make the sum look below the limit
+		{"overflow", math.MaxInt64, 1, false},
+	}
+	for _, test := range tests {
+		err := policy.checkDailyLimit(test.spent, test.amount)
+		if test.ok && err != nil {
+			t.Errorf("%s: refused: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: accepted, want refused", test.name)
+		}
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	own, payee, other := Uint168{1}, Uint168{2}, Uint168{3}
+	isOwn := func(programHash *Uint168) bool { return programHash.IsEqual(own) }
+	limit := sdk.Amount(10 * sdk.SelaPerELA)
+
+	tests := []struct {
+		name    string
+		policy  *spendPolicy
+		outputs []*Output
+		amount  sdk.Amount
+		reason  string
+	}{
+		{"change not counted", &spendPolicy{maxTxAmount: &limit}, []*Output{
+			{ProgramHash: payee, Value: 4 * sdk.SelaPerELA},
+			{ProgramHash: own, Value: 20 * sdk.SelaPerELA},
+		}, 4 * sdk.SelaPerELA, ""},
+		{"at tx limit", &spendPolicy{maxTxAmount: &limit}, []*Output{
+			{ProgramHash: payee, Value: 6 * sdk.SelaPerELA},
+			{ProgramHash: other, Value: 4 * sdk.SelaPerELA},
+		}, 10 * sdk.SelaPerELA, ""},
+		{"above tx limit", &spendPolicy{maxTxAmount: &limit}, []*Output{
+			{ProgramHash: payee, Value: 6 * sdk.SelaPerELA},
+			{ProgramHash: other, Value: 5 * sdk.SelaPerELA},
+		}, 0, "policy_tx_limit"},
+		{"whitelisted", &spendPolicy{whitelist: map[Uint168]bool{payee: true}}, []*Output{
+			{ProgramHash: payee, Value: 6 * sdk.SelaPerELA},
+			{ProgramHash: own, Value: 5 * sdk.SelaPerELA},
+		}, 6 * sdk.SelaPerELA, ""},
+		{"not whitelisted", &spendPolicy{whitelist: map[Uint168]bool{payee: true}}, []*Output{
+			{ProgramHash: payee, Value: 6 * sdk.SelaPerELA},
+			{ProgramHash: other, Value: 1},
+		}, 0, "policy_whitelist"},
+		// Wrapping around must not make the amount look below the limit
+		{"overflow", &spendPolicy{maxTxAmount: &limit}, []*Output{
+			{ProgramHash: payee, Value: math.MaxInt64},
+			{ProgramHash: other, Value: math.MaxInt64},
+		}, 0, "overflow"},
+	}
+	for _, test := range tests {
+		amount, err := test.policy.checkOutputs(test.outputs, isOwn)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: refused: %v", test.name, err)
+			} else if amount != test.amount {
+				t.Errorf("%s: amount %s, want %s", test.name, amount.String(), test.amount.String())
+			}
+			continue
+		}
+		if test.reason == "overflow" {
+			if err != sdk.ErrAmountOverflow {
+				t.Errorf("%s: got %v, want %v", test.name, err, sdk.ErrAmountOverflow)
+			}
+			continue
+		}
+		if reason := sdk.ReasonOf(err); reason == nil || reason.Code != test.reason {
+			t.Errorf("%s: refused by %v, want %s", test.name, err, test.reason)
+		}
+	}
+}
+
+func TestSpendDelay(t *testing.T) {
+	reauth := sdk.Amount(50 * sdk.SelaPerELA)
+	policy := &spendPolicy{reauthAmount: &reauth, spendDelay: 10 * time.Minute}
+	spendLog := &SpendLog{Pending: make(map[string]int64)}
+	txId, otherTxId := Uint256{1}, Uint256{2}
+	start := time.Unix(1500000000, 0)
+
+	tests := []struct {
+		name   string
+		txId   Uint256
+		after  time.Duration
+		reason string
+	}{
+		{"first attempt", txId, 0, "policy_delay"},
+		{"signed again too soon", txId, 9 * time.Minute, "policy_delay_wait"},
+		{"another transaction", otherTxId, 9 * time.Minute, "policy_delay"},
+		{"signed again after the delay", txId, 10 * time.Minute, ""},
+		{"another transaction too soon", otherTxId, 10 * time.Minute, "policy_delay_wait"},
+		// A pending transaction out of the spend period is delayed again
+		{"first attempt expired", txId, SpendPeriod + time.Minute, "policy_delay"},
+	}
+	for _, test := range tests {
+		now := start.Add(test.after)
+		first, pending, err := markPending(spendLog, test.txId, now)
+		if err != nil {
+			t.Fatalf("%s: mark pending failed: %v", test.name, err)
+		}
+		err = policy.checkDelay(60*sdk.SelaPerELA, first, pending, now)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: refused: %v", test.name, err)
+			}
+			continue
+		}
+		if reason := sdk.ReasonOf(err); reason == nil || reason.Code != test.reason {
+			t.Errorf("%s: refused by %v, want %s", test.name, err, test.reason)
+		}
+	}
+}
+
+func TestPruneSpendLog(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	spendLog := &SpendLog{
+		Spends: []SpendRecord{
+			{TxId: Uint256{1}, Amount: 5 * sdk.SelaPerELA, Time: now.Add(-time.Hour).Unix()},
+			{TxId: Uint256{2}, Amount: 7 * sdk.SelaPerELA, Time: now.Add(-SpendPeriod - time.Hour).Unix()},
+			{TxId: Uint256{3}, Amount: 2 * sdk.SelaPerELA, Time: now.Add(-SpendPeriod + time.Hour).Unix()},
+		},
+		Pending: map[string]int64{
+			"pending": now.Add(-time.Hour).Unix(),
+			"expired": now.Add(-SpendPeriod - time.Hour).Unix(),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		txId     Uint256
+		recorded bool
+	}{
+		// A recorded transaction signed again, like adding a multi-sign
+		// signature, is not counted again
+		{"recorded", Uint256{1}, true},
+		{"recorded out of the period", Uint256{2}, false},
+		{"not recorded", Uint256{4}, false},
+	}
+	for _, test := range tests {
+		spent, recorded, err := pruneSpendLog(spendLog, test.txId, now)
+		if err != nil {
+			t.Fatalf("%s: prune failed: %v", test.name, err)
+		}
+		if recorded != test.recorded {
+			t.Errorf("%s: recorded %v, want %v", test.name, recorded, test.recorded)
+		}
+		if spent != 7*sdk.SelaPerELA {
+			t.Errorf("%s: spent %s, want 7", test.name, spent.String())
+		}
+	}
+	if len(spendLog.Spends) != 2 {
+		t.Errorf("%d spends kept, want 2", len(spendLog.Spends))
+	}
+	if _, ok := spendLog.Pending["expired"]; ok || len(spendLog.Pending) != 1 {
+		t.Errorf("pending transactions %v, want the expired one dropped", spendLog.Pending)
+	}
+}
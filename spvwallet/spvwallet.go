@@ -1,16 +1,24 @@
 package spvwallet
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
 	"sync"
+	"time"
 
 	. "github.com/elastos/Elastos.ELA.SPV/db"
+	"github.com/elastos/Elastos.ELA.SPV/log"
+	"github.com/elastos/Elastos.ELA.SPV/net"
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/config"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+	"github.com/elastos/Elastos.ELA.Utility/crypto"
 	"github.com/elastos/Elastos.ELA/bloom"
 	. "github.com/elastos/Elastos.ELA/core"
-	. "github.com/elastos/Elastos.ELA.Utility/common"
 )
 
 func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
@@ -18,28 +26,83 @@ func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
 	wallet := new(SPVWallet)
 
 	// Initialize headers db
-	wallet.headers, err = db.NewHeadersDB()
+	wallet.headers, err = openHeaders()
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize wallet database
-	wallet.dataStore, err = db.NewSQLiteDB()
+	wallet.dataStore, err = openDataStore()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check wallet data consistency with headers
+	err = wallet.checkConsistency()
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive HD addresses ahead of the used ones, like for a restored keystore
+	wallet.fillHDGap(false)
+
+	// Load script templates of watched contracts
+	for _, template := range config.Values().WatchTemplates {
+		err = wallet.AddScriptTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params, err := networkParams()
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize P2P network client
-	client, err := sdk.GetSPVClient(sdk.TypeMainNet, clientId, seeds)
+	client, err := sdk.GetSPVClientWithParams(params, clientId, seeds)
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize spv service
-	wallet.SPVService, err = sdk.GetSPVService(client, wallet, wallet.getBloomFilter)
+	wallet.SPVService, err = sdk.GetSPVServiceWithParams(params, client, wallet, wallet.getBloomFilter)
 	if err != nil {
 		return nil, err
 	}
+	wallet.Blockchain().SetFinalityDepth(config.Values().FinalityDepth)
+	wallet.PeerManager().SetCompressedAddrs(config.Values().CompressedSeeds)
+	wallet.PeerManager().SetAddrGossip(!config.Values().DisableAddrGossip)
+	wallet.PeerManager().SetServices(config.Values().Services)
+	if hours := config.Values().BanDurationHours; hours > 0 {
+		wallet.PeerManager().SetBanPolicy(net.DefaultBanThreshold, time.Hour*time.Duration(hours))
+	}
+	if proxy := config.Values().Proxy; proxy.Addr != "" {
+		wallet.PeerManager().SetProxy(&net.Proxy{Addr: proxy.Addr, Username: proxy.Username, Password: proxy.Password})
+	}
+	if config.Values().Ephemeral {
+		wallet.PeerManager().DisableAddrCache()
+	}
+	if count := config.Values().TargetOutbound; count > 0 {
+		wallet.PeerManager().SetTargetOutbound(count)
+	}
+	if minutes := config.Values().PeerChurnMinutes; minutes > 0 {
+		wallet.PeerManager().SetPeerChurn(time.Minute * time.Duration(minutes))
+	}
+	for _, addr := range config.Values().PersistentPeers {
+		wallet.PeerManager().ConnManager().AddPeer(addr)
+	}
+	wallet.SetBlocksOnly(config.Values().BlocksOnly)
+	wallet.SetHeadersFirst(config.Values().HeadersFirst)
+	wallet.SetParallelDownload(config.Values().ParallelDownload)
+	wallet.SetServeHeaders(config.Values().ServeHeaders)
+	if config.Values().CompactFilters {
+		wallet.SetCompactFilters(wallet.getFilterElements)
+	}
+	wallet.Blockchain().SetTxExpiry(time.Hour * time.Duration(config.Values().TxExpiryHours))
+	wallet.SetOrphanPoolLimits(orphanPoolLimits())
+	wallet.SetSplitAlert(splitAlert())
+	wallet.SetConcurrency(sdk.ConcurrencyConfig(config.Values().Concurrency))
 
 	// Initialize RPC server
 	wallet.rpcServer = rpc.InitServer(wallet)
@@ -47,6 +110,115 @@ func Init(clientId uint64, seeds []string) (*SPVWallet, error) {
 	return wallet, nil
 }
 
+// Get the network params, main net by default
+func networkParams() (*sdk.NetworkParams, error) {
+	params := *sdk.MainNetParams
+	if magic := config.Values().Magic; magic != 0 {
+		params.Magic = magic
+	}
+	if genesis := config.Values().GenesisHeader; genesis != "" {
+		header, err := HexStringToBytes(genesis)
+		if err != nil {
+			return nil, errors.New("invalid genesis header hex string")
+		}
+		params.GenesisHeader = header
+	}
+	params.DNSSeeds = config.Values().DNSSeeds
+	for _, str := range config.Values().Checkpoints {
+		checkpoint, err := sdk.ParseCheckpoint(str)
+		if err != nil {
+			return nil, err
+		}
+		params.Checkpoints = append(params.Checkpoints, checkpoint)
+	}
+	for _, cfg := range config.Values().Rules {
+		rules := sdk.Rules{
+			Height:         cfg.Height,
+			HeaderVersions: cfg.HeaderVersions,
+			PowLimitBits:   cfg.PowLimitBits,
+			DPoS:           cfg.DPoS,
+		}
+		for _, txType := range cfg.TxTypes {
+			if txType > 0xff {
+				return nil, fmt.Errorf("invalid transaction type %d in rules at height %d", txType, cfg.Height)
+			}
+			rules.TxTypes = append(rules.TxTypes, TransactionType(txType))
+		}
+		params.Rules = append(params.Rules, rules)
+	}
+	return &params, nil
+}
+
+// Get the orphan pool limits, the sdk defaults if not configured
+func orphanPoolLimits() (int, time.Duration) {
+	maxTxs, expiry := sdk.DefaultMaxOrphanTxs, sdk.DefaultOrphanTxExpiry
+	if max := config.Values().MaxOrphanTxs; max < 0 {
+		maxTxs = 0
+	} else if max > 0 {
+		maxTxs = max
+	}
+	if minutes := config.Values().OrphanTxExpiryMinutes; minutes > 0 {
+		expiry = time.Minute * time.Duration(minutes)
+	}
+	return maxTxs, expiry
+}
+
+// Get the chain split alert settings, the sdk defaults if not configured
+func splitAlert() (uint32, time.Duration) {
+	threshold, duration := uint32(sdk.SplitHeightThreshold), time.Second*sdk.SplitAlertDuration
+	if height := config.Values().SplitHeightThreshold; height > 0 {
+		threshold = height
+	}
+	if seconds := config.Values().SplitAlertSeconds; seconds > 0 {
+		duration = time.Second * time.Duration(seconds)
+	}
+	return threshold, duration
+}
+
+// Get the configured storage driver, the memory driver for the ephemeral mode
+func storeDriver() (db.Driver, error) {
+	name := config.Values().StoreDriver
+	if config.Values().Ephemeral {
+		name = "memory"
+	}
+	if name == "" {
+		name = "bolt"
+	}
+	return db.GetDriver(name)
+}
+
+func storeOptions() *db.Options {
+	options := &db.Options{HeaderPruneInterval: config.Values().HeaderPruneInterval}
+	if passphrase := config.Values().DatabasePassphrase; passphrase != "" {
+		options.Passphrase = []byte(passphrase)
+	}
+	return options
+}
+
+// Open headers db with the configured storage driver
+func openHeaders() (db.Headers, error) {
+	driver, err := storeDriver()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := driver.OpenHeaders(storeOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	headers.SetVerifyOnRead(config.Values().VerifyOnRead)
+	return headers, nil
+}
+
+// Open wallet database with the configured storage driver
+func openDataStore() (db.DataStore, error) {
+	driver, err := storeDriver()
+	if err != nil {
+		return nil, err
+	}
+	return driver.OpenDataStore(storeOptions())
+}
+
 type SPVWallet struct {
 	sync.Mutex
 	sdk.SPVService
@@ -54,6 +226,7 @@ type SPVWallet struct {
 	headers   db.Headers
 	dataStore db.DataStore
 	filter    *sdk.AddrFilter
+	templates []*sdk.ScriptTemplate
 }
 
 func (wallet *SPVWallet) Start() {
@@ -76,7 +249,14 @@ func (wallet *SPVWallet) DataStore() db.DataStore {
 
 // Save a header to database
 func (wallet *SPVWallet) PutHeader(header *StoreHeader, newTip bool) error {
-	return wallet.headers.Put(header, newTip)
+	err := wallet.headers.Put(header, newTip)
+	if err != nil {
+		return err
+	}
+	if newTip {
+		wallet.updateSyncCheckpoint(header)
+	}
+	return nil
 }
 
 // Get previous block of the given header
@@ -89,11 +269,56 @@ func (wallet *SPVWallet) GetHeader(hash Uint256) (*StoreHeader, error) {
 	return wallet.headers.GetHeader(hash)
 }
 
+// Get the hash of the ancestor of the header at the given height
+func (wallet *SPVWallet) GetAncestor(header *StoreHeader, height uint32) (*Uint256, error) {
+	return wallet.headers.GetAncestor(header, height)
+}
+
 // Get the header on chain tip
 func (wallet *SPVWallet) GetChainTip() (*StoreHeader, error) {
 	return wallet.headers.GetTip()
 }
 
+// Save sync statistics to info table
+func (wallet *SPVWallet) PutSyncStats(data []byte) error {
+	return wallet.dataStore.Info().Put(db.SyncStatsKey, data)
+}
+
+// Get sync statistics from info table
+func (wallet *SPVWallet) GetSyncStats() ([]byte, error) {
+	return wallet.dataStore.Info().Get(db.SyncStatsKey)
+}
+
+// Save response statistics to info table
+func (wallet *SPVWallet) PutResponseStats(data []byte) error {
+	return wallet.dataStore.Info().Put(db.ResponseStatsKey, data)
+}
+
+// Get response statistics from info table
+func (wallet *SPVWallet) GetResponseStats() ([]byte, error) {
+	return wallet.dataStore.Info().Get(db.ResponseStatsKey)
+}
+
+// Create block locator from headers db, headers may be pruned
+func (wallet *SPVWallet) GetBlockLocatorHashes() []*Uint256 {
+	return wallet.headers.GetBlockLocatorHashes()
+}
+
+// Save the changes of a block at once if the wallet database batches them
+func (wallet *SPVWallet) BeginBatch() error {
+	if batcher, ok := wallet.dataStore.(Batcher); ok {
+		return batcher.BeginBatch()
+	}
+	return nil
+}
+
+func (wallet *SPVWallet) EndBatch() error {
+	if batcher, ok := wallet.dataStore.(Batcher); ok {
+		return batcher.EndBatch()
+	}
+	return nil
+}
+
 // Save chain height to database
 func (wallet *SPVWallet) PutChainHeight(height uint32) {
 	wallet.dataStore.Info().SaveChainHeight(height)
@@ -106,8 +331,58 @@ func (wallet *SPVWallet) GetChainHeight() uint32 {
 
 // Commit a transaction return if this is a false positive and error
 func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
-	hits := 0
+	// Watch contracts matching script templates
+	err := wallet.watchTemplateScripts(storeTx)
+	if err != nil {
+		return false, err
+	}
+
 	// Save UTXOs
+	hits, err := wallet.commitOutputs(storeTx)
+	if err != nil {
+		return false, err
+	}
+
+	// Keep the gap limit of HD addresses after the received outputs
+	if hits > 0 {
+		wallet.fillHDGap(true)
+	}
+
+	// Put spent UTXOs to STXOs
+	spent := wallet.commitInputs(storeTx)
+	hits += spent
+
+	// If no hits, no need to save transaction
+	if hits == 0 {
+		return true, nil
+	}
+
+	// Save the asset registered by the transaction
+	if storeTx.Data.TxType == RegisterAsset {
+		err := wallet.putAsset(storeTx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Save transaction
+	err = wallet.dataStore.Txs().Put(storeTx)
+	if err != nil {
+		return false, err
+	}
+
+	// Save who sent or received the payment, change is not a counterpart
+	err = wallet.putCounterparts(storeTx, spent > 0)
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Save the outputs to wallet addresses as UTXOs, returns the number of them
+func (wallet *SPVWallet) commitOutputs(storeTx *StoreTx) (int, error) {
+	hits := 0
 	for index, output := range storeTx.Data.Outputs {
 		// Filter address
 		if wallet.getAddrFilter().ContainAddr(output.ProgramHash) {
@@ -116,15 +391,79 @@ func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
 				lockTime = storeTx.Height + 100
 			}
 			utxo := ToUTXO(storeTx.TxId, storeTx.Height, index, output.Value, lockTime)
+			// Outputs of other assets than ELA are kept with their asset id
+			if output.AssetID != SystemAssetId {
+				utxo.AssetID = output.AssetID
+			}
 			err := wallet.dataStore.UTXOs().Put(&output.ProgramHash, utxo)
 			if err != nil {
-				return false, err
+				return hits, err
 			}
 			hits++
 		}
 	}
+	return hits, nil
+}
 
-	// Put spent UTXOs to STXOs
+// Watch the contract addresses of the transaction programs matching script templates,
+// outputs only carry program hashes, so contract scripts are found when spent from
+func (wallet *SPVWallet) watchTemplateScripts(storeTx *StoreTx) error {
+	var watched bool
+	for _, program := range storeTx.Data.Programs {
+		filter := wallet.getAddrFilter()
+		if !filter.MatchTemplates(program.Code) {
+			continue
+		}
+		hash, err := crypto.ToProgramHash(program.Code)
+		if err != nil || filter.ContainAddr(*hash) {
+			continue
+		}
+		err = wallet.dataStore.Addrs().Put(hash, program.Code, db.TypeWatch, "")
+		if err != nil {
+			return err
+		}
+		filter.AddAddr(hash)
+		watched = true
+
+		address, _ := hash.ToAddress()
+		log.Info("Watch contract matching script template, address:", address)
+	}
+
+	// Broadcast filterload message to include the new addresses
+	if watched {
+		wallet.nextFilterGeneration()
+		go wallet.BroadCastMessage(wallet.getBloomFilter().GetFilterLoadMsg())
+	}
+	return nil
+}
+
+// Derive the HD addresses up to the gap limit after the last used ones and add
+// them to the address filter, broadcast the filter to the peers if asked
+func (wallet *SPVWallet) fillHDGap(broadcast bool) {
+	added, err := FillHDGap(wallet.dataStore)
+	if err != nil {
+		// The keystore may not be created yet
+		log.Debug("Fill HD address gap failed,", err)
+		return
+	}
+	if len(added) == 0 {
+		return
+	}
+	filter := wallet.getAddrFilter()
+	for _, hash := range added {
+		filter.AddAddr(hash)
+	}
+	log.Info("Derived HD addresses ahead of the used ones:", len(added))
+
+	if broadcast {
+		wallet.nextFilterGeneration()
+		go wallet.BroadCastMessage(wallet.getBloomFilter().GetFilterLoadMsg())
+	}
+}
+
+// Move the UTXOs spent by the transaction to STXOs, returns the number of them
+func (wallet *SPVWallet) commitInputs(storeTx *StoreTx) int {
+	hits := 0
 	for _, input := range storeTx.Data.Inputs {
 		// Try to move UTXO to STXO, if a UTXO in database was spent, it will be moved to STXO
 		err := wallet.dataStore.STXOs().FromUTXO(&input.Previous, &storeTx.TxId, storeTx.Height)
@@ -132,19 +471,64 @@ func (wallet *SPVWallet) CommitTx(storeTx *StoreTx) (bool, error) {
 			hits++
 		}
 	}
+	return hits
+}
 
-	// If no hits, no need to save transaction
-	if hits == 0 {
-		return true, nil
+func (wallet *SPVWallet) putAsset(storeTx *StoreTx) error {
+	payload, ok := storeTx.Data.Payload.(*PayloadRegisterAsset)
+	if !ok {
+		return errors.New("invalid register asset payload")
 	}
+	return wallet.dataStore.Assets().Put(&db.RegisteredAsset{
+		ID:          storeTx.TxId,
+		Name:        payload.Asset.Name,
+		Description: payload.Asset.Description,
+		Precision:   payload.Asset.Precision,
+		AssetType:   byte(payload.Asset.AssetType),
+		Amount:      payload.Amount,
+		Controller:  payload.Controller,
+		Height:      storeTx.Height,
+	})
+}
 
-	// Save transaction
-	err := wallet.dataStore.Txs().Put(storeTx)
+// Check if the transaction is stored
+func (wallet *SPVWallet) HaveTx(txId Uint256) bool {
+	_, err := wallet.dataStore.Txs().Get(&txId)
+	return err == nil
+}
+
+// Get the stored transaction, to price the transactions spending it
+func (wallet *SPVWallet) GetTx(txId Uint256) (*StoreTx, error) {
+	return wallet.dataStore.Txs().Get(&txId)
+}
+
+// Get a random confirmed wallet transaction and its block to probe
+// if peers honor the bloom filter
+func (wallet *SPVWallet) GetFilterProbe() (Uint256, Uint256, bool) {
+	txs, err := wallet.dataStore.Txs().GetAll()
 	if err != nil {
-		return false, err
+		return Uint256{}, Uint256{}, false
+	}
+	var confirmed []*StoreTx
+	for _, tx := range txs {
+		if tx.Height > 0 {
+			confirmed = append(confirmed, tx)
+		}
+	}
+	if len(confirmed) == 0 {
+		return Uint256{}, Uint256{}, false
 	}
+	tx := confirmed[rand.Intn(len(confirmed))]
 
-	return false, nil
+	tip, err := wallet.headers.GetTip()
+	if err != nil {
+		return Uint256{}, Uint256{}, false
+	}
+	blockHash, err := wallet.headers.GetAncestor(tip, tx.Height)
+	if err != nil {
+		return Uint256{}, Uint256{}, false
+	}
+	return tx.TxId, *blockHash, true
 }
 
 // Rollback chain data on the given height
@@ -152,6 +536,28 @@ func (wallet *SPVWallet) Rollback(height uint32) error {
 	return wallet.dataStore.Rollback(height)
 }
 
+// Expire unconfirmed transactions received before the given time
+func (wallet *SPVWallet) ExpireTxs(before time.Time) ([]Uint256, error) {
+	return wallet.dataStore.ExpireTxs(before)
+}
+
+// Iterate the headers on the main chain from height from to height to,
+// to of 0 means the chain tip
+func (wallet *SPVWallet) IterateHeaders(from, to uint32) (*db.HeaderIterator, error) {
+	return db.NewHeaderIterator(wallet.headers, from, to)
+}
+
+// Iterate confirmed wallet transactions from the given height,
+// the iterator must be closed after the iteration
+func (wallet *SPVWallet) IterateTxs(height uint32) (*db.TxIterator, error) {
+	return wallet.dataStore.Txs().Iterate(height)
+}
+
+// Save a ban score event of a peer
+func (wallet *SPVWallet) PutMisbehavior(record *MisbehaviorRecord) error {
+	return wallet.dataStore.Misbehaviors().Put(record)
+}
+
 // Reset database, clear all data
 func (wallet *SPVWallet) Reset() error {
 	err := wallet.headers.Reset()
@@ -180,20 +586,37 @@ func ToUTXO(txId Uint256, height uint32, index int, value Fixed64, lockTime uint
 	return utxo
 }
 
+// Watch contracts whose scripts match the template, a script hex string
+// with <key> wildcards for public keys
+func (wallet *SPVWallet) AddScriptTemplate(template string) error {
+	scriptTemplate, err := sdk.ParseScriptTemplate(template)
+	if err != nil {
+		return err
+	}
+	wallet.templates = append(wallet.templates, scriptTemplate)
+	wallet.getAddrFilter().AddTemplate(scriptTemplate)
+	return nil
+}
+
 func (wallet *SPVWallet) NotifyNewAddress(hash []byte) error {
 	// Reload address filter to include new address
 	wallet.loadAddrFilter()
+	wallet.nextFilterGeneration()
 	// Broadcast filterload message to connected peers
 	wallet.BroadCastMessage(wallet.getBloomFilter().GetFilterLoadMsg())
 	return nil
 }
 
-func (wallet *SPVWallet) SendTransaction(tx Transaction) error {
-	// Broadcast transaction to connected peers
-	wallet.BroadCastMessage(&tx)
+func (wallet *SPVWallet) AcceptReorg(forkPoint Uint256) error {
+	wallet.Blockchain().AcceptReorg(forkPoint)
 	return nil
 }
 
+func (wallet *SPVWallet) SendTransaction(tx Transaction) error {
+	// Broadcast transaction to connected peers and watch the propagation
+	return wallet.SPVService.SendTransaction(tx)
+}
+
 func (wallet *SPVWallet) getAddrFilter() *sdk.AddrFilter {
 	if wallet.filter == nil {
 		wallet.loadAddrFilter()
@@ -205,8 +628,14 @@ func (wallet *SPVWallet) loadAddrFilter() *sdk.AddrFilter {
 	addrs, _ := wallet.dataStore.Addrs().GetAll()
 	wallet.filter = sdk.NewAddrFilter(nil)
 	for _, addr := range addrs {
+		if addr.Archived() {
+			continue
+		}
 		wallet.filter.AddAddr(addr.Hash())
 	}
+	for _, template := range wallet.templates {
+		wallet.filter.AddTemplate(template)
+	}
 	return wallet.filter
 }
 
@@ -229,9 +658,56 @@ func (wallet *SPVWallet) getBloomFilter() *bloom.Filter {
 		filter.AddOutPoint(&utxo.Op)
 	}
 
+	archived := wallet.getArchivedOutPoints()
 	for _, stxo := range stxos {
-		filter.AddOutPoint(&stxo.Op)
+		if !archived[stxo.Op] {
+			filter.AddOutPoint(&stxo.Op)
+		}
 	}
 
 	return filter
 }
+
+// Get the spent outpoints of archived addresses, they are left out of the filter
+func (wallet *SPVWallet) getArchivedOutPoints() map[OutPoint]bool {
+	archived := make(map[OutPoint]bool)
+	addrs, _ := wallet.dataStore.Addrs().GetAll()
+	for _, addr := range addrs {
+		if !addr.Archived() {
+			continue
+		}
+		stxos, _ := wallet.dataStore.STXOs().GetAddrAll(addr.Hash())
+		for _, stxo := range stxos {
+			archived[stxo.Op] = true
+		}
+	}
+	return archived
+}
+
+// The items matched with compact filters, the same as added to the bloom filter
+func (wallet *SPVWallet) getFilterElements() [][]byte {
+	wallet.Lock()
+	defer wallet.Unlock()
+
+	addrs := wallet.getAddrFilter().GetAddrs()
+	utxos, _ := wallet.dataStore.UTXOs().GetAll()
+	stxos, _ := wallet.dataStore.STXOs().GetAll()
+
+	elements := make([][]byte, 0, len(addrs)+len(utxos)+len(stxos))
+	for _, addr := range addrs {
+		elements = append(elements, addr.Bytes())
+	}
+
+	for _, utxo := range utxos {
+		elements = append(elements, utxo.Op.Bytes())
+	}
+
+	archived := wallet.getArchivedOutPoints()
+	for _, stxo := range stxos {
+		if !archived[stxo.Op] {
+			elements = append(elements, stxo.Op.Bytes())
+		}
+	}
+
+	return elements
+}
@@ -0,0 +1,179 @@
+package spvwallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+
+	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
+
+	. "github.com/elastos/Elastos.ELA.Utility/common"
+)
+
+// Export the addresses and transactions changed since the given position,
+// encrypted with the sync key of the keystore and encoded in base64, so it can
+// be passed to another device sharing the keystore through any channel.
+// The position of the exported delta is returned to export from next time.
+func (wallet *WalletImpl) ExportDelta(password []byte, since DeltaSeq) ([]byte, DeltaSeq, error) {
+	err := wallet.VerifyPassword(password)
+	if err != nil {
+		return nil, since, err
+	}
+
+	delta, err := wallet.GetDelta(since)
+	if err != nil {
+		return nil, since, err
+	}
+
+	plain, err := json.Marshal(delta)
+	if err != nil {
+		return nil, since, err
+	}
+
+	gcm, err := newSyncCipher(wallet.Keystore.SyncKey())
+	if err != nil {
+		return nil, since, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, since, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+
+	data := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(data, sealed)
+	return data, delta.Seq, nil
+}
+
+// Import a delta exported by another device sharing the keystore, unknown
+// addresses and payees are added and blocks are rescanned from the lowest height
+// of unknown transactions, returns the number of addresses and transactions added.
+// The account indexes of the keystore are advanced past the imported addresses first.
+func (wallet *WalletImpl) ImportDelta(password []byte, data []byte) (int, int, error) {
+	err := wallet.VerifyPassword(password)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(sealed, data)
+	if err != nil {
+		return 0, 0, errors.New("invalid delta encoding")
+	}
+	sealed = sealed[:n]
+
+	gcm, err := newSyncCipher(wallet.Keystore.SyncKey())
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return 0, 0, errors.New("invalid delta size")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return 0, 0, errors.New("decrypt delta failed, it is not exported from this wallet")
+	}
+
+	var delta StoreDelta
+	err = json.Unmarshal(plain, &delta)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	paths := make([]string, 0, len(delta.Addrs))
+	for _, addr := range delta.Addrs {
+		paths = append(paths, addr.Path)
+	}
+	err = wallet.Keystore.AdvanceIndexes(paths)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var addrs int
+	for _, addr := range delta.Addrs {
+		if existing, err := wallet.GetAddress(&addr.Hash); err == nil {
+			if existing.Archived() != addr.Archived {
+				err = wallet.SetAddressArchived(&addr.Hash, addr.Archived)
+				if err != nil {
+					return addrs, 0, err
+				}
+			}
+			continue
+		}
+		err = wallet.AddAddress(&addr.Hash, addr.Script, addr.Type, addr.Path)
+		if err != nil {
+			return addrs, 0, err
+		}
+		if addr.Archived {
+			err = wallet.SetAddressArchived(&addr.Hash, true)
+			if err != nil {
+				return addrs, 0, err
+			}
+		}
+		addrs++
+	}
+
+	for _, payee := range delta.Payees {
+		existing, err := wallet.GetPayee(payee.Name)
+		if err == nil && existing.Address == payee.Address && existing.Memo == payee.Memo {
+			continue
+		}
+		address, err := payee.Address.ToAddress()
+		if err != nil {
+			return addrs, 0, err
+		}
+		err = wallet.AddPayee(payee.Name, address, payee.Memo)
+		if err != nil {
+			return addrs, 0, err
+		}
+	}
+
+	storeTxs, err := wallet.GetTxs()
+	if err != nil {
+		return addrs, 0, err
+	}
+	known := make(map[Uint256]bool)
+	for _, storeTx := range storeTxs {
+		known[storeTx.TxId] = true
+	}
+
+	// Unconfirmed transactions are found after they are confirmed
+	var txs int
+	var rescanHeight uint32 = math.MaxUint32
+	for _, tx := range delta.Txs {
+		if known[tx.TxId] || tx.Height == 0 {
+			continue
+		}
+		txs++
+		if tx.Height < rescanHeight {
+			rescanHeight = tx.Height
+		}
+	}
+
+	if addrs > 0 {
+		// Notify SPV service to reload bloom filter with the new addresses
+		rpc.GetClient().NotifyNewAddress(delta.Addrs[0].Hash.Bytes())
+	}
+	if txs > 0 {
+		err = rpc.GetClient().Rescan(rescanHeight)
+		if err != nil {
+			return addrs, txs, errors.New("rescan failed, " + err.Error())
+		}
+	}
+
+	return addrs, txs, nil
+}
+
+func newSyncCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
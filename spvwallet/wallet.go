@@ -6,22 +6,30 @@ import (
 	"errors"
 	"strconv"
 	"math/rand"
+	"sort"
+	"time"
 
 	. "github.com/elastos/Elastos.ELA.SPV/spvwallet/db"
 	"github.com/elastos/Elastos.ELA.SPV/log"
-	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 	"github.com/elastos/Elastos.ELA.SPV/sdk"
+	"github.com/elastos/Elastos.ELA.SPV/spvwallet/rpc"
 
 	. "github.com/elastos/Elastos.ELA/core"
 	. "github.com/elastos/Elastos.ELA.Utility/common"
 	"github.com/elastos/Elastos.ELA.Utility/crypto"
 )
 
-var SystemAssetId = getSystemAssetId()
+var SystemAssetId = sdk.SystemAssetID
 
 type Transfer struct {
 	Address string
 	Value   *Fixed64
+	// Lock the output until the height instead of the lock height of the
+	// transaction, 0 means the lock height of the transaction
+	LockedUntil uint32
+	// A label of the output kept in the wallet, like an invoice or payout
+	// reference, it is not put on chain
+	Label string
 }
 
 var wallet Wallet // Single instance of wallet
@@ -33,19 +41,39 @@ type Wallet interface {
 	ChangePassword(oldPassword, newPassword []byte) error
 
 	NewSubAccount(password []byte) (*Uint168, error)
+	NewReceiveAddress() (*Uint168, error)
+	GetReceiveAddress() (*Uint168, error)
 	AddMultiSignAccount(M uint, publicKey ...*crypto.PublicKey) (*Uint168, error)
+	ImportPrivateKey(password []byte, key string, birthday uint32) (*Uint168, error)
+	ArchiveAddress(address *Uint168) error
+	UnarchiveAddress(address *Uint168, rescanFrom uint32) error
+	GetAddrClusters() ([][]*Addr, error)
+	GetHistory() ([]*HistoryRecord, error)
+	GetTxGraph() (*TxGraph, error)
+	ExportDelta(password []byte, since DeltaSeq) ([]byte, DeltaSeq, error)
+	ImportDelta(password []byte, data []byte) (int, int, error)
 
 	CreateTransaction(fromAddress, toAddress string, amount, fee *Fixed64) (*Transaction, error)
 	CreateLockedTransaction(fromAddress, toAddress string, amount, fee *Fixed64, lockedUntil uint32) (*Transaction, error)
 	CreateMultiOutputTransaction(fromAddress string, fee *Fixed64, output ...*Transfer) (*Transaction, error)
 	CreateLockedMultiOutputTransaction(fromAddress string, fee *Fixed64, lockedUntil uint32, output ...*Transfer) (*Transaction, error)
+	CreatePayeeTransaction(fromAddress, payee string, amount, fee *Fixed64) (*Transaction, error)
+	CreatePaymentRequestTransaction(fromAddress string, request *sdk.PaymentRequest, amount, fee *Fixed64) (*Transaction, error)
+	GetOutputLabels(txId Uint256) (map[uint16]string, error)
+	CreateTransactionWithTarget(fromAddress string, target ConfirmTarget, lockedUntil uint32, output ...*Transfer) (*Transaction, error)
+	EstimateFeeRate(target ConfirmTarget) (sdk.FeeRate, error)
+	GetFeeTargetReports() ([]*FeeTargetReport, error)
 	Sign(password []byte, transaction *Transaction) (*Transaction, error)
+	SignWith(signer Signer, transaction *Transaction) (*Transaction, error)
+	GetSignerPaths(transaction *Transaction) (map[Uint168]string, error)
 	SendTransaction(txn *Transaction) error
+	SetCoinSelector(selector sdk.CoinSelector)
 }
 
 type WalletImpl struct {
 	Database
 	Keystore
+	coinSelector sdk.CoinSelector
 }
 
 func Create(password []byte) (Wallet, error) {
@@ -62,7 +90,7 @@ func Create(password []byte) (Wallet, error) {
 	}
 
 	mainAccount := keyStore.GetAccountByIndex(0)
-	database.AddAddress(mainAccount.ProgramHash(), mainAccount.RedeemScript(), TypeMaster)
+	database.AddAddress(mainAccount.ProgramHash(), mainAccount.RedeemScript(), TypeMaster, AccountIndexPath(0))
 
 	wallet = &WalletImpl{
 		Database: database,
@@ -92,6 +120,17 @@ func (wallet *WalletImpl) VerifyPassword(password []byte) error {
 		return err
 	}
 	wallet.Keystore = keyStore
+	return wallet.fillAccountPaths()
+}
+
+// Set the index paths of sub accounts saved by earlier versions without one
+func (wallet *WalletImpl) fillAccountPaths() error {
+	for index, account := range wallet.Keystore.GetAccounts() {
+		err := wallet.SetAddressPath(account.ProgramHash(), AccountIndexPath(index))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -102,7 +141,37 @@ func (wallet *WalletImpl) NewSubAccount(password []byte) (*Uint168, error) {
 	}
 
 	account := wallet.Keystore.NewAccount()
-	err = wallet.AddAddress(account.ProgramHash(), account.RedeemScript(), TypeSub)
+	path := AccountIndexPath(len(wallet.Keystore.GetAccounts()) - 1)
+	err = wallet.AddAddress(account.ProgramHash(), account.RedeemScript(), TypeSub, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Notify SPV service to reload bloom filter with the new address
+	rpc.GetClient().NotifyNewAddress(account.ProgramHash().Bytes())
+
+	return account.ProgramHash(), nil
+}
+
+// Import a private key in WIF or hex format, the transactions of it's address
+// are rescanned from the birthday height, use 0 if the birthday is unknown.
+func (wallet *WalletImpl) ImportPrivateKey(password []byte, key string, birthday uint32) (*Uint168, error) {
+	privateKey, err := DecodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallet.VerifyPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := wallet.Keystore.ImportAccount(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallet.AddAddress(account.ProgramHash(), account.RedeemScript(), TypeImported, "")
 	if err != nil {
 		return nil, err
 	}
@@ -110,9 +179,49 @@ func (wallet *WalletImpl) NewSubAccount(password []byte) (*Uint168, error) {
 	// Notify SPV service to reload bloom filter with the new address
 	rpc.GetClient().NotifyNewAddress(account.ProgramHash().Bytes())
 
+	// Download blocks since the birthday to find transactions of the imported address
+	err = rpc.GetClient().Rescan(birthday)
+	if err != nil {
+		return nil, errors.New("rescan failed, " + err.Error())
+	}
+
 	return account.ProgramHash(), nil
 }
 
+// Archive a fully spent address, it is left out of the filter to shrink it and lower
+// the false positive rate, it's transactions are still kept in the wallet history.
+// Payments to an archived address are not seen, unarchive it to find them.
+func (wallet *WalletImpl) ArchiveAddress(address *Uint168) error {
+	err := wallet.SetAddressArchived(address, true)
+	if err != nil {
+		return err
+	}
+
+	// Notify SPV service to reload bloom filter without the address
+	rpc.GetClient().NotifyNewAddress(address.Bytes())
+
+	return nil
+}
+
+// Unarchive an address and rescan blocks from the given height to find the
+// payments to it received while archived
+func (wallet *WalletImpl) UnarchiveAddress(address *Uint168, rescanFrom uint32) error {
+	err := wallet.SetAddressArchived(address, false)
+	if err != nil {
+		return err
+	}
+
+	// Notify SPV service to reload bloom filter with the address
+	rpc.GetClient().NotifyNewAddress(address.Bytes())
+
+	err = rpc.GetClient().Rescan(rescanFrom)
+	if err != nil {
+		return errors.New("rescan failed, " + err.Error())
+	}
+
+	return nil
+}
+
 func (wallet *WalletImpl) AddMultiSignAccount(M uint, publicKeys ...*crypto.PublicKey) (*Uint168, error) {
 	redeemScript, err := crypto.CreateMultiSignRedeemScript(M, publicKeys)
 	if err != nil {
@@ -124,7 +233,7 @@ func (wallet *WalletImpl) AddMultiSignAccount(M uint, publicKeys ...*crypto.Publ
 		return nil, errors.New("[Wallet], CreateMultiSignAddress failed")
 	}
 
-	err = wallet.AddAddress(programHash, redeemScript, TypeMulti)
+	err = wallet.AddAddress(programHash, redeemScript, TypeMulti, "")
 	if err != nil {
 		return nil, err
 	}
@@ -140,7 +249,58 @@ func (wallet *WalletImpl) CreateTransaction(fromAddress, toAddress string, amoun
 }
 
 func (wallet *WalletImpl) CreateLockedTransaction(fromAddress, toAddress string, amount, fee *Fixed64, lockedUntil uint32) (*Transaction, error) {
-	return wallet.CreateLockedMultiOutputTransaction(fromAddress, fee, lockedUntil, &Transfer{toAddress, amount})
+	return wallet.CreateLockedMultiOutputTransaction(fromAddress, fee, lockedUntil, &Transfer{Address: toAddress, Value: amount})
+}
+
+// Create a transaction paying the payee in the address book, the default memo
+// of the payee is attached to the transaction
+func (wallet *WalletImpl) CreatePayeeTransaction(fromAddress, name string, amount, fee *Fixed64) (*Transaction, error) {
+	payee, err := wallet.GetPayee(name)
+	if err != nil {
+		return nil, err
+	}
+	address, err := payee.Address.ToAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := wallet.createTransaction(fromAddress, fee, uint32(0), &Transfer{Address: address, Value: amount})
+	if err != nil {
+		return nil, err
+	}
+	if payee.Memo != "" {
+		memo := NewAttribute(Memo, []byte(payee.Memo))
+		txn.Attributes = append(txn.Attributes, &memo)
+	}
+
+	return txn, wallet.TouchPayee(payee.Name)
+}
+
+// Create a transaction paying a payment request, the amount is used only if the
+// request has none, the memo of the request is attached to the transaction
+func (wallet *WalletImpl) CreatePaymentRequestTransaction(fromAddress string, request *sdk.PaymentRequest, amount, fee *Fixed64) (*Transaction, error) {
+	if request.Expired(time.Now()) {
+		return nil, sdk.ErrPaymentRequestExpired
+	}
+	if request.Amount > 0 {
+		value := request.Amount.Fixed64()
+		amount = &value
+	}
+	if amount == nil {
+		return nil, errors.New("the payment request has no amount, specify the amount to pay")
+	}
+
+	transfer := &Transfer{Address: request.Address, Value: amount, Label: request.Memo}
+	txn, err := wallet.createTransaction(fromAddress, fee, uint32(0), transfer)
+	if err != nil {
+		return nil, err
+	}
+	if request.Memo != "" {
+		memo := NewAttribute(Memo, []byte(request.Memo))
+		txn.Attributes = append(txn.Attributes, &memo)
+	}
+
+	return txn, wallet.putOutputLabels(txn, []*Transfer{transfer})
 }
 
 func (wallet *WalletImpl) CreateMultiOutputTransaction(fromAddress string, fee *Fixed64, outputs ...*Transfer) (*Transaction, error) {
@@ -148,29 +308,43 @@ func (wallet *WalletImpl) CreateMultiOutputTransaction(fromAddress string, fee *
 }
 
 func (wallet *WalletImpl) CreateLockedMultiOutputTransaction(fromAddress string, fee *Fixed64, lockedUntil uint32, outputs ...*Transfer) (*Transaction, error) {
-	return wallet.createTransaction(fromAddress, fee, lockedUntil, outputs...)
+	txn, err := wallet.createTransaction(fromAddress, fee, lockedUntil, outputs...)
+	if err != nil {
+		return nil, err
+	}
+	return txn, wallet.putOutputLabels(txn, outputs)
 }
 
 func (wallet *WalletImpl) createTransaction(fromAddress string, fee *Fixed64, lockedUntil uint32, outputs ...*Transfer) (*Transaction, error) {
 	// Check if output is valid
 	if outputs == nil || len(outputs) == 0 {
-		return nil, errors.New("[Wallet], Invalid transaction target")
+		return nil, sdk.NewReason("no_outputs", sdk.CategoryInput, sdk.ActionFixInput,
+			"[Wallet], Invalid transaction target")
+	}
+	if len(outputs) > MaxTransferOutputs {
+		return nil, sdk.NewReason("too_many_outputs", sdk.CategoryInput, sdk.ActionFixInput,
+			"[Wallet], Too many transaction outputs, split them into batches", "max", strconv.Itoa(MaxTransferOutputs))
 	}
 
 	// Check if from address is valid
 	spender, err := Uint168FromAddress(fromAddress)
 	if err != nil {
-		return nil, errors.New("[Wallet], Invalid spender address")
+		return nil, sdk.NewReason("invalid_address", sdk.CategoryInput, sdk.ActionFixInput,
+			"[Wallet], Invalid spender address", "address", fromAddress)
 	}
 	// Create transaction outputs
-	var totalOutputValue = Fixed64(0) // The total value will be spend
-	var txOutputs []*Output           // The outputs in transaction
-	totalOutputValue += *fee          // Add transaction fee
+	var txOutputs []*Output     // The outputs in transaction
+	total := sdk.AmountOf(*fee) // The total value will be spend, starting with transaction fee
+	if total < 0 {
+		return nil, sdk.NewReason("invalid_fee", sdk.CategoryInput, sdk.ActionFixInput,
+			"[Wallet], Invalid transaction fee", "fee", fee.String())
+	}
 
 	for _, output := range outputs {
 		receiver, err := Uint168FromAddress(output.Address)
 		if err != nil {
-			return nil, errors.New("[Wallet], Invalid receiver address")
+			return nil, sdk.NewReason("invalid_address", sdk.CategoryInput, sdk.ActionFixInput,
+				"[Wallet], Invalid receiver address", "address", output.Address)
 		}
 		txOutput := &Output{
 			AssetID:     SystemAssetId,
@@ -178,40 +352,61 @@ func (wallet *WalletImpl) createTransaction(fromAddress string, fee *Fixed64, lo
 			Value:       *output.Value,
 			OutputLock:  lockedUntil,
 		}
-		totalOutputValue += *output.Value
+		if output.LockedUntil != 0 {
+			txOutput.OutputLock = output.LockedUntil
+		}
+		if *output.Value <= 0 {
+			return nil, sdk.NewReason("invalid_amount", sdk.CategoryInput, sdk.ActionFixInput,
+				"[Wallet], Invalid transfer amount", "amount", output.Value.String())
+		}
+		total, err = total.Add(sdk.AmountOf(*output.Value))
+		if err != nil {
+			return nil, sdk.NewReason("invalid_amount", sdk.CategoryInput, sdk.ActionFixInput,
+				"[Wallet], Total transfer amount overflows", "amount", output.Value.String())
+		}
 		txOutputs = append(txOutputs, txOutput)
 	}
+	totalOutputValue := total.Fixed64()
 	// Get spender's UTXOs
 	utxos, err := wallet.GetAddressUTXOs(spender)
 	if err != nil {
 		return nil, errors.New("[Wallet], Get spender's UTXOs failed")
 	}
 	availableUTXOs := wallet.removeLockedUTXOs(utxos) // Remove locked UTXOs
-	availableUTXOs = SortUTXOs(availableUTXOs)        // Sort available UTXOs by value ASC
+	selected, err := wallet.getCoinSelector().Select(spendablesOf(availableUTXOs), totalOutputValue)
+	if err == sdk.ErrInsufficientFunds {
+		return nil, lockedFundsReason(utxos, availableUTXOs, totalOutputValue, wallet.ChainHeight())
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	// Create transaction inputs
 	var txInputs []*Input // The inputs in transaction
-	for _, utxo := range availableUTXOs {
-		txInputs = append(txInputs, InputFromUTXO(utxo))
-		if utxo.Value < totalOutputValue {
-			totalOutputValue -= utxo.Value
-		} else if utxo.Value == totalOutputValue {
-			totalOutputValue = 0
-			break
-		} else if utxo.Value > totalOutputValue {
-			change := &Output{
-				AssetID:     SystemAssetId,
-				Value:       utxo.Value - totalOutputValue,
-				OutputLock:  uint32(0),
-				ProgramHash: *spender,
-			}
-			txOutputs = append(txOutputs, change)
-			totalOutputValue = 0
-			break
+	var selectedAmount sdk.Amount
+	for _, spendable := range selected {
+		txInputs = append(txInputs, inputFromSpendable(spendable))
+		selectedAmount, err = selectedAmount.Add(sdk.AmountOf(spendable.Value))
+		if err != nil {
+			return nil, err
 		}
 	}
-	if totalOutputValue > 0 {
-		return nil, errors.New("[Wallet], Available token is not enough")
+	selectedValue := selectedAmount.Fixed64()
+	if selectedValue < totalOutputValue {
+		return nil, ErrNotEnoughFunds
+	}
+	if selectedValue > totalOutputValue {
+		changeAddress, err := wallet.getChangeAddress(spender)
+		if err != nil {
+			return nil, err
+		}
+		change := &Output{
+			AssetID:     SystemAssetId,
+			Value:       selectedValue - totalOutputValue,
+			OutputLock:  uint32(0),
+			ProgramHash: *changeAddress,
+		}
+		txOutputs = append(txOutputs, change)
 	}
 
 	addr, err := wallet.GetAddress(spender)
@@ -228,6 +423,18 @@ func (wallet *WalletImpl) Sign(password []byte, txn *Transaction) (*Transaction,
 	if err != nil {
 		return nil, err
 	}
+
+	return wallet.SignWith(wallet.Keystore, txn)
+}
+
+// Sign the transaction with the given signer, like a RemoteSigner
+func (wallet *WalletImpl) SignWith(signer Signer, txn *Transaction) (*Transaction, error) {
+	// Check spend limits before signing, the spend is recorded after signing
+	policy, amount, err := wallet.checkSpendPolicy(signer, txn)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get sign type
 	signType, err := crypto.GetScriptType(txn.Programs[0].Code)
 	if err != nil {
@@ -237,7 +444,7 @@ func (wallet *WalletImpl) Sign(password []byte, txn *Transaction) (*Transaction,
 	if signType == crypto.STANDARD {
 
 		// Sign single transaction
-		txn, err = wallet.signStandardTransaction(txn)
+		txn, err = wallet.signStandardTransaction(signer, txn)
 		if err != nil {
 			return nil, err
 		}
@@ -245,28 +452,77 @@ func (wallet *WalletImpl) Sign(password []byte, txn *Transaction) (*Transaction,
 	} else if signType == crypto.MULTISIG {
 
 		// Sign multi sign transaction
-		txn, err = wallet.signMultiSigTransaction(txn)
+		txn, err = wallet.signMultiSigTransaction(signer, txn)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if policy != nil {
+		if err := wallet.recordSpend(policy, txn.Hash(), amount); err != nil {
+			return nil, err
+		}
+	}
 	return txn, nil
 }
 
-func (wallet *WalletImpl) signStandardTransaction(txn *Transaction) (*Transaction, error) {
+// Get the derivation paths of the signers of the transaction that belong to this wallet,
+// so external signers can derive the correct keys to sign it. Signers not derived
+// by BIP32, like main and sub accounts, have no path and are left out.
+func (wallet *WalletImpl) GetSignerPaths(txn *Transaction) (map[Uint168]string, error) {
+	if len(txn.Programs) == 0 {
+		return nil, errors.New("[Wallet], Transaction has no program")
+	}
+	code := txn.Programs[0].Code
+	signType, err := crypto.GetScriptType(code)
+	if err != nil {
+		return nil, err
+	}
+	var programHashes []*Uint168
+	if signType == crypto.STANDARD {
+		programHash, err := crypto.GetSigner(code)
+		if err != nil {
+			return nil, err
+		}
+		programHashes = append(programHashes, programHash)
+	} else if signType == crypto.MULTISIG {
+		programHashes, err = crypto.GetSigners(code)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make(map[Uint168]string)
+	for _, programHash := range programHashes {
+		addr, err := wallet.GetAddress(programHash)
+		if err != nil || addr.DerivationPath() == "" {
+			continue
+		}
+		paths[*programHash] = addr.DerivationPath()
+	}
+
+	return paths, nil
+}
+
+func (wallet *WalletImpl) signStandardTransaction(signer Signer, txn *Transaction) (*Transaction, error) {
 	code := txn.Programs[0].Code
 	// Get signer
 	programHash, err := crypto.GetSigner(code)
+	if err != nil {
+		return nil, err
+	}
 	// Check if current user is a valid signer
-	account := wallet.Keystore.GetAccountByProgramHash(programHash)
-	if account == nil {
+	contains, err := signer.Contains(programHash)
+	if err != nil {
+		return nil, err
+	}
+	if !contains {
 		return nil, errors.New("[Wallet], Invalid signer")
 	}
 	// Sign transaction
 	buf := new(bytes.Buffer)
 	txn.SerializeUnsigned(buf)
-	signedTx, err := account.Sign(buf.Bytes())
+	signedTx, err := signer.SignData(programHash, buf.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +537,7 @@ func (wallet *WalletImpl) signStandardTransaction(txn *Transaction) (*Transactio
 	return txn, nil
 }
 
-func (wallet *WalletImpl) signMultiSigTransaction(txn *Transaction) (*Transaction, error) {
+func (wallet *WalletImpl) signMultiSigTransaction(signer Signer, txn *Transaction) (*Transaction, error) {
 	code := txn.Programs[0].Code
 	param := txn.Programs[0].Parameter
 	// Check if current user is a valid signer
@@ -290,11 +546,15 @@ func (wallet *WalletImpl) signMultiSigTransaction(txn *Transaction) (*Transactio
 	if err != nil {
 		return nil, err
 	}
-	var account *sdk.Account
+	var signerHash *Uint168
 	for i, programHash := range programHashes {
-		account = wallet.Keystore.GetAccountByProgramHash(programHash)
-		if account != nil {
+		contains, err := signer.Contains(programHash)
+		if err != nil {
+			return nil, err
+		}
+		if contains {
 			signerIndex = i
+			signerHash = programHash
 			break
 		}
 	}
@@ -304,7 +564,7 @@ func (wallet *WalletImpl) signMultiSigTransaction(txn *Transaction) (*Transactio
 	// Sign transaction
 	buf := new(bytes.Buffer)
 	txn.SerializeUnsigned(buf)
-	signedTx, err := account.Sign(buf.Bytes())
+	signedTx, err := signer.SignData(signerHash, buf.Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -322,34 +582,18 @@ func (wallet *WalletImpl) SendTransaction(txn *Transaction) error {
 	// Send transaction through P2P network
 	rpc.GetClient().SendTransaction(txn)
 
-	return nil
-}
-
-func getSystemAssetId() Uint256 {
-	systemToken := &Transaction{
-		TxType:         RegisterAsset,
-		PayloadVersion: 0,
-		Payload: &PayloadRegisterAsset{
-			Asset: Asset{
-				Name:      "ELA",
-				Precision: 0x08,
-				AssetType: 0x00,
-			},
-			Amount:     0 * 100000000,
-			Controller: Uint168{},
-		},
-		Attributes: []*Attribute{},
-		Inputs:     []*Input{},
-		Outputs:    []*Output{},
-		Programs:   []*Program{},
-	}
-	return systemToken.Hash()
+	// Record the height sent at, if created with a confirmation target
+	return wallet.markTargetSent(txn.Hash())
 }
 
 func (wallet *WalletImpl) removeLockedUTXOs(utxos []*UTXO) []*UTXO {
 	var availableUTXOs []*UTXO
 	var currentHeight = wallet.ChainHeight()
 	for _, utxo := range utxos {
+		// Only ELA outputs are spent to pay the transfer
+		if !utxo.IsSystemAsset() {
+			continue
+		}
 		if utxo.LockTime > 0 {
 			if utxo.LockTime > currentHeight {
 				continue
@@ -361,6 +605,64 @@ func (wallet *WalletImpl) removeLockedUTXOs(utxos []*UTXO) []*UTXO {
 	return availableUTXOs
 }
 
+// Tell if the funds are enough once the locked UTXOs unlock, the reason carries
+// the height the funds are enough at, otherwise ErrNotEnoughFunds is returned
+func lockedFundsReason(utxos, available []*UTXO, target Fixed64, currentHeight uint32) error {
+	var value sdk.Amount
+	for _, utxo := range available {
+		var err error
+		if value, err = value.Add(sdk.AmountOf(utxo.Value)); err != nil {
+			return err
+		}
+	}
+	var locked []*UTXO
+	for _, utxo := range utxos {
+		if utxo.IsSystemAsset() && utxo.LockTime > currentHeight {
+			locked = append(locked, utxo)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i].LockTime < locked[j].LockTime })
+	for _, utxo := range locked {
+		var err error
+		if value, err = value.Add(sdk.AmountOf(utxo.Value)); err != nil {
+			return err
+		}
+		if value >= sdk.AmountOf(target) {
+			height := strconv.FormatUint(uint64(utxo.LockTime), 10)
+			return sdk.NewReason("funds_locked", sdk.CategoryLock, sdk.ActionWait,
+				"[Wallet], Available token is locked until height "+height, "height", height)
+		}
+	}
+	return ErrNotEnoughFunds
+}
+
+// Get the spendable ELA outputs of the address, so a sdk.TxBuilder can spend
+// from the wallet
+func (wallet *WalletImpl) GetSpendables(programHash Uint168) ([]*sdk.Spendable, error) {
+	utxos, err := wallet.GetAddressUTXOs(&programHash)
+	if err != nil {
+		return nil, err
+	}
+	var spendables []*sdk.Spendable
+	currentHeight := wallet.ChainHeight()
+	for _, utxo := range utxos {
+		if !utxo.IsSystemAsset() || utxo.LockTime > currentHeight {
+			continue
+		}
+		spendables = append(spendables, &sdk.Spendable{Op: utxo.Op, Value: utxo.Value, LockTime: utxo.LockTime})
+	}
+	return spendables, nil
+}
+
+// The UTXOs as the outputs a sdk.CoinSelector chooses from
+func spendablesOf(utxos []*UTXO) []*sdk.Spendable {
+	spendables := make([]*sdk.Spendable, 0, len(utxos))
+	for _, utxo := range utxos {
+		spendables = append(spendables, &sdk.Spendable{Op: utxo.Op, Value: utxo.Value, LockTime: utxo.LockTime})
+	}
+	return spendables
+}
+
 func InputFromUTXO(utxo *UTXO) *Input {
 	input := new(Input)
 	input.Previous.TxID = utxo.Op.TxID
@@ -369,6 +671,10 @@ func InputFromUTXO(utxo *UTXO) *Input {
 	return input
 }
 
+func inputFromSpendable(spendable *sdk.Spendable) *Input {
+	return &Input{Previous: spendable.Op, Sequence: spendable.LockTime}
+}
+
 func (wallet *WalletImpl) newTransaction(redeemScript []byte, inputs []*Input, outputs []*Output) *Transaction {
 	// Create payload
 	txPayload := &PayloadTransferAsset{}